@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/citadel/citadel"
+	"github.com/codegangsta/cli"
+	"github.com/samalba/dockerclient"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/client"
+)
+
+var joinCommand = cli.Command{
+	Name:   "join",
+	Usage:  "join this host to the cluster as an engine",
+	Action: joinAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "url",
+			Value:  "",
+			Usage:  "shipyard controller url",
+			EnvVar: "SHIPYARD_URL",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Value:  "",
+			Usage:  "join token created with shipyard add-join-token",
+			EnvVar: "SHIPYARD_JOIN_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "docker",
+			Value: "unix:///var/run/docker.sock",
+			Usage: "local docker endpoint used to detect cpus and memory",
+		},
+		cli.StringFlag{
+			Name:  "addr",
+			Value: "",
+			Usage: "address the controller uses to reach docker (default: the address of this host towards the controller)",
+		},
+		cli.IntFlag{
+			Name:  "port",
+			Value: 2375,
+			Usage: "docker port when the address is detected",
+		},
+		cli.StringFlag{
+			Name:  "id",
+			Value: "",
+			Usage: "engine id (default: hostname)",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Value: &cli.StringSlice{},
+			Usage: "engine labels in addition to the labels of the token",
+		},
+		cli.Float64Flag{
+			Name:  "cpus",
+			Value: 0,
+			Usage: "engine cpus (default: detected)",
+		},
+		cli.Float64Flag{
+			Name:  "memory",
+			Value: 0,
+			Usage: "engine memory in MB (default: detected)",
+		},
+		cli.StringFlag{
+			Name:  "ssl-cert",
+			Value: "",
+			Usage: "path to the client certificate for docker",
+		},
+		cli.StringFlag{
+			Name:  "ssl-key",
+			Value: "",
+			Usage: "path to the client certificate key for docker",
+		},
+		cli.StringFlag{
+			Name:  "ca-cert",
+			Value: "",
+			Usage: "path to the ca certificate to verify the local docker; the controller uses the ca certificate of the join token",
+		},
+		cli.StringFlag{
+			Name:  "tls-ca-cert",
+			Value: "",
+			Usage: "ca certificate to verify the controller",
+		},
+		cli.BoolFlag{
+			Name:  "allow-insecure",
+			Usage: "allow insecure controller certificates",
+		},
+	},
+}
+
+func joinAction(c *cli.Context) {
+	controllerURL := c.String("url")
+	token := c.String("token")
+	if controllerURL == "" || token == "" {
+		logger.Fatal("you must specify the controller url and a join token")
+	}
+
+	engine := &shipyard.Engine{
+		Engine: &citadel.Engine{
+			ID:     c.String("id"),
+			Addr:   c.String("addr"),
+			Cpus:   c.Float64("cpus"),
+			Memory: c.Float64("memory"),
+			Labels: c.StringSlice("label"),
+		},
+	}
+	if err := readCertificates(c, engine); err != nil {
+		logger.Fatal(err)
+	}
+	if engine.Engine.ID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Fatalf("unable to detect the hostname: %s", err)
+		}
+		engine.Engine.ID = hostname
+	}
+	if engine.Engine.Addr == "" {
+		addr, err := detectAddr(controllerURL, c.Int("port"), engine.SSLCertificate != "")
+		if err != nil {
+			logger.Fatalf("unable to detect the docker address; use --addr: %s", err)
+		}
+		engine.Engine.Addr = addr
+	}
+
+	if engine.Engine.Cpus == 0 || engine.Engine.Memory == 0 {
+		info, err := dockerInfo(c.String("docker"), engine, c.String("ca-cert"))
+		if err != nil {
+			logger.Fatalf("unable to detect cpus and memory from docker: %s", err)
+		}
+		if engine.Engine.Cpus == 0 {
+			engine.Engine.Cpus = float64(info.NCPU)
+		}
+		if engine.Engine.Memory == 0 {
+			engine.Engine.Memory = float64(info.MemTotal / 1024 / 1024)
+		}
+		engine.Engine.Labels = shipyard.MergeLabels(engine.Engine.Labels, info.Labels)
+	}
+
+	m := client.NewManager(&client.ShipyardConfig{
+		Url:           controllerURL,
+		AllowInsecure: c.Bool("allow-insecure"),
+		TLSCACert:     c.String("tls-ca-cert"),
+	})
+	joined, err := m.Join(&shipyard.JoinRequest{
+		Token:  token,
+		Engine: engine,
+	})
+	if err != nil {
+		logger.Fatalf("error joining the cluster: %s", err)
+	}
+	fmt.Printf("joined as %s addr=%s cpus=%.2f memory=%.2f labels=%s\n", joined.Engine.ID, joined.Engine.Addr, joined.Engine.Cpus, joined.Engine.Memory, strings.Join(joined.Engine.Labels, ","))
+}
+
+// readCertificates loads the docker certificates sent to the controller
+func readCertificates(c *cli.Context, engine *shipyard.Engine) error {
+	files := []struct {
+		flag string
+		dest *string
+	}{
+		{"ssl-cert", &engine.SSLCertificate},
+		{"ssl-key", &engine.SSLKey},
+	}
+	for _, f := range files {
+		path := c.String(f.flag)
+		if path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", f.flag, err)
+		}
+		*f.dest = string(data)
+	}
+	if (engine.SSLCertificate == "") != (engine.SSLKey == "") {
+		return fmt.Errorf("--ssl-cert and --ssl-key must be used together")
+	}
+	return nil
+}
+
+// detectAddr returns the docker address of this host on the interface
+// that routes to the controller.  No packets are sent.
+func detectAddr(controllerURL string, port int, secure bool) (string, error) {
+	u, err := url.Parse(controllerURL)
+	if err != nil {
+		return "", err
+	}
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "80")
+	}
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ip.String(), fmt.Sprint(port))), nil
+}
+
+// dockerInfo queries the local docker with the engine certificates when
+// it is served over tcp
+func dockerInfo(endpoint string, engine *shipyard.Engine, caCertPath string) (*dockerclient.Info, error) {
+	var tlsConfig *tls.Config
+	if !strings.HasPrefix(endpoint, "unix://") && engine.SSLCertificate != "" {
+		// the ca certificate is only used here; it is not sent
+		local := *engine
+		if caCertPath != "" {
+			caCert, err := ioutil.ReadFile(caCertPath)
+			if err != nil {
+				return nil, err
+			}
+			local.CACertificate = string(caCert)
+		}
+		cfg, err := local.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = cfg
+	}
+	docker, err := dockerclient.NewDockerClient(endpoint, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return docker.Info()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard"
+)
+
+var (
+	logger = logrus.New()
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "shipyard-agent"
+	app.Usage = "register a docker host with a shipyard cluster"
+	app.Version = shipyard.VERSION
+	app.Commands = []cli.Command{
+		joinCommand,
+	}
+
+	app.Run(os.Args)
+}
@@ -0,0 +1,92 @@
+package shipyard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type (
+	// AuditRecord is an entry in the append-only audit log.  Records are
+	// chained by including the hash of the previous record so that any
+	// modification or removal can be detected.
+	AuditRecord struct {
+		ID        string    `json:"id,omitempty" gorethink:"id,omitempty"`
+		Sequence  int64     `json:"sequence" gorethink:"sequence"`
+		Time      time.Time `json:"time" gorethink:"time"`
+		Actor     string    `json:"actor,omitempty" gorethink:"actor"`
+		ActorType string    `json:"actor_type,omitempty" gorethink:"actor_type"`
+		SourceIP  string    `json:"source_ip,omitempty" gorethink:"source_ip"`
+		Method    string    `json:"method,omitempty" gorethink:"method"`
+		Route     string    `json:"route,omitempty" gorethink:"route"`
+		Target    string    `json:"target,omitempty" gorethink:"target"`
+		Summary   string    `json:"summary,omitempty" gorethink:"summary"`
+		Status    int       `json:"status" gorethink:"status"`
+		PrevHash  string    `json:"prev_hash" gorethink:"prev_hash"`
+		Hash      string    `json:"hash" gorethink:"hash"`
+	}
+
+	// AuditVerification is the result of verifying the audit log chain
+	AuditVerification struct {
+		Records int    `json:"records"`
+		Valid   bool   `json:"valid"`
+		Error   string `json:"error,omitempty"`
+	}
+)
+
+// ComputeHash returns the hash of the record contents chained to the
+// previous hash.  The time is normalized to UTC milliseconds which is the
+// precision kept by the store.
+func (a *AuditRecord) ComputeHash() string {
+	data, _ := json.Marshal([]interface{}{
+		a.Sequence,
+		a.Time.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+		a.Actor,
+		a.ActorType,
+		a.SourceIP,
+		a.Method,
+		a.Route,
+		a.Target,
+		a.Summary,
+		a.Status,
+		a.PrevHash,
+	})
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// Chain links the record to the previous record and sets its hash
+func (a *AuditRecord) Chain(prev *AuditRecord) {
+	a.Sequence = 1
+	a.PrevHash = ""
+	if prev != nil {
+		a.Sequence = prev.Sequence + 1
+		a.PrevHash = prev.Hash
+	}
+	a.Time = a.Time.UTC().Truncate(time.Millisecond)
+	a.ID = fmt.Sprintf("%020d", a.Sequence)
+	a.Hash = a.ComputeHash()
+}
+
+// VerifyAuditChain checks records ordered by ascending sequence.  The
+// first record may start anywhere in the chain.
+func VerifyAuditChain(records []*AuditRecord) error {
+	var prev *AuditRecord
+	for _, rec := range records {
+		if rec.Hash != rec.ComputeHash() {
+			return fmt.Errorf("audit record %d has been modified", rec.Sequence)
+		}
+		if prev != nil {
+			if rec.Sequence != prev.Sequence+1 {
+				return fmt.Errorf("audit record %d is missing", prev.Sequence+1)
+			}
+			if rec.PrevHash != prev.Hash {
+				return fmt.Errorf("audit record %d does not chain to %d", rec.Sequence, prev.Sequence)
+			}
+		}
+		prev = rec
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package shipyard
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestAuditChain(n int) []*AuditRecord {
+	records := []*AuditRecord{}
+	var prev *AuditRecord
+	for i := 0; i < n; i++ {
+		rec := &AuditRecord{
+			Time:   time.Now(),
+			Actor:  "admin",
+			Method: "DELETE",
+			Route:  "/api/containers/{id}",
+			Target: "abcdef",
+			Status: 204,
+		}
+		rec.Chain(prev)
+		records = append(records, rec)
+		prev = rec
+	}
+	return records
+}
+
+func TestAuditChain(t *testing.T) {
+	records := newTestAuditChain(5)
+	if err := VerifyAuditChain(records); err != nil {
+		t.Fatal(err)
+	}
+	if records[0].PrevHash != "" || records[1].PrevHash != records[0].Hash {
+		t.Error("expected records to be chained")
+	}
+	if records[4].ID != "00000000000000000005" {
+		t.Errorf("expected id to be the padded sequence; received %s", records[4].ID)
+	}
+}
+
+func TestAuditChainTampered(t *testing.T) {
+	records := newTestAuditChain(5)
+	records[2].Actor = "someone-else"
+	if err := VerifyAuditChain(records); err == nil {
+		t.Error("expected modified record to be detected")
+	}
+
+	records = newTestAuditChain(5)
+	records = append(records[:2], records[3:]...)
+	if err := VerifyAuditChain(records); err == nil {
+		t.Error("expected removed record to be detected")
+	}
+}
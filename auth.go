@@ -2,6 +2,8 @@ package shipyard
 
 import (
 	"errors"
+	"net"
+	"strings"
 	"time"
 
 	"code.google.com/p/go.crypto/bcrypt"
@@ -18,21 +20,73 @@ type (
 		Password string       `json:"password,omitempty" gorethink:"password"`
 		Tokens   []*AuthToken `json:"-" gorethink:"tokens"`
 		Role     *Role        `json:"role,omitempty" gorethink:"role"`
+		// PasswordChangeRequired restricts the account to changing its
+		// password until it has been changed
+		PasswordChangeRequired bool `json:"password_change_required,omitempty" gorethink:"password_change_required"`
+		// SSO accounts are created by single sign-on
+		SSO bool `json:"sso,omitempty" gorethink:"sso"`
+		// SSOIdentity is the issuer and subject of the user at the
+		// identity provider
+		SSOIdentity string `json:"sso_identity,omitempty" gorethink:"sso_identity"`
+		TOTPEnabled bool   `json:"totp_enabled,omitempty" gorethink:"totp_enabled"`
+		// TOTPSecret is sealed with the secrets master key when one is
+		// configured
+		TOTPSecret    string   `json:"-" gorethink:"totp_secret"`
+		TOTPLastStep  int64    `json:"-" gorethink:"totp_last_step"`
+		RecoveryCodes []string `json:"-" gorethink:"recovery_codes"`
 	}
 	Role struct {
 		ID   string `json:"id,omitempty" gorethink:"id,omitempty"`
 		Name string `json:"name,omitempty" gorethink:"name"`
+		// RequireTOTP forces accounts with the role to enroll in two-factor
+		// authentication before they can use the api
+		RequireTOTP bool `json:"require_totp,omitempty" gorethink:"require_totp"`
 	}
 	AuthToken struct {
 		Token     string `json:"auth_token,omitempty" gorethink:"auth_token"`
 		UserAgent string `json:"user_agent,omitempty" gorethink:"user_agent"`
+		// PasswordChangeRequired is only set in login responses
+		PasswordChangeRequired bool `json:"password_change_required,omitempty" gorethink:"-"`
+		// TOTPRequired is set instead of a token when the login needs a
+		// two-factor code
+		TOTPRequired bool `json:"totp_required,omitempty" gorethink:"-"`
+		// TOTPEnrollmentRequired is set when the account role requires
+		// two-factor authentication and the account has not enrolled
+		TOTPEnrollmentRequired bool `json:"totp_enrollment_required,omitempty" gorethink:"-"`
+		// MultiFactor is set on tokens from single sign-on logins where
+		// the identity provider asserted a second factor
+		MultiFactor bool `json:"-" gorethink:"multi_factor,omitempty"`
 	}
 	Authenticator struct {
 		salt []byte
 	}
+	// SSORequest is a pending single sign-on started by a client that runs
+	// the authorization flow itself; the nonce must be sent to the
+	// identity provider and the state returned with the id token
+	SSORequest struct {
+		State string `json:"state,omitempty"`
+		Nonce string `json:"nonce,omitempty"`
+	}
+	// SSOLogin is returned after a successful single sign-on
+	SSOLogin struct {
+		Username  string `json:"username,omitempty"`
+		AuthToken string `json:"auth_token,omitempty"`
+		// TOTPEnrollmentRequired is set when the account role requires
+		// two-factor authentication the identity provider did not assert
+		TOTPEnrollmentRequired bool `json:"totp_enrollment_required,omitempty"`
+	}
 	ServiceKey struct {
-		Key         string `json:"key,omitempty" gorethink:"key"`
-		Description string `json:"description,omitempty" gorethink:"description"`
+		Key          string     `json:"key,omitempty" gorethink:"key"`
+		Description  string     `json:"description,omitempty" gorethink:"description"`
+		Scopes       []string   `json:"scopes,omitempty" gorethink:"scopes,omitempty"`
+		Expires      *time.Time `json:"expires,omitempty" gorethink:"expires,omitempty"`
+		AllowedCIDRs []string   `json:"allowed_cidrs,omitempty" gorethink:"allowed_cidrs,omitempty"`
+		LastUsed     *time.Time `json:"last_used,omitempty" gorethink:"last_used,omitempty"`
+		LastUsedAddr string     `json:"last_used_addr,omitempty" gorethink:"last_used_addr,omitempty"`
+		CommonName   string     `json:"common_name,omitempty" gorethink:"common_name,omitempty"`
+		// Images limits the images the key can create containers from;
+		// entries without a tag allow every tag of the repository
+		Images []string `json:"images,omitempty" gorethink:"images,omitempty"`
 	}
 )
 
@@ -57,3 +111,98 @@ func (a *Authenticator) Authenticate(password, hash string) bool {
 func (a *Authenticator) GenerateToken() (string, error) {
 	return a.Hash(time.Now().String())
 }
+
+// Redacted returns a copy of the account without the password hash for
+// api responses
+func (a *Account) Redacted() *Account {
+	c := *a
+	c.Password = ""
+	return &c
+}
+
+// TOTPEnrollmentRequired returns true if the account role requires
+// two-factor authentication the account has not enrolled in.  Single
+// sign-on tokens with a second factor are exempt; see AuthToken.
+func (a *Account) TOTPEnrollmentRequired() bool {
+	return a.Role != nil && a.Role.RequireTOTP && !a.TOTPEnabled
+}
+
+// AuthToken returns the token of the account or nil if it does not exist
+func (a *Account) AuthToken(token string) *AuthToken {
+	for _, t := range a.Tokens {
+		if t.Token == token {
+			return t
+		}
+	}
+	return nil
+}
+
+// Expired returns true if the key has an expiry in the past
+func (k *ServiceKey) Expired() bool {
+	return k.Expires != nil && time.Now().After(*k.Expires)
+}
+
+// AllowedFrom returns true if the key can be used from the address.  Keys
+// without allowed networks can be used from anywhere.
+func (k *ServiceKey) AllowedFrom(addr string) bool {
+	if len(k.AllowedCIDRs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, c := range k.AllowedCIDRs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks the request against the key scopes.  Keys created before
+// scopes were introduced have none and keep full access.
+func (k *ServiceKey) Allows(method string, path string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	return CheckPermissions(k.Scopes, method, path)
+}
+
+// AllowsImage checks the image against the key images.  Keys without
+// images can create containers from any image.
+func (k *ServiceKey) AllowsImage(image string) bool {
+	if len(k.Images) == 0 {
+		return true
+	}
+	repo, tag := splitImageName(image)
+	if tag == "" {
+		tag = "latest"
+	}
+	for _, i := range k.Images {
+		r, t := splitImageName(i)
+		if r == repo && (t == "" || t == tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitImageName returns the repository and tag of an image name; the
+// tag is empty when the name has none
+func splitImageName(name string) (string, string) {
+	i := strings.LastIndex(name, ":")
+	// a colon before the last slash separates a registry port
+	if i < 0 || strings.Contains(name[i+1:], "/") {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
+}
@@ -43,3 +43,31 @@ func TestAuthenticateFailIfNoPass(t *testing.T) {
 		t.Error("empty password should not match")
 	}
 }
+
+func TestAccountRedacted(t *testing.T) {
+	a := &Account{Username: "admin", Password: "$2a$10$hash"}
+	if r := a.Redacted(); r.Password != "" || r.Username != "admin" {
+		t.Errorf("expected the password to be removed; received %+v", r)
+	}
+	if a.Password == "" {
+		t.Error("expected the account to be unchanged")
+	}
+}
+
+func TestSSOAccountRequiresTOTPEnrollment(t *testing.T) {
+	acct := &Account{
+		Username: "sso",
+		SSO:      true,
+		Role:     &Role{Name: "admin", RequireTOTP: true},
+		Tokens:   []*AuthToken{{Token: "abc", MultiFactor: true}},
+	}
+	if !acct.TOTPEnrollmentRequired() {
+		t.Error("expected sso accounts to need enrollment without a second factor token")
+	}
+	if tk := acct.AuthToken("abc"); tk == nil || !tk.MultiFactor {
+		t.Errorf("expected the multi-factor token; got %v", tk)
+	}
+	if acct.AuthToken("def") != nil {
+		t.Error("expected no token for an unknown value")
+	}
+}
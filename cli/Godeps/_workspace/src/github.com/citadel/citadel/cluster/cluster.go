@@ -0,0 +1,643 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/citadel/citadel"
+)
+
+var (
+	ErrEngineNotConnected = errors.New("engine is not connected to docker's REST API")
+)
+
+const (
+	// reservationWindow is how long the resources of a started container
+	// are still counted for engine snapshots taken before it started
+	reservationWindow = time.Minute
+)
+
+// Cluster schedules containers across engines.  The engine and scheduler
+// maps are guarded by mux, operations on an engine only hold that engine's
+// lock and placement decisions are serialized by scheduling.
+//
+// Containers are read from a cached state of every engine that is seeded
+// by Sync and kept current from the engines' events once Events is called.
+type Cluster struct {
+	mux sync.RWMutex
+
+	engines         map[string]*citadel.Engine
+	engineLocks     map[string]*sync.Mutex
+	states          map[string]*engineState
+	schedulers      map[string]citadel.Scheduler
+	resourceManager citadel.ResourceManager
+	handler         citadel.EventHandler
+
+	scheduling   sync.Mutex
+	reservations map[string][]*reservation
+}
+
+// reservation holds the resources of a container that is being started
+// on an engine and may not be returned by the engine's containers yet
+type reservation struct {
+	cpus     float64
+	memory   float64
+	finished time.Time
+}
+
+// counts reports whether the reservation must be added to a snapshot of
+// the engine's containers that was listed at the given time
+func (r *reservation) counts(listed time.Time) bool {
+	return r.finished.IsZero() || r.finished.After(listed)
+}
+
+func New(manager citadel.ResourceManager, engines ...*citadel.Engine) (*Cluster, error) {
+	c := &Cluster{
+		engines:         make(map[string]*citadel.Engine),
+		engineLocks:     make(map[string]*sync.Mutex),
+		states:          make(map[string]*engineState),
+		schedulers:      make(map[string]citadel.Scheduler),
+		resourceManager: manager,
+		reservations:    make(map[string][]*reservation),
+	}
+
+	for _, e := range engines {
+		if !e.IsConnected() {
+			return nil, ErrEngineNotConnected
+		}
+
+		c.engines[e.ID] = e
+		c.engineLocks[e.ID] = &sync.Mutex{}
+		c.states[e.ID] = newEngineState()
+	}
+
+	return c, nil
+}
+
+// Events subscribes to the events of every engine to keep the cached
+// state current and passes the events to the handler
+func (c *Cluster) Events(handler citadel.EventHandler) error {
+	c.mux.Lock()
+	c.handler = handler
+	c.mux.Unlock()
+
+	for _, e := range c.Engines() {
+		if err := e.Events(&stateHandler{cluster: c, next: handler}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sync replaces the cached state of every engine with a full listing of
+// its containers.  Engines are listed in parallel.
+func (c *Cluster) Sync() error {
+	return c.syncEngines(c.Engines())
+}
+
+func (c *Cluster) syncEngines(engines []*citadel.Engine) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(engines))
+	)
+
+	for i, e := range engines {
+		wg.Add(1)
+		go func(i int, e *citadel.Engine) {
+			defer wg.Done()
+			errs[i] = c.syncEngine(e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) syncEngine(e *citadel.Engine) error {
+	s := c.state(e.ID)
+	if s == nil {
+		return nil
+	}
+
+	since := s.begin()
+
+	containers, err := e.ListContainers(true, false, "")
+	if err != nil {
+		s.fail(err)
+		return fmt.Errorf("unable to sync engine %s: %s", e.ID, err)
+	}
+
+	images, err := e.ListImages()
+	if err != nil {
+		s.fail(err)
+		return fmt.Errorf("unable to sync engine %s: %s", e.ID, err)
+	}
+
+	s.replace(containers, len(images), since)
+
+	return nil
+}
+
+// synced returns the engines of the cluster after syncing the ones that
+// have not been synced yet
+func (c *Cluster) synced() []*citadel.Engine {
+	var (
+		engines  = c.Engines()
+		unsynced = []*citadel.Engine{}
+	)
+
+	for _, e := range engines {
+		if s := c.state(e.ID); s != nil && !s.isSynced() {
+			unsynced = append(unsynced, e)
+		}
+	}
+
+	// unavailable engines are skipped by reads
+	c.syncEngines(unsynced)
+
+	return engines
+}
+
+func (c *Cluster) state(id string) *engineState {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.states[id]
+}
+
+// refresh updates the cached state of a container after an action on it
+func (c *Cluster) refresh(e *citadel.Engine, container *citadel.Container) error {
+	s := c.state(e.ID)
+	if s == nil {
+		return nil
+	}
+
+	image := ""
+	if container.Image != nil {
+		image = container.Image.Name
+	}
+
+	cnt, err := citadel.FromDockerContainer(container.ID, image, e)
+	if err != nil {
+		// the engine's events or the next sync correct the state
+		return err
+	}
+
+	s.update(cnt)
+
+	return nil
+}
+
+func (c *Cluster) RegisterScheduler(tpe string, s citadel.Scheduler) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.schedulers[tpe] = s
+
+	return nil
+}
+
+func (c *Cluster) AddEngine(e *citadel.Engine) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	// a replaced engine stops watching events
+	if old := c.engines[e.ID]; old != nil && old != e {
+		old.StopEvents()
+	}
+
+	c.engines[e.ID] = e
+	if _, ok := c.engineLocks[e.ID]; !ok {
+		c.engineLocks[e.ID] = &sync.Mutex{}
+	}
+	c.states[e.ID] = newEngineState()
+
+	if c.handler != nil {
+		return e.Events(&stateHandler{cluster: c, next: c.handler})
+	}
+
+	return nil
+}
+
+// RemoveEngine removes the engine and stops watching its events
+func (c *Cluster) RemoveEngine(e *citadel.Engine) error {
+	c.mux.Lock()
+	if old := c.engines[e.ID]; old != nil {
+		old.StopEvents()
+	}
+	delete(c.engines, e.ID)
+	delete(c.engineLocks, e.ID)
+	delete(c.states, e.ID)
+	c.mux.Unlock()
+
+	c.scheduling.Lock()
+	delete(c.reservations, e.ID)
+	c.scheduling.Unlock()
+
+	return nil
+}
+
+// engine returns the engine with the id and the lock that serializes
+// operations on it
+func (c *Cluster) engine(id string) (*citadel.Engine, *sync.Mutex, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	engine := c.engines[id]
+	if engine == nil {
+		return nil, nil, fmt.Errorf("engine with id %s is not in cluster", id)
+	}
+
+	return engine, c.engineLocks[id], nil
+}
+
+// ListContainers returns all the containers running in the cluster.  They
+// are read from the cached state unless sizes or a filter are requested.
+func (c *Cluster) ListContainers(all bool, size bool, filter string) []*citadel.Container {
+	out := []*citadel.Container{}
+
+	if size || filter != "" {
+		for _, e := range c.Engines() {
+			containers, _ := e.ListContainers(all, size, filter)
+
+			out = append(out, containers...)
+		}
+
+		return out
+	}
+
+	for _, e := range c.synced() {
+		if s := c.state(e.ID); s != nil {
+			out = append(out, s.list(all)...)
+		}
+	}
+
+	return out
+}
+
+func (c *Cluster) Kill(container *citadel.Container, sig int) error {
+	engine, lock, err := c.engine(container.Engine.ID)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := engine.Kill(container, sig); err != nil {
+		return err
+	}
+
+	c.refresh(engine, container)
+
+	return nil
+}
+
+func (c *Cluster) Logs(container *citadel.Container, stdout bool, stderr bool) (io.ReadCloser, error) {
+	engine, _, err := c.engine(container.Engine.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.Logs(container, stdout, stderr)
+}
+
+func (c *Cluster) Stop(container *citadel.Container) error {
+	engine, lock, err := c.engine(container.Engine.ID)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := engine.Stop(container); err != nil {
+		return err
+	}
+
+	c.refresh(engine, container)
+
+	return nil
+}
+
+// StartExisting starts a container that was created or has stopped
+func (c *Cluster) StartExisting(container *citadel.Container) error {
+	engine, lock, err := c.engine(container.Engine.ID)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := engine.StartExisting(container); err != nil {
+		return err
+	}
+
+	c.refresh(engine, container)
+
+	return nil
+}
+
+func (c *Cluster) Restart(container *citadel.Container, timeout int) error {
+	engine, lock, err := c.engine(container.Engine.ID)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := engine.Restart(container, timeout); err != nil {
+		return err
+	}
+
+	c.refresh(engine, container)
+
+	return nil
+}
+
+func (c *Cluster) Remove(container *citadel.Container) error {
+	engine, lock, err := c.engine(container.Engine.ID)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := engine.Remove(container); err != nil {
+		return err
+	}
+
+	if s := c.state(engine.ID); s != nil {
+		s.remove(container.ID)
+	}
+
+	return nil
+}
+
+// Start places a container for the image on an engine and starts it.
+// Engine snapshots are taken from the cached state without holding a
+// cluster lock; only the
+// placement and the reservation of the container's resources on the
+// chosen engine are serialized.  The image is pulled and the container
+// started while holding just the chosen engine's lock.
+func (c *Cluster) Start(image *citadel.Image, pull bool) (*citadel.Container, error) {
+	return c.launch(image, pull, true)
+}
+
+// Create places a container for the image on an engine and creates it
+// without starting it.  The container's resources are reserved the same
+// as for a started container.
+func (c *Cluster) Create(image *citadel.Image, pull bool) (*citadel.Container, error) {
+	return c.launch(image, pull, false)
+}
+
+func (c *Cluster) launch(image *citadel.Image, pull bool, start bool) (*citadel.Container, error) {
+	c.mux.RLock()
+	scheduler := c.schedulers[image.Type]
+	c.mux.RUnlock()
+
+	if scheduler == nil {
+		return nil, fmt.Errorf("no scheduler for type %s", image.Type)
+	}
+
+	var (
+		accepted = []*citadel.EngineSnapshot{}
+		listed   = time.Now()
+	)
+
+	for _, e := range c.synced() {
+		s := c.state(e.ID)
+		if s == nil {
+			continue
+		}
+
+		if _, ok := s.available(); !ok {
+			continue
+		}
+
+		canrun, err := scheduler.Schedule(image, e)
+		if err != nil {
+			return nil, err
+		}
+
+		if canrun {
+			containers := s.list(false)
+
+			var cpus, memory float64
+			for _, con := range containers {
+				cpus += con.Image.Cpus
+				memory += con.Image.Memory
+			}
+
+			accepted = append(accepted, &citadel.EngineSnapshot{
+				ID:             e.ID,
+				ReservedCpus:   cpus,
+				ReservedMemory: memory,
+				Cpus:           e.Cpus,
+				Memory:         e.Memory,
+			})
+		}
+	}
+
+	if len(accepted) == 0 {
+		return nil, fmt.Errorf("no eligible engines to run image")
+	}
+
+	container := &citadel.Container{
+		Image: image,
+		Name:  image.ContainerName,
+	}
+
+	s, r, err := c.place(container, accepted, listed)
+	if err != nil {
+		return nil, err
+	}
+
+	started := false
+	defer func() {
+		c.release(s.ID, r, started)
+	}()
+
+	engine, lock, err := c.engine(s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if start {
+		err = engine.Start(container, pull)
+	} else {
+		err = engine.Create(container, pull)
+	}
+	if err != nil {
+		return nil, err
+	}
+	started = true
+
+	// the state must hold the container before its reservation finishes
+	if err := c.refresh(engine, container); err != nil {
+		if s := c.state(engine.ID); s != nil {
+			cnt := copyContainer(container)
+			cnt.State = "stopped"
+			if start {
+				cnt.State = "running"
+			}
+			s.update(cnt)
+		}
+	}
+
+	return container, nil
+}
+
+// place chooses the engine for the container from snapshots that were
+// listed at the given time and reserves the container's resources on it
+func (c *Cluster) place(container *citadel.Container, accepted []*citadel.EngineSnapshot, listed time.Time) (*citadel.EngineSnapshot, *reservation, error) {
+	c.scheduling.Lock()
+	defer c.scheduling.Unlock()
+
+	c.pruneReservations(time.Now())
+
+	for _, s := range accepted {
+		for _, r := range c.reservations[s.ID] {
+			if r.counts(listed) {
+				s.ReservedCpus += r.cpus
+				s.ReservedMemory += r.memory
+			}
+		}
+	}
+
+	s, err := c.resourceManager.PlaceContainer(container, accepted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &reservation{
+		cpus:   container.Image.Cpus,
+		memory: container.Image.Memory,
+	}
+	c.reservations[s.ID] = append(c.reservations[s.ID], r)
+
+	return s, r, nil
+}
+
+// release finishes a reservation.  The reservation of a started container
+// is kept for snapshots that were listed before the container existed.
+func (c *Cluster) release(id string, r *reservation, started bool) {
+	c.scheduling.Lock()
+	defer c.scheduling.Unlock()
+
+	if started {
+		r.finished = time.Now()
+		return
+	}
+
+	reservations := c.reservations[id]
+	for i, res := range reservations {
+		if res == r {
+			c.reservations[id] = append(reservations[:i], reservations[i+1:]...)
+			break
+		}
+	}
+}
+
+// pruneReservations removes finished reservations that are older than the
+// reservation window; the caller must hold the scheduling lock
+func (c *Cluster) pruneReservations(now time.Time) {
+	for id, reservations := range c.reservations {
+		kept := reservations[:0]
+		for _, r := range reservations {
+			if r.finished.IsZero() || now.Sub(r.finished) < reservationWindow {
+				kept = append(kept, r)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(c.reservations, id)
+			continue
+		}
+
+		c.reservations[id] = kept
+	}
+}
+
+// Engines returns the engines registered in the cluster
+func (c *Cluster) Engines() []*citadel.Engine {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	out := []*citadel.Engine{}
+
+	for _, e := range c.engines {
+		out = append(out, e)
+	}
+
+	return out
+}
+
+// Info returns information about the cluster from the cached state.  Image
+// counts are updated when the engines are synced.
+func (c *Cluster) ClusterInfo() *citadel.ClusterInfo {
+	containerCount := 0
+	imageCount := 0
+	engines := c.synced()
+	engineCount := len(engines)
+	totalCpu := 0.0
+	totalMemory := 0.0
+	reservedCpus := 0.0
+	reservedMemory := 0.0
+	for _, e := range engines {
+		s := c.state(e.ID)
+		if s == nil {
+			continue
+		}
+		images, ok := s.available()
+		if !ok {
+			// skip engines that are not available
+			continue
+		}
+		c := s.list(false)
+		for _, cnt := range c {
+			reservedCpus += cnt.Image.Cpus
+			reservedMemory += cnt.Image.Memory
+		}
+		containerCount += len(c)
+		imageCount += images
+		totalCpu += e.Cpus
+		totalMemory += e.Memory
+	}
+
+	return &citadel.ClusterInfo{
+		Cpus:           totalCpu,
+		Memory:         totalMemory,
+		ContainerCount: containerCount,
+		ImageCount:     imageCount,
+		EngineCount:    engineCount,
+		ReservedCpus:   reservedCpus,
+		ReservedMemory: reservedMemory,
+	}
+}
+
+// Close signals to the cluster that no other actions will be applied and
+// stops watching the events of the engines
+func (c *Cluster) Close() error {
+	for _, e := range c.Engines() {
+		e.StopEvents()
+	}
+
+	return nil
+}
@@ -0,0 +1,508 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/citadel/citadel/scheduler"
+	"github.com/samalba/dockerclient"
+)
+
+// fakeEngine serves the parts of the docker remote api used to start,
+// list and remove containers and to watch events.  Starting a container
+// takes latency.
+type fakeEngine struct {
+	latency time.Duration
+	// exitOnStart stops containers once they started so that engine
+	// snapshots stay small in benchmarks
+	exitOnStart bool
+	events      chan *dockerclient.Event
+
+	mux        sync.Mutex
+	containers map[string]*dockerclient.ContainerInfo
+	lists      int
+	watching   int
+	starting   int
+	maxStarts  int
+}
+
+// fakeIDs numbers the containers of all fake engines
+var fakeIDs uint64
+
+// add creates a container without going through the cluster
+func (f *fakeEngine) add(image string, running bool) string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	id := fmt.Sprintf("%064d", atomic.AddUint64(&fakeIDs, 1))
+	info := &dockerclient.ContainerInfo{
+		Id:         id,
+		Image:      image,
+		Config:     &dockerclient.ContainerConfig{Image: image},
+		HostConfig: &dockerclient.HostConfig{},
+	}
+	info.State.Running = running
+	f.containers[id] = info
+
+	return id
+}
+
+// waitWatching waits until n clients watch the events of the engine
+func (f *fakeEngine) waitWatching(t *testing.T, n int) {
+	for i := 0; i < 500; i++ {
+		f.mux.Lock()
+		watching := f.watching
+		f.mux.Unlock()
+		if watching == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d event watchers", n)
+}
+
+func (f *fakeEngine) listCount() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.lists
+}
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+dockerclient.APIVersion)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case r.Method == "GET" && path == "/containers/json":
+		all := r.URL.Query().Get("all") == "1"
+		f.mux.Lock()
+		f.lists++
+		out := []dockerclient.Container{}
+		for id, info := range f.containers {
+			if all || info.State.Running {
+				out = append(out, dockerclient.Container{Id: id, Image: info.Image})
+			}
+		}
+		f.mux.Unlock()
+		json.NewEncoder(w).Encode(out)
+	case r.Method == "POST" && path == "/containers/create":
+		config := &dockerclient.ContainerConfig{}
+		if err := json.NewDecoder(r.Body).Decode(config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := f.add(config.Image, false)
+		f.mux.Lock()
+		f.containers[id].Config = config
+		f.mux.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&dockerclient.RespContainersCreate{Id: id})
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "start":
+		f.mux.Lock()
+		f.starting++
+		if f.starting > f.maxStarts {
+			f.maxStarts = f.starting
+		}
+		f.mux.Unlock()
+
+		time.Sleep(f.latency)
+
+		f.mux.Lock()
+		f.starting--
+		info := f.containers[parts[1]]
+		if info != nil {
+			info.State.Running = !f.exitOnStart
+		}
+		f.mux.Unlock()
+		if info == nil {
+			http.Error(w, "no such container", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && len(parts) == 3 && parts[2] == "json":
+		f.mux.Lock()
+		info := f.containers[parts[1]]
+		f.mux.Unlock()
+		if info == nil {
+			http.Error(w, "no such container", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "containers":
+		f.mux.Lock()
+		delete(f.containers, parts[1])
+		f.mux.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && path == "/images/json":
+		json.NewEncoder(w).Encode([]dockerclient.Image{{Id: "nginx", RepoTags: []string{"nginx:latest"}}})
+	case r.Method == "GET" && path == "/events":
+		f.mux.Lock()
+		f.watching++
+		f.mux.Unlock()
+		defer func() {
+			f.mux.Lock()
+			f.watching--
+			f.mux.Unlock()
+		}()
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case ev := <-f.events:
+				json.NewEncoder(w).Encode(ev)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type acceptScheduler struct{}
+
+func (acceptScheduler) Schedule(*citadel.Image, *citadel.Engine) (bool, error) {
+	return true, nil
+}
+
+func newFakeCluster(t testing.TB, count int, cpus float64, memory float64, latency time.Duration, exitOnStart bool) (*Cluster, []*fakeEngine) {
+	var (
+		engines = []*citadel.Engine{}
+		fakes   = []*fakeEngine{}
+	)
+
+	for i := 0; i < count; i++ {
+		f := &fakeEngine{
+			latency:     latency,
+			exitOnStart: exitOnStart,
+			events:      make(chan *dockerclient.Event),
+			containers:  make(map[string]*dockerclient.ContainerInfo),
+		}
+		srv := httptest.NewServer(f)
+		t.Cleanup(func() {
+			// end event streams that would keep the server open
+			srv.CloseClientConnections()
+			srv.Close()
+		})
+
+		e := &citadel.Engine{
+			ID:     fmt.Sprintf("engine-%d", i),
+			Addr:   srv.URL,
+			Cpus:   cpus,
+			Memory: memory,
+		}
+		if err := e.Connect(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		engines = append(engines, e)
+		fakes = append(fakes, f)
+	}
+
+	c, err := New(scheduler.NewResourceManager(), engines...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RegisterScheduler("service", acceptScheduler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return c, fakes
+}
+
+func startConcurrently(c *Cluster, image *citadel.Image, count int) ([]*citadel.Container, []error) {
+	var (
+		wg         sync.WaitGroup
+		containers = make([]*citadel.Container, count)
+		errs       = make([]error, count)
+	)
+
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			containers[i], errs[i] = c.Start(image, false)
+		}(i)
+	}
+	wg.Wait()
+
+	return containers, errs
+}
+
+func TestStartReservesResourcesOfConcurrentStarts(t *testing.T) {
+	c, fakes := newFakeCluster(t, 4, 1, 1024, 20*time.Millisecond, false)
+	image := &citadel.Image{Name: "nginx", Type: "service", Cpus: 1, Memory: 512}
+
+	containers, errs := startConcurrently(c, image, 4)
+
+	engines := make(map[string]bool)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("start %d: %s", i, err)
+		}
+		engines[containers[i].Engine.ID] = true
+	}
+
+	if len(engines) != 4 {
+		t.Fatalf("expected containers on 4 engines; received %d", len(engines))
+	}
+
+	if _, err := c.Start(image, false); err == nil {
+		t.Fatal("expected no resources for a fifth container")
+	}
+
+	for i, f := range fakes {
+		if f.maxStarts > 1 {
+			t.Errorf("expected one start at a time on engine %d; received %d", i, f.maxStarts)
+		}
+	}
+}
+
+func TestStartReleasesFailedReservations(t *testing.T) {
+	c, _ := newFakeCluster(t, 1, 1, 1024, 0, false)
+	image := &citadel.Image{Name: "nginx", Type: "service", Cpus: 1, Memory: 512, ContainerName: "web"}
+
+	// the fake engine does not support pulling
+	if _, err := c.Start(image, true); err == nil {
+		t.Fatal("expected the pull to fail")
+	}
+
+	if _, err := c.Start(image, false); err != nil {
+		t.Fatalf("expected the failed start to release its resources: %s", err)
+	}
+}
+
+// eventRecorder passes the events it handles to a channel
+type eventRecorder chan *citadel.Event
+
+func (r eventRecorder) Handle(e *citadel.Event) error {
+	r <- e
+	return nil
+}
+
+func (r eventRecorder) wait(t *testing.T, eventType string) {
+	select {
+	case e := <-r:
+		if e.Type != eventType {
+			t.Fatalf("expected %s event; received %s", eventType, e.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s event", eventType)
+	}
+}
+
+func containerIDs(containers []*citadel.Container) map[string]bool {
+	ids := make(map[string]bool)
+	for _, c := range containers {
+		ids[c.ID] = true
+	}
+
+	return ids
+}
+
+func TestListContainersFromState(t *testing.T) {
+	c, fakes := newFakeCluster(t, 2, 1, 1024, 0, false)
+	running := fakes[0].add("nginx", true)
+	stopped := fakes[1].add("redis", false)
+
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if ids := containerIDs(c.ListContainers(true, false, "")); len(ids) != 2 || !ids[running] || !ids[stopped] {
+			t.Fatalf("expected both containers; received %v", ids)
+		}
+	}
+
+	if ids := containerIDs(c.ListContainers(false, false, "")); len(ids) != 1 || !ids[running] {
+		t.Fatalf("expected the running container; received %v", ids)
+	}
+
+	if info := c.ClusterInfo(); info.ContainerCount != 1 || info.ImageCount != 2 {
+		t.Errorf("unexpected cluster info %+v", info)
+	}
+
+	for i, f := range fakes {
+		if n := f.listCount(); n != 1 {
+			t.Errorf("expected engine %d to be listed once; received %d", i, n)
+		}
+	}
+}
+
+func TestStateFollowsEvents(t *testing.T) {
+	c, fakes := newFakeCluster(t, 1, 1, 1024, 0, false)
+	events := make(eventRecorder)
+	if err := c.Events(events); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	id := fakes[0].add("nginx", true)
+	fakes[0].events <- &dockerclient.Event{Id: id, Status: "start", From: "nginx"}
+	events.wait(t, "start")
+
+	if ids := containerIDs(c.ListContainers(false, false, "")); !ids[id] {
+		t.Fatal("expected the started container after its event")
+	}
+
+	fakes[0].mux.Lock()
+	delete(fakes[0].containers, id)
+	fakes[0].mux.Unlock()
+	fakes[0].events <- &dockerclient.Event{Id: id, Status: "destroy", From: "nginx"}
+	events.wait(t, "destroy")
+
+	if ids := containerIDs(c.ListContainers(true, false, "")); ids[id] {
+		t.Fatal("expected the destroyed container to be removed")
+	}
+
+	// changes without events are picked up by the next sync
+	missed := fakes[0].add("redis", true)
+	if ids := containerIDs(c.ListContainers(true, false, "")); ids[missed] {
+		t.Fatal("expected the container to be missing before a sync")
+	}
+
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := containerIDs(c.ListContainers(true, false, "")); !ids[missed] {
+		t.Fatal("expected the container after a sync")
+	}
+}
+
+func TestEngineEventsFollowMembership(t *testing.T) {
+	c, fakes := newFakeCluster(t, 2, 1, 1024, 0, false)
+	events := make(eventRecorder, 1)
+	if err := c.Events(events); err != nil {
+		t.Fatal(err)
+	}
+	fakes[0].waitWatching(t, 1)
+
+	var removed *citadel.Engine
+	for _, e := range c.Engines() {
+		if e.ID == "engine-0" {
+			removed = e
+		}
+	}
+	if err := c.RemoveEngine(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stream closes after the next event, which is dropped
+	fakes[0].events <- &dockerclient.Event{Id: fakes[0].add("nginx", true), Status: "start"}
+	fakes[0].waitWatching(t, 0)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected %s event from a removed engine", e.Type)
+	default:
+	}
+
+	added, fake := newFakeCluster(t, 1, 1, 1024, 0, false)
+	e := added.Engines()[0]
+	e.ID = "engine-added"
+	if err := c.AddEngine(e); err != nil {
+		t.Fatal(err)
+	}
+	fake[0].waitWatching(t, 1)
+
+	fake[0].events <- &dockerclient.Event{Id: fake[0].add("nginx", true), Status: "start"}
+	events.wait(t, "start")
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fake[0].events <- &dockerclient.Event{Id: fake[0].add("nginx", true), Status: "start"}
+	fake[0].waitWatching(t, 0)
+}
+
+func TestClusterActionsUpdateState(t *testing.T) {
+	c, fakes := newFakeCluster(t, 1, 1, 1024, 0, false)
+	image := &citadel.Image{Name: "nginx", Type: "service", Cpus: 1, Memory: 512}
+
+	container, err := c.Start(image, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers := c.ListContainers(false, false, "")
+	if len(containers) != 1 || containers[0].ID != container.ID || containers[0].Image.Cpus != 1 {
+		t.Fatalf("expected the started container; received %v", containers)
+	}
+
+	if err := c.Remove(container); err != nil {
+		t.Fatal(err)
+	}
+
+	if containers := c.ListContainers(true, false, ""); len(containers) != 0 {
+		t.Fatalf("expected no containers after remove; received %d", len(containers))
+	}
+
+	if n := fakes[0].listCount(); n != 1 {
+		t.Errorf("expected the engine to be listed once; received %d", n)
+	}
+}
+
+func TestCreateDoesNotStart(t *testing.T) {
+	c, fakes := newFakeCluster(t, 1, 1, 1024, 0, false)
+	image := &citadel.Image{Name: "nginx", Type: "service", Cpus: 1, Memory: 512, Privileged: true}
+
+	container, err := c.Create(image, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakes[0].mux.Lock()
+	info := fakes[0].containers[container.ID]
+	running, privileged := info.State.Running, info.Config.HostConfig.Privileged
+	fakes[0].mux.Unlock()
+	if running {
+		t.Error("expected the created container to not be running")
+	}
+	if !privileged {
+		t.Error("expected the host config to be sent with the create request")
+	}
+	if containers := c.ListContainers(false, false, ""); len(containers) != 0 {
+		t.Fatalf("expected no running containers; received %d", len(containers))
+	}
+	if containers := c.ListContainers(true, false, ""); len(containers) != 1 || containers[0].State != "stopped" {
+		t.Fatalf("expected the stopped container; received %v", containers)
+	}
+
+	if err := c.StartExisting(container); err != nil {
+		t.Fatal(err)
+	}
+	if containers := c.ListContainers(false, false, ""); len(containers) != 1 || containers[0].ID != container.ID {
+		t.Fatalf("expected the started container; received %v", containers)
+	}
+}
+
+func BenchmarkStart20Engines(b *testing.B) {
+	c, _ := newFakeCluster(b, 20, 4, 4096, 5*time.Millisecond, true)
+	// without reservations every engine scores the same so that starts
+	// are spread instead of packed onto the fullest engine
+	image := &citadel.Image{Name: "nginx", Type: "service"}
+
+	b.SetParallelism(20)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := c.Start(image, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package cluster
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/citadel/citadel"
+)
+
+// engineState caches the containers of an engine.  It is seeded by a full
+// sync and kept current from the engine's events and the actions of the
+// cluster.
+type engineState struct {
+	mux sync.RWMutex
+
+	synced     bool
+	err        error
+	containers map[string]*citadel.Container
+	images     int
+
+	// seq orders changes; changed holds the last change of each container
+	// so that a sync does not overwrite changes made while it was listing
+	seq     uint64
+	changed map[string]uint64
+}
+
+func newEngineState() *engineState {
+	return &engineState{
+		containers: make(map[string]*citadel.Container),
+		changed:    make(map[string]uint64),
+	}
+}
+
+// isSynced reports whether the engine has been synced at least once
+func (s *engineState) isSynced() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.synced
+}
+
+// begin returns the sequence to pass to replace for a sync starting now
+func (s *engineState) begin() uint64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.seq
+}
+
+// replace sets the containers listed by a sync that began at since.
+// Containers that changed after since keep their cached state.
+func (s *engineState) replace(containers []*citadel.Container, images int, since uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	fresh := make(map[string]*citadel.Container, len(containers))
+	for _, c := range containers {
+		fresh[c.ID] = c
+	}
+
+	for id, seq := range s.changed {
+		if seq <= since {
+			delete(s.changed, id)
+			continue
+		}
+
+		if c, ok := s.containers[id]; ok {
+			fresh[id] = c
+		} else {
+			delete(fresh, id)
+		}
+	}
+
+	s.containers = fresh
+	s.images = images
+	s.synced = true
+	s.err = nil
+}
+
+// fail marks the engine as unavailable until the next successful sync
+func (s *engineState) fail(err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.synced = true
+	s.err = err
+}
+
+func (s *engineState) update(c *citadel.Container) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.seq++
+	s.changed[c.ID] = s.seq
+	s.containers[c.ID] = c
+}
+
+func (s *engineState) remove(id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.seq++
+	s.changed[id] = s.seq
+	delete(s.containers, id)
+}
+
+// list returns copies of the cached containers; stopped containers are
+// only included when all is set.  Unavailable engines have no containers.
+func (s *engineState) list(all bool) []*citadel.Container {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	out := []*citadel.Container{}
+	if s.err != nil {
+		return out
+	}
+
+	for _, c := range s.containers {
+		if all || c.State == "running" {
+			out = append(out, copyContainer(c))
+		}
+	}
+
+	sort.Sort(containersByID(out))
+
+	return out
+}
+
+// available reports whether the last sync of the engine succeeded and
+// returns the number of images it listed
+func (s *engineState) available() (int, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.images, s.synced && s.err == nil
+}
+
+func copyContainer(c *citadel.Container) *citadel.Container {
+	cc := *c
+	if c.Image != nil {
+		i := *c.Image
+		cc.Image = &i
+	}
+
+	return &cc
+}
+
+type containersByID []*citadel.Container
+
+func (c containersByID) Len() int           { return len(c) }
+func (c containersByID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c containersByID) Less(i, j int) bool { return c[i].ID < c[j].ID }
+
+// stateHandler applies engine events to the cached state before passing
+// them to the cluster's event handler
+type stateHandler struct {
+	cluster *Cluster
+	next    citadel.EventHandler
+}
+
+func (h *stateHandler) Handle(e *citadel.Event) error {
+	if s := h.cluster.state(e.Engine.ID); s != nil {
+		switch e.Type {
+		case "destroy":
+			s.remove(e.Container.ID)
+		default:
+			s.update(e.Container)
+		}
+	}
+
+	if h.next == nil {
+		return nil
+	}
+
+	return h.next.Handle(e)
+}
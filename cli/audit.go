@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard/client"
+)
+
+var auditCommand = cli.Command{
+	Name:   "audit",
+	Usage:  "show the api audit log",
+	Action: auditAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "actor",
+			Value: "",
+			Usage: "only show records for an account or service key description",
+		},
+		cli.IntFlag{
+			Name:  "limit",
+			Value: 50,
+			Usage: "number of records to show",
+		},
+		cli.BoolFlag{
+			Name:  "export",
+			Usage: "export the complete audit log as json lines",
+		},
+	},
+}
+
+func auditAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	if c.Bool("export") {
+		data, err := m.ExportAudit()
+		if err != nil {
+			logger.Fatalf("error exporting audit log: %s", err)
+		}
+		defer data.Close()
+		if _, err := io.Copy(os.Stdout, data); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+	records, err := m.AuditRecords(c.String("actor"), c.Int("limit"))
+	if err != nil {
+		logger.Fatalf("error getting audit log: %s", err)
+	}
+	if len(records) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "Time\tActor\tSource\tMethod\tRoute\tTarget\tStatus")
+	for _, a := range records {
+		actor := a.Actor
+		switch a.ActorType {
+		case "service-key":
+			actor = fmt.Sprintf("%s (service key)", a.Actor)
+		case "unverified":
+			actor = fmt.Sprintf("%s (unverified)", a.Actor)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", a.Time.Format(time.RubyDate), actor, a.SourceIP, a.Method, a.Route, a.Target, a.Status)
+	}
+	w.Flush()
+}
@@ -36,13 +36,33 @@ func main() {
 			Name:  "allow-insecure",
 			Usage: "allow insecure certificates if using TLS",
 		},
+		cli.StringFlag{
+			Name:  "tls-ca-cert",
+			Value: "",
+			Usage: "ca certificate to verify the controller",
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Value: "",
+			Usage: "client certificate to authenticate to the controller",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Value: "",
+			Usage: "client certificate key",
+		},
 	}
 	app.Commands = []cli.Command{
 		loginCommand,
 		changePasswordCommand,
+		enableTOTPCommand,
+		disableTOTPCommand,
+		recoveryCodesCommand,
 		accountsCommand,
 		addAccountCommand,
 		deleteAccountCommand,
+		resetTOTPCommand,
+		requireTOTPCommand,
 		containersCommand,
 		containerInspectCommand,
 		runCommand,
@@ -55,6 +75,8 @@ func main() {
 		engineAddCommand,
 		engineRemoveCommand,
 		engineInspectCommand,
+		engineHealthCommand,
+		engineRotateCertsCommand,
 		serviceKeysListCommand,
 		serviceKeyCreateCommand,
 		serviceKeyRemoveCommand,
@@ -64,8 +86,25 @@ func main() {
 		webhookKeysListCommand,
 		webhookKeyCreateCommand,
 		webhookKeyRemoveCommand,
+		joinTokensListCommand,
+		joinTokenCreateCommand,
+		joinTokenRemoveCommand,
+		notificationsListCommand,
+		notificationAddCommand,
+		notificationRemoveCommand,
+		notificationTestCommand,
+		notificationDeliveriesCommand,
+		secretsListCommand,
+		secretAddCommand,
+		secretRemoveCommand,
 		infoCommand,
+		controllersCommand,
 		eventsCommand,
+		auditCommand,
+		operationsCommand,
+		operationWatchCommand,
+		operationCancelCommand,
+		pullCommand,
 	}
 	app.Run(os.Args)
 }
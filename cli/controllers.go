@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard/client"
+)
+
+var controllersCommand = cli.Command{
+	Name:   "controllers",
+	Usage:  "list controllers and the leader",
+	Action: controllersAction,
+}
+
+func controllersAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	membership, err := m.Controllers()
+	if err != nil {
+		logger.Fatalf("error getting controllers: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "ID\tHostname\tVersion\tLeader\tStarted\tLast Seen")
+	for _, ctl := range membership.Controllers {
+		leader := ""
+		if ctl.Leader {
+			leader = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", ctl.ID, ctl.Hostname, ctl.Version, leader, ctl.Started.Format(time.RFC822), ctl.LastSeen.Format(time.RFC822))
+	}
+	w.Flush()
+}
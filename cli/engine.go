@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/citadel/citadel"
 	"github.com/codegangsta/cli"
@@ -72,13 +73,13 @@ var engineAddCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "cpus",
-			Value: "1.0",
-			Usage: "engine cpus",
+			Value: "0",
+			Usage: "engine cpus (default: detected from docker)",
 		},
 		cli.StringFlag{
 			Name:  "memory",
-			Value: "1024",
-			Usage: "engine memory",
+			Value: "0",
+			Usage: "engine memory in MB (default: detected from docker)",
 		},
 		cli.StringSliceFlag{
 			Name:  "label",
@@ -100,6 +101,15 @@ var engineAddCommand = cli.Command{
 			Value: "",
 			Usage: "path to ca certificate",
 		},
+		cli.StringFlag{
+			Name:  "server-name",
+			Value: "",
+			Usage: "tls server name to verify if different from the address",
+		},
+		cli.BoolFlag{
+			Name:  "insecure",
+			Usage: "skip tls certificate verification for the engine",
+		},
 	},
 }
 
@@ -169,6 +179,8 @@ func engineAddAction(c *cli.Context) {
 		SSLCertificate: string(sslCertData),
 		SSLKey:         string(sslKeyData),
 		CACertificate:  string(caCertData),
+		ServerName:     c.String("server-name"),
+		Insecure:       c.Bool("insecure"),
 		Engine:         engine,
 	}
 	if err := m.AddEngine(shipyardEngine); err != nil {
@@ -207,6 +219,113 @@ func engineRemoveAction(c *cli.Context) {
 	}
 }
 
+var engineRotateCertsCommand = cli.Command{
+	Name:        "rotate-engine-certs",
+	Usage:       "replace the tls client certificate of an engine",
+	Description: "rotate-engine-certs <id>",
+	Action:      engineRotateCertsAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "ssl-cert",
+			Value: "",
+			Usage: "new ssl certificate for the engine",
+		},
+		cli.StringFlag{
+			Name:  "ssl-key",
+			Value: "",
+			Usage: "new ssl key for the engine",
+		},
+		cli.StringFlag{
+			Name:  "ca-cert",
+			Value: "",
+			Usage: "new ca certificate; the current one is kept if not given",
+		},
+	},
+}
+
+func engineRotateCertsAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(c.Args()) == 0 {
+		logger.Fatal("you must specify an id")
+	}
+	if c.String("ssl-cert") == "" || c.String("ssl-key") == "" {
+		logger.Fatal("you must specify an ssl certificate and key")
+	}
+	certs := &shipyard.EngineCertificates{}
+	sslCert, err := ioutil.ReadFile(c.String("ssl-cert"))
+	if err != nil {
+		logger.Fatalf("unable to read ssl certificate: %s", err)
+	}
+	certs.SSLCertificate = string(sslCert)
+	sslKey, err := ioutil.ReadFile(c.String("ssl-key"))
+	if err != nil {
+		logger.Fatalf("unable to read ssl key: %s", err)
+	}
+	certs.SSLKey = string(sslKey)
+	if p := c.String("ca-cert"); p != "" {
+		caCert, err := ioutil.ReadFile(p)
+		if err != nil {
+			logger.Fatalf("unable to read ca certificate: %s", err)
+		}
+		certs.CACertificate = string(caCert)
+	}
+	m := client.NewManager(cfg)
+	if err := m.RotateEngineCertificates(c.Args()[0], certs); err != nil {
+		logger.Fatalf("error rotating certificates: %s", err)
+	}
+}
+
+var engineHealthCommand = cli.Command{
+	Name:        "engine-health",
+	Usage:       "show engine uptime and recent health checks",
+	Description: "engine-health <id>",
+	Action:      engineHealthAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "since",
+			Value: "24h",
+			Usage: "period for the uptime (i.e. 1h, 168h)",
+		},
+	},
+}
+
+func engineHealthAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	if len(c.Args()) == 0 {
+		logger.Fatal("you must specify an id")
+	}
+	history, err := m.EngineHealth(c.Args()[0], c.String("since"))
+	if err != nil {
+		logger.Fatalf("error getting engine health: %s", err)
+	}
+	status := "-"
+	if history.Health != nil {
+		status = history.Health.Status
+		if history.Health.Flapping {
+			status += " (flapping)"
+		}
+	}
+	fmt.Printf("Status: %s\n", status)
+	fmt.Printf("Uptime: %.2f%% since %s\n", history.Uptime, history.Since.Format(time.RFC822))
+	fmt.Printf("Transitions: %d\n", history.Transitions)
+	if len(history.Checks) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "Time\tStatus\tResponse Time (ms)\tError")
+	for _, check := range history.Checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", check.Time.Format(time.RFC822), check.Status, responseTimeToString(check.ResponseTime), check.Error)
+	}
+	w.Flush()
+}
+
 var engineInspectCommand = cli.Command{
 	Name:        "inspect-engine",
 	Usage:       "inspect an engine",
@@ -2,19 +2,74 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard"
 	"github.com/shipyard/shipyard/client"
 )
 
 var eventsCommand = cli.Command{
-	Name:   "events",
-	Usage:  "show cluster events",
-	Action: eventsAction,
+	Name:        "events",
+	Usage:       "show cluster events",
+	Description: "events --since 24h --type die --engine local-01",
+	Action:      eventsAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "since",
+			Value: "",
+			Usage: "only show events after a time (RFC3339) or duration ago (i.e. 24h)",
+		},
+		cli.StringFlag{
+			Name:  "until",
+			Value: "",
+			Usage: "only show events before a time (RFC3339) or duration ago",
+		},
+		cli.StringFlag{
+			Name:  "type",
+			Value: "",
+			Usage: "only show events of a type (i.e. die, engine-down)",
+		},
+		cli.StringFlag{
+			Name:  "tag",
+			Value: "",
+			Usage: "only show events with a tag (i.e. docker, security)",
+		},
+		cli.StringFlag{
+			Name:  "engine",
+			Value: "",
+			Usage: "only show events of an engine",
+		},
+		cli.StringFlag{
+			Name:  "container",
+			Value: "",
+			Usage: "only show events of a container id or id prefix",
+		},
+		cli.StringFlag{
+			Name:  "actor",
+			Value: "",
+			Usage: "only show events caused by an account or service key",
+		},
+		cli.IntFlag{
+			Name:  "limit",
+			Value: 100,
+			Usage: "number of events to show; 0 shows all",
+		},
+		cli.StringFlag{
+			Name:  "cursor",
+			Value: "",
+			Usage: "continue after the last event of a previous page",
+		},
+		cli.BoolFlag{
+			Name:  "export",
+			Usage: "export the matching events as json lines, oldest first",
+		},
+	},
 }
 
 func eventsAction(c *cli.Context) {
@@ -22,8 +77,31 @@ func eventsAction(c *cli.Context) {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	v := url.Values{}
+	for _, name := range []string{"since", "until", "type", "tag", "engine", "container", "actor", "cursor"} {
+		if s := c.String(name); s != "" {
+			v.Set(name, s)
+		}
+	}
+	v.Set("limit", fmt.Sprint(c.Int("limit")))
+	q, err := shipyard.ParseEventQuery(v, time.Now())
+	if err != nil {
+		logger.Fatal(err)
+	}
 	m := client.NewManager(cfg)
-	events, err := m.Events()
+	if c.Bool("export") {
+		q.Limit = 0
+		data, err := m.ExportEvents(q)
+		if err != nil {
+			logger.Fatalf("error exporting events: %s", err)
+		}
+		defer data.Close()
+		if _, err := io.Copy(os.Stdout, data); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+	events, next, err := m.QueryEvents(q)
 	if err != nil {
 		logger.Fatalf("error getting events: %s", err)
 	}
@@ -31,19 +109,25 @@ func eventsAction(c *cli.Context) {
 		return
 	}
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
-	fmt.Fprintln(w, "Time\tMessage\tEngine\tType\tTags")
+	fmt.Fprintln(w, "Time\tMessage\tEngine\tType\tTags\tActor")
 	for _, e := range events {
 		tags := strings.Join(e.Tags, ",")
 		message := e.Message
 		engine := ""
-		if e.Container.ID != "" {
-			cntId := e.Container.ID[:12]
+		if e.Container != nil && e.Container.ID != "" {
+			cntId := e.Container.ID
+			if len(cntId) > 12 {
+				cntId = cntId[:12]
+			}
 			message = fmt.Sprintf("container:%s %s", cntId, e.Message)
 		}
-		if e.Engine.ID != "" {
+		if e.Engine != nil {
 			engine = e.Engine.ID
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RubyDate), message, engine, e.Type, tags)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RubyDate), message, engine, e.Type, tags, e.Actor)
 	}
 	w.Flush()
+	if next != "" {
+		fmt.Fprintf(os.Stderr, "more events: --cursor %s\n", next)
+	}
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/client"
+)
+
+var joinTokensListCommand = cli.Command{
+	Name:   "join-tokens",
+	Usage:  "list engine join tokens",
+	Action: joinTokensListAction,
+}
+
+func joinTokensListAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	tokens, err := m.JoinTokens()
+	if err != nil {
+		logger.Fatalf("error getting join tokens: %s", err)
+		return
+	}
+	if len(tokens) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "ID\tToken\tDescription\tLabels\tUses\tExpires")
+	for _, t := range tokens {
+		uses := fmt.Sprintf("%d", t.Uses)
+		if t.MaxUses > 0 {
+			uses = fmt.Sprintf("%d/%d", t.Uses, t.MaxUses)
+		}
+		expires := t.Expires.Format(time.RFC822)
+		if t.Expired(time.Now()) {
+			expires = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Token, t.Description, strings.Join(t.Labels, ","), uses, expires)
+	}
+	w.Flush()
+}
+
+var joinTokenCreateCommand = cli.Command{
+	Name:   "add-join-token",
+	Usage:  "create a token for hosts to join as engines with shipyard-agent",
+	Action: joinTokenCreateAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "description, d",
+			Value: "",
+			Usage: "join token description",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Value: &cli.StringSlice{},
+			Usage: "labels for engines that join with the token",
+		},
+		cli.StringFlag{
+			Name:  "ttl",
+			Value: "24h",
+			Usage: "time until the token expires (i.e. 1h, 72h)",
+		},
+		cli.IntFlag{
+			Name:  "max-uses",
+			Value: 0,
+			Usage: "number of engines that can join with the token; 0 is unlimited",
+		},
+		cli.StringFlag{
+			Name:  "ca-cert",
+			Value: "",
+			Usage: "path to the ca certificate that verifies docker on joined engines",
+		},
+		cli.BoolFlag{
+			Name:  "insecure",
+			Usage: "skip tls certificate verification for docker on joined engines",
+		},
+	},
+}
+
+func joinTokenCreateAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	ttl, err := time.ParseDuration(c.String("ttl"))
+	if err != nil {
+		logger.Fatalf("invalid ttl: %s", err)
+	}
+	var caCert []byte
+	if path := c.String("ca-cert"); path != "" {
+		if caCert, err = ioutil.ReadFile(path); err != nil {
+			logger.Fatalf("unable to read ca certificate: %s", err)
+		}
+	}
+	m := client.NewManager(cfg)
+	token, err := m.NewJoinToken(&shipyard.JoinToken{
+		Description:   c.String("description"),
+		Labels:        c.StringSlice("label"),
+		TTL:           int(ttl.Seconds()),
+		MaxUses:       c.Int("max-uses"),
+		CACertificate: string(caCert),
+		Insecure:      c.Bool("insecure"),
+	})
+	if err != nil {
+		logger.Fatalf("error creating join token: %s", err)
+	}
+	fmt.Printf("created join token: %s\n", token.Token)
+	fmt.Printf("expires: %s\n", token.Expires.Format(time.RFC822))
+	fmt.Printf("join with: shipyard-agent join --url %s --token %s\n", cfg.Url, token.Token)
+}
+
+var joinTokenRemoveCommand = cli.Command{
+	Name:        "remove-join-token",
+	Usage:       "remove an engine join token",
+	Description: "remove-join-token <id> [<id>]",
+	Action:      joinTokenRemoveAction,
+}
+
+func joinTokenRemoveAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	for _, id := range c.Args() {
+		if err := m.RemoveJoinToken(id); err != nil {
+			logger.Fatalf("error removing join token: %s", err)
+		}
+		fmt.Printf("removed %s\n", id)
+	}
+}
@@ -3,21 +3,40 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/howeyc/gopass"
 	"github.com/shipyard/shipyard/client"
+	"github.com/shipyard/shipyard/oidc"
+)
+
+const (
+	ssoLoginTimeout = time.Duration(5 * time.Minute)
 )
 
 var loginCommand = cli.Command{
 	Name:   "login",
 	Usage:  "login to a shipyard cluster",
 	Action: loginAction,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "sso",
+			Usage: "login using the cluster single sign-on provider",
+		},
+		cli.BoolFlag{
+			Name:  "certificate",
+			Usage: "login with the client certificate from --tls-cert instead of a password",
+		},
+	},
 }
 
 func saveConfig(cfg *client.ShipyardConfig) error {
@@ -53,6 +72,15 @@ func loginAction(c *cli.Context) {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	sUrl := strings.TrimSpace(string(ur[:]))
+	if c.Bool("sso") {
+		ssoLoginAction(c, sUrl)
+		return
+	}
+	if c.Bool("certificate") {
+		certificateLoginAction(c, sUrl)
+		return
+	}
 	fmt.Printf("Username: ")
 	u, err := reader.ReadString('\n')
 	if err != nil {
@@ -60,7 +88,6 @@ func loginAction(c *cli.Context) {
 	}
 	fmt.Printf("Password: ")
 	p := gopass.GetPasswd()
-	sUrl := strings.TrimSpace(string(ur[:]))
 	username := strings.TrimSpace(string(u[:]))
 	pass := strings.TrimSpace(string(p[:]))
 
@@ -69,17 +96,140 @@ func loginAction(c *cli.Context) {
 		Username:      username,
 		AllowInsecure: c.GlobalBool("allow-insecure"),
 	}
+	setTLSConfig(c, cfg)
 	m := client.NewManager(cfg)
-	token, err := m.Login(username, pass)
+	token, err := m.Login(username, pass, "")
 	if err != nil {
 		logger.Fatal(err)
 	}
+	if token.TOTPRequired {
+		fmt.Printf("Code: ")
+		code, err := reader.ReadString('\n')
+		if err != nil {
+			logger.Fatal(err)
+		}
+		token, err = m.Login(username, pass, strings.TrimSpace(code))
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
 	cfg.Token = token.Token
+	if token.PasswordChangeRequired {
+		fmt.Println("Your password must be changed before continuing")
+		changePassword(client.NewManager(cfg))
+	}
+	if token.TOTPEnrollmentRequired {
+		fmt.Println("Your role requires two-factor authentication")
+		enableTOTP(client.NewManager(cfg))
+	}
 	if err := saveConfig(cfg); err != nil {
 		logger.Fatal(err)
 	}
 }
 
+// certificateLoginAction saves a config that authenticates with the
+// client certificate; the controller maps its common name to an account
+// or service key
+func certificateLoginAction(c *cli.Context, sUrl string) {
+	cfg := &client.ShipyardConfig{
+		Url:           sUrl,
+		AllowInsecure: c.GlobalBool("allow-insecure"),
+	}
+	setTLSConfig(c, cfg)
+	if cfg.TLSCert == "" || cfg.TLSKey == "" {
+		logger.Fatal("--tls-cert and --tls-key are required to login with a certificate")
+	}
+	m := client.NewManager(cfg)
+	if _, err := m.Info(); err != nil {
+		logger.Fatalf("unable to login with certificate: %s", err)
+	}
+	if err := saveConfig(cfg); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// ssoLoginAction runs the authorization code flow with PKCE using a
+// loopback redirect (RFC 8252) and exchanges the resulting id token for
+// a shipyard auth token
+func ssoLoginAction(c *cli.Context, sUrl string) {
+	cfg := &client.ShipyardConfig{
+		Url:           sUrl,
+		AllowInsecure: c.GlobalBool("allow-insecure"),
+	}
+	setTLSConfig(c, cfg)
+	m := client.NewManager(cfg)
+	ssoCfg, err := m.SSOConfig()
+	if err != nil {
+		logger.Fatalf("unable to get single sign-on configuration: %s", err)
+	}
+	// the controller redirect url is for the browser flow only
+	ssoCfg.RedirectURL = ""
+	provider, err := oidc.NewProvider(ssoCfg)
+	if err != nil {
+		logger.Fatalf("unable to contact identity provider: %s", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer l.Close()
+	redirectURL := fmt.Sprintf("http://%s/callback", l.Addr().String())
+
+	// the id token is only accepted with a nonce issued by the controller
+	req, err := m.SSORequest()
+	if err != nil {
+		logger.Fatalf("unable to start single sign-on: %s", err)
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		if e := r.FormValue("error"); e != "" {
+			fmt.Fprintf(w, "login failed: %s\n", e)
+			errs <- errors.New(e)
+			return
+		}
+		if r.FormValue("state") != req.State {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "login complete; you can close this window")
+		codes <- r.FormValue("code")
+	}))
+
+	fmt.Printf("Open the following URL in your browser to login:\n\n%s\n\n", provider.AuthCodeURL(redirectURL, req.State, req.Nonce, verifier))
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		logger.Fatalf("login failed: %s", err)
+	case <-time.After(ssoLoginTimeout):
+		logger.Fatal("timed out waiting for login")
+	}
+	tr, err := provider.Exchange(code, redirectURL, verifier)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	login, err := m.SSOLogin(tr.IDToken, req.State)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	cfg.Username = login.Username
+	cfg.Token = login.AuthToken
+	if err := saveConfig(cfg); err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("logged in as %s\n", login.Username)
+}
+
 var changePasswordCommand = cli.Command{
 	Name:   "change-password",
 	Usage:  "update your password",
@@ -91,7 +241,10 @@ func changePasswordAction(c *cli.Context) {
 	if err != nil {
 		logger.Fatal(err)
 	}
-	m := client.NewManager(cfg)
+	changePassword(client.NewManager(cfg))
+}
+
+func changePassword(m *client.Manager) {
 	fmt.Printf("Password: ")
 	p1 := gopass.GetPasswd()
 	fmt.Printf("Confirm: ")
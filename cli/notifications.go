@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/client"
+)
+
+var notificationsListCommand = cli.Command{
+	Name:   "notifications",
+	Usage:  "list notification channels",
+	Action: notificationsListAction,
+}
+
+func notificationsListAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	channels, err := m.NotificationChannels()
+	if err != nil {
+		logger.Fatalf("error getting notification channels: %s", err)
+		return
+	}
+	if len(channels) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "ID\tName\tType\tRules\tDisabled")
+	for _, ch := range channels {
+		rules := []string{}
+		for _, r := range ch.Rules {
+			rules = append(rules, fmt.Sprintf("types=%s tags=%s", strings.Join(r.Types, ","), strings.Join(r.Tags, ",")))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", ch.ID, ch.Name, ch.Type, strings.Join(rules, "; "), ch.Disabled)
+	}
+	w.Flush()
+}
+
+var notificationAddCommand = cli.Command{
+	Name:        "add-notification",
+	Usage:       "add a webhook, slack or email notification channel",
+	Description: "add-notification --name oncall --type slack --url <webhook url> --event 'engine-*' --tag security",
+	Action:      notificationAddAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Value: "",
+			Usage: "channel name",
+		},
+		cli.StringFlag{
+			Name:  "type",
+			Value: shipyard.NotificationWebhook,
+			Usage: "channel type (webhook, slack, email)",
+		},
+		cli.StringFlag{
+			Name:  "url",
+			Value: "",
+			Usage: "webhook or slack incoming webhook url",
+		},
+		cli.StringFlag{
+			Name:  "template",
+			Value: "",
+			Usage: "path to a template for the webhook json body",
+		},
+		cli.StringFlag{
+			Name:  "smtp-addr",
+			Value: "",
+			Usage: "smtp server (host:port) for email",
+		},
+		cli.StringFlag{
+			Name:  "smtp-username",
+			Value: "",
+			Usage: "smtp username",
+		},
+		cli.StringFlag{
+			Name:  "smtp-password",
+			Value: "",
+			Usage: "smtp password or secret reference (i.e. secret:smtp)",
+		},
+		cli.StringFlag{
+			Name:  "from",
+			Value: "",
+			Usage: "email sender",
+		},
+		cli.StringSliceFlag{
+			Name:  "to",
+			Value: &cli.StringSlice{},
+			Usage: "email recipients",
+		},
+		cli.StringSliceFlag{
+			Name:  "event",
+			Value: &cli.StringSlice{},
+			Usage: "event types to notify (i.e. engine-down, die, engine-*)",
+		},
+		cli.StringSliceFlag{
+			Name:  "tag",
+			Value: &cli.StringSlice{},
+			Usage: "event tags to notify (i.e. security, health)",
+		},
+	},
+}
+
+func notificationAddAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	ch := &shipyard.NotificationChannel{
+		Name: c.String("name"),
+		Type: c.String("type"),
+		URL:  c.String("url"),
+		Rules: []*shipyard.NotificationRule{
+			{
+				Types: c.StringSlice("event"),
+				Tags:  c.StringSlice("tag"),
+			},
+		},
+	}
+	if path := c.String("template"); path != "" {
+		t, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.Fatalf("error reading template: %s", err)
+		}
+		ch.Template = string(t)
+	}
+	if ch.Type == shipyard.NotificationEmail {
+		ch.SMTP = &shipyard.SMTPSettings{
+			Addr:     c.String("smtp-addr"),
+			From:     c.String("from"),
+			To:       c.StringSlice("to"),
+			Username: c.String("smtp-username"),
+			Password: c.String("smtp-password"),
+		}
+	}
+	m := client.NewManager(cfg)
+	channel, err := m.AddNotificationChannel(ch)
+	if err != nil {
+		logger.Fatalf("error adding notification channel: %s", err)
+	}
+	fmt.Printf("added notification channel %s\n", channel.ID)
+}
+
+var notificationRemoveCommand = cli.Command{
+	Name:        "remove-notification",
+	Usage:       "remove a notification channel",
+	Description: "remove-notification <id> [<id>]",
+	Action:      notificationRemoveAction,
+}
+
+func notificationRemoveAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	for _, id := range c.Args() {
+		if err := m.RemoveNotificationChannel(id); err != nil {
+			logger.Fatalf("error removing notification channel: %s", err)
+		}
+		fmt.Printf("removed %s\n", id)
+	}
+}
+
+var notificationTestCommand = cli.Command{
+	Name:        "test-notification",
+	Usage:       "send a test notification to a channel",
+	Description: "test-notification <id>",
+	Action:      notificationTestAction,
+}
+
+func notificationTestAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(c.Args()) == 0 {
+		logger.Fatal("you must specify a channel id")
+	}
+	m := client.NewManager(cfg)
+	d, err := m.TestNotificationChannel(c.Args()[0])
+	if err != nil {
+		logger.Fatalf("error testing notification channel: %s", err)
+	}
+	if d.Status != shipyard.DeliveryDelivered {
+		logger.Fatalf("notification %s: %s", d.Status, d.LastError)
+	}
+	fmt.Println("delivered")
+}
+
+var notificationDeliveriesCommand = cli.Command{
+	Name:        "notification-deliveries",
+	Usage:       "show the latest deliveries to a notification channel",
+	Description: "notification-deliveries <id>",
+	Action:      notificationDeliveriesAction,
+}
+
+func notificationDeliveriesAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(c.Args()) == 0 {
+		logger.Fatal("you must specify a channel id")
+	}
+	m := client.NewManager(cfg)
+	deliveries, err := m.NotificationDeliveries(c.Args()[0])
+	if err != nil {
+		logger.Fatalf("error getting notification deliveries: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "Created\tEvent\tStatus\tAttempts\tError")
+	for _, d := range deliveries {
+		status := d.Status
+		if d.NextAttempt != nil {
+			status = fmt.Sprintf("%s (retry %s)", status, d.NextAttempt.Format(time.Kitchen))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", d.Created.Format(time.RFC822), d.EventType, status, d.Attempts, d.LastError)
+	}
+	w.Flush()
+}
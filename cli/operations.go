@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/client"
+)
+
+const (
+	progressBarWidth = 30
+)
+
+var operationsCommand = cli.Command{
+	Name:   "operations",
+	Usage:  "show operations",
+	Action: operationsAction,
+}
+
+func operationsAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	ops, err := m.Operations()
+	if err != nil {
+		logger.Fatalf("error getting operations: %s", err)
+	}
+	if len(ops) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "ID\tType\tTarget\tStatus\tProgress\tCreated\tActor")
+	for _, op := range ops {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\t%s\t%s\n", op.ID, op.Type, op.Target, op.Status, op.Completed+op.Failed, op.Total, op.Created.Format(time.RubyDate), op.Actor)
+	}
+	w.Flush()
+}
+
+var operationWatchCommand = cli.Command{
+	Name:   "watch-operation",
+	Usage:  "show the progress of an operation",
+	Action: operationWatchAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "operation id",
+		},
+	},
+}
+
+func operationWatchAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	id := c.String("id")
+	if id == "" {
+		logger.Fatal("you must specify an operation id")
+	}
+	waitOperation(m, &shipyard.Operation{ID: id})
+}
+
+var operationCancelCommand = cli.Command{
+	Name:   "cancel-operation",
+	Usage:  "cancel an operation",
+	Action: operationCancelAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "operation id",
+		},
+	},
+}
+
+func operationCancelAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	id := c.String("id")
+	if id == "" {
+		logger.Fatal("you must specify an operation id")
+	}
+	if err := m.CancelOperation(id); err != nil {
+		logger.Fatalf("error cancelling operation: %s", err)
+	}
+	fmt.Printf("cancelled %s\n", id)
+}
+
+var pullCommand = cli.Command{
+	Name:   "pull",
+	Usage:  "pull an image on every engine",
+	Action: pullAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "image name",
+		},
+		cli.BoolFlag{
+			Name:  "detach, d",
+			Usage: "print the operation id and do not wait for the pull",
+		},
+	},
+}
+
+func pullAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	if c.String("name") == "" {
+		logger.Fatal("you must specify an image name")
+	}
+	op, err := m.PullImage(c.String("name"))
+	if err != nil {
+		logger.Fatalf("error pulling image: %s", err)
+	}
+	if c.Bool("detach") {
+		fmt.Println(op.ID)
+		return
+	}
+	op = waitOperation(m, op)
+	for _, r := range op.Results {
+		if r.Error == "" {
+			fmt.Printf("pulled %s on %s\n", op.Target, r.Engine)
+		}
+	}
+}
+
+// waitOperation shows a progress bar until the operation finishes and
+// exits when it did not succeed
+func waitOperation(m *client.Manager, op *shipyard.Operation) *shipyard.Operation {
+	final, err := m.WatchOperation(op.ID, func(op *shipyard.Operation) {
+		fmt.Fprintf(os.Stderr, "\r%s %s", progressBar(op.Completed+op.Failed, op.Total, progressBarWidth), op.Status)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		logger.Fatalf("error watching operation %s: %s", op.ID, err)
+	}
+	for _, r := range final.Results {
+		switch {
+		case r.Error != "" && r.Instance > 0:
+			logger.Errorf("instance %d: %s", r.Instance, r.Error)
+		case r.Error != "":
+			logger.Errorf("%s: %s", r.Engine, r.Error)
+		case r.RolledBack:
+			logger.Warnf("instance %d: removed %s from %s", r.Instance, r.ContainerID[:12], r.Engine)
+		}
+	}
+	switch final.Status {
+	case shipyard.OperationSucceeded:
+	case shipyard.OperationFailed:
+		if final.Error != "" {
+			logger.Fatalf("operation %s failed: %s", final.ID, final.Error)
+		}
+		logger.Fatalf("operation %s failed for %d of %d", final.ID, final.Failed, final.Total)
+	default:
+		logger.Fatalf("operation %s %s", final.ID, final.Status)
+	}
+	return final
+}
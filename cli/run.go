@@ -104,6 +104,24 @@ var runCommand = cli.Command{
 			Value: "no",
 			Usage: "restart policy for container (on-failure, always, on-failure:5, etc.)",
 		},
+		cli.StringFlag{
+			Name:  "log-driver",
+			Value: "",
+			Usage: "docker log driver (i.e. syslog, gelf, fluentd); defaults to the controller --container-log-driver",
+		},
+		cli.StringSliceFlag{
+			Name:  "log-opt",
+			Usage: "log driver options (key=value pairs)",
+			Value: &cli.StringSlice{},
+		},
+		cli.BoolFlag{
+			Name:  "atomic",
+			Usage: "remove the started containers if any instance fails",
+		},
+		cli.BoolFlag{
+			Name:  "detach, d",
+			Usage: "print the operation id and do not wait for the containers to start",
+		},
 	},
 }
 
@@ -147,11 +165,24 @@ func runAction(c *cli.Context) {
 		RestartPolicy: rp,
 		Type:          c.String("type"),
 	}
-	containers, err := m.Run(image, c.Int("count"), c.Bool("pull"))
+	if driver := c.String("log-driver"); driver != "" {
+		image.LogConfig = &citadel.LogConfig{
+			Type:   driver,
+			Config: parseEnvironmentVariables(c.StringSlice("log-opt")),
+		}
+	}
+	op, err := m.RunAsync(image, c.Int("count"), c.Bool("pull"), c.Bool("atomic"))
 	if err != nil {
 		logger.Fatalf("error running container: %s\n", err)
 	}
-	for _, c := range containers {
-		fmt.Printf("started %s on %s\n", c.ID[:12], c.Engine.ID)
+	if c.Bool("detach") {
+		fmt.Println(op.ID)
+		return
+	}
+	op = waitOperation(m, op)
+	for _, r := range op.Results {
+		if r.Error == "" && !r.RolledBack {
+			fmt.Printf("started %s on %s\n", r.ContainerID[:12], r.Engine)
+		}
 	}
 }
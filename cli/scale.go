@@ -22,6 +22,10 @@ var scaleCommand = cli.Command{
 			Value: "",
 			Usage: "total number of instances for container",
 		},
+		cli.BoolFlag{
+			Name:  "detach, d",
+			Usage: "print the operation id and do not wait for the scale",
+		},
 	},
 }
 
@@ -40,8 +44,14 @@ func scaleAction(c *cli.Context) {
 	if containerId == "" {
 		logger.Fatalf("you must specify a container id")
 	}
-	if err := m.Scale(container, count); err != nil {
+	op, err := m.ScaleAsync(container, count)
+	if err != nil {
 		logger.Fatalf("error scaling container: %s\n", err)
 	}
+	if c.Bool("detach") {
+		fmt.Println(op.ID)
+		return
+	}
+	waitOperation(m, op)
 	fmt.Printf("scaled %s to %d\n", container.ID[:12], count)
 }
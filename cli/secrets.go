@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/howeyc/gopass"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/client"
+)
+
+var secretsListCommand = cli.Command{
+	Name:   "secrets",
+	Usage:  "list secrets",
+	Action: secretsListAction,
+}
+
+func secretsListAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	secrets, err := m.Secrets()
+	if err != nil {
+		logger.Fatalf("error getting secrets: %s", err)
+	}
+	if len(secrets) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "Name\tReference\tRoles\tService Keys\tUpdated")
+	for _, s := range secrets {
+		fmt.Fprintf(w, "%s\t%s%s\t%s\t%d\t%s\n", s.Name, shipyard.SecretRefPrefix, s.Name, strings.Join(s.Roles, ","), len(s.ServiceKeys), s.Updated.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+var secretAddCommand = cli.Command{
+	Name:        "add-secret",
+	Usage:       "add or update a secret",
+	Description: "add-secret <name>; reference it in container environment as secret:<name>",
+	Action:      secretAddAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "file, f",
+			Value: "",
+			Usage: "read the value from a file instead of prompting",
+		},
+		cli.StringSliceFlag{
+			Name:  "role",
+			Value: &cli.StringSlice{},
+			Usage: "role allowed to use the secret (default: everyone)",
+		},
+		cli.StringSliceFlag{
+			Name:  "service-key",
+			Value: &cli.StringSlice{},
+			Usage: "service key allowed to use the secret (default: everyone)",
+		},
+	},
+}
+
+func secretAddAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	name := c.Args().First()
+	if name == "" {
+		logger.Fatal("you must specify a secret name")
+	}
+	var value string
+	if f := c.String("file"); f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		value = string(b)
+	} else {
+		fmt.Printf("Value: ")
+		value = strings.TrimSpace(string(gopass.GetPasswd()))
+	}
+	m := client.NewManager(cfg)
+	secret := &shipyard.Secret{
+		Name:        name,
+		Value:       value,
+		Roles:       c.StringSlice("role"),
+		ServiceKeys: c.StringSlice("service-key"),
+	}
+	if err := m.SaveSecret(secret); err != nil {
+		logger.Fatalf("error saving secret: %s", err)
+	}
+}
+
+var secretRemoveCommand = cli.Command{
+	Name:        "remove-secret",
+	Usage:       "removes a secret",
+	Description: "remove-secret <name> [<name>]",
+	Action:      secretRemoveAction,
+}
+
+func secretRemoveAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	for _, name := range c.Args() {
+		if err := m.DeleteSecret(name); err != nil {
+			logger.Fatalf("error removing secret: %s", err)
+		}
+		fmt.Printf("removed %s\n", name)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/shipyard/shipyard"
@@ -31,9 +33,25 @@ func serviceKeysListAction(c *cli.Context) {
 		return
 	}
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
-	fmt.Fprintln(w, "Key\tDescription")
+	fmt.Fprintln(w, "Key\tDescription\tScopes\tImages\tAllowed Networks\tExpires\tLast Used")
 	for _, k := range keys {
-		fmt.Fprintf(w, "%s\t%s\n", k.Key, k.Description)
+		scopes := "*"
+		if len(k.Scopes) > 0 {
+			scopes = strings.Join(k.Scopes, ",")
+		}
+		images := "*"
+		if len(k.Images) > 0 {
+			images = strings.Join(k.Images, ",")
+		}
+		expires := "never"
+		if k.Expires != nil {
+			expires = k.Expires.Format(time.RFC3339)
+		}
+		lastUsed := "-"
+		if k.LastUsed != nil {
+			lastUsed = fmt.Sprintf("%s (%s)", k.LastUsed.Format(time.RFC3339), k.LastUsedAddr)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.Key, k.Description, scopes, images, strings.Join(k.AllowedCIDRs, ","), expires, lastUsed)
 	}
 	w.Flush()
 }
@@ -48,6 +66,31 @@ var serviceKeyCreateCommand = cli.Command{
 			Value: "",
 			Usage: "service key description",
 		},
+		cli.StringSliceFlag{
+			Name:  "scope",
+			Usage: "limit the key to an api path with optional method (i.e. \"POST /api/containers\"); keys without scopes have full access",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "image",
+			Usage: "limit the images the key can run containers from (i.e. myorg/web or myorg/web:1.0); keys without images can use any image",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:  "expires",
+			Value: "",
+			Usage: "expire the key after a duration (i.e. 720h)",
+		},
+		cli.StringSliceFlag{
+			Name:  "allow-cidr",
+			Usage: "only allow the key from a network (i.e. 10.0.0.0/8)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:  "common-name",
+			Value: "",
+			Usage: "client certificate common name that authenticates as this key",
+		},
 	},
 }
 
@@ -57,7 +100,22 @@ func serviceKeyCreateAction(c *cli.Context) {
 		logger.Fatal(err)
 	}
 	m := client.NewManager(cfg)
-	key, err := m.NewServiceKey(c.String("description"))
+	k := &shipyard.ServiceKey{
+		Description:  c.String("description"),
+		Scopes:       c.StringSlice("scope"),
+		Images:       c.StringSlice("image"),
+		AllowedCIDRs: c.StringSlice("allow-cidr"),
+		CommonName:   c.String("common-name"),
+	}
+	if e := c.String("expires"); e != "" {
+		d, err := time.ParseDuration(e)
+		if err != nil {
+			logger.Fatalf("invalid expiration: %s", err)
+		}
+		expires := time.Now().Add(d)
+		k.Expires = &expires
+	}
+	key, err := m.NewServiceKey(k)
 	if err != nil {
 		logger.Fatalf("error generating service key: %s\n", err)
 	}
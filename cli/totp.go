@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/shipyard/shipyard/client"
+)
+
+var enableTOTPCommand = cli.Command{
+	Name:   "enable-totp",
+	Usage:  "enable two-factor authentication for your account",
+	Action: enableTOTPAction,
+}
+
+var disableTOTPCommand = cli.Command{
+	Name:   "disable-totp",
+	Usage:  "disable two-factor authentication for your account",
+	Action: disableTOTPAction,
+}
+
+var recoveryCodesCommand = cli.Command{
+	Name:   "recovery-codes",
+	Usage:  "replace your two-factor recovery codes",
+	Action: recoveryCodesAction,
+}
+
+var resetTOTPCommand = cli.Command{
+	Name:   "reset-totp",
+	Usage:  "remove two-factor authentication from an account",
+	Action: resetTOTPAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "username, u",
+			Usage: "account username",
+		},
+	},
+}
+
+var requireTOTPCommand = cli.Command{
+	Name:   "require-totp",
+	Usage:  "require two-factor authentication for a role",
+	Action: requireTOTPAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "role, r",
+			Usage: "role name",
+		},
+		cli.BoolFlag{
+			Name:  "disable",
+			Usage: "no longer require two-factor authentication",
+		},
+	},
+}
+
+func readCode(prompt string) string {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("%s: ", prompt)
+	c, err := reader.ReadString('\n')
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return strings.TrimSpace(c)
+}
+
+func printRecoveryCodes(codes []string) {
+	fmt.Println("Recovery codes (each can be used once in place of a code; store them safely):")
+	for _, c := range codes {
+		fmt.Printf("  %s\n", c)
+	}
+}
+
+func enableTOTP(m *client.Manager) {
+	enrollment, err := m.EnrollTOTP()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Println("Add this account to your authenticator app using the uri (as a QR code) or the secret:")
+	fmt.Printf("  URI:    %s\n", enrollment.URI)
+	fmt.Printf("  Secret: %s\n", enrollment.Secret)
+	codes, err := m.ActivateTOTP(readCode("Code"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	printRecoveryCodes(codes.Codes)
+}
+
+func enableTOTPAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	enableTOTP(client.NewManager(cfg))
+}
+
+func disableTOTPAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	if err := m.DisableTOTP(readCode("Code or recovery code")); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func recoveryCodesAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m := client.NewManager(cfg)
+	codes, err := m.RegenerateRecoveryCodes(readCode("Code"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	printRecoveryCodes(codes.Codes)
+}
+
+func resetTOTPAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	username := c.String("username")
+	if username == "" {
+		logger.Fatal("you must specify a username")
+	}
+	m := client.NewManager(cfg)
+	if err := m.ResetTOTP(username); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func requireTOTPAction(c *cli.Context) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	role := c.String("role")
+	if role == "" {
+		logger.Fatal("you must specify a role")
+	}
+	m := client.NewManager(cfg)
+	if err := m.SetRoleTOTP(role, !c.Bool("disable")); err != nil {
+		logger.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -127,5 +128,35 @@ func loadConfig(c *cli.Context) (*client.ShipyardConfig, error) {
 	if c != nil && c.GlobalBool("allow-insecure") {
 		cfg.AllowInsecure = true
 	}
+	if c != nil {
+		setTLSConfig(c, cfg)
+	}
 	return cfg, nil
 }
+
+// setTLSConfig overrides the tls options of the config with the global
+// flags
+func setTLSConfig(c *cli.Context, cfg *client.ShipyardConfig) {
+	if v := c.GlobalString("tls-ca-cert"); v != "" {
+		cfg.TLSCACert = v
+	}
+	if v := c.GlobalString("tls-cert"); v != "" {
+		cfg.TLSCert = v
+	}
+	if v := c.GlobalString("tls-key"); v != "" {
+		cfg.TLSKey = v
+	}
+}
+
+// progressBar renders the progress of done out of total as a fixed width
+// bar, i.e. [=====     ] 5/10
+func progressBar(done int, total int, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = done * width / total
+	}
+	if filled > width {
+		filled = width
+	}
+	return fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), done, total)
+}
@@ -31,3 +31,21 @@ func TestParseRestartPolicyWithMaximum(t *testing.T) {
 		t.Errorf("expected 5 retries; received %s", retry)
 	}
 }
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		done, total int
+		expected    string
+	}{
+		{0, 10, "[          ] 0/10"},
+		{5, 10, "[=====     ] 5/10"},
+		{10, 10, "[==========] 10/10"},
+		{0, 0, "[          ] 0/0"},
+		{3, 2, "[==========] 3/2"},
+	}
+	for _, test := range tests {
+		if bar := progressBar(test.done, test.total, 10); bar != test.expected {
+			t.Errorf("expected %q; received %q", test.expected, bar)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,11 @@ import (
 	"github.com/citadel/citadel"
 	"github.com/shipyard/shipyard"
 	"github.com/shipyard/shipyard/dockerhub"
+	"github.com/shipyard/shipyard/oidc"
+)
+
+var (
+	ErrOperationStreamClosed = errors.New("operation stream closed before the operation finished")
 )
 
 type (
@@ -35,29 +41,68 @@ func (m *Manager) buildUrl(path string) string {
 	return fmt.Sprintf("%s%s", m.config.Url, path)
 }
 
-func (m *Manager) doRequest(path string, method string, expectedStatus int, b []byte) (*http.Response, error) {
-	url := m.buildUrl(path)
-	buf := bytes.NewBuffer(b)
+// tlsConfig returns the tls config for the controller with the optional
+// ca and client certificate from the config
+func (m *Manager) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: m.config.AllowInsecure,
+	}
+	if m.config.TLSCACert != "" {
+		caCert, err := ioutil.ReadFile(m.config.TLSCACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", m.config.TLSCACert)
+		}
+		cfg.RootCAs = pool
+	}
+	if m.config.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(m.config.TLSCert, m.config.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (m *Manager) httpClient(url string) (*http.Client, error) {
 	transport := &http.Transport{}
 	if strings.Index(url, "https") != -1 {
-		if m.config.AllowInsecure {
-			transport.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
+		tlsConfig, err := m.tlsConfig()
+		if err != nil {
+			return nil, err
 		}
+		transport.TLSClientConfig = tlsConfig
 	}
-	req, err := http.NewRequest(method, url, buf)
-	if err != nil {
-		return nil, err
-	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (m *Manager) setHeaders(req *http.Request) {
 	if m.config.ServiceKey != "" {
 		req.Header.Add("X-Service-Key", m.config.ServiceKey)
-	} else {
+	} else if m.config.Username != "" || m.config.TLSCert == "" {
+		// without a token the client certificate identifies the client
 		req.Header.Add("X-Access-Token", fmt.Sprintf("%s:%s", m.config.Username, m.config.Token))
 	}
 	req.Header.Set("User-Agent", "shipyard-cli")
+}
+
+func (m *Manager) doRequest(path string, method string, expectedStatus int, b []byte) (*http.Response, error) {
+	url := m.buildUrl(path)
+	buf := bytes.NewBuffer(b)
+	client, err := m.httpClient(url)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, buf)
+	if err != nil {
+		return nil, err
+	}
+	m.setHeaders(req)
 
-	client := &http.Client{Transport: transport}
 	//resp, err := http.DefaultClient.Do(req)
 	resp, err := client.Do(req)
 	if err != nil {
@@ -117,50 +162,129 @@ func (m *Manager) Run(image *citadel.Image, count int, pull bool) ([]*citadel.Co
 	return containers, nil
 }
 
-func (m *Manager) Destroy(container *citadel.Container) error {
-	b, err := json.Marshal(container)
+// RunAsync runs containers as an operation and returns without waiting.
+// With atomic the started containers are removed if any instance fails.
+func (m *Manager) RunAsync(image *citadel.Image, count int, pull bool, atomic bool) (*shipyard.Operation, error) {
+	b, err := json.Marshal(image)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s", container.ID), "DELETE", 204, b); err != nil {
+	resp, err := m.doRequest(fmt.Sprintf("/api/containers?count=%d&pull=%v&atomic=%v&async=true", count, pull, atomic), "POST", 202, b)
+	if err != nil {
+		return nil, err
+	}
+	return decodeOperation(resp)
+}
+
+func (m *Manager) Destroy(container *citadel.Container) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s", container.ID), "DELETE", 204, nil); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (m *Manager) Stop(container *citadel.Container) error {
-	b, err := json.Marshal(container)
-	if err != nil {
-		return err
-	}
-	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s/stop", container.ID), "GET", 204, b); err != nil {
+	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s/stop", container.ID), "GET", 204, nil); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (m *Manager) Restart(container *citadel.Container) error {
-	b, err := json.Marshal(container)
-	if err != nil {
+	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s/restart", container.ID), "GET", 204, nil); err != nil {
 		return err
 	}
-	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s/restart", container.ID), "GET", 204, b); err != nil {
+	return nil
+}
+
+func (m *Manager) Scale(container *citadel.Container, count int) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s/scale?count=%d", container.ID, count), "GET", 204, nil); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (m *Manager) Scale(container *citadel.Container, count int) error {
-	b, err := json.Marshal(container)
+// ScaleAsync scales a container as an operation and returns without waiting
+func (m *Manager) ScaleAsync(container *citadel.Container, count int) (*shipyard.Operation, error) {
+	resp, err := m.doRequest(fmt.Sprintf("/api/containers/%s/scale?count=%d&async=true", container.ID, count), "GET", 202, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return decodeOperation(resp)
+}
+
+// PullImage pulls an image on every engine as an operation
+func (m *Manager) PullImage(image string) (*shipyard.Operation, error) {
+	v := url.Values{}
+	v.Set("image", image)
+	resp, err := m.doRequest(fmt.Sprintf("/api/images/pull?%s", v.Encode()), "POST", 202, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeOperation(resp)
+}
+
+func (m *Manager) Operations() ([]*shipyard.Operation, error) {
+	ops := []*shipyard.Operation{}
+	resp, err := m.doRequest("/api/operations", "GET", 200, nil)
+	if err != nil {
+		return nil, err
 	}
-	if _, err := m.doRequest(fmt.Sprintf("/api/containers/%s/scale?count=%d", container.ID, count), "GET", 204, b); err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(&ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func (m *Manager) Operation(id string) (*shipyard.Operation, error) {
+	resp, err := m.doRequest(fmt.Sprintf("/api/operations/%s", id), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeOperation(resp)
+}
+
+func (m *Manager) CancelOperation(id string) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/operations/%s", id), "DELETE", 204, nil); err != nil {
 		return err
 	}
 	return nil
 }
 
+// WatchOperation calls fn with every update of the operation until it
+// finishes and returns the finished operation
+func (m *Manager) WatchOperation(id string, fn func(op *shipyard.Operation)) (*shipyard.Operation, error) {
+	resp, err := m.doRequest(fmt.Sprintf("/api/operations/%s/stream", id), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var op *shipyard.Operation
+		if err := dec.Decode(&op); err != nil {
+			if err == io.EOF {
+				return nil, ErrOperationStreamClosed
+			}
+			return nil, err
+		}
+		if fn != nil {
+			fn(op)
+		}
+		if op.Done() {
+			return op, nil
+		}
+	}
+}
+
+func decodeOperation(resp *http.Response) (*shipyard.Operation, error) {
+	var op *shipyard.Operation
+	if err := json.NewDecoder(resp.Body).Decode(&op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
 func (m *Manager) Logs(container *citadel.Container, stdout bool, stderr bool) (io.ReadCloser, error) {
 	v := url.Values{}
 	if stdout {
@@ -172,19 +296,17 @@ func (m *Manager) Logs(container *citadel.Container, stdout bool, stderr bool) (
 
 	path := fmt.Sprintf("/api/containers/%s/logs?%s", container.ID, v.Encode())
 	url := m.buildUrl(path)
-	req, err := http.NewRequest("GET", url, nil)
+	client, err := m.httpClient(url)
 	if err != nil {
 		return nil, err
 	}
-
-	if m.config.ServiceKey != "" {
-		req.Header.Add("X-Service-Key", m.config.ServiceKey)
-	} else {
-		req.Header.Add("X-Access-Token", fmt.Sprintf("%s:%s", m.config.Username, m.config.Token))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
 	}
-	req.Header.Set("User-Agent", "shipyard-cli")
+	m.setHeaders(req)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -222,6 +344,17 @@ func (m *Manager) RemoveEngine(engine *shipyard.Engine) error {
 	return nil
 }
 
+func (m *Manager) RotateEngineCertificates(id string, certs *shipyard.EngineCertificates) error {
+	b, err := json.Marshal(certs)
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest(fmt.Sprintf("/api/engines/%s/certificates", id), "POST", 204, b); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (m *Manager) GetContainer(id string) (*citadel.Container, error) {
 	var container *citadel.Container
 	resp, err := m.doRequest(fmt.Sprintf("/api/containers/%s", id), "GET", 200, nil)
@@ -246,6 +379,24 @@ func (m *Manager) GetEngine(id string) (*shipyard.Engine, error) {
 	return engine, nil
 }
 
+// EngineHealth returns the uptime and health checks of the engine over
+// since, a duration such as 1h; empty uses the controller default
+func (m *Manager) EngineHealth(id string, since string) (*shipyard.EngineHealthHistory, error) {
+	path := fmt.Sprintf("/api/engines/%s/health", id)
+	if since != "" {
+		path += "?" + url.Values{"since": {since}}.Encode()
+	}
+	var history *shipyard.EngineHealthHistory
+	resp, err := m.doRequest(path, "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
 func (m *Manager) Info() (*shipyard.ClusterInfo, error) {
 	var info *shipyard.ClusterInfo
 	resp, err := m.doRequest("/api/cluster/info", "GET", 200, nil)
@@ -258,6 +409,18 @@ func (m *Manager) Info() (*shipyard.ClusterInfo, error) {
 	return info, nil
 }
 
+func (m *Manager) Controllers() (*shipyard.ControllerMembership, error) {
+	var controllers *shipyard.ControllerMembership
+	resp, err := m.doRequest("/api/cluster/controllers", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&controllers); err != nil {
+		return nil, err
+	}
+	return controllers, nil
+}
+
 func (m *Manager) Events() ([]*shipyard.Event, error) {
 	events := []*shipyard.Event{}
 	resp, err := m.doRequest("/api/events", "GET", 200, nil)
@@ -270,6 +433,74 @@ func (m *Manager) Events() ([]*shipyard.Event, error) {
 	return events, nil
 }
 
+// QueryEvents returns the events matching the query, newest first, and the
+// cursor of the next page if there is one
+func (m *Manager) QueryEvents(q *shipyard.EventQuery) ([]*shipyard.Event, string, error) {
+	events := []*shipyard.Event{}
+	resp, err := m.doRequest(fmt.Sprintf("/api/events?%s", q.Values().Encode()), "GET", 200, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, "", err
+	}
+	return events, resp.Header.Get("X-Next-Cursor"), nil
+}
+
+func (m *Manager) ExportEvents(q *shipyard.EventQuery) (io.ReadCloser, error) {
+	resp, err := m.doRequest(fmt.Sprintf("/api/events/export?%s", q.Values().Encode()), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (m *Manager) PurgeEvents() error {
+	if _, err := m.doRequest("/api/events", "DELETE", 204, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) AuditRecords(actor string, limit int) ([]*shipyard.AuditRecord, error) {
+	records := []*shipyard.AuditRecord{}
+	v := url.Values{}
+	if actor != "" {
+		v.Set("actor", actor)
+	}
+	if limit > 0 {
+		v.Set("limit", fmt.Sprint(limit))
+	}
+	resp, err := m.doRequest(fmt.Sprintf("/api/audit?%s", v.Encode()), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (m *Manager) ExportAudit() (io.ReadCloser, error) {
+	resp, err := m.doRequest("/api/audit/export", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (m *Manager) VerifyAudit() (*shipyard.AuditVerification, error) {
+	var result *shipyard.AuditVerification
+	resp, err := m.doRequest("/api/audit/verify", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (m *Manager) Accounts() ([]*shipyard.Account, error) {
 	accounts := []*shipyard.Account{}
 	resp, err := m.doRequest("/api/accounts", "GET", 200, nil)
@@ -306,6 +537,28 @@ func (m *Manager) Role(name string) (*shipyard.Role, error) {
 	return role, nil
 }
 
+func (m *Manager) AddRole(role *shipyard.Role) error {
+	b, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest("/api/roles", "POST", 204, b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) DeleteRole(role *shipyard.Role) error {
+	b, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest("/api/roles", "DELETE", 200, b); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (m *Manager) AddAccount(account *shipyard.Account) error {
 	b, err := json.Marshal(account)
 	if err != nil {
@@ -328,10 +581,16 @@ func (m *Manager) DeleteAccount(account *shipyard.Account) error {
 	return nil
 }
 
-func (m *Manager) Login(username, password string) (*shipyard.AuthToken, error) {
+// Login returns an auth token.  When the account uses two-factor
+// authentication and no code is given, the token only has TOTPRequired
+// set and the login must be retried with a code.
+func (m *Manager) Login(username, password, code string) (*shipyard.AuthToken, error) {
 	creds := map[string]string{}
 	creds["username"] = username
 	creds["password"] = password
+	if code != "" {
+		creds["code"] = code
+	}
 	b, err := json.Marshal(creds)
 	if err != nil {
 		return nil, err
@@ -347,6 +606,51 @@ func (m *Manager) Login(username, password string) (*shipyard.AuthToken, error)
 	return token, nil
 }
 
+func (m *Manager) SSOConfig() (*oidc.Config, error) {
+	var cfg *oidc.Config
+	resp, err := m.doRequest("/auth/sso/config", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// SSORequest starts a single sign-on; the nonce must be sent to the
+// identity provider and the state passed to SSOLogin
+func (m *Manager) SSORequest() (*shipyard.SSORequest, error) {
+	resp, err := m.doRequest("/auth/sso/request", "POST", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	var req *shipyard.SSORequest
+	if err := json.NewDecoder(resp.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (m *Manager) SSOLogin(idToken, state string) (*shipyard.SSOLogin, error) {
+	creds := map[string]string{}
+	creds["id_token"] = idToken
+	creds["state"] = state
+	b, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.doRequest("/auth/sso/token", "POST", 200, b)
+	if err != nil {
+		return nil, err
+	}
+	var login *shipyard.SSOLogin
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
 func (m *Manager) ChangePassword(password string) error {
 	creds := map[string]string{}
 	creds["password"] = password
@@ -360,6 +664,101 @@ func (m *Manager) ChangePassword(password string) error {
 	return nil
 }
 
+func (m *Manager) EnrollTOTP() (*shipyard.TOTPEnrollment, error) {
+	resp, err := m.doRequest("/account/totp/enroll", "POST", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	var enrollment *shipyard.TOTPEnrollment
+	if err := json.NewDecoder(resp.Body).Decode(&enrollment); err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+func (m *Manager) ActivateTOTP(code string) (*shipyard.RecoveryCodes, error) {
+	return m.recoveryCodes("/account/totp/activate", code)
+}
+
+func (m *Manager) RegenerateRecoveryCodes(code string) (*shipyard.RecoveryCodes, error) {
+	return m.recoveryCodes("/account/totp/recovery-codes", code)
+}
+
+func (m *Manager) recoveryCodes(path string, code string) (*shipyard.RecoveryCodes, error) {
+	b, err := json.Marshal(&shipyard.TOTPCode{Code: code})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.doRequest(path, "POST", 200, b)
+	if err != nil {
+		return nil, err
+	}
+	var codes *shipyard.RecoveryCodes
+	if err := json.NewDecoder(resp.Body).Decode(&codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (m *Manager) DisableTOTP(code string) error {
+	b, err := json.Marshal(&shipyard.TOTPCode{Code: code})
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest("/account/totp/disable", "POST", 204, b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) ResetTOTP(username string) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/accounts/%s/totp", username), "DELETE", 204, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) SetRoleTOTP(name string, required bool) error {
+	b, err := json.Marshal(map[string]bool{"required": required})
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest(fmt.Sprintf("/api/roles/%s/totp", name), "POST", 204, b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) Secrets() ([]*shipyard.Secret, error) {
+	s := []*shipyard.Secret{}
+	resp, err := m.doRequest("/api/secrets", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *Manager) SaveSecret(s *shipyard.Secret) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest("/api/secrets", "POST", 204, b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) DeleteSecret(name string) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/secrets/%s", name), "DELETE", 204, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (m *Manager) ServiceKeys() ([]*shipyard.ServiceKey, error) {
 	keys := []*shipyard.ServiceKey{}
 	resp, err := m.doRequest("/api/servicekeys", "GET", 200, nil)
@@ -372,10 +771,7 @@ func (m *Manager) ServiceKeys() ([]*shipyard.ServiceKey, error) {
 	return keys, nil
 }
 
-func (m *Manager) NewServiceKey(description string) (*shipyard.ServiceKey, error) {
-	k := &shipyard.ServiceKey{
-		Description: description,
-	}
+func (m *Manager) NewServiceKey(k *shipyard.ServiceKey) (*shipyard.ServiceKey, error) {
 	b, err := json.Marshal(k)
 	if err != nil {
 		return nil, err
@@ -425,6 +821,18 @@ func (m *Manager) AddExtension(ext *shipyard.Extension) error {
 	return nil
 }
 
+func (m *Manager) Extension(id string) (*shipyard.Extension, error) {
+	var ext *shipyard.Extension
+	resp, err := m.doRequest(fmt.Sprintf("/api/extensions/%s", id), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ext); err != nil {
+		return nil, err
+	}
+	return ext, nil
+}
+
 func (m *Manager) RemoveExtension(id string) error {
 	if _, err := m.doRequest(fmt.Sprintf("/api/extensions/%s", id), "DELETE", 204, nil); err != nil {
 		return err
@@ -463,9 +871,146 @@ func (m *Manager) NewWebhookKey(image string) (*dockerhub.WebhookKey, error) {
 	return key, nil
 }
 
+func (m *Manager) WebhookKey(id string) (*dockerhub.WebhookKey, error) {
+	var key *dockerhub.WebhookKey
+	resp, err := m.doRequest(fmt.Sprintf("/api/webhookkeys/%s", id), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 func (m *Manager) RemoveWebhookKey(key string) error {
 	if _, err := m.doRequest(fmt.Sprintf("/api/webhookkeys/%s", key), "DELETE", 204, nil); err != nil {
 		return err
 	}
 	return nil
 }
+
+func (m *Manager) JoinTokens() ([]*shipyard.JoinToken, error) {
+	tokens := []*shipyard.JoinToken{}
+	resp, err := m.doRequest("/api/jointokens", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (m *Manager) NewJoinToken(t *shipyard.JoinToken) (*shipyard.JoinToken, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.doRequest("/api/jointokens", "POST", 201, b)
+	if err != nil {
+		return nil, err
+	}
+	var token *shipyard.JoinToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (m *Manager) RemoveJoinToken(id string) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/jointokens/%s", id), "DELETE", 204, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Join adds an engine to the cluster with a join token instead of
+// credentials
+func (m *Manager) Join(req *shipyard.JoinRequest) (*shipyard.Engine, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.doRequest("/join", "POST", 201, b)
+	if err != nil {
+		return nil, err
+	}
+	var engine *shipyard.Engine
+	if err := json.NewDecoder(resp.Body).Decode(&engine); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+func (m *Manager) NotificationChannels() ([]*shipyard.NotificationChannel, error) {
+	channels := []*shipyard.NotificationChannel{}
+	resp, err := m.doRequest("/api/notifications", "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (m *Manager) AddNotificationChannel(c *shipyard.NotificationChannel) (*shipyard.NotificationChannel, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.doRequest("/api/notifications", "POST", 201, b)
+	if err != nil {
+		return nil, err
+	}
+	var channel *shipyard.NotificationChannel
+	if err := json.NewDecoder(resp.Body).Decode(&channel); err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+func (m *Manager) UpdateNotificationChannel(c *shipyard.NotificationChannel) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if _, err := m.doRequest(fmt.Sprintf("/api/notifications/%s", c.ID), "PUT", 204, b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) RemoveNotificationChannel(id string) error {
+	if _, err := m.doRequest(fmt.Sprintf("/api/notifications/%s", id), "DELETE", 204, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TestNotificationChannel sends a test event to the channel and returns
+// the delivery; a failed delivery is not an error
+func (m *Manager) TestNotificationChannel(id string) (*shipyard.NotificationDelivery, error) {
+	var delivery *shipyard.NotificationDelivery
+	resp, err := m.doRequest(fmt.Sprintf("/api/notifications/%s/test", id), "POST", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (m *Manager) NotificationDeliveries(id string) ([]*shipyard.NotificationDelivery, error) {
+	deliveries := []*shipyard.NotificationDelivery{}
+	resp, err := m.doRequest(fmt.Sprintf("/api/notifications/%s/deliveries", id), "GET", 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
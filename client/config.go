@@ -7,5 +7,8 @@ type (
 		Username      string `json:"username,omitempty"`
 		Token         string `json:"token,omitempty"`
 		AllowInsecure bool   `json:"allow_insecure,omitempty"`
+		TLSCACert     string `json:"tls_ca_cert,omitempty"`
+		TLSCert       string `json:"tls_cert,omitempty"`
+		TLSKey        string `json:"tls_key,omitempty"`
 	}
 )
@@ -0,0 +1,65 @@
+package shipyard
+
+import (
+	"time"
+)
+
+type (
+	// Controller is a controller sharing the store with the other
+	// controllers of the cluster.  Only the leader runs background checks.
+	Controller struct {
+		ID       string    `json:"id" gorethink:"id"`
+		Hostname string    `json:"hostname,omitempty" gorethink:"hostname,omitempty"`
+		Version  string    `json:"version,omitempty" gorethink:"version,omitempty"`
+		Started  time.Time `json:"started" gorethink:"started"`
+		LastSeen time.Time `json:"last_seen" gorethink:"last_seen"`
+		Leader   bool      `json:"leader" gorethink:"-"`
+	}
+
+	// ControllerMembership lists the live controllers and the leader
+	ControllerMembership struct {
+		Leader      string        `json:"leader"`
+		Controllers []*Controller `json:"controllers"`
+	}
+
+	// ControllerHealth reports whether a controller can serve requests
+	ControllerHealth struct {
+		Status     string          `json:"status"`
+		Controller string          `json:"controller"`
+		Version    string          `json:"version"`
+		Leader     bool            `json:"leader"`
+		Store      *StoreHealth    `json:"store"`
+		Engines    *EngineSummary  `json:"engines"`
+		Workers    []*WorkerStatus `json:"workers"`
+	}
+
+	// StoreHealth is the result of a round trip to the store
+	StoreHealth struct {
+		Status       string `json:"status"`
+		ResponseTime int64  `json:"response_time"`
+		Error        string `json:"error,omitempty"`
+	}
+
+	// EngineSummary counts the engines by their last health check
+	EngineSummary struct {
+		Total   int `json:"total"`
+		Up      int `json:"up"`
+		Down    int `json:"down"`
+		Unknown int `json:"unknown"`
+	}
+
+	// WorkerStatus is the state of a background worker.  Leader workers
+	// are idle on the other controllers.
+	WorkerStatus struct {
+		Name    string     `json:"name"`
+		Leader  bool       `json:"leader"`
+		Running bool       `json:"running"`
+		Started time.Time  `json:"started"`
+		Stopped *time.Time `json:"stopped,omitempty"`
+	}
+)
+
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
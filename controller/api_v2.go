@@ -0,0 +1,1058 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+	"github.com/shipyard/shipyard/dockerhub"
+	"github.com/shipyard/shipyard/notify"
+)
+
+// The v2 api uses POST for actions, returns JSON error bodies with
+// machine readable codes and paginates list endpoints.  The v1 routes
+// are kept for compatibility.
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+	// statusUnprocessableEntity is not defined by net/http in go 1.3
+	statusUnprocessableEntity = 422
+)
+
+const (
+	codeInvalidJSON      = "invalid_json"
+	codeInvalidParameter = "invalid_parameter"
+	codeValidation       = "validation_failed"
+	codeInternal         = "internal_error"
+)
+
+type (
+	// APIError is the body of every v2 error response
+	APIError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	// ListResponse is the body of v2 list endpoints
+	ListResponse struct {
+		Items  interface{} `json:"items"`
+		Total  int         `json:"total"`
+		Limit  int         `json:"limit"`
+		Offset int         `json:"offset"`
+		// Next is the cursor of the next page for lists that support one
+		Next string `json:"next,omitempty"`
+	}
+
+	ScaleRequest struct {
+		Count int `json:"count"`
+	}
+
+	apiErrorMapping struct {
+		status int
+		code   string
+	}
+)
+
+// apiErrors maps manager errors to status codes and error codes
+var apiErrors = map[error]apiErrorMapping{
+	manager.ErrAccountExists:              {http.StatusConflict, "account_exists"},
+	manager.ErrAccountDoesNotExist:        {http.StatusNotFound, "account_not_found"},
+	manager.ErrRoleDoesNotExist:           {http.StatusNotFound, "role_not_found"},
+	manager.ErrServiceKeyDoesNotExist:     {http.StatusNotFound, "service_key_not_found"},
+	manager.ErrImageNotAllowed:            {http.StatusForbidden, "image_not_allowed"},
+	manager.ErrSecretNotAllowed:           {http.StatusForbidden, "secret_not_allowed"},
+	manager.ErrExtensionDoesNotExist:      {http.StatusNotFound, "extension_not_found"},
+	manager.ErrWebhookKeyDoesNotExist:     {http.StatusNotFound, "webhook_key_not_found"},
+	manager.ErrEngineDoesNotExist:         {http.StatusNotFound, "engine_not_found"},
+	manager.ErrSecretDoesNotExist:         {http.StatusNotFound, "secret_not_found"},
+	manager.ErrSecretsNotConfigured:       {http.StatusServiceUnavailable, "secrets_not_configured"},
+	manager.ErrCommonNameExists:           {http.StatusConflict, "common_name_exists"},
+	manager.ErrTOTPNotEnrolled:            {http.StatusConflict, "totp_not_enrolled"},
+	manager.ErrTOTPAlreadyEnabled:         {http.StatusConflict, "totp_already_enabled"},
+	manager.ErrInvalidTOTPCode:            {statusUnprocessableEntity, "invalid_totp_code"},
+	shipyard.ErrInvalidSecretName:         {statusUnprocessableEntity, "invalid_secret_name"},
+	shipyard.ErrInvalidCACertificate:      {statusUnprocessableEntity, "invalid_ca_certificate"},
+	manager.ErrClientCertificateNotMapped: {http.StatusUnauthorized, "certificate_not_mapped"},
+	manager.ErrOperationDoesNotExist:      {http.StatusNotFound, "operation_not_found"},
+	manager.ErrOperationFinished:          {http.StatusConflict, "operation_finished"},
+	manager.ErrOperationNotAllowed:        {http.StatusForbidden, "operation_not_allowed"},
+	manager.ErrJoinTokenDoesNotExist:      {http.StatusNotFound, "join_token_not_found"},
+	manager.ErrEngineCapacityUnknown:      {statusUnprocessableEntity, "engine_capacity_unknown"},
+	manager.ErrInvalidJoinTokenTTL:        {statusUnprocessableEntity, "invalid_join_token_ttl"},
+	manager.ErrInvalidCount:               {statusUnprocessableEntity, codeValidation},
+	shipyard.ErrInvalidEventCursor:        {http.StatusBadRequest, codeInvalidParameter},
+
+	// notification channels
+	manager.ErrNotificationChannelDoesNotExist: {http.StatusNotFound, "notification_channel_not_found"},
+	shipyard.ErrInvalidNotificationType:        {statusUnprocessableEntity, "invalid_notification_channel"},
+	shipyard.ErrNotificationNameRequired:       {statusUnprocessableEntity, "invalid_notification_channel"},
+	shipyard.ErrNotificationURLRequired:        {statusUnprocessableEntity, "invalid_notification_channel"},
+	shipyard.ErrNotificationSMTPRequired:       {statusUnprocessableEntity, "invalid_notification_channel"},
+	shipyard.ErrNotificationRulesRequired:      {statusUnprocessableEntity, "invalid_notification_channel"},
+}
+
+// middlewareError writes the errors of the auth and access middleware and
+// of unknown api routes; v2 clients receive json errors
+func middlewareError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if !strings.HasPrefix(r.URL.Path, "/api/v2/") {
+		http.Error(w, msg, status)
+		return
+	}
+	code := "forbidden"
+	switch {
+	case status == http.StatusUnauthorized:
+		code = "unauthorized"
+	case status == http.StatusNotFound:
+		code = "not_found"
+	case msg == manager.ErrPasswordChangeRequired.Error():
+		code = "password_change_required"
+	case msg == manager.ErrTOTPEnrollmentRequired.Error():
+		code = "totp_enrollment_required"
+	}
+	writeAPIError(w, status, code, msg)
+}
+
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	middlewareError(w, r, http.StatusNotFound, "404 page not found")
+}
+
+// errNotFound is returned by lookups that return nil without an error
+type errNotFound string
+
+func (e errNotFound) Error() string {
+	return string(e) + " does not exist"
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&APIError{Code: code, Message: message}); err != nil {
+		logger.Error(err)
+	}
+}
+
+// apiError writes the error with the status and code mapped from it;
+// unknown errors are internal errors
+func apiError(w http.ResponseWriter, err error) {
+	if m, ok := apiErrors[err]; ok {
+		writeAPIError(w, m.status, m.code, err.Error())
+		return
+	}
+	switch e := err.(type) {
+	case *shipyard.PasswordPolicyError:
+		writeAPIError(w, statusUnprocessableEntity, "password_policy", e.Error())
+		return
+	case *notify.TemplateError:
+		writeAPIError(w, statusUnprocessableEntity, "invalid_notification_template", e.Error())
+		return
+	case errNotFound:
+		writeAPIError(w, http.StatusNotFound, strings.Replace(string(e), " ", "_", -1)+"_not_found", e.Error())
+		return
+	}
+	logger.Errorf("api error: %s", err)
+	writeAPIError(w, http.StatusInternalServerError, codeInternal, err.Error())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error(err)
+	}
+}
+
+// decodeJSON decodes the request body and writes a 400 if it is invalid
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidJSON, err.Error())
+		return false
+	}
+	return true
+}
+
+// intParam returns the integer query parameter or the default and writes
+// a 400 if it is invalid
+func intParam(w http.ResponseWriter, r *http.Request, name string, def int) (int, bool) {
+	v := r.FormValue(name)
+	if v == "" {
+		return def, true
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("%s must be a non-negative integer", name))
+		return 0, false
+	}
+	return i, true
+}
+
+// page returns the limit and offset query parameters
+func page(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, ok := intParam(w, r, "limit", defaultPageLimit)
+	if !ok {
+		return 0, 0, false
+	}
+	if limit == 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	offset, ok := intParam(w, r, "offset", 0)
+	if !ok {
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+// pageBounds returns the slice bounds of the page for total items
+func pageBounds(total int, limit int, offset int) (int, int) {
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
+
+func writeList(w http.ResponseWriter, items interface{}, total int, limit int, offset int) {
+	writeJSON(w, http.StatusOK, &ListResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func v2Container(w http.ResponseWriter, r *http.Request) *citadel.Container {
+	id := mux.Vars(r)["id"]
+	container, err := controllerManager.Container(id)
+	if err != nil {
+		apiError(w, err)
+		return nil
+	}
+	if container == nil {
+		apiError(w, errNotFound("container"))
+		return nil
+	}
+	return container
+}
+
+func v2Containers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	image := r.FormValue("image")
+	state := r.FormValue("state")
+	engine := r.FormValue("engine")
+	all := controllerManager.Containers(true)
+	containers := []*citadel.Container{}
+	for _, c := range all {
+		if image != "" && (c.Image == nil || !strings.HasPrefix(c.Image.Name, image)) {
+			continue
+		}
+		if state != "" && c.State != state {
+			continue
+		}
+		if engine != "" && (c.Engine == nil || c.Engine.ID != engine) {
+			continue
+		}
+		containers = append(containers, c)
+	}
+	start, end := pageBounds(len(containers), limit, offset)
+	writeList(w, containers[start:end], len(containers), limit, offset)
+}
+
+func v2Run(w http.ResponseWriter, r *http.Request) {
+	count, ok := intParam(w, r, "count", 1)
+	if !ok {
+		return
+	}
+	pull := false
+	if p := r.FormValue("pull"); p != "" {
+		pv, err := strconv.ParseBool(p)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, codeInvalidParameter, "pull must be a boolean")
+			return
+		}
+		pull = pv
+	}
+	atomic := false
+	if a := r.FormValue("atomic"); a != "" {
+		av, err := strconv.ParseBool(a)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, codeInvalidParameter, "atomic must be a boolean")
+			return
+		}
+		atomic = av
+	}
+	var image *citadel.Image
+	if !decodeJSON(w, r, &image) {
+		return
+	}
+	if image == nil || image.Name == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "name is required")
+		return
+	}
+	if count < 1 {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "count must be at least 1")
+		return
+	}
+	if !manager.RequestIdentity(r).AllowsImage(image.Name) {
+		apiError(w, manager.ErrImageNotAllowed)
+		return
+	}
+	if err := controllerManager.CheckSecrets(manager.RequestIdentity(r), image); err != nil {
+		apiError(w, err)
+		return
+	}
+	if image.Privileged && privilegedTOTP && !manager.RequestIdentity(r).SecondFactor() {
+		writeAPIError(w, http.StatusForbidden, "totp_required", "two-factor authentication is required to run privileged containers")
+		return
+	}
+	op := controllerManager.RunOperation(image, count, manager.RunOptions{Pull: pull, Atomic: atomic}, requestActor(r))
+	logger.Infof("running %d %s: operation %s", count, image.Name, op.ID)
+	writeOperation(w, op, "/api/v2")
+}
+
+func v2InspectContainer(w http.ResponseWriter, r *http.Request) {
+	if c := v2Container(w, r); c != nil {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+func v2DestroyContainer(w http.ResponseWriter, r *http.Request) {
+	c := v2Container(w, r)
+	if c == nil {
+		return
+	}
+	if err := controllerManager.Destroy(c); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("destroyed container %s (%s)", c.ID, c.Image.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2StopContainer(w http.ResponseWriter, r *http.Request) {
+	c := v2Container(w, r)
+	if c == nil {
+		return
+	}
+	if err := controllerManager.Stop(c); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("stopped container %s (%s)", c.ID, c.Image.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2RestartContainer(w http.ResponseWriter, r *http.Request) {
+	c := v2Container(w, r)
+	if c == nil {
+		return
+	}
+	if err := controllerManager.Restart(c, 10); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("restarted container %s (%s)", c.ID, c.Image.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2ScaleContainer(w http.ResponseWriter, r *http.Request) {
+	var req *ScaleRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req == nil || req.Count < 0 {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "count must not be negative")
+		return
+	}
+	c := v2Container(w, r)
+	if c == nil {
+		return
+	}
+	if !manager.RequestIdentity(r).AllowsImage(c.Image.Name) {
+		apiError(w, manager.ErrImageNotAllowed)
+		return
+	}
+	if err := controllerManager.CheckSecrets(manager.RequestIdentity(r), c.Image); err != nil {
+		apiError(w, err)
+		return
+	}
+	op := controllerManager.ScaleOperation(c, req.Count, requestActor(r))
+	logger.Infof("scaling container %s (%s) to %d: operation %s", c.ID, c.Image.Name, req.Count, op.ID)
+	writeOperation(w, op, "/api/v2")
+}
+
+func v2ContainerLogs(w http.ResponseWriter, r *http.Request) {
+	c := v2Container(w, r)
+	if c == nil {
+		return
+	}
+	if err := writeContainerLogs(w, c); err != nil {
+		apiError(w, err)
+	}
+}
+
+func v2Engines(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	label := r.FormValue("label")
+	health := r.FormValue("health")
+	engines := []*shipyard.Engine{}
+	for _, e := range controllerManager.Engines() {
+		if label != "" && !hasString(e.Engine.Labels, label) {
+			continue
+		}
+		if health != "" && (e.Health == nil || e.Health.Status != health) {
+			continue
+		}
+		engines = append(engines, e.Redacted())
+	}
+	start, end := pageBounds(len(engines), limit, offset)
+	writeList(w, engines[start:end], len(engines), limit, offset)
+}
+
+func v2AddEngine(w http.ResponseWriter, r *http.Request) {
+	var engine *shipyard.Engine
+	if !decodeJSON(w, r, &engine) {
+		return
+	}
+	if engine == nil || engine.Engine == nil || engine.Engine.ID == "" || engine.Engine.Addr == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "engine id and addr are required")
+		return
+	}
+	if controllerManager.Engine(engine.Engine.ID) != nil {
+		writeAPIError(w, http.StatusConflict, "engine_exists", "engine already exists")
+		return
+	}
+	engine.Health = &shipyard.Health{
+		Status:       "pending",
+		ResponseTime: 0,
+	}
+	if err := controllerManager.AddEngine(engine, requestActor(r)); err != nil {
+		if _, ok := apiErrors[err]; ok {
+			apiError(w, err)
+			return
+		}
+		// the engine could not be reached with the given address and certificates
+		writeAPIError(w, statusUnprocessableEntity, "engine_unreachable", err.Error())
+		return
+	}
+	logger.Infof("added engine id=%s addr=%s cpus=%f memory=%f", engine.Engine.ID, engine.Engine.Addr, engine.Engine.Cpus, engine.Engine.Memory)
+	writeJSON(w, http.StatusCreated, engine.Redacted())
+}
+
+func v2InspectEngine(w http.ResponseWriter, r *http.Request) {
+	engine := controllerManager.Engine(mux.Vars(r)["id"])
+	if engine == nil {
+		apiError(w, manager.ErrEngineDoesNotExist)
+		return
+	}
+	writeJSON(w, http.StatusOK, engine.Redacted())
+}
+
+func v2EngineHealth(w http.ResponseWriter, r *http.Request) {
+	since, limit, err := healthParams(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	history, err := controllerManager.EngineHealth(mux.Vars(r)["id"], since, limit)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+func v2RemoveEngine(w http.ResponseWriter, r *http.Request) {
+	engine := controllerManager.Engine(mux.Vars(r)["id"])
+	if engine == nil {
+		apiError(w, manager.ErrEngineDoesNotExist)
+		return
+	}
+	if err := controllerManager.RemoveEngine(engine.ID, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("removed engine id=%s", engine.Engine.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2RotateEngineCertificates(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var certs *shipyard.EngineCertificates
+	if !decodeJSON(w, r, &certs) {
+		return
+	}
+	if certs == nil {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "certificates are required")
+		return
+	}
+	if err := controllerManager.RotateEngineCertificates(id, certs, requestActor(r)); err != nil {
+		if _, ok := apiErrors[err]; ok {
+			apiError(w, err)
+			return
+		}
+		writeAPIError(w, statusUnprocessableEntity, "invalid_certificates", err.Error())
+		return
+	}
+	logger.Infof("rotated certificates for engine %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2ClusterInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, controllerManager.ClusterInfo())
+}
+
+func v2ClusterControllers(w http.ResponseWriter, r *http.Request) {
+	controllers, err := controllerManager.Controllers()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, controllers)
+}
+
+func v2JoinTokens(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := controllerManager.JoinTokens()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	start, end := pageBounds(len(tokens), limit, offset)
+	writeList(w, tokens[start:end], len(tokens), limit, offset)
+}
+
+func v2AddJoinToken(w http.ResponseWriter, r *http.Request) {
+	var t *shipyard.JoinToken
+	if !decodeJSON(w, r, &t) {
+		return
+	}
+	if t == nil {
+		t = &shipyard.JoinToken{}
+	}
+	token, err := controllerManager.NewJoinToken(t, requestActor(r))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("created join token id=%s labels=%s expires=%s", token.ID, strings.Join(token.Labels, ","), token.Expires)
+	writeJSON(w, http.StatusCreated, token)
+}
+
+func v2RemoveJoinToken(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := controllerManager.RemoveJoinToken(id, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("removed join token id=%s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2NotificationChannels(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	all, err := controllerManager.NotificationChannels()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	channels := []*shipyard.NotificationChannel{}
+	for _, c := range all {
+		channels = append(channels, c.Redacted())
+	}
+	start, end := pageBounds(len(channels), limit, offset)
+	writeList(w, channels[start:end], len(channels), limit, offset)
+}
+
+func v2NotificationChannel(w http.ResponseWriter, r *http.Request) {
+	c, err := controllerManager.NotificationChannel(mux.Vars(r)["id"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Redacted())
+}
+
+func v2AddNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var c *shipyard.NotificationChannel
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if c == nil {
+		c = &shipyard.NotificationChannel{}
+	}
+	if err := controllerManager.AddNotificationChannel(c, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("added notification channel id=%s name=%s type=%s", c.ID, c.Name, c.Type)
+	writeJSON(w, http.StatusCreated, c.Redacted())
+}
+
+func v2UpdateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var c *shipyard.NotificationChannel
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if c == nil {
+		c = &shipyard.NotificationChannel{}
+	}
+	c.ID = mux.Vars(r)["id"]
+	if err := controllerManager.UpdateNotificationChannel(c, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("updated notification channel id=%s name=%s", c.ID, c.Name)
+	writeJSON(w, http.StatusOK, c.Redacted())
+}
+
+func v2RemoveNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := controllerManager.RemoveNotificationChannel(id, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("removed notification channel id=%s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2TestNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	d, err := controllerManager.TestNotificationChannel(mux.Vars(r)["id"], requestActor(r))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func v2NotificationDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	status := r.FormValue("status")
+	all, err := controllerManager.NotificationDeliveries(mux.Vars(r)["id"], -1)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	deliveries := []*shipyard.NotificationDelivery{}
+	for _, d := range all {
+		if status != "" && d.Status != status {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	start, end := pageBounds(len(deliveries), limit, offset)
+	writeList(w, deliveries[start:end], len(deliveries), limit, offset)
+}
+
+// v2Events pages through the events newest first, by offset or by the
+// cursor returned in next
+func v2Events(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	q, err := shipyard.ParseEventQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	q.Limit = offset + limit
+	events, next, err := controllerManager.QueryEvents(q)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	total, err := controllerManager.CountEvents(q)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	start, _ := pageBounds(len(events), limit, offset)
+	writeJSON(w, http.StatusOK, &ListResponse{
+		Items:  events[start:],
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+		Next:   next,
+	})
+}
+
+func v2PurgeEvents(w http.ResponseWriter, r *http.Request) {
+	if err := controllerManager.PurgeEvents(); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Info("cluster events purged")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2Accounts(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	role := r.FormValue("role")
+	all, err := controllerManager.Accounts()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	accounts := []*shipyard.Account{}
+	for _, a := range all {
+		if role != "" && (a.Role == nil || a.Role.Name != role) {
+			continue
+		}
+		accounts = append(accounts, a.Redacted())
+	}
+	start, end := pageBounds(len(accounts), limit, offset)
+	writeList(w, accounts[start:end], len(accounts), limit, offset)
+}
+
+func v2Account(w http.ResponseWriter, r *http.Request) {
+	account, err := controllerManager.Account(mux.Vars(r)["username"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, account.Redacted())
+}
+
+func v2AddAccount(w http.ResponseWriter, r *http.Request) {
+	var account *shipyard.Account
+	if !decodeJSON(w, r, &account) {
+		return
+	}
+	if account == nil || account.Username == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "username is required")
+		return
+	}
+	if account.Role != nil && account.Role.Name != "" {
+		if _, err := controllerManager.Role(account.Role.Name); err != nil {
+			apiError(w, err)
+			return
+		}
+	}
+	if _, err := controllerManager.Account(account.Username); err == nil {
+		apiError(w, manager.ErrAccountExists)
+		return
+	} else if err != manager.ErrAccountDoesNotExist {
+		apiError(w, err)
+		return
+	}
+	if err := controllerManager.SaveAccount(account, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("saved account %s", account.Username)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func v2DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := controllerManager.Account(mux.Vars(r)["username"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	if err := controllerManager.DeleteAccount(account, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("deleted account %s (%s)", account.Username, account.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2Roles(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	roles, err := controllerManager.Roles()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	start, end := pageBounds(len(roles), limit, offset)
+	writeList(w, roles[start:end], len(roles), limit, offset)
+}
+
+func v2Role(w http.ResponseWriter, r *http.Request) {
+	role, err := controllerManager.Role(mux.Vars(r)["name"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+func v2AddRole(w http.ResponseWriter, r *http.Request) {
+	var role *shipyard.Role
+	if !decodeJSON(w, r, &role) {
+		return
+	}
+	if role == nil || role.Name == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "name is required")
+		return
+	}
+	if _, err := controllerManager.Role(role.Name); err == nil {
+		writeAPIError(w, http.StatusConflict, "role_exists", "role already exists")
+		return
+	} else if err != manager.ErrRoleDoesNotExist {
+		apiError(w, err)
+		return
+	}
+	if err := controllerManager.SaveRole(role, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("saved role %s", role.Name)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func v2DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role, err := controllerManager.Role(mux.Vars(r)["name"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	if err := controllerManager.DeleteRole(role, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("deleted role %s", role.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2ServiceKeys(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	keys, err := controllerManager.ServiceKeys()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	start, end := pageBounds(len(keys), limit, offset)
+	writeList(w, keys[start:end], len(keys), limit, offset)
+}
+
+func v2AddServiceKey(w http.ResponseWriter, r *http.Request) {
+	var k *shipyard.ServiceKey
+	if !decodeJSON(w, r, &k) {
+		return
+	}
+	if k == nil {
+		k = &shipyard.ServiceKey{}
+	}
+	key, err := controllerManager.NewServiceKey(k, requestActor(r))
+	if err != nil {
+		if _, ok := apiErrors[err]; ok {
+			apiError(w, err)
+			return
+		}
+		// invalid scopes or networks
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, err.Error())
+		return
+	}
+	logger.Infof("created service key description=%s scopes=%s", key.Description, strings.Join(key.Scopes, ","))
+	writeJSON(w, http.StatusCreated, key)
+}
+
+func v2RemoveServiceKey(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if err := controllerManager.RemoveServiceKey(key, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("removed service key %s", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2WebhookKeys(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	image := r.FormValue("image")
+	all, err := controllerManager.WebhookKeys()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	keys := []*dockerhub.WebhookKey{}
+	for _, k := range all {
+		if image != "" && k.Image != image {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	start, end := pageBounds(len(keys), limit, offset)
+	writeList(w, keys[start:end], len(keys), limit, offset)
+}
+
+func v2WebhookKey(w http.ResponseWriter, r *http.Request) {
+	key, err := controllerManager.WebhookKey(mux.Vars(r)["id"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+func v2AddWebhookKey(w http.ResponseWriter, r *http.Request) {
+	var k *dockerhub.WebhookKey
+	if !decodeJSON(w, r, &k) {
+		return
+	}
+	if k == nil || k.Image == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "image is required")
+		return
+	}
+	key, err := controllerManager.NewWebhookKey(k.Image, requestActor(r))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("saved webhook key image=%s", key.Image)
+	writeJSON(w, http.StatusCreated, key)
+}
+
+func v2DeleteWebhookKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := controllerManager.DeleteWebhookKey(id, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("removed webhook key id=%s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2Extensions(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	exts, err := controllerManager.Extensions()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	start, end := pageBounds(len(exts), limit, offset)
+	writeList(w, exts[start:end], len(exts), limit, offset)
+}
+
+func v2Extension(w http.ResponseWriter, r *http.Request) {
+	ext, err := controllerManager.Extension(mux.Vars(r)["id"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ext)
+}
+
+func v2AddExtension(w http.ResponseWriter, r *http.Request) {
+	var ext *shipyard.Extension
+	if !decodeJSON(w, r, &ext) {
+		return
+	}
+	if ext == nil || ext.Name == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "name is required")
+		return
+	}
+	op, err := controllerManager.RegisterExtensionOperation(ext, requestActor(r))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("saved extension name=%s version=%s author=%s: operation %s", ext.Name, ext.Version, ext.Author, op.ID)
+	writeOperation(w, op, "/api/v2")
+}
+
+func v2DeleteExtension(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := controllerManager.DeleteExtension(id); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("removed extension %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2Secrets(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	s, err := controllerManager.Secrets()
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	start, end := pageBounds(len(s), limit, offset)
+	writeList(w, s[start:end], len(s), limit, offset)
+}
+
+func v2AddSecret(w http.ResponseWriter, r *http.Request) {
+	var s *shipyard.Secret
+	if !decodeJSON(w, r, &s) {
+		return
+	}
+	if s == nil || s.Value == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "value is required")
+		return
+	}
+	if err := controllerManager.SaveSecret(s, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("saved secret %s", s.Name)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func v2DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := controllerManager.DeleteSecret(name, requestActor(r)); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("deleted secret %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func hasString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// registerV2Routes adds the /api/v2 routes to the api router
+func registerV2Routes(router *mux.Router) {
+	register(router, v2Routes())
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+)
+
+func TestAPIErrorMapping(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{manager.ErrEngineDoesNotExist, http.StatusNotFound, "engine_not_found"},
+		{manager.ErrAccountExists, http.StatusConflict, "account_exists"},
+		{shipyard.ErrPasswordNoUpper, statusUnprocessableEntity, "password_policy"},
+		{errNotFound("container"), http.StatusNotFound, "container_not_found"},
+		{errors.New("boom"), http.StatusInternalServerError, codeInternal},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		apiError(w, test.err)
+		if w.Code != test.status {
+			t.Errorf("expected status %d for %q; received %d", test.status, test.err, w.Code)
+		}
+		var body APIError
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != test.code || body.Message != test.err.Error() {
+			t.Errorf("unexpected error body for %q: %+v", test.err, body)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/api/v2/events?limit=10&offset=20", nil)
+	limit, offset, ok := page(httptest.NewRecorder(), r)
+	if !ok || limit != 10 || offset != 20 {
+		t.Errorf("expected limit 10 offset 20; received %d %d", limit, offset)
+	}
+	r, _ = http.NewRequest("GET", "/api/v2/events?limit=abc", nil)
+	w := httptest.NewRecorder()
+	if _, _, ok := page(w, r); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit; received %d", w.Code)
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	if start, end := pageBounds(25, 10, 20); start != 20 || end != 25 {
+		t.Errorf("expected 20:25; received %d:%d", start, end)
+	}
+	if start, end := pageBounds(5, 10, 20); start != 5 || end != 5 {
+		t.Errorf("expected an empty page past the end; received %d:%d", start, end)
+	}
+}
+
+func TestCancelOperationActor(t *testing.T) {
+	c := newMemController("shipyard")
+	defer func(m Controller) { controllerManager = m }(controllerManager)
+	controllerManager = c
+
+	user := &shipyard.Account{Username: "jdoe", Role: &shipyard.Role{Name: "user"}}
+	admin := &shipyard.Account{Username: "admin", Role: &shipyard.Role{Name: "admin"}}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v2/operations/{id}/cancel", v2CancelOperation)
+	cancel := func(acct *shipyard.Account, op *shipyard.Operation) int {
+		r, _ := http.NewRequest("POST", "/api/v2/operations/"+op.ID+"/cancel", nil)
+		manager.SetIdentity(r, manager.NewAccountIdentity(acct))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	adminOp := c.PullOperation("nginx", "admin")
+	if code := cancel(user, adminOp); code != http.StatusForbidden {
+		t.Errorf("expected a user to be refused cancelling an admin operation; received %d", code)
+	}
+	if code := cancel(user, c.PullOperation("nginx", "jdoe")); code != http.StatusNoContent {
+		t.Errorf("expected a user to cancel their operation; received %d", code)
+	}
+	if code := cancel(admin, adminOp); code != http.StatusNoContent {
+		t.Errorf("expected an admin to cancel any operation; received %d", code)
+	}
+}
+
+func TestRunSecretACL(t *testing.T) {
+	c := newMemController("shipyard")
+	defer func(m Controller) { controllerManager = m }(controllerManager)
+	controllerManager = c
+	if err := c.SaveSecret(&shipyard.Secret{Name: "db", Value: "s3cret", Roles: []string{"admin"}}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(id *manager.Identity) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/api/v2/containers", strings.NewReader(`{"name":"nginx","environment":{"DB_PASS":"secret:db"}}`))
+		manager.SetIdentity(r, id)
+		w := httptest.NewRecorder()
+		v2Run(w, r)
+		return w
+	}
+	w := run(manager.NewAccountIdentity(&shipyard.Account{Username: "jdoe", Role: &shipyard.Role{Name: "user"}}))
+	var e APIError
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil || w.Code != http.StatusForbidden || e.Code != "secret_not_allowed" {
+		t.Errorf("expected a user to be refused the secret; received %d %+v", w.Code, e)
+	}
+	w = run(manager.NewServiceKeyIdentity(&shipyard.ServiceKey{Key: "ci"}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a service key outside the acl to be refused; received %d", w.Code)
+	}
+	w = run(manager.NewAccountIdentity(&shipyard.Account{Username: "admin", Role: &shipyard.Role{Name: "admin"}}))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected an admin to run with the secret; received %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		msg    string
+		code   string
+	}{
+		{"/api/v2/containers", http.StatusUnauthorized, "unauthorized", "unauthorized"},
+		{"/api/v2/accounts", http.StatusForbidden, "access denied", "forbidden"},
+		{"/api/v2/containers", http.StatusForbidden, manager.ErrTOTPEnrollmentRequired.Error(), "totp_enrollment_required"},
+		{"/api/v2/unknown", http.StatusNotFound, "404 page not found", "not_found"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		middlewareError(w, r, test.status, test.msg)
+		var body APIError
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("expected a json error for %s: %s", test.path, err)
+		}
+		if w.Code != test.status || body.Code != test.code || body.Message != test.msg {
+			t.Errorf("unexpected error for %s: %d %+v", test.path, w.Code, body)
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/api/containers", nil)
+	w := httptest.NewRecorder()
+	middlewareError(w, r, http.StatusUnauthorized, "unauthorized")
+	if ct := w.Header().Get("content-type"); strings.Contains(ct, "json") {
+		t.Errorf("expected a plain text error for the v1 api; received %s", ct)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/gorilla/sessions"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+	"github.com/shipyard/shipyard/dockerhub"
+)
+
+// Controller is the part of the manager used by the api handlers.  It is
+// satisfied by *manager.Manager; the conformance tests serve the handlers
+// from an in-memory controller.
+type Controller interface {
+	Store() *sessions.CookieStore
+	Health() *shipyard.ControllerHealth
+	Close() error
+
+	// accounts and roles
+	Login(username, password, code, addr string) (*shipyard.Account, error)
+	NewAuthToken(username string, userAgent string, multiFactor bool) (*shipyard.AuthToken, error)
+	SSOAccount(identity string, username string, roleName string) (*shipyard.Account, error)
+	ChangePassword(username, password string) error
+	Account(username string) (*shipyard.Account, error)
+	Accounts() ([]*shipyard.Account, error)
+	SaveAccount(account *shipyard.Account, actor string) error
+	DeleteAccount(account *shipyard.Account, actor string) error
+	Role(name string) (*shipyard.Role, error)
+	Roles() ([]*shipyard.Role, error)
+	SaveRole(role *shipyard.Role, actor string) error
+	DeleteRole(role *shipyard.Role, actor string) error
+	SetRoleTOTP(name string, required bool, actor string) error
+	EnrollTOTP(username string) (*shipyard.TOTPEnrollment, error)
+	ActivateTOTP(username string, code string) (*shipyard.RecoveryCodes, error)
+	RegenerateRecoveryCodes(username string, code string) (*shipyard.RecoveryCodes, error)
+	DisableTOTP(username string, code string) error
+	ResetTOTP(username string, actor string) error
+	ServiceKeys() ([]*shipyard.ServiceKey, error)
+	NewServiceKey(k *shipyard.ServiceKey, actor string) (*shipyard.ServiceKey, error)
+	RemoveServiceKey(key string, actor string) error
+	AuditRecords(q *manager.AuditQuery) ([]*shipyard.AuditRecord, error)
+	ExportAudit(fn func(*shipyard.AuditRecord) error) error
+	VerifyAudit() (int, error)
+
+	// cluster
+	ClusterInfo() *shipyard.ClusterInfo
+	Controllers() (*shipyard.ControllerMembership, error)
+	Engine(id string) *shipyard.Engine
+	Engines() []*shipyard.Engine
+	AddEngine(engine *shipyard.Engine, actor string) error
+	RemoveEngine(id string, actor string) error
+	RotateEngineCertificates(id string, certs *shipyard.EngineCertificates, actor string) error
+	EngineHealth(id string, since time.Time, limit int) (*shipyard.EngineHealthHistory, error)
+	JoinTokens() ([]*shipyard.JoinToken, error)
+	NewJoinToken(t *shipyard.JoinToken, actor string) (*shipyard.JoinToken, error)
+	RemoveJoinToken(id string, actor string) error
+	Join(req *shipyard.JoinRequest, remoteAddr string) (*shipyard.Engine, error)
+
+	// containers
+	Container(id string) (*citadel.Container, error)
+	Containers(all bool) []*citadel.Container
+	RunInstances(image *citadel.Image, count int, opts manager.RunOptions) ([]*manager.RunResult, error)
+	Scale(container *citadel.Container, count int) error
+	Stop(container *citadel.Container) error
+	Restart(container *citadel.Container, timeout int) error
+	Destroy(container *citadel.Container) error
+	Logs(container *citadel.Container, stdout bool, stderr bool) (io.ReadCloser, error)
+	SecretValues(c *citadel.Container) []string
+	CheckSecrets(id *manager.Identity, image *citadel.Image) error
+	Secrets() ([]*shipyard.Secret, error)
+	SaveSecret(s *shipyard.Secret, actor string) error
+	DeleteSecret(name string, actor string) error
+
+	// operations
+	Operation(id string) (*shipyard.Operation, error)
+	Operations() []*shipyard.Operation
+	WatchOperation(id string) (*shipyard.Operation, <-chan struct{}, error)
+	CancelOperation(id string) error
+	DrainOperations(deadline time.Time) error
+	RunOperation(image *citadel.Image, count int, opts manager.RunOptions, actor string) *shipyard.Operation
+	ScaleOperation(container *citadel.Container, count int, actor string) *shipyard.Operation
+	PullOperation(image string, actor string) *shipyard.Operation
+	RedeployOperation(image string, actor string) *shipyard.Operation
+	RegisterExtensionOperation(ext *shipyard.Extension, actor string) (*shipyard.Operation, error)
+
+	// extensions and webhooks
+	Extension(id string) (*shipyard.Extension, error)
+	Extensions() ([]*shipyard.Extension, error)
+	SaveExtension(ext *shipyard.Extension, actor string) error
+	DeleteExtension(id string) error
+	WebhookKey(key string) (*dockerhub.WebhookKey, error)
+	WebhookKeys() ([]*dockerhub.WebhookKey, error)
+	NewWebhookKey(image string, actor string) (*dockerhub.WebhookKey, error)
+	DeleteWebhookKey(id string, actor string) error
+
+	// events and notifications
+	QueryEvents(q *shipyard.EventQuery) ([]*shipyard.Event, string, error)
+	CountEvents(q *shipyard.EventQuery) (int, error)
+	ExportEvents(q *shipyard.EventQuery, fn func(*shipyard.Event) error) error
+	PurgeEvents() error
+	NotificationChannel(id string) (*shipyard.NotificationChannel, error)
+	NotificationChannels() ([]*shipyard.NotificationChannel, error)
+	AddNotificationChannel(c *shipyard.NotificationChannel, actor string) error
+	UpdateNotificationChannel(c *shipyard.NotificationChannel, actor string) error
+	RemoveNotificationChannel(id string, actor string) error
+	TestNotificationChannel(id string, actor string) (*shipyard.NotificationDelivery, error)
+	NotificationDeliveries(id string, limit int) ([]*shipyard.NotificationDelivery, error)
+}
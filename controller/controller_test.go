@@ -0,0 +1,1034 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gorilla/sessions"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+	"github.com/shipyard/shipyard/dockerhub"
+)
+
+// memController is an in-memory Controller with fake engines.  It keeps
+// the data of the store in maps and runs containers by recording them;
+// calling a method it does not implement panics.
+type memController struct {
+	Controller
+
+	mux         sync.Mutex
+	store       *sessions.CookieStore
+	operations  *manager.OperationTracker
+	lastID      int
+	accounts    map[string]*shipyard.Account
+	passwords   map[string]string
+	roles       map[string]*shipyard.Role
+	engines     map[string]*shipyard.Engine
+	containers  map[string]*citadel.Container
+	secrets     map[string]*shipyard.Secret
+	serviceKeys map[string]*shipyard.ServiceKey
+	extensions  map[string]*shipyard.Extension
+	webhookKeys map[string]*dockerhub.WebhookKey
+	joinTokens  map[string]*shipyard.JoinToken
+	channels    map[string]*shipyard.NotificationChannel
+	deliveries  []*shipyard.NotificationDelivery
+	events      []*shipyard.Event
+	audit       []*shipyard.AuditRecord
+}
+
+// newMemController returns a controller with the admin and user roles,
+// an admin account, two engines and a running container
+func newMemController(adminPassword string) *memController {
+	c := &memController{
+		store:       sessions.NewCookieStore([]byte(STORE_KEY)),
+		operations:  manager.NewOperationTracker(time.Hour),
+		accounts:    map[string]*shipyard.Account{},
+		passwords:   map[string]string{},
+		roles:       map[string]*shipyard.Role{},
+		engines:     map[string]*shipyard.Engine{},
+		containers:  map[string]*citadel.Container{},
+		secrets:     map[string]*shipyard.Secret{},
+		serviceKeys: map[string]*shipyard.ServiceKey{},
+		extensions:  map[string]*shipyard.Extension{},
+		webhookKeys: map[string]*dockerhub.WebhookKey{},
+		joinTokens:  map[string]*shipyard.JoinToken{},
+		channels:    map[string]*shipyard.NotificationChannel{},
+	}
+	for _, name := range []string{"admin", "user"} {
+		c.roles[name] = &shipyard.Role{ID: c.newID(), Name: name}
+	}
+	c.accounts["admin"] = &shipyard.Account{ID: c.newID(), Username: "admin", Role: c.roles["admin"]}
+	c.passwords["admin"] = adminPassword
+	for _, e := range []*citadel.Engine{
+		{ID: "local-01", Addr: "tcp://10.0.0.1:2375", Cpus: 4, Memory: 4096},
+		{ID: "local-02", Addr: "tcp://10.0.0.2:2375", Cpus: 2, Memory: 2048},
+	} {
+		id := c.newID()
+		c.engines[id] = &shipyard.Engine{
+			ID:     id,
+			SSLKey: "sealed",
+			Engine: e,
+			Health: &shipyard.Health{Status: "up"},
+		}
+	}
+	web := c.launch(&citadel.Image{Name: "nginx", Environment: map[string]string{"DB_PASSWORD": "s3cret"}})
+	c.events = append(c.events, &shipyard.Event{
+		ID:        c.newID(),
+		Type:      "start",
+		Container: web,
+		Engine:    web.Engine,
+		Time:      time.Now(),
+		Tags:      []string{"docker"},
+	})
+	c.audit = append(c.audit, &shipyard.AuditRecord{ID: c.newID(), Sequence: 1, Time: time.Now(), Actor: "admin", Method: "POST", Route: "/api/containers", Status: 201})
+	return c
+}
+
+// newID returns a unique id; the caller must hold the lock or own c
+func (c *memController) newID() string {
+	c.lastID++
+	return fmt.Sprintf("%012x", c.lastID)
+}
+
+// launch records a running container of the image on the first engine;
+// the caller must hold the lock or own c
+func (c *memController) launch(image *citadel.Image) *citadel.Container {
+	ids := []string{}
+	for id := range c.engines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	cnt := &citadel.Container{
+		ID:     c.newID() + "abcdef",
+		Image:  image,
+		Engine: c.engines[ids[0]].Engine,
+		State:  "running",
+	}
+	c.containers[cnt.ID] = cnt
+	return cnt
+}
+
+func (c *memController) Store() *sessions.CookieStore {
+	return c.store
+}
+
+func (c *memController) Login(username, password, code, addr string) (*shipyard.Account, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, ok := c.accounts[username]
+	if !ok || c.passwords[username] != password {
+		return nil, manager.ErrInvalidLogin
+	}
+	if acct.TOTPEnabled {
+		if code == "" {
+			return nil, manager.ErrTOTPRequired
+		}
+		if shipyard.ValidateTOTP(acct.TOTPSecret, code, time.Now()) == 0 {
+			return nil, manager.ErrInvalidTOTPCode
+		}
+	}
+	return acct, nil
+}
+
+func (c *memController) NewAuthToken(username string, userAgent string, multiFactor bool) (*shipyard.AuthToken, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return &shipyard.AuthToken{Token: c.newID(), UserAgent: userAgent, MultiFactor: multiFactor}, nil
+}
+
+func (c *memController) SSOAccount(identity string, username string, roleName string) (*shipyard.Account, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	role, ok := c.roles[roleName]
+	if !ok {
+		return nil, manager.ErrRoleDoesNotExist
+	}
+	for _, acct := range c.accounts {
+		if acct.SSOIdentity == identity {
+			acct.Role = role
+			return acct, nil
+		}
+	}
+	if _, ok := c.accounts[username]; ok {
+		return nil, manager.ErrSSOAccountConflict
+	}
+	acct := &shipyard.Account{ID: c.newID(), Username: username, Role: role, SSO: true, SSOIdentity: identity}
+	c.accounts[username] = acct
+	return acct, nil
+}
+
+func (c *memController) ChangePassword(username, password string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, ok := c.accounts[username]
+	if !ok {
+		return manager.ErrAccountDoesNotExist
+	}
+	if c.passwords[username] == password {
+		return shipyard.ErrPasswordUnchanged
+	}
+	c.passwords[username] = password
+	acct.PasswordChangeRequired = false
+	return nil
+}
+
+func (c *memController) Account(username string) (*shipyard.Account, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, ok := c.accounts[username]
+	if !ok {
+		return nil, manager.ErrAccountDoesNotExist
+	}
+	return acct, nil
+}
+
+func (c *memController) Accounts() ([]*shipyard.Account, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	accounts := []*shipyard.Account{}
+	for _, acct := range c.accounts {
+		accounts = append(accounts, acct)
+	}
+	return accounts, nil
+}
+
+func (c *memController) SaveAccount(account *shipyard.Account, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if account.Role == nil || c.roles[account.Role.Name] == nil {
+		return manager.ErrRoleDoesNotExist
+	}
+	if existing, ok := c.accounts[account.Username]; ok {
+		account.ID = existing.ID
+	} else {
+		account.ID = c.newID()
+	}
+	if account.Password != "" {
+		c.passwords[account.Username] = account.Password
+		account.Password = ""
+	}
+	account.Role = c.roles[account.Role.Name]
+	c.accounts[account.Username] = account
+	return nil
+}
+
+func (c *memController) DeleteAccount(account *shipyard.Account, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.accounts[account.Username]; !ok {
+		return manager.ErrAccountDoesNotExist
+	}
+	delete(c.accounts, account.Username)
+	delete(c.passwords, account.Username)
+	return nil
+}
+
+func (c *memController) Role(name string) (*shipyard.Role, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	role, ok := c.roles[name]
+	if !ok {
+		return nil, manager.ErrRoleDoesNotExist
+	}
+	return role, nil
+}
+
+func (c *memController) Roles() ([]*shipyard.Role, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	roles := []*shipyard.Role{}
+	for _, role := range c.roles {
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (c *memController) SaveRole(role *shipyard.Role, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	role.ID = c.newID()
+	c.roles[role.Name] = role
+	return nil
+}
+
+// DeleteRole removes the role by id like the store
+func (c *memController) DeleteRole(role *shipyard.Role, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for name, r := range c.roles {
+		if r.ID == role.ID {
+			delete(c.roles, name)
+			return nil
+		}
+	}
+	return manager.ErrRoleDoesNotExist
+}
+
+func (c *memController) SetRoleTOTP(name string, required bool, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	role, ok := c.roles[name]
+	if !ok {
+		return manager.ErrRoleDoesNotExist
+	}
+	role.RequireTOTP = required
+	return nil
+}
+
+func (c *memController) EnrollTOTP(username string) (*shipyard.TOTPEnrollment, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, ok := c.accounts[username]
+	if !ok {
+		return nil, manager.ErrAccountDoesNotExist
+	}
+	if acct.TOTPEnabled {
+		return nil, manager.ErrTOTPAlreadyEnabled
+	}
+	secret, err := shipyard.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	acct.TOTPSecret = secret
+	return &shipyard.TOTPEnrollment{Secret: secret, URI: shipyard.TOTPProvisioningURI(username, secret)}, nil
+}
+
+// totpAccount returns the account if the code matches its secret; the
+// caller must hold the lock
+func (c *memController) totpAccount(username string, code string) (*shipyard.Account, error) {
+	acct, ok := c.accounts[username]
+	if !ok {
+		return nil, manager.ErrAccountDoesNotExist
+	}
+	if acct.TOTPSecret == "" {
+		return nil, manager.ErrTOTPNotEnrolled
+	}
+	if shipyard.ValidateTOTP(acct.TOTPSecret, code, time.Now()) == 0 {
+		return nil, manager.ErrInvalidTOTPCode
+	}
+	return acct, nil
+}
+
+func (c *memController) ActivateTOTP(username string, code string) (*shipyard.RecoveryCodes, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, err := c.totpAccount(username, code)
+	if err != nil {
+		return nil, err
+	}
+	if acct.TOTPEnabled {
+		return nil, manager.ErrTOTPAlreadyEnabled
+	}
+	codes, err := shipyard.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	acct.TOTPEnabled = true
+	return &shipyard.RecoveryCodes{Codes: codes}, nil
+}
+
+func (c *memController) RegenerateRecoveryCodes(username string, code string) (*shipyard.RecoveryCodes, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, err := c.totpAccount(username, code); err != nil {
+		return nil, err
+	}
+	codes, err := shipyard.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return &shipyard.RecoveryCodes{Codes: codes}, nil
+}
+
+func (c *memController) DisableTOTP(username string, code string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, err := c.totpAccount(username, code)
+	if err != nil {
+		return err
+	}
+	acct.TOTPEnabled = false
+	acct.TOTPSecret = ""
+	return nil
+}
+
+func (c *memController) ResetTOTP(username string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	acct, ok := c.accounts[username]
+	if !ok {
+		return manager.ErrAccountDoesNotExist
+	}
+	acct.TOTPEnabled = false
+	acct.TOTPSecret = ""
+	return nil
+}
+
+func (c *memController) ServiceKeys() ([]*shipyard.ServiceKey, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	keys := []*shipyard.ServiceKey{}
+	for _, k := range c.serviceKeys {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (c *memController) NewServiceKey(k *shipyard.ServiceKey, actor string) (*shipyard.ServiceKey, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, s := range k.Scopes {
+		if err := shipyard.ValidatePermission(s); err != nil {
+			return nil, err
+		}
+	}
+	key := &shipyard.ServiceKey{
+		Key:         c.newID(),
+		Description: k.Description,
+		Scopes:      k.Scopes,
+		Images:      k.Images,
+	}
+	c.serviceKeys[key.Key] = key
+	return key, nil
+}
+
+func (c *memController) RemoveServiceKey(key string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.serviceKeys[key]; !ok {
+		return manager.ErrServiceKeyDoesNotExist
+	}
+	delete(c.serviceKeys, key)
+	return nil
+}
+
+func (c *memController) AuditRecords(q *manager.AuditQuery) ([]*shipyard.AuditRecord, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	records := []*shipyard.AuditRecord{}
+	for i := len(c.audit) - 1; i >= 0 && len(records) < q.Limit; i-- {
+		if rec := c.audit[i]; q.Actor == "" || rec.Actor == q.Actor {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func (c *memController) ExportAudit(fn func(*shipyard.AuditRecord) error) error {
+	c.mux.Lock()
+	records := append([]*shipyard.AuditRecord{}, c.audit...)
+	c.mux.Unlock()
+	for _, rec := range records {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *memController) VerifyAudit() (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.audit), nil
+}
+
+func (c *memController) ClusterInfo() *shipyard.ClusterInfo {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	info := &shipyard.ClusterInfo{
+		ContainerCount: len(c.containers),
+		EngineCount:    len(c.engines),
+		Version:        VERSION,
+	}
+	for _, e := range c.engines {
+		info.Cpus += e.Engine.Cpus
+		info.Memory += e.Engine.Memory
+	}
+	return info
+}
+
+func (c *memController) Controllers() (*shipyard.ControllerMembership, error) {
+	now := time.Now()
+	return &shipyard.ControllerMembership{
+		Leader: "controller-1",
+		Controllers: []*shipyard.Controller{
+			{ID: "controller-1", Hostname: "controller-1", Version: VERSION, Started: now, LastSeen: now, Leader: true},
+		},
+	}, nil
+}
+
+func (c *memController) Engine(id string) *shipyard.Engine {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.engines[id]
+}
+
+func (c *memController) Engines() []*shipyard.Engine {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ids := []string{}
+	for id := range c.engines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	engines := []*shipyard.Engine{}
+	for _, id := range ids {
+		engines = append(engines, c.engines[id])
+	}
+	return engines
+}
+
+func (c *memController) AddEngine(engine *shipyard.Engine, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if engine.Engine == nil || engine.Engine.ID == "" {
+		return shipyard.ErrJoinEngineRequired
+	}
+	for _, e := range c.engines {
+		if e.Engine.ID == engine.Engine.ID || e.Engine.Addr == engine.Engine.Addr {
+			return manager.ErrEngineExists
+		}
+	}
+	engine.ID = c.newID()
+	c.engines[engine.ID] = engine
+	c.events = append(c.events, &shipyard.Event{
+		Type:    "add-engine",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("addr=%s", engine.Engine.Addr),
+		Engine:  engine.Engine,
+		Actor:   actor,
+	})
+	return nil
+}
+
+func (c *memController) RemoveEngine(id string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.engines[id]; !ok {
+		return manager.ErrEngineDoesNotExist
+	}
+	delete(c.engines, id)
+	return nil
+}
+
+func (c *memController) RotateEngineCertificates(id string, certs *shipyard.EngineCertificates, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, ok := c.engines[id]
+	if !ok {
+		return manager.ErrEngineDoesNotExist
+	}
+	e.SSLCertificate = certs.SSLCertificate
+	e.SSLKey = "sealed"
+	e.CACertificate = certs.CACertificate
+	return nil
+}
+
+func (c *memController) EngineHealth(id string, since time.Time, limit int) (*shipyard.EngineHealthHistory, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, ok := c.engines[id]
+	if !ok {
+		return nil, manager.ErrEngineDoesNotExist
+	}
+	return &shipyard.EngineHealthHistory{
+		EngineID: id,
+		Health:   e.Health,
+		Since:    since,
+		Uptime:   100,
+		Checks:   []*shipyard.HealthCheck{{EngineID: id, Time: time.Now(), Status: e.Health.Status}},
+	}, nil
+}
+
+func (c *memController) JoinTokens() ([]*shipyard.JoinToken, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	tokens := []*shipyard.JoinToken{}
+	for _, t := range c.joinTokens {
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (c *memController) NewJoinToken(t *shipyard.JoinToken, actor string) (*shipyard.JoinToken, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if t.TTL < 0 || t.MaxUses < 0 {
+		return nil, manager.ErrInvalidJoinTokenTTL
+	}
+	now := time.Now()
+	token := &shipyard.JoinToken{
+		ID:            c.newID(),
+		Token:         c.newID(),
+		Description:   t.Description,
+		Labels:        t.Labels,
+		Expires:       now.Add(time.Duration(t.TTL) * time.Second),
+		MaxUses:       t.MaxUses,
+		Created:       now,
+		CACertificate: t.CACertificate,
+		Insecure:      t.Insecure,
+	}
+	c.joinTokens[token.ID] = token
+	return token, nil
+}
+
+func (c *memController) RemoveJoinToken(id string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.joinTokens[id]; !ok {
+		return manager.ErrJoinTokenDoesNotExist
+	}
+	delete(c.joinTokens, id)
+	return nil
+}
+
+func (c *memController) Join(req *shipyard.JoinRequest, remoteAddr string) (*shipyard.Engine, error) {
+	c.mux.Lock()
+	var token *shipyard.JoinToken
+	for _, t := range c.joinTokens {
+		if t.Token == req.Token {
+			token = t
+		}
+	}
+	c.mux.Unlock()
+	if token == nil {
+		return nil, manager.ErrJoinTokenDoesNotExist
+	}
+	if token.Expired(time.Now()) {
+		return nil, manager.ErrJoinTokenExpired
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	engine := req.Engine
+	engine.Health = &shipyard.Health{Status: "pending"}
+	engine.Engine.Labels = shipyard.MergeLabels(token.Labels, engine.Engine.Labels)
+	engine.CACertificate = token.CACertificate
+	engine.Insecure = token.Insecure
+	if err := c.AddEngine(engine, ""); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Container looks up containers by id prefix like the cluster
+func (c *memController) Container(id string) (*citadel.Container, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for cid, cnt := range c.containers {
+		if len(id) > 0 && len(cid) >= len(id) && cid[:len(id)] == id {
+			return cnt, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *memController) Containers(all bool) []*citadel.Container {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ids := []string{}
+	for id, cnt := range c.containers {
+		if all || cnt.State == "running" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	containers := []*citadel.Container{}
+	for _, id := range ids {
+		containers = append(containers, c.containers[id])
+	}
+	return containers
+}
+
+func (c *memController) run(image *citadel.Image, count int, task *manager.OperationTask) []*manager.RunResult {
+	results := []*manager.RunResult{}
+	for i := 1; i <= count; i++ {
+		c.mux.Lock()
+		cnt := c.launch(image)
+		c.mux.Unlock()
+		task.Result(cnt.ID, cnt.Engine.ID, nil)
+		results = append(results, &manager.RunResult{Instance: i, Container: cnt})
+	}
+	return results
+}
+
+func (c *memController) RunInstances(image *citadel.Image, count int, opts manager.RunOptions) ([]*manager.RunResult, error) {
+	return c.run(image, count, nil), nil
+}
+
+func (c *memController) scale(container *citadel.Container, count int, task *manager.OperationTask) error {
+	c.mux.Lock()
+	running := []*citadel.Container{}
+	for _, cnt := range c.containers {
+		if cnt.Image.Name == container.Image.Name {
+			running = append(running, cnt)
+		}
+	}
+	// the oldest containers are kept
+	sort.Sort(containersByID(running))
+	for i := count; i < len(running); i++ {
+		delete(c.containers, running[i].ID)
+	}
+	c.mux.Unlock()
+	if count > len(running) {
+		c.run(container.Image, count-len(running), task)
+	}
+	return nil
+}
+
+func (c *memController) Scale(container *citadel.Container, count int) error {
+	return c.scale(container, count, nil)
+}
+
+func (c *memController) Stop(container *citadel.Container) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	container.State = "stopped"
+	return nil
+}
+
+func (c *memController) Restart(container *citadel.Container, timeout int) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	container.State = "running"
+	return nil
+}
+
+func (c *memController) Destroy(container *citadel.Container) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.containers, container.ID)
+	return nil
+}
+
+// Logs returns the environment of the container as multiplexed docker
+// output
+func (c *memController) Logs(container *citadel.Container, stdout bool, stderr bool) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	w := stdcopy.NewStdWriter(&buf, stdcopy.Stdout)
+	for k, v := range container.Image.Environment {
+		fmt.Fprintf(w, "%s=%s\n", k, v)
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+// SecretValues treats every environment value as a secret
+func (c *memController) SecretValues(container *citadel.Container) []string {
+	values := []string{}
+	for _, v := range container.Image.Environment {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (c *memController) Secrets() ([]*shipyard.Secret, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	secrets := []*shipyard.Secret{}
+	for _, s := range c.secrets {
+		secrets = append(secrets, &shipyard.Secret{ID: s.ID, Name: s.Name, Roles: s.Roles, ServiceKeys: s.ServiceKeys, Created: s.Created, Updated: s.Updated})
+	}
+	return secrets, nil
+}
+
+func (c *memController) SaveSecret(s *shipyard.Secret, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err := shipyard.ValidateSecretName(s.Name); err != nil {
+		return err
+	}
+	now := time.Now()
+	c.secrets[s.Name] = &shipyard.Secret{ID: c.newID(), Name: s.Name, Value: s.Value, Roles: s.Roles, ServiceKeys: s.ServiceKeys, Created: now, Updated: now}
+	return nil
+}
+
+func (c *memController) CheckSecrets(id *manager.Identity, image *citadel.Image) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, v := range image.Environment {
+		name, ok := shipyard.ParseSecretRef(v)
+		if !ok {
+			continue
+		}
+		if s, ok := c.secrets[name]; ok && !id.AllowsSecret(s) {
+			return manager.ErrSecretNotAllowed
+		}
+	}
+	return nil
+}
+
+func (c *memController) DeleteSecret(name string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.secrets[name]; !ok {
+		return manager.ErrSecretDoesNotExist
+	}
+	delete(c.secrets, name)
+	return nil
+}
+
+func (c *memController) Operation(id string) (*shipyard.Operation, error) {
+	return c.operations.Operation(id)
+}
+
+func (c *memController) Operations() []*shipyard.Operation {
+	return c.operations.Operations()
+}
+
+func (c *memController) WatchOperation(id string) (*shipyard.Operation, <-chan struct{}, error) {
+	return c.operations.Watch(id)
+}
+
+func (c *memController) DrainOperations(deadline time.Time) error {
+	return c.operations.Drain(deadline)
+}
+
+func (c *memController) CancelOperation(id string) error {
+	return c.operations.Cancel(id)
+}
+
+func (c *memController) RunOperation(image *citadel.Image, count int, opts manager.RunOptions, actor string) *shipyard.Operation {
+	return c.operations.Start("run", image.Name, actor, func(task *manager.OperationTask) error {
+		task.SetTotal(count)
+		c.run(image, count, task)
+		return nil
+	})
+}
+
+func (c *memController) ScaleOperation(container *citadel.Container, count int, actor string) *shipyard.Operation {
+	return c.operations.Start("scale", container.ID, actor, func(task *manager.OperationTask) error {
+		return c.scale(container, count, task)
+	})
+}
+
+// PullOperation runs until it is cancelled so the tests can cancel it
+func (c *memController) PullOperation(image string, actor string) *shipyard.Operation {
+	return c.operations.Start("pull", image, actor, func(task *manager.OperationTask) error {
+		task.SetTotal(len(c.Engines()))
+		for !task.Cancelled() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	})
+}
+
+func (c *memController) Extension(id string) (*shipyard.Extension, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ext, ok := c.extensions[id]
+	if !ok {
+		return nil, manager.ErrExtensionDoesNotExist
+	}
+	return ext, nil
+}
+
+func (c *memController) Extensions() ([]*shipyard.Extension, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	exts := []*shipyard.Extension{}
+	for _, ext := range c.extensions {
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+func (c *memController) SaveExtension(ext *shipyard.Extension, actor string) error {
+	c.mux.Lock()
+	ext.ID = c.newID()
+	c.extensions[ext.ID] = ext
+	c.mux.Unlock()
+	c.run(&citadel.Image{Name: ext.Image}, 1, nil)
+	return nil
+}
+
+func (c *memController) DeleteExtension(id string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.extensions[id]; !ok {
+		return manager.ErrExtensionDoesNotExist
+	}
+	delete(c.extensions, id)
+	return nil
+}
+
+func (c *memController) WebhookKey(key string) (*dockerhub.WebhookKey, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	k, ok := c.webhookKeys[key]
+	if !ok {
+		return nil, manager.ErrWebhookKeyDoesNotExist
+	}
+	return k, nil
+}
+
+func (c *memController) WebhookKeys() ([]*dockerhub.WebhookKey, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	keys := []*dockerhub.WebhookKey{}
+	for _, k := range c.webhookKeys {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (c *memController) NewWebhookKey(image string, actor string) (*dockerhub.WebhookKey, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	key := &dockerhub.WebhookKey{ID: c.newID(), Image: image, Key: c.newID()}
+	c.webhookKeys[key.Key] = key
+	return key, nil
+}
+
+func (c *memController) DeleteWebhookKey(key string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.webhookKeys[key]; !ok {
+		return manager.ErrWebhookKeyDoesNotExist
+	}
+	delete(c.webhookKeys, key)
+	return nil
+}
+
+func (c *memController) queryEvents(q *shipyard.EventQuery) []*shipyard.Event {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	events := []*shipyard.Event{}
+	for i := len(c.events) - 1; i >= 0; i-- {
+		e := c.events[i]
+		if (q.Type != "" && e.Type != q.Type) || (q.Engine != "" && (e.Engine == nil || e.Engine.ID != q.Engine)) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func (c *memController) QueryEvents(q *shipyard.EventQuery) ([]*shipyard.Event, string, error) {
+	events := c.queryEvents(q)
+	if q.Limit > 0 && len(events) > q.Limit {
+		return events[:q.Limit], shipyard.NewEventCursor(events[q.Limit-1]), nil
+	}
+	return events, "", nil
+}
+
+func (c *memController) ExportEvents(q *shipyard.EventQuery, fn func(*shipyard.Event) error) error {
+	for _, e := range c.queryEvents(q) {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *memController) PurgeEvents() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.events = nil
+	return nil
+}
+
+func (c *memController) NotificationChannel(id string) (*shipyard.NotificationChannel, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ch, ok := c.channels[id]
+	if !ok {
+		return nil, manager.ErrNotificationChannelDoesNotExist
+	}
+	return ch, nil
+}
+
+func (c *memController) NotificationChannels() ([]*shipyard.NotificationChannel, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	channels := []*shipyard.NotificationChannel{}
+	for _, ch := range c.channels {
+		channels = append(channels, ch)
+	}
+	return channels, nil
+}
+
+func (c *memController) AddNotificationChannel(ch *shipyard.NotificationChannel, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err := ch.Validate(); err != nil {
+		return err
+	}
+	ch.ID = c.newID()
+	ch.Created = time.Now()
+	c.channels[ch.ID] = ch
+	return nil
+}
+
+func (c *memController) UpdateNotificationChannel(ch *shipyard.NotificationChannel, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	existing, ok := c.channels[ch.ID]
+	if !ok {
+		return manager.ErrNotificationChannelDoesNotExist
+	}
+	if err := ch.Validate(); err != nil {
+		return err
+	}
+	ch.Created = existing.Created
+	c.channels[ch.ID] = ch
+	return nil
+}
+
+func (c *memController) RemoveNotificationChannel(id string, actor string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.channels[id]; !ok {
+		return manager.ErrNotificationChannelDoesNotExist
+	}
+	delete(c.channels, id)
+	return nil
+}
+
+// TestNotificationChannel records a delivery without sending it
+func (c *memController) TestNotificationChannel(id string, actor string) (*shipyard.NotificationDelivery, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.channels[id]; !ok {
+		return nil, manager.ErrNotificationChannelDoesNotExist
+	}
+	now := time.Now()
+	d := &shipyard.NotificationDelivery{
+		ID:        c.newID(),
+		ChannelID: id,
+		EventType: "notification-test",
+		Status:    shipyard.DeliveryDelivered,
+		Attempts:  1,
+		Created:   now,
+		Updated:   now,
+	}
+	c.deliveries = append(c.deliveries, d)
+	return d, nil
+}
+
+func (c *memController) NotificationDeliveries(id string, limit int) ([]*shipyard.NotificationDelivery, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.channels[id]; !ok {
+		return nil, manager.ErrNotificationChannelDoesNotExist
+	}
+	deliveries := []*shipyard.NotificationDelivery{}
+	for i := len(c.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := c.deliveries[i]; d.ChannelID == id {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+type containersByID []*citadel.Container
+
+func (c containersByID) Len() int           { return len(c) }
+func (c containersByID) Less(i, j int) bool { return c[i].ID < c[j].ID }
+func (c containersByID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
@@ -0,0 +1,466 @@
+package dockerproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/citadel/citadel"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gorilla/mux"
+	"github.com/samalba/dockerclient"
+	"github.com/shipyard/shipyard/controller/manager"
+	"github.com/shipyard/shipyard/secrets"
+)
+
+type (
+	// Version is the /version response
+	Version struct {
+		Version    string
+		ApiVersion string
+		GoVersion  string
+		Os         string
+		Arch       string
+	}
+
+	// Event is a docker event from the /events stream
+	Event struct {
+		Status string `json:"status"`
+		ID     string `json:"id"`
+		From   string `json:"from"`
+		Time   int64  `json:"time"`
+	}
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error(err)
+	}
+}
+
+func (p *Proxy) ping(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func (p *Proxy) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &Version{
+		Version:    "shipyard/" + p.manager.ClusterInfo().Version,
+		ApiVersion: APIVersion,
+		GoVersion:  runtime.Version(),
+		Os:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+	})
+}
+
+func (p *Proxy) info(w http.ResponseWriter, r *http.Request) {
+	info := p.manager.ClusterInfo()
+	engines := p.manager.Engines()
+	status := [][]string{{"Engines", strconv.Itoa(len(engines))}}
+	for _, e := range engines {
+		status = append(status, []string{e.ID, e.Engine.Addr})
+	}
+	writeJSON(w, http.StatusOK, &dockerclient.Info{
+		Containers:      int64(info.ContainerCount),
+		Images:          int64(info.ImageCount),
+		Driver:          "shipyard",
+		DriverStatus:    status,
+		NCPU:            int64(info.Cpus),
+		MemTotal:        int64(info.Memory * 1024 * 1024),
+		Name:            "shipyard",
+		OperatingSystem: "shipyard " + info.Version,
+	})
+}
+
+func (p *Proxy) listImages(w http.ResponseWriter, r *http.Request) {
+	tags := map[string]bool{}
+	for _, e := range p.manager.ClusterManager().Engines() {
+		images, err := e.ListImages()
+		if err != nil {
+			logger.Warnf("unable to list images on %s: %s", e.ID, err)
+			continue
+		}
+		for _, i := range images {
+			tags[i] = true
+		}
+	}
+	names := []string{}
+	for t := range tags {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	images := []*dockerclient.Image{}
+	for _, n := range names {
+		images = append(images, &dockerclient.Image{RepoTags: []string{n}})
+	}
+	writeJSON(w, http.StatusOK, images)
+}
+
+func (p *Proxy) listContainers(w http.ResponseWriter, r *http.Request) {
+	all := r.FormValue("all") == "1" || r.FormValue("all") == "true"
+	out := []*dockerclient.Container{}
+	for _, c := range p.manager.Containers(all) {
+		out = append(out, toDockerContainer(c))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// container returns the container from the route by id prefix or name
+// and writes a 404 if it does not exist
+func (p *Proxy) container(w http.ResponseWriter, r *http.Request) *citadel.Container {
+	id := mux.Vars(r)["id"]
+	if c := findContainer(p.manager.Containers(true), id); c != nil {
+		return c
+	}
+	http.Error(w, fmt.Sprintf("No such container: %s", id), http.StatusNotFound)
+	return nil
+}
+
+func (p *Proxy) createContainer(w http.ResponseWriter, r *http.Request) {
+	var config *dockerclient.ContainerConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	image, err := imageFromConfig(config, r.FormValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !manager.RequestIdentity(r).AllowsImage(image.Name) {
+		http.Error(w, manager.ErrImageNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+	if err := p.manager.CheckSecrets(manager.RequestIdentity(r), image); err != nil {
+		if err == manager.ErrSecretNotAllowed {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if image.Privileged && p.PrivilegedRequiresTOTP && !manager.RequestIdentity(r).SecondFactor() {
+		http.Error(w, "two-factor authentication is required to run privileged containers", http.StatusForbidden)
+		return
+	}
+	c, err := p.manager.CreateContainer(image, false)
+	if err == dockerclient.ErrNotFound {
+		// the image is not on the selected engine
+		c, err = p.manager.CreateContainer(image, true)
+	}
+	if err != nil {
+		logger.Errorf("error creating container from %s: %s", image.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Infof("created container %s (%s) on %s from the docker api", c.ID, image.Name, c.Engine.ID)
+	writeJSON(w, http.StatusCreated, &dockerclient.RespContainersCreate{Id: c.ID})
+}
+
+func (p *Proxy) startContainer(w http.ResponseWriter, r *http.Request) {
+	c := p.container(w, r)
+	if c == nil {
+		return
+	}
+	if c.State != "running" {
+		if err := p.manager.ClusterManager().StartExisting(c); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Proxy) stopContainer(w http.ResponseWriter, r *http.Request) {
+	c := p.container(w, r)
+	if c == nil {
+		return
+	}
+	if err := p.manager.ClusterManager().Stop(c); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Proxy) killContainer(w http.ResponseWriter, r *http.Request) {
+	c := p.container(w, r)
+	if c == nil {
+		return
+	}
+	sig, err := parseSignal(r.FormValue("signal"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := p.manager.ClusterManager().Kill(c, sig); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Proxy) removeContainer(w http.ResponseWriter, r *http.Request) {
+	c := p.container(w, r)
+	if c == nil {
+		return
+	}
+	if err := p.manager.Destroy(c); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Proxy) containerLogs(w http.ResponseWriter, r *http.Request) {
+	c := p.container(w, r)
+	if c == nil {
+		return
+	}
+	stdout := r.FormValue("stdout") == "1" || r.FormValue("stdout") == "true"
+	stderr := r.FormValue("stderr") == "1" || r.FormValue("stderr") == "true"
+	data, err := p.manager.Logs(c, stdout, stderr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer data.Close()
+
+	// the stream stays multiplexed for the client; secrets referenced by
+	// the container are redacted from each stream
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	values := p.manager.SecretValues(c)
+	outw := secrets.NewRedactor(stdcopy.NewStdWriter(w, stdcopy.Stdout), values)
+	errw := secrets.NewRedactor(stdcopy.NewStdWriter(w, stdcopy.Stderr), values)
+	stdcopy.StdCopy(outw, errw, data)
+	outw.Flush()
+	errw.Flush()
+}
+
+func (p *Proxy) events(w http.ResponseWriter, r *http.Request) {
+	ch := p.manager.SubscribeEvents()
+	defer p.manager.UnsubscribeEvents(ch)
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case evt := <-ch:
+			if evt.Container == nil || !hasTag(evt.Tags, "docker") {
+				continue
+			}
+			from := ""
+			if evt.Container.Image != nil {
+				from = evt.Container.Image.Name
+			}
+			if err := enc.Encode(&Event{
+				Status: evt.Type,
+				ID:     evt.Container.ID,
+				From:   from,
+				Time:   evt.Time.Unix(),
+			}); err != nil {
+				return
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var signals = map[string]int{
+	"HUP":  1,
+	"INT":  2,
+	"QUIT": 3,
+	"KILL": 9,
+	"USR1": 10,
+	"USR2": 12,
+	"TERM": 15,
+}
+
+// parseSignal parses a signal number or name such as SIGTERM; the
+// default is SIGKILL
+func parseSignal(s string) (int, error) {
+	if s == "" {
+		return 9, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	if n, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid signal: %s", s)
+}
+
+// toDockerContainer returns the container in the docker list format; the
+// name is prefixed with the engine id
+func toDockerContainer(c *citadel.Container) *dockerclient.Container {
+	status := "Exited"
+	if c.State == "running" {
+		status = "Up"
+	}
+	ports := []dockerclient.Port{}
+	for _, p := range c.Ports {
+		ports = append(ports, dockerclient.Port{
+			IP:          p.HostIp,
+			PrivatePort: p.ContainerPort,
+			PublicPort:  p.Port,
+			Type:        p.Proto,
+		})
+	}
+	image := ""
+	cmd := ""
+	if c.Image != nil {
+		image = c.Image.Name
+		cmd = strings.Join(append(append([]string{}, c.Image.Entrypoint...), c.Image.Args...), " ")
+	}
+	names := []string{}
+	if c.Name != "" && c.Engine != nil {
+		names = append(names, "/"+c.Engine.ID+"/"+strings.TrimPrefix(c.Name, "/"))
+	}
+	return &dockerclient.Container{
+		Id:      c.ID,
+		Names:   names,
+		Image:   image,
+		Command: cmd,
+		Status:  status,
+		Ports:   ports,
+	}
+}
+
+// findContainer finds a container by id prefix, name or engine/name
+func findContainer(containers []*citadel.Container, id string) *citadel.Container {
+	name := strings.TrimPrefix(id, "/")
+	for _, c := range containers {
+		if strings.HasPrefix(c.ID, id) {
+			return c
+		}
+		cname := strings.TrimPrefix(c.Name, "/")
+		if cname == "" {
+			continue
+		}
+		if cname == name || (c.Engine != nil && c.Engine.ID+"/"+cname == name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// imageFromConfig translates a docker create request into an image for
+// the cluster schedulers
+func imageFromConfig(config *dockerclient.ContainerConfig, name string) (*citadel.Image, error) {
+	if config == nil || config.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+	hc := config.HostConfig
+	image := &citadel.Image{
+		Name:          config.Image,
+		Args:          config.Cmd,
+		Entrypoint:    config.Entrypoint,
+		Hostname:      config.Hostname,
+		Domainname:    config.Domainname,
+		Cpuset:        config.Cpuset,
+		Memory:        float64(config.Memory) / 1024 / 1024,
+		Environment:   map[string]string{},
+		Type:          "service",
+		Links:         map[string]string{},
+		Publish:       hc.PublishAllPorts,
+		Privileged:    hc.Privileged,
+		NetworkMode:   hc.NetworkMode,
+		ContainerName: name,
+		RestartPolicy: citadel.RestartPolicy{
+			Name:              hc.RestartPolicy.Name,
+			MaximumRetryCount: hc.RestartPolicy.MaximumRetryCount,
+		},
+	}
+	if config.CpuShares > 0 {
+		// docker shares are relative to 1024 for a single cpu
+		image.Cpus = float64(config.CpuShares) / 1024
+	}
+	for _, e := range config.Env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "_citadel_type":
+			image.Type = parts[1]
+		case "_citadel_labels":
+			if parts[1] != "" {
+				image.Labels = strings.Split(parts[1], ",")
+			}
+		default:
+			image.Environment[parts[0]] = parts[1]
+		}
+	}
+	bound := map[string]bool{}
+	for _, b := range hc.Binds {
+		image.Volumes = append(image.Volumes, b)
+		if parts := strings.Split(b, ":"); len(parts) > 1 {
+			bound[parts[1]] = true
+		}
+	}
+	for v := range config.Volumes {
+		if !bound[v] {
+			image.Volumes = append(image.Volumes, v)
+		}
+	}
+	for _, l := range hc.Links {
+		parts := strings.SplitN(l, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid link: %s", l)
+		}
+		image.Links[strings.TrimPrefix(parts[0], "/")] = parts[1]
+	}
+	for key, bindings := range hc.PortBindings {
+		parts := strings.SplitN(key, "/", 2)
+		containerPort, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", key)
+		}
+		proto := "tcp"
+		if len(parts) == 2 {
+			proto = parts[1]
+		}
+		for _, b := range bindings {
+			hostPort := 0
+			if b.HostPort != "" {
+				if hostPort, err = strconv.Atoi(b.HostPort); err != nil {
+					return nil, fmt.Errorf("invalid host port: %s", b.HostPort)
+				}
+			}
+			image.BindPorts = append(image.BindPorts, &citadel.Port{
+				Proto:         proto,
+				HostIp:        b.HostIp,
+				Port:          hostPort,
+				ContainerPort: containerPort,
+			})
+		}
+	}
+	return image, nil
+}
@@ -0,0 +1,179 @@
+// Package dockerproxy serves a subset of the Docker Remote API backed by
+// the cluster so the docker cli can target the whole cluster with
+// DOCKER_HOST.
+//
+// Containers are placed by the cluster schedulers when they are created
+// and run once the client starts them, the same as on a single engine.
+// The scheduler type and constraint labels can be set with the
+// _citadel_type and _citadel_labels environment variables.
+package dockerproxy
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+)
+
+const (
+	// APIVersion is the Docker Remote API version reported by the proxy
+	APIVersion = "1.17"
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errAccessDenied = errors.New("access denied")
+	logger          = logrus.New()
+	// clients prefix paths with the api version, i.e. /v1.17/info
+	versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+)
+
+// SetLogger replaces the logger of the proxy
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
+type Proxy struct {
+	manager *manager.Manager
+	router  *mux.Router
+	acl     map[string][]string
+	// PrivilegedRequiresTOTP denies privileged containers to accounts
+	// without two-factor authentication and to service keys
+	PrivilegedRequiresTOTP bool
+}
+
+func defaultAccessLevels() map[string][]string {
+	acl := make(map[string][]string)
+	acl["admin"] = []string{"*"}
+	acl["user"] = []string{
+		"/_ping",
+		"/containers",
+		"/images",
+		"/info",
+		"/version",
+		"/events",
+	}
+	return acl
+}
+
+func NewProxy(m *manager.Manager) *Proxy {
+	p := &Proxy{
+		manager: m,
+		acl:     defaultAccessLevels(),
+	}
+	p.router = p.newRouter()
+	return p
+}
+
+// Router returns the router for the proxy endpoints
+func (p *Proxy) Router() *mux.Router {
+	return p.router
+}
+
+func (p *Proxy) newRouter() *mux.Router {
+	router := mux.NewRouter()
+	routes := map[string]map[string]http.HandlerFunc{
+		"GET": {
+			"/_ping":                p.ping,
+			"/version":              p.version,
+			"/info":                 p.info,
+			"/events":               p.events,
+			"/images/json":          p.listImages,
+			"/containers/json":      p.listContainers,
+			"/containers/{id}/logs": p.containerLogs,
+		},
+		"POST": {
+			"/containers/create":     p.createContainer,
+			"/containers/{id}/start": p.startContainer,
+			"/containers/{id}/stop":  p.stopContainer,
+			"/containers/{id}/kill":  p.killContainer,
+		},
+		"DELETE": {
+			"/containers/{id}": p.removeContainer,
+		},
+	}
+	for method, paths := range routes {
+		for path, h := range paths {
+			router.HandleFunc(path, h).Methods(method)
+			router.HandleFunc("/v{version:[0-9.]+}"+path, h).Methods(method)
+		}
+	}
+	return router
+}
+
+// HandlerFuncWithNext authenticates the request with a service key, an
+// auth token or a client certificate and checks access to the endpoint
+func (p *Proxy) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	if path == "/_ping" {
+		next(w, r)
+		return
+	}
+	if err := p.authorize(r, path); err != nil {
+		logger.Warnf("docker api request for %s from %s denied: %s", r.URL.Path, r.RemoteAddr, err)
+		if err == errUnauthorized {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+		return
+	}
+	next(w, r)
+}
+
+func (p *Proxy) authorize(r *http.Request, path string) error {
+	if key := r.Header.Get("X-Service-Key"); key != "" {
+		k, err := p.manager.VerifyServiceKey(key, r.RemoteAddr)
+		if err != nil {
+			return errUnauthorized
+		}
+		if !k.Allows(r.Method, path) {
+			return errAccessDenied
+		}
+		manager.SetIdentity(r, manager.NewServiceKeyIdentity(k))
+		return nil
+	}
+	if authHeader := r.Header.Get("X-Access-Token"); authHeader != "" {
+		parts := strings.Split(authHeader, ":")
+		if len(parts) != 2 || p.manager.VerifyAuthToken(parts[0], parts[1]) != nil {
+			return errUnauthorized
+		}
+		acct, err := p.manager.Account(parts[0])
+		if err != nil {
+			return errUnauthorized
+		}
+		t := acct.AuthToken(parts[1])
+		return p.authorizeAccount(r, path, acct, t != nil && t.MultiFactor)
+	}
+	if cn := manager.ClientCommonName(r.TLS); cn != "" {
+		acct, key, err := p.manager.VerifyClientCertificate(cn, r.RemoteAddr)
+		if err != nil {
+			// includes accounts that must complete their setup
+			return errUnauthorized
+		}
+		if key != nil {
+			if !key.Allows(r.Method, path) {
+				return errAccessDenied
+			}
+			manager.SetIdentity(r, manager.NewServiceKeyIdentity(key))
+			return nil
+		}
+		return p.authorizeAccount(r, path, acct, false)
+	}
+	return errUnauthorized
+}
+
+func (p *Proxy) authorizeAccount(r *http.Request, path string, acct *shipyard.Account, multiFactor bool) error {
+	if acct.Role == nil || !shipyard.CheckPermissions(p.acl[acct.Role.Name], r.Method, path) {
+		return errAccessDenied
+	}
+	id := manager.NewAccountIdentity(acct)
+	id.MultiFactor = multiFactor
+	manager.SetIdentity(r, id)
+	return nil
+}
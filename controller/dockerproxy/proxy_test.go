@@ -0,0 +1,82 @@
+package dockerproxy
+
+import (
+	"testing"
+
+	"github.com/citadel/citadel"
+	"github.com/samalba/dockerclient"
+)
+
+func TestImageFromConfig(t *testing.T) {
+	config := &dockerclient.ContainerConfig{
+		Image:     "redis",
+		Cmd:       []string{"redis-server"},
+		Memory:    256 * 1024 * 1024,
+		CpuShares: 512,
+		Env:       []string{"PORT=6379", "_citadel_type=batch", "_citadel_labels=ssd,zone:a"},
+		Volumes:   map[string]struct{}{"/data": {}, "/logs": {}},
+		HostConfig: dockerclient.HostConfig{
+			Binds: []string{"/srv/data:/data"},
+			Links: []string{"/db:db"},
+			PortBindings: map[string][]dockerclient.PortBinding{
+				"6379/tcp": {{HostIp: "0.0.0.0", HostPort: "6379"}},
+			},
+		},
+	}
+	image, err := imageFromConfig(config, "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Type != "batch" || len(image.Labels) != 2 || image.Labels[1] != "zone:a" {
+		t.Errorf("expected type and labels from the environment; received %s %v", image.Type, image.Labels)
+	}
+	if _, ok := image.Environment["_citadel_type"]; ok || image.Environment["PORT"] != "6379" {
+		t.Errorf("unexpected environment %v", image.Environment)
+	}
+	if image.Memory != 256 || image.Cpus != 0.5 {
+		t.Errorf("expected 256MB and 0.5 cpus; received %f %f", image.Memory, image.Cpus)
+	}
+	if len(image.Volumes) != 2 {
+		t.Errorf("expected the bind and the /logs volume; received %v", image.Volumes)
+	}
+	if image.Links["db"] != "db" {
+		t.Errorf("expected link to db; received %v", image.Links)
+	}
+	if len(image.BindPorts) != 1 || image.BindPorts[0].Port != 6379 || image.BindPorts[0].Proto != "tcp" {
+		t.Errorf("unexpected port bindings %v", image.BindPorts)
+	}
+	if image.ContainerName != "cache" {
+		t.Errorf("expected container name cache; received %s", image.ContainerName)
+	}
+	if _, err := imageFromConfig(&dockerclient.ContainerConfig{}, ""); err == nil {
+		t.Error("expected an error without an image")
+	}
+}
+
+func TestFindContainer(t *testing.T) {
+	engine := &citadel.Engine{ID: "node-1"}
+	containers := []*citadel.Container{
+		{ID: "abcdef123456", Name: "/web", Engine: engine},
+		{ID: "123456abcdef", Name: "/db", Engine: engine},
+	}
+	for _, id := range []string{"abc", "web", "/web", "node-1/web"} {
+		if c := findContainer(containers, id); c == nil || c.ID != "abcdef123456" {
+			t.Errorf("expected to find web by %q", id)
+		}
+	}
+	if c := findContainer(containers, "cache"); c != nil {
+		t.Errorf("expected no container; found %s", c.ID)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for s, expected := range map[string]int{"": 9, "15": 15, "SIGTERM": 15, "hup": 1} {
+		n, err := parseSignal(s)
+		if err != nil || n != expected {
+			t.Errorf("expected %d for %q; received %d %v", expected, s, n, err)
+		}
+	}
+	if _, err := parseSignal("SIGBOGUS"); err == nil {
+		t.Error("expected an error for an unknown signal")
+	}
+}
@@ -1,25 +1,38 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/citadel/citadel"
 	"github.com/codegangsta/negroni"
 	"github.com/docker/docker/pkg/stdcopy"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/dockerproxy"
 	"github.com/shipyard/shipyard/controller/manager"
 	"github.com/shipyard/shipyard/controller/middleware/access"
+	"github.com/shipyard/shipyard/controller/middleware/audit"
 	"github.com/shipyard/shipyard/controller/middleware/auth"
 	"github.com/shipyard/shipyard/dockerhub"
+	"github.com/shipyard/shipyard/logsink"
+	"github.com/shipyard/shipyard/notify"
+	"github.com/shipyard/shipyard/oidc"
+	"github.com/shipyard/shipyard/secrets"
 )
 
 var (
@@ -29,29 +42,111 @@ var (
 	rethinkdbAuthKey  string
 	disableUsageInfo  bool
 	showVersion       bool
-	controllerManager *manager.Manager
+	oidcIssuer        string
+	oidcClientID      string
+	oidcClientSecret  string
+	oidcRedirectURL   string
+	oidcRoleClaim     string
+	oidcRoleMap       string
+	oidcDefaultRole   string
+	oidcMFAValues     string
+	passwordPolicy    = &shipyard.PasswordPolicy{}
+	loginMaxAttempts  int
+	loginMaxAddr      int
+	loginLockout      time.Duration
+	loginLockoutMax   time.Duration
+	adminPassword     string
+	totpRoles         string
+	privilegedTOTP    bool
+	secretsKeyFile    string
+	certExpiryDays    int
+	runWorkers        int
+	tlsCertPath       string
+	tlsKeyPath        string
+	tlsCACertPath     string
+	dockerListenAddr  string
+	shutdownTimeout   time.Duration
+	healthRetention   time.Duration
+	eventRetention    manager.EventRetention
+	logSinks          string
+	eventSinks        string
+	logDriver         string
+	logDriverOpts     string
+	controllerManager Controller
+	ssoProvider       *oidc.Provider
+	ssoRoles          *oidc.RoleMapper
+	ssoMFAValues      []string
+	ssoStates         = oidc.NewStateStore()
 	logger            = logrus.New()
 )
 
 const (
 	STORE_KEY = "shipyard"
 	VERSION   = shipyard.VERSION
+	// statusTooManyRequests is not defined by net/http in go 1.3
+	statusTooManyRequests = 429
 )
 
 type (
 	Credentials struct {
 		Username string `json:"username,omitempty"`
 		Password string `json:"password,omitempty"`
+		Code     string `json:"code,omitempty"`
+	}
+
+	RoleTOTP struct {
+		Required bool `json:"required"`
+	}
+
+	SSOCredentials struct {
+		IDToken string `json:"id_token,omitempty"`
+		State   string `json:"state,omitempty"`
 	}
 )
 
 func init() {
 	flag.StringVar(&listenAddr, "listen", ":8080", "listen address")
+	flag.StringVar(&tlsCertPath, "tls-cert", "", "tls certificate to serve the api over https")
+	flag.StringVar(&tlsKeyPath, "tls-key", "", "tls key to serve the api over https")
+	flag.StringVar(&tlsCACertPath, "tls-ca", "", "ca certificate to verify client certificates; the certificate common name maps to a service key or account")
+	flag.StringVar(&dockerListenAddr, "docker-listen", "", "listen address for the docker remote api proxy (i.e. :2375); uses the api tls options")
+	flag.DurationVar(&healthRetention, "engine-health-retention", time.Hour*24*7, "how long engine health checks are kept")
+	flag.DurationVar(&eventRetention.MaxAge, "event-retention", time.Hour*24*30, "how long events are kept; 0 keeps events until they are purged")
+	flag.IntVar(&eventRetention.MaxCount, "event-max-count", 0, "maximum number of events kept; 0 is unlimited")
+	flag.StringVar(&logSinks, "log-sink", "", "comma separated urls to forward controller logs to (i.e. syslog+tcp://logs:514, gelf://graylog:12201, fluentd://fluentd:24224)")
+	flag.StringVar(&logDriver, "container-log-driver", "", "docker log driver for containers run without one (i.e. syslog, gelf, fluentd)")
+	flag.StringVar(&logDriverOpts, "container-log-opt", "", "comma separated options for --container-log-driver (i.e. gelf-address=udp://graylog:12201)")
+	flag.StringVar(&eventSinks, "event-sink", "", "comma separated urls to forward events to; same formats as --log-sink")
+	flag.StringVar(&eventRetention.ArchiveDir, "event-archive-dir", "", "directory where events are written as json lines before they are removed")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", time.Second*30, "time to finish requests in flight and stop background workers on SIGTERM")
 	flag.StringVar(&rethinkdbAddr, "rethinkdb-addr", "127.0.0.1:28015", "rethinkdb address")
 	flag.StringVar(&rethinkdbDatabase, "rethinkdb-database", "shipyard", "rethinkdb database")
 	flag.StringVar(&rethinkdbAuthKey, "rethinkdb-auth-key", "", "rethinkdb auth key")
 	flag.BoolVar(&disableUsageInfo, "disable-usage-info", false, "disable anonymous usage info")
 	flag.BoolVar(&showVersion, "version", false, "show version and exit")
+	flag.StringVar(&oidcIssuer, "oidc-issuer", "", "openid connect issuer url to enable single sign-on")
+	flag.StringVar(&oidcClientID, "oidc-client-id", "", "openid connect client id")
+	flag.StringVar(&oidcClientSecret, "oidc-client-secret", "", "openid connect client secret (optional for public clients)")
+	flag.StringVar(&oidcRedirectURL, "oidc-redirect-url", "", "openid connect redirect url (i.e. https://shipyard.example.com/auth/sso/callback)")
+	flag.StringVar(&oidcRoleClaim, "oidc-role-claim", "groups", "id token claim used for role mapping")
+	flag.StringVar(&oidcRoleMap, "oidc-role-map", "", "claim value to role mappings (i.e. ops:admin,developers:user)")
+	flag.StringVar(&oidcDefaultRole, "oidc-default-role", "", "role for sso users without a mapping; empty denies login")
+	flag.StringVar(&oidcMFAValues, "oidc-mfa-values", "", "id token amr or acr values that count as a second factor (i.e. mfa,otp); empty never counts sso as a second factor")
+	flag.IntVar(&passwordPolicy.MinLength, "password-min-length", 8, "minimum password length")
+	flag.BoolVar(&passwordPolicy.RequireUpper, "password-require-upper", false, "require an upper case letter in passwords")
+	flag.BoolVar(&passwordPolicy.RequireLower, "password-require-lower", false, "require a lower case letter in passwords")
+	flag.BoolVar(&passwordPolicy.RequireDigit, "password-require-digit", false, "require a digit in passwords")
+	flag.BoolVar(&passwordPolicy.RequireSymbol, "password-require-symbol", false, "require a symbol in passwords")
+	flag.IntVar(&loginMaxAttempts, "login-max-attempts", 5, "failed logins for an account before it is locked; 0 disables")
+	flag.IntVar(&loginMaxAddr, "login-max-attempts-per-ip", 20, "failed logins from an address before it is locked; 0 disables")
+	flag.DurationVar(&loginLockout, "login-lockout", time.Second*30, "initial lockout; doubles with each further failure")
+	flag.DurationVar(&loginLockoutMax, "login-lockout-max", time.Hour, "maximum lockout")
+	flag.StringVar(&adminPassword, "admin-password", "", "initial admin password; the default must be changed on first login")
+	flag.StringVar(&totpRoles, "totp-required-roles", "", "comma separated roles that must use two-factor authentication (i.e. admin)")
+	flag.BoolVar(&privilegedTOTP, "privileged-requires-totp", false, "require two-factor authentication to run privileged containers")
+	flag.IntVar(&certExpiryDays, "cert-expiry-warning-days", 30, "raise an event when an engine certificate expires within this many days")
+	flag.IntVar(&runWorkers, "run-workers", 8, "maximum number of containers started concurrently for a run")
+	flag.StringVar(&secretsKeyFile, "secrets-key-file", "", "file with the base64 master key used to encrypt secrets and engine tls keys (or SHIPYARD_SECRETS_KEY)")
 }
 
 func destroy(w http.ResponseWriter, r *http.Request) {
@@ -84,6 +179,7 @@ func run(w http.ResponseWriter, r *http.Request) {
 	c := r.FormValue("count")
 	count := 1
 	pull := false
+	atomic := false
 	if p != "" {
 		pv, err := strconv.ParseBool(p)
 		if err != nil {
@@ -92,6 +188,14 @@ func run(w http.ResponseWriter, r *http.Request) {
 		}
 		pull = pv
 	}
+	if a := r.FormValue("atomic"); a != "" {
+		av, err := strconv.ParseBool(a)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		atomic = av
+	}
 	if c != "" {
 		cc, err := strconv.Atoi(c)
 		if err != nil {
@@ -100,19 +204,49 @@ func run(w http.ResponseWriter, r *http.Request) {
 		}
 		count = cc
 	}
+	if count < 1 {
+		http.Error(w, "count must be at least 1", http.StatusBadRequest)
+		return
+	}
 	var image *citadel.Image
 	if err := json.NewDecoder(r.Body).Decode(&image); err != nil {
 		logger.Warnf("error decoding image: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !manager.RequestIdentity(r).AllowsImage(image.Name) {
+		http.Error(w, manager.ErrImageNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+	if !checkSecrets(w, r, image) {
+		return
+	}
+
+	if image.Privileged && privilegedTOTP && !manager.RequestIdentity(r).SecondFactor() {
+		logger.Warnf("denied privileged container for %q without two-factor authentication", requestActor(r))
+		http.Error(w, "two-factor authentication is required to run privileged containers", http.StatusForbidden)
+		return
+	}
+
+	async, err := asyncRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if async {
+		op := controllerManager.RunOperation(image, count, manager.RunOptions{Pull: pull, Atomic: atomic}, requestActor(r))
+		logger.Infof("running %d %s: operation %s", count, image.Name, op.ID)
+		writeOperation(w, op, "/api")
+		return
+	}
 
-	launched, err := controllerManager.Run(image, count, pull)
+	results, err := controllerManager.RunInstances(image, count, manager.RunOptions{Pull: pull, Atomic: atomic})
 	if err != nil {
 		logger.Warnf("error running container: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	launched := manager.Launched(results)
 
 	w.Header().Set("content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -135,7 +269,7 @@ func stopContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := controllerManager.ClusterManager().Stop(container); err != nil {
+	if err := controllerManager.Stop(container); err != nil {
 		logger.Errorf("error stopping %s: %s", container.ID, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -159,14 +293,89 @@ func containerLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := controllerManager.ClusterManager().Logs(container, true, true)
+	if err := writeContainerLogs(w, container); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeContainerLogs(w http.ResponseWriter, container *citadel.Container) error {
+	data, err := controllerManager.Logs(container, true, true)
 	if err != nil {
 		logger.Errorf("error getting logs for %s: %s", container.ID, err)
+		return err
+	}
+
+	// secrets referenced by the container are redacted from its output
+	out := secrets.NewRedactor(w, controllerManager.SecretValues(container))
+	stdcopy.StdCopy(out, out, data)
+	return out.Flush()
+}
+
+func listSecrets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	s, err := controllerManager.Secrets()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		logger.Error(err)
+	}
+}
+
+func addSecret(w http.ResponseWriter, r *http.Request) {
+	var s *shipyard.Secret
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := controllerManager.SaveSecret(s, requestActor(r)); err != nil {
+		switch err {
+		case shipyard.ErrInvalidSecretName:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case manager.ErrSecretsNotConfigured:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			logger.Errorf("error saving secret: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Infof("saved secret %s", s.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteSecret(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+	if err := controllerManager.DeleteSecret(name, requestActor(r)); err != nil {
+		if err == manager.ErrSecretDoesNotExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Errorf("error deleting secret: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	logger.Infof("deleted secret %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	stdcopy.StdCopy(w, w, data)
+// checkSecrets writes an error and returns false when the caller cannot
+// use a secret referenced by the image
+func checkSecrets(w http.ResponseWriter, r *http.Request, image *citadel.Image) bool {
+	err := controllerManager.CheckSecrets(manager.RequestIdentity(r), image)
+	switch err {
+	case nil:
+		return true
+	case manager.ErrSecretNotAllowed:
+		logger.Warnf("denied %s to %q: %s", image.Name, requestActor(r), err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
 }
 
 func restartContainer(w http.ResponseWriter, r *http.Request) {
@@ -182,7 +391,7 @@ func restartContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := controllerManager.ClusterManager().Restart(container, 10); err != nil {
+	if err := controllerManager.Restart(container, 10); err != nil {
 		logger.Errorf("error restarting %s: %s", container.ID, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -207,6 +416,10 @@ func scaleContainer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if count < 0 {
+		http.Error(w, "count must not be negative", http.StatusBadRequest)
+		return
+	}
 
 	container, err := controllerManager.Container(id)
 	if err != nil {
@@ -218,6 +431,26 @@ func scaleContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !manager.RequestIdentity(r).AllowsImage(container.Image.Name) {
+		http.Error(w, manager.ErrImageNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+	if !checkSecrets(w, r, container.Image) {
+		return
+	}
+
+	async, err := asyncRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if async {
+		op := controllerManager.ScaleOperation(container, count, requestActor(r))
+		logger.Infof("scaling container %s (%s) to %d: operation %s", container.ID, container.Image.Name, count, op.ID)
+		writeOperation(w, op, "/api")
+		return
+	}
+
 	if err := controllerManager.Scale(container, count); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -230,7 +463,10 @@ func scaleContainer(w http.ResponseWriter, r *http.Request) {
 func engines(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	engines := controllerManager.Engines()
+	engines := []*shipyard.Engine{}
+	for _, e := range controllerManager.Engines() {
+		engines = append(engines, e.Redacted())
+	}
 	if err := json.NewEncoder(w).Encode(engines); err != nil {
 		logger.Error(err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -244,15 +480,91 @@ func inspectEngine(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	engine := controllerManager.Engine(id)
-	if err := json.NewEncoder(w).Encode(engine); err != nil {
+	if engine == nil {
+		http.Error(w, "engine not found", http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(engine.Redacted()); err != nil {
+		logger.Error(err)
+	}
+}
+
+const (
+	defaultHealthSince = 24 * time.Hour
+	defaultHealthLimit = 100
+	// defaultDeliveryLimit is the number of notification deliveries listed
+	defaultDeliveryLimit = 100
+)
+
+// healthParams returns the start of the health history from the since
+// duration and the number of checks to return
+func healthParams(r *http.Request) (time.Time, int, error) {
+	since := defaultHealthSince
+	if v := r.FormValue("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return time.Time{}, 0, fmt.Errorf("since must be a positive duration (i.e. 1h)")
+		}
+		since = d
+	}
+	limit := defaultHealthLimit
+	if v := r.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 {
+			return time.Time{}, 0, fmt.Errorf("limit must be a non-negative integer")
+		}
+		limit = l
+	}
+	return time.Now().Add(-since), limit, nil
+}
+
+func engineHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	since, limit, err := healthParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, err := controllerManager.EngineHealth(mux.Vars(r)["id"], since, limit)
+	if err != nil {
+		if err == manager.ErrEngineDoesNotExist {
+			http.Error(w, "engine not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(history); err != nil {
 		logger.Error(err)
 	}
 }
 
+func rotateEngineCertificates(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var certs *shipyard.EngineCertificates
+	if err := json.NewDecoder(r.Body).Decode(&certs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := controllerManager.RotateEngineCertificates(id, certs, requestActor(r)); err != nil {
+		if err == manager.ErrEngineDoesNotExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Errorf("error rotating certificates for engine %s: %s", id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Infof("rotated certificates for engine %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func containers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	containers := controllerManager.ClusterManager().ListContainers(true, false, "")
+	containers := controllerManager.Containers(true)
 	if err := json.NewEncoder(w).Encode(containers); err != nil {
 		logger.Error(err)
 	}
@@ -288,7 +600,7 @@ func addEngine(w http.ResponseWriter, r *http.Request) {
 		ResponseTime: 0,
 	}
 	engine.Health = health
-	if err := controllerManager.AddEngine(engine); err != nil {
+	if err := controllerManager.AddEngine(engine, requestActor(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -300,7 +612,11 @@ func removeEngine(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	engine := controllerManager.Engine(id)
-	if err := controllerManager.RemoveEngine(engine.ID); err != nil {
+	if engine == nil {
+		http.Error(w, "engine not found", http.StatusNotFound)
+		return
+	}
+	if err := controllerManager.RemoveEngine(engine.ID, requestActor(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -317,18 +633,52 @@ func clusterInfo(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ping reports that the controller is running
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain")
+	w.Write([]byte("OK"))
+}
+
+// health reports whether the controller can serve requests; load
+// balancers should only route to controllers that return 200
+func health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	h := controllerManager.Health()
+	if h.Status != shipyard.HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		logger.Error(err)
+	}
+}
+
+func clusterControllers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	controllers, err := controllerManager.Controllers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(controllers); err != nil {
+		logger.Error(err)
+	}
+}
+
 func addServiceKey(w http.ResponseWriter, r *http.Request) {
 	var k *shipyard.ServiceKey
 	if err := json.NewDecoder(r.Body).Decode(&k); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	key, err := controllerManager.NewServiceKey(k.Description)
+	key, err := controllerManager.NewServiceKey(k, requestActor(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	logger.Infof("created service key key=%s description=%s", key.Key, key.Description)
+	logger.Infof("created service key description=%s scopes=%s", key.Description, strings.Join(key.Scopes, ","))
+	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(key); err != nil {
 		logger.Error(err)
 	}
@@ -356,7 +706,7 @@ func removeServiceKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := controllerManager.RemoveServiceKey(key.Key); err != nil {
+	if err := controllerManager.RemoveServiceKey(key.Key, requestActor(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -364,30 +714,47 @@ func removeServiceKey(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// events lists events newest first; the cursor of the next page is
+// returned in the X-Next-Cursor header when there are more events
 func events(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	limit := -1
-	l := r.FormValue("limit")
-	if l != "" {
-		lt, err := strconv.Atoi(l)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		limit = lt
+	q, err := shipyard.ParseEventQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	events, err := controllerManager.Events(limit)
+	events, next, err := controllerManager.QueryEvents(q)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
 	if err := json.NewEncoder(w).Encode(events); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+func exportEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := shipyard.ParseEventQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.Header().Set("content-disposition", "attachment; filename=shipyard-events.jsonl")
+
+	enc := json.NewEncoder(w)
+	if err := controllerManager.ExportEvents(q, func(e *shipyard.Event) error {
+		return enc.Encode(e)
+	}); err != nil {
+		logger.Errorf("error exporting events: %s", err)
+	}
+}
+
 func purgeEvents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
@@ -399,6 +766,77 @@ func purgeEvents(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func auditRecords(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	q := &manager.AuditQuery{
+		Actor:  r.FormValue("actor"),
+		Method: r.FormValue("method"),
+		Limit:  100,
+	}
+	if l := r.FormValue("limit"); l != "" {
+		lt, err := strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Limit = lt
+	}
+	if v := r.FormValue("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Since = t
+	}
+	if v := r.FormValue("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Until = t
+	}
+	records, err := controllerManager.AuditRecords(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		logger.Error(err)
+	}
+}
+
+func exportAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.Header().Set("content-disposition", "attachment; filename=shipyard-audit.jsonl")
+
+	enc := json.NewEncoder(w)
+	if err := controllerManager.ExportAudit(func(rec *shipyard.AuditRecord) error {
+		return enc.Encode(rec)
+	}); err != nil {
+		logger.Errorf("error exporting audit log: %s", err)
+	}
+}
+
+func verifyAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	count, err := controllerManager.VerifyAudit()
+	result := &shipyard.AuditVerification{
+		Records: count,
+		Valid:   err == nil,
+	}
+	if err != nil {
+		logger.Warnf("audit log verification failed: %s", err)
+		result.Error = err.Error()
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error(err)
+	}
+}
+
 func accounts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
@@ -420,7 +858,11 @@ func addAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := controllerManager.SaveAccount(account); err != nil {
+	if err := controllerManager.SaveAccount(account, requestActor(r)); err != nil {
+		if _, ok := err.(*shipyard.PasswordPolicyError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		logger.Errorf("error saving account: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -442,7 +884,7 @@ func deleteAccount(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := controllerManager.DeleteAccount(account); err != nil {
+	if err := controllerManager.DeleteAccount(account, requestActor(r)); err != nil {
 		logger.Errorf("error deleting account: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -489,7 +931,7 @@ func addRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := controllerManager.SaveRole(role); err != nil {
+	if err := controllerManager.SaveRole(role, requestActor(r)); err != nil {
 		logger.Errorf("error saving role: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -505,7 +947,7 @@ func deleteRole(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := controllerManager.DeleteRole(role); err != nil {
+	if err := controllerManager.DeleteRole(role, requestActor(r)); err != nil {
 		logger.Errorf("error deleting role: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -549,7 +991,24 @@ func addExtension(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := controllerManager.SaveExtension(ext); err != nil {
+	async, err := asyncRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if async {
+		op, err := controllerManager.RegisterExtensionOperation(ext, requestActor(r))
+		if err != nil {
+			logger.Errorf("error saving extension: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Infof("saved extension name=%s version=%s author=%s: operation %s", ext.Name, ext.Version, ext.Author, op.ID)
+		writeOperation(w, op, "/api")
+		return
+	}
+
+	if err := controllerManager.SaveExtension(ext, requestActor(r)); err != nil {
 		logger.Errorf("error saving extension: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -607,13 +1066,14 @@ func addWebhookKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	key, err := controllerManager.NewWebhookKey(k.Image)
+	key, err := controllerManager.NewWebhookKey(k.Image, requestActor(r))
 	if err != nil {
 		logger.Errorf("error generating webhook key: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	logger.Infof("saved webhook key image=%s", key.Image)
+	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(key); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -623,7 +1083,7 @@ func addWebhookKey(w http.ResponseWriter, r *http.Request) {
 func deleteWebhookKey(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	if err := controllerManager.DeleteWebhookKey(id); err != nil {
+	if err := controllerManager.DeleteWebhookKey(id, requestActor(r)); err != nil {
 		logger.Errorf("error deleting webhook key: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -632,54 +1092,438 @@ func deleteWebhookKey(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func login(w http.ResponseWriter, r *http.Request) {
-	var creds *Credentials
-	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+func joinTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	tokens, err := controllerManager.JoinTokens()
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if !controllerManager.Authenticate(creds.Username, creds.Password) {
-		logger.Errorf("invalid login for %s from %s", creds.Username, r.RemoteAddr)
-		http.Error(w, "invalid username/password", http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		logger.Error(err)
+	}
+}
+
+func addJoinToken(w http.ResponseWriter, r *http.Request) {
+	var t *shipyard.JoinToken
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	// return token
-	token, err := controllerManager.NewAuthToken(creds.Username, r.UserAgent())
+	token, err := controllerManager.NewJoinToken(t, requestActor(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	logger.Infof("created join token id=%s labels=%s expires=%s", token.ID, strings.Join(token.Labels, ","), token.Expires)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(token); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		logger.Error(err)
 	}
 }
 
-func changePassword(w http.ResponseWriter, r *http.Request) {
-	session, _ := controllerManager.Store().Get(r, controllerManager.StoreKey)
-	var creds *Credentials
-	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+func removeJoinToken(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := controllerManager.RemoveJoinToken(id, requestActor(r)); err != nil {
+		if err == manager.ErrJoinTokenDoesNotExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	username := session.Values["username"].(string)
-	if username == "" {
-		http.Error(w, "unauthorized", http.StatusInternalServerError)
-		return
+	logger.Infof("removed join token id=%s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notificationStatus is the status of a notification channel error
+func notificationStatus(err error) int {
+	switch err.(type) {
+	case *notify.TemplateError:
+		return http.StatusBadRequest
 	}
-	if err := controllerManager.ChangePassword(username, creds.Password); err != nil {
+	switch err {
+	case manager.ErrNotificationChannelDoesNotExist:
+		return http.StatusNotFound
+	case shipyard.ErrInvalidNotificationType, shipyard.ErrNotificationNameRequired, shipyard.ErrNotificationURLRequired, shipyard.ErrNotificationSMTPRequired, shipyard.ErrNotificationRulesRequired:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func notificationChannels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	channels, err := controllerManager.NotificationChannels()
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	redacted := []*shipyard.NotificationChannel{}
+	for _, c := range channels {
+		redacted = append(redacted, c.Redacted())
+	}
+	if err := json.NewEncoder(w).Encode(redacted); err != nil {
+		logger.Error(err)
+	}
 }
 
-func hubWebhook(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-	key, err := controllerManager.WebhookKey(id)
+func notificationChannel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	c, err := controllerManager.NotificationChannel(mux.Vars(r)["id"])
 	if err != nil {
-		logger.Errorf("invalid webook key: id=%s from %s", id, r.RemoteAddr)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), notificationStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(c.Redacted()); err != nil {
+		logger.Error(err)
+	}
+}
+
+func addNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var c *shipyard.NotificationChannel
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := controllerManager.AddNotificationChannel(c, requestActor(r)); err != nil {
+		http.Error(w, err.Error(), notificationStatus(err))
+		return
+	}
+	logger.Infof("added notification channel id=%s name=%s type=%s", c.ID, c.Name, c.Type)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(c.Redacted()); err != nil {
+		logger.Error(err)
+	}
+}
+
+func updateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var c *shipyard.NotificationChannel
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.ID = mux.Vars(r)["id"]
+	if err := controllerManager.UpdateNotificationChannel(c, requestActor(r)); err != nil {
+		http.Error(w, err.Error(), notificationStatus(err))
+		return
+	}
+	logger.Infof("updated notification channel id=%s name=%s", c.ID, c.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func removeNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := controllerManager.RemoveNotificationChannel(id, requestActor(r)); err != nil {
+		http.Error(w, err.Error(), notificationStatus(err))
+		return
+	}
+	logger.Infof("removed notification channel id=%s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testNotificationChannel sends a test event; a failed delivery is
+// reported in the delivery status
+func testNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	d, err := controllerManager.TestNotificationChannel(mux.Vars(r)["id"], requestActor(r))
+	if err != nil {
+		http.Error(w, err.Error(), notificationStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		logger.Error(err)
+	}
+}
+
+func notificationDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	limit := defaultDeliveryLimit
+	if v := r.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+	deliveries, err := controllerManager.NotificationDeliveries(mux.Vars(r)["id"], limit)
+	if err != nil {
+		http.Error(w, err.Error(), notificationStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		logger.Error(err)
+	}
+}
+
+// joinEngine adds the engine of an agent that presents a join token
+func joinEngine(w http.ResponseWriter, r *http.Request) {
+	var req *shipyard.JoinRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req == nil {
+		req = &shipyard.JoinRequest{}
+	}
+	engine, err := controllerManager.Join(req, r.RemoteAddr)
+	if err != nil {
+		switch err {
+		case manager.ErrJoinTokenDoesNotExist, manager.ErrJoinTokenExpired, manager.ErrJoinTokenUsed:
+			logger.Warnf("rejected engine join from %s: %s", r.RemoteAddr, err)
+			writeAPIError(w, http.StatusForbidden, "invalid_join_token", "invalid join token")
+		case shipyard.ErrJoinEngineRequired, shipyard.ErrJoinCapacity, shipyard.ErrJoinTrustSettings:
+			writeAPIError(w, statusUnprocessableEntity, codeValidation, err.Error())
+		case manager.ErrEngineExists:
+			writeAPIError(w, http.StatusConflict, "engine_exists", err.Error())
+		default:
+			// the engine could not be reached with the given address and certificates
+			writeAPIError(w, statusUnprocessableEntity, "engine_unreachable", err.Error())
+		}
+		return
+	}
+	logger.Infof("joined engine id=%s addr=%s cpus=%f memory=%f from %s", engine.Engine.ID, engine.Engine.Addr, engine.Engine.Cpus, engine.Engine.Memory, r.RemoteAddr)
+	writeJSON(w, http.StatusCreated, engine.Redacted())
+}
+
+func login(w http.ResponseWriter, r *http.Request) {
+	var creds *Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	acct, err := controllerManager.Login(creds.Username, creds.Password, creds.Code, r.RemoteAddr)
+	if err != nil {
+		switch e := err.(type) {
+		case *manager.LockoutError:
+			logger.Warnf("locked login for %s from %s", creds.Username, r.RemoteAddr)
+			w.Header().Set("Retry-After", strconv.Itoa(int(e.RetryAfter().Seconds())))
+			http.Error(w, err.Error(), statusTooManyRequests)
+		default:
+			switch err {
+			case manager.ErrTOTPRequired:
+				// second step; the client retries with the code
+				w.Header().Set("content-type", "application/json")
+				json.NewEncoder(w).Encode(&shipyard.AuthToken{TOTPRequired: true})
+			case manager.ErrInvalidLogin, manager.ErrInvalidTOTPCode:
+				logger.Errorf("invalid login for %s from %s: %s", creds.Username, r.RemoteAddr, err)
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		}
+		return
+	}
+	// return token
+	token, err := controllerManager.NewAuthToken(creds.Username, r.UserAgent(), false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token.PasswordChangeRequired = acct.PasswordChangeRequired
+	token.TOTPEnrollmentRequired = acct.TOTPEnrollmentRequired()
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func ssoConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	if ssoProvider == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(ssoProvider.Config); err != nil {
+		logger.Error(err)
+	}
+}
+
+func ssoLogin(w http.ResponseWriter, r *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	req, err := ssoStates.New()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u := ssoProvider.AuthCodeURL(ssoProvider.Config.RedirectURL, req.State, req.Nonce, req.Verifier)
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// ssoCallback completes a browser login and redirects to the ui, which
+// stores the token from the url fragment.  Fragments are not sent to the
+// server so the token does not reach access logs.
+func ssoCallback(w http.ResponseWriter, r *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		logger.Warnf("sso login failed from %s: %s", r.RemoteAddr, e)
+		ssoRedirectError(w, r, e)
+		return
+	}
+	req := ssoStates.Take(r.FormValue("state"))
+	if req == nil {
+		logger.Warnf("invalid sso state from %s", r.RemoteAddr)
+		ssoRedirectError(w, r, "invalid or expired state")
+		return
+	}
+	tr, err := ssoProvider.Exchange(r.FormValue("code"), ssoProvider.Config.RedirectURL, req.Verifier)
+	if err != nil {
+		logger.Warnf("sso code exchange failed from %s: %s", r.RemoteAddr, err)
+		ssoRedirectError(w, r, err.Error())
+		return
+	}
+	login, _, err := ssoIssueToken(r, tr.IDToken, req.Nonce)
+	if err != nil {
+		ssoRedirectError(w, r, err.Error())
+		return
+	}
+	v := url.Values{}
+	v.Set("username", login.Username)
+	v.Set("token", login.AuthToken)
+	if login.TOTPEnrollmentRequired {
+		v.Set("totp_enrollment_required", "true")
+	}
+	http.Redirect(w, r, "/#/sso?"+v.Encode(), http.StatusFound)
+}
+
+// ssoRedirectError returns the browser to the login page with the error
+func ssoRedirectError(w http.ResponseWriter, r *http.Request, msg string) {
+	v := url.Values{}
+	v.Set("error", "single sign-on failed: "+msg)
+	http.Redirect(w, r, "/#/login?"+v.Encode(), http.StatusFound)
+}
+
+// ssoRequest starts a login for clients that run the authorization flow
+// themselves; the id token is only accepted with the nonce created here
+func ssoRequest(w http.ResponseWriter, r *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	req, err := ssoStates.New()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(&shipyard.SSORequest{State: req.State, Nonce: req.Nonce}); err != nil {
+		logger.Error(err)
+	}
+}
+
+func ssoToken(w http.ResponseWriter, r *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	var creds *SSOCredentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := ssoStates.Take(creds.State)
+	if req == nil {
+		logger.Warnf("invalid sso state from %s", r.RemoteAddr)
+		http.Error(w, "invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	login, status, err := ssoIssueToken(r, creds.IDToken, req.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(login); err != nil {
+		logger.Error(err)
+	}
+}
+
+// ssoIssueToken verifies the id token and issues a token for its account.
+// Errors are returned with the status for api clients.
+func ssoIssueToken(r *http.Request, idToken string, nonce string) (*shipyard.SSOLogin, int, error) {
+	claims, err := ssoProvider.Verify(idToken, nonce)
+	if err != nil {
+		logger.Warnf("invalid sso id token from %s: %s", r.RemoteAddr, err)
+		return nil, http.StatusForbidden, err
+	}
+	username, err := claims.Username()
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	role, err := ssoRoles.Role(claims)
+	if err != nil {
+		logger.Warnf("sso login denied for %s from %s: %s", username, r.RemoteAddr, err)
+		return nil, http.StatusForbidden, err
+	}
+	acct, err := controllerManager.SSOAccount(claims.Identity(), username, role)
+	if err != nil {
+		if err == manager.ErrSSOAccountConflict {
+			logger.Warnf("sso login denied for %s from %s: %s", username, r.RemoteAddr, err)
+			return nil, http.StatusForbidden, err
+		}
+		logger.Errorf("error saving sso account %s: %s", username, err)
+		return nil, http.StatusInternalServerError, err
+	}
+	// the account keeps its username when the username claim changes
+	username = acct.Username
+	multiFactor := claims.MultiFactor(ssoMFAValues)
+	token, err := controllerManager.NewAuthToken(username, r.UserAgent(), multiFactor)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	logger.Infof("sso login for %s (role=%s mfa=%v) from %s", username, role, multiFactor, r.RemoteAddr)
+	login := &shipyard.SSOLogin{
+		Username:               username,
+		AuthToken:              token.Token,
+		TOTPEnrollmentRequired: acct.TOTPEnrollmentRequired() && !multiFactor,
+	}
+	return login, http.StatusOK, nil
+}
+
+func changePassword(w http.ResponseWriter, r *http.Request) {
+	session, _ := controllerManager.Store().Get(r, STORE_KEY)
+	var creds *Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	username := session.Values["username"].(string)
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusInternalServerError)
+		return
+	}
+	if err := controllerManager.ChangePassword(username, creds.Password); err != nil {
+		if _, ok := err.(*shipyard.PasswordPolicyError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Infof("password changed for %s", username)
+}
+
+func hubWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	key, err := controllerManager.WebhookKey(id)
+	if err != nil {
+		logger.Errorf("invalid webook key: id=%s from %s", id, r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 	var webhook *dockerhub.Webhook
@@ -694,11 +1538,148 @@ func hubWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	logger.Infof("received webhook notification for %s", webhook.Repository.RepoName)
-	if err := controllerManager.RedeployContainers(webhook.Repository.RepoName); err != nil {
-		logger.Errorf("error redeploying containers: %s", err)
+	// redeploy in the background so docker hub does not wait on pulls
+	op := controllerManager.RedeployOperation(webhook.Repository.RepoName, "webhook:"+key.ID)
+	writeOperation(w, op, "/api")
+}
+
+func sessionUsername(r *http.Request) string {
+	session, _ := controllerManager.Store().Get(r, STORE_KEY)
+	username, _ := session.Values["username"].(string)
+	return username
+}
+
+// requestActor returns the name of the account or service key that made
+// the request for events and operations
+func requestActor(r *http.Request) string {
+	if id := manager.RequestIdentity(r); id != nil {
+		return id.Name
+	}
+	return sessionUsername(r)
+}
+
+func totpError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrInvalidTOTPCode:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case manager.ErrTOTPNotEnrolled, manager.ErrTOTPAlreadyEnabled:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrAccountDoesNotExist, manager.ErrRoleDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	username := sessionUsername(r)
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	enrollment, err := controllerManager.EnrollTOTP(username)
+	if err != nil {
+		totpError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(enrollment); err != nil {
+		logger.Error(err)
+	}
+}
+
+func activateTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	username := sessionUsername(r)
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var code *shipyard.TOTPCode
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	codes, err := controllerManager.ActivateTOTP(username, code.Code)
+	if err != nil {
+		totpError(w, err)
+		return
+	}
+	logger.Infof("enabled two-factor authentication for %s", username)
+	if err := json.NewEncoder(w).Encode(codes); err != nil {
+		logger.Error(err)
+	}
+}
+
+func disableTOTP(w http.ResponseWriter, r *http.Request) {
+	username := sessionUsername(r)
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var code *shipyard.TOTPCode
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := controllerManager.DisableTOTP(username, code.Code); err != nil {
+		totpError(w, err)
+		return
+	}
+	logger.Infof("disabled two-factor authentication for %s", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	username := sessionUsername(r)
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var code *shipyard.TOTPCode
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	codes, err := controllerManager.RegenerateRecoveryCodes(username, code.Code)
+	if err != nil {
+		totpError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(codes); err != nil {
+		logger.Error(err)
+	}
+}
+
+func resetAccountTOTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username := vars["username"]
+	if err := controllerManager.ResetTOTP(username, requestActor(r)); err != nil {
+		totpError(w, err)
 		return
 	}
+	logger.Infof("reset two-factor authentication for %s", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setRoleTOTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+	var t *RoleTOTP
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := controllerManager.SetRoleTOTP(name, t.Required, requestActor(r)); err != nil {
+		totpError(w, err)
+		return
+	}
+	logger.Infof("set role %s require_totp=%v", name, t.Required)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func main() {
@@ -715,122 +1696,305 @@ func main() {
 	if rAuthKey != "" {
 		rethinkdbAuthKey = rAuthKey
 	}
+	if v := os.Getenv("OIDC_CLIENT_SECRET"); v != "" {
+		oidcClientSecret = v
+	}
+	if v := os.Getenv("SHIPYARD_ADMIN_PASSWORD"); v != "" {
+		adminPassword = v
+	}
 	flag.Parse()
 	if showVersion {
 		fmt.Println(VERSION)
 		os.Exit(0)
 	}
+	if (tlsCertPath == "") != (tlsKeyPath == "") {
+		logger.Fatal("--tls-cert and --tls-key must be used together")
+	}
+	if tlsCACertPath != "" && tlsCertPath == "" {
+		logger.Fatal("--tls-ca requires --tls-cert and --tls-key")
+	}
+	logHook, err := configureLogging(logSinks)
+	if err != nil {
+		logger.Fatalf("invalid --log-sink: %s", err)
+	}
+	eventSinkList, err := logsink.Parse(eventSinks)
+	if err != nil {
+		logger.Fatalf("invalid --event-sink: %s", err)
+	}
+	var secretsKey []byte
+	if v := os.Getenv("SHIPYARD_SECRETS_KEY"); v != "" {
+		k, err := secrets.ParseKey(v)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		secretsKey = k
+	}
+	if secretsKeyFile != "" {
+		k, err := secrets.LoadKey(secretsKeyFile)
+		if err != nil {
+			logger.Fatalf("unable to load secrets key: %s", err)
+		}
+		secretsKey = k
+	}
 	var (
+		mgr       *manager.Manager
 		mErr      error
 		globalMux = http.NewServeMux()
 	)
 
 	logger.Infof("shipyard version %s", VERSION)
 
-	controllerManager, mErr = manager.NewManager(rethinkdbAddr, rethinkdbDatabase, rethinkdbAuthKey, VERSION, disableUsageInfo)
+	mgrOpts := &manager.Options{
+		EventRetention:           &eventRetention,
+		EventSinks:               eventSinkList,
+		HealthRetention:          healthRetention,
+		CertificateExpiryWarning: time.Duration(certExpiryDays) * 24 * time.Hour,
+		RunWorkers:               runWorkers,
+		PasswordPolicy:           passwordPolicy,
+		LoginLimiter:             manager.NewLoginLimiter(loginMaxAttempts, loginMaxAddr, loginLockout, loginLockoutMax),
+	}
+	if logDriver != "" {
+		opts, err := parseLogOpts(logDriverOpts)
+		if err != nil {
+			logger.Fatalf("invalid --container-log-opt: %s", err)
+		}
+		mgrOpts.ContainerLogConfig = &citadel.LogConfig{Type: logDriver, Config: opts}
+	}
+	if secretsKey != nil {
+		box, err := secrets.NewBox(secretsKey)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		mgrOpts.SecretsBox = box
+	}
+	mgr, mErr = manager.NewManager(rethinkdbAddr, rethinkdbDatabase, rethinkdbAuthKey, VERSION, disableUsageInfo, mgrOpts)
 	if mErr != nil {
 		logger.Fatal(mErr)
 	}
+	controllerManager = mgr
+
+	if oidcIssuer != "" {
+		mapping, err := oidc.ParseRoleMapping(oidcRoleMap)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		ssoRoles = &oidc.RoleMapper{
+			Claim:       oidcRoleClaim,
+			Mapping:     mapping,
+			DefaultRole: oidcDefaultRole,
+		}
+		for _, v := range strings.Split(oidcMFAValues, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				ssoMFAValues = append(ssoMFAValues, v)
+			}
+		}
+		p, err := oidc.NewProvider(&oidc.Config{
+			Issuer:       oidcIssuer,
+			ClientID:     oidcClientID,
+			ClientSecret: oidcClientSecret,
+			RedirectURL:  oidcRedirectURL,
+		})
+		if err != nil {
+			logger.Fatalf("unable to configure single sign-on: %s", err)
+		}
+		ssoProvider = p
+		logger.Infof("single sign-on enabled issuer=%s", oidcIssuer)
+	}
 
 	apiRouter := mux.NewRouter()
-	apiRouter.HandleFunc("/api/accounts", accounts).Methods("GET")
-	apiRouter.HandleFunc("/api/accounts", addAccount).Methods("POST")
-	apiRouter.HandleFunc("/api/accounts", deleteAccount).Methods("DELETE")
-	apiRouter.HandleFunc("/api/roles", roles).Methods("GET")
-	apiRouter.HandleFunc("/api/roles/{name}", role).Methods("GET")
-	apiRouter.HandleFunc("/api/roles", addRole).Methods("POST")
-	apiRouter.HandleFunc("/api/roles", deleteRole).Methods("DELETE")
-	apiRouter.HandleFunc("/api/cluster/info", clusterInfo).Methods("GET")
-	apiRouter.HandleFunc("/api/containers", containers).Methods("GET")
-	apiRouter.HandleFunc("/api/containers", run).Methods("POST")
-	apiRouter.HandleFunc("/api/containers/{id}", inspectContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/containers/{id}", destroy).Methods("DELETE")
-	apiRouter.HandleFunc("/api/containers/{id}/stop", stopContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/containers/{id}/restart", restartContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/containers/{id}/scale", scaleContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/containers/{id}/logs", containerLogs).Methods("GET")
-	apiRouter.HandleFunc("/api/events", events).Methods("GET")
-	apiRouter.HandleFunc("/api/events", purgeEvents).Methods("DELETE")
-	apiRouter.HandleFunc("/api/engines", engines).Methods("GET")
-	apiRouter.HandleFunc("/api/engines", addEngine).Methods("POST")
-	apiRouter.HandleFunc("/api/engines/{id}", inspectEngine).Methods("GET")
-	apiRouter.HandleFunc("/api/engines/{id}", removeEngine).Methods("DELETE")
-	apiRouter.HandleFunc("/api/extensions", extensions).Methods("GET")
-	apiRouter.HandleFunc("/api/extensions/{id}", extension).Methods("GET")
-	apiRouter.HandleFunc("/api/extensions", addExtension).Methods("POST")
-	apiRouter.HandleFunc("/api/extensions/{id}", deleteExtension).Methods("DELETE")
-	apiRouter.HandleFunc("/api/servicekeys", serviceKeys).Methods("GET")
-	apiRouter.HandleFunc("/api/servicekeys", addServiceKey).Methods("POST")
-	apiRouter.HandleFunc("/api/servicekeys", removeServiceKey).Methods("DELETE")
-	apiRouter.HandleFunc("/api/webhookkeys", webhookKeys).Methods("GET")
-	apiRouter.HandleFunc("/api/webhookkeys/{id}", webhookKey).Methods("GET")
-	apiRouter.HandleFunc("/api/webhookkeys", addWebhookKey).Methods("POST")
-	apiRouter.HandleFunc("/api/webhookkeys/{id}", deleteWebhookKey).Methods("DELETE")
+	apiRouter.NotFoundHandler = http.HandlerFunc(apiNotFound)
+	register(apiRouter, apiRoutes())
+	registerV2Routes(apiRouter)
 
 	// global handler
 	globalMux.Handle("/", http.FileServer(http.Dir("static")))
 
 	// api router; protected by auth
 	apiAuthRouter := negroni.New()
-	apiAuthRequired := auth.NewAuthRequired(controllerManager)
-	apiAccessRequired := access.NewAccessRequired(controllerManager)
+	apiAudit := audit.NewAudit(mgr, apiRouter)
+	apiAuthRequired := auth.NewAuthRequired(mgr)
+	apiAccessRequired := access.NewAccessRequired(mgr)
+	apiAuthRequired.SetErrorFunc(middlewareError)
+	apiAccessRequired.SetErrorFunc(middlewareError)
+	apiAuthRouter.Use(negroni.HandlerFunc(apiAudit.HandlerFuncWithNext))
 	apiAuthRouter.Use(negroni.HandlerFunc(apiAuthRequired.HandlerFuncWithNext))
 	apiAuthRouter.Use(negroni.HandlerFunc(apiAccessRequired.HandlerFuncWithNext))
 	apiAuthRouter.UseHandler(apiRouter)
 	globalMux.Handle("/api/", apiAuthRouter)
 
+	// api specification; public
+	globalMux.HandleFunc("/api/spec", apiSpec)
+
+	// liveness and readiness; public
+	globalMux.HandleFunc("/_ping", ping)
+	globalMux.HandleFunc("/_health", health)
+
 	// account router ; protected by auth
 	accountRouter := mux.NewRouter()
-	accountRouter.HandleFunc("/account/changepassword", changePassword).Methods("POST")
+	register(accountRouter, accountRoutes())
 	accountAuthRouter := negroni.New()
-	accountAuthRequired := auth.NewAuthRequired(controllerManager)
+	accountAudit := audit.NewAudit(mgr, accountRouter)
+	accountAuthRequired := auth.NewAuthRequired(mgr)
+	accountAuthRouter.Use(negroni.HandlerFunc(accountAudit.HandlerFuncWithNext))
 	accountAuthRouter.Use(negroni.HandlerFunc(accountAuthRequired.HandlerFuncWithNext))
 	accountAuthRouter.UseHandler(accountRouter)
 	globalMux.Handle("/account/", accountAuthRouter)
 
 	// login handler; public
 	loginRouter := mux.NewRouter()
-	loginRouter.HandleFunc("/auth/login", login).Methods("POST")
+	register(loginRouter, authRoutes())
 	globalMux.Handle("/auth/", loginRouter)
 
 	// hub handler; public
 	hubRouter := mux.NewRouter()
-	hubRouter.HandleFunc("/hub/webhook/{id}", hubWebhook).Methods("POST")
+	register(hubRouter, hubRoutes())
 	globalMux.Handle("/hub/", hubRouter)
 
-	// check for admin user
-	if _, err := controllerManager.Account("admin"); err == manager.ErrAccountDoesNotExist {
-		// create roles
-		r := &shipyard.Role{
-			Name: "admin",
-		}
-		ru := &shipyard.Role{
-			Name: "user",
-		}
-		if err := controllerManager.SaveRole(r); err != nil {
-			logger.Fatal(err)
-		}
-		if err := controllerManager.SaveRole(ru); err != nil {
-			logger.Fatal(err)
-		}
-		role, err := controllerManager.Role(r.Name)
-		if err != nil {
-			logger.Fatal(err)
+	// engine join handler; authenticated by the join token
+	joinRouter := mux.NewRouter()
+	register(joinRouter, joinRoutes())
+	globalMux.Handle("/join", joinRouter)
+
+	if err := mgr.Bootstrap(adminPassword); err != nil {
+		logger.Fatalf("unable to create admin account: %s", err)
+	}
+	if totpRoles != "" {
+		for _, name := range strings.Split(totpRoles, ",") {
+			if err := mgr.SetRoleTOTP(strings.TrimSpace(name), true, ""); err != nil {
+				logger.Fatalf("unable to require two-factor authentication for role %s: %s", name, err)
+			}
 		}
-		acct := &shipyard.Account{
-			Username: "admin",
-			Password: "shipyard",
-			Role:     role,
+	}
+
+	servers := []*server{newServer("controller", listenAddr, globalMux)}
+
+	if dockerListenAddr != "" {
+		// docker remote api proxy
+		proxy := dockerproxy.NewProxy(mgr)
+		proxy.PrivilegedRequiresTOTP = privilegedTOTP
+		proxyRouter := negroni.New()
+		proxyAudit := audit.NewAudit(mgr, proxy.Router())
+		proxyRouter.Use(negroni.HandlerFunc(proxyAudit.HandlerFuncWithNext))
+		proxyRouter.Use(negroni.HandlerFunc(proxy.HandlerFuncWithNext))
+		proxyRouter.UseHandler(proxy.Router())
+		servers = append(servers, newServer("docker api", dockerListenAddr, proxyRouter))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	errs := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *server) {
+			errs <- s.listen()
+		}(s)
+	}
+
+	select {
+	case err := <-errs:
+		logger.Fatal(err)
+	case sig := <-signals:
+		logger.Infof("received %s; shutting down", sig)
+	}
+
+	if err := shutdown(servers, shutdownTimeout); err != nil {
+		logger.Fatal(err)
+	}
+	logger.Info("shutdown complete")
+	if logHook != nil {
+		logHook.Close()
+	}
+}
+
+// parseLogOpts parses comma separated key=value docker log options
+func parseLogOpts(s string) (map[string]string, error) {
+	opts := map[string]string{}
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
 		}
-		if err := controllerManager.SaveAccount(acct); err != nil {
-			logger.Fatal(err)
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected key=value; received %s", opt)
 		}
-		logger.Infof("created admin user: username: admin password: shipyard")
+		opts[kv[0]] = kv[1]
 	}
+	return opts, nil
+}
 
-	logger.Infof("controller listening on %s", listenAddr)
+// configureLogging shares the controller logger with the other packages
+// and forwards it to the log sinks, if any
+func configureLogging(urls string) (*logsink.Hook, error) {
+	manager.SetLogger(logger)
+	dockerproxy.SetLogger(logger)
+	auth.SetLogger(logger)
+	audit.SetLogger(logger)
+	access.SetLogger(logger)
+
+	sinks, err := logsink.Parse(urls)
+	if err != nil || len(sinks) == 0 {
+		return nil, err
+	}
+	hook := logsink.NewHook(sinks)
+	logger.Hooks.Add(hook)
+	return hook, nil
+}
 
-	if err := http.ListenAndServe(listenAddr, context.ClearHandler(globalMux)); err != nil {
-		logger.Fatal(err)
+// shutdown drains the servers and then stops the background workers and
+// engine event monitors, giving up after timeout
+func shutdown(servers []*server, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			if err := s.shutdown(deadline); err != nil {
+				logger.Warn(err)
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	// operations started by the requests run in the background
+	if err := controllerManager.DrainOperations(deadline); err != nil {
+		logger.Warn(err)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- controllerManager.Close()
+	}()
+	select {
+	case err := <-closed:
+		return err
+	case <-time.After(deadline.Sub(time.Now())):
+		return fmt.Errorf("background workers did not stop within %s", timeout)
+	}
+}
+
+// serverTLSConfig returns the api tls config; with a ca certificate,
+// clients may authenticate with a certificate signed by it instead of a
+// token
+func serverTLSConfig(caCertPath string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caCertPath == "" {
+		return cfg, nil
+	}
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", caCertPath)
 	}
+	cfg.ClientCAs = pool
+	// browsers and token clients do not present a certificate
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
 }
@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	auditAppendRetries = 5
+)
+
+var (
+	ErrAuditConflict   = errors.New("unable to append audit record")
+	ErrAuditIncomplete = errors.New("audit log does not start at the first record")
+)
+
+type (
+	// AuditQuery filters audit records; zero values match everything
+	AuditQuery struct {
+		Actor  string
+		Method string
+		Since  time.Time
+		Until  time.Time
+		Limit  int
+	}
+)
+
+func (m *Manager) lastAuditRecord() (*shipyard.AuditRecord, error) {
+	res, err := r.Table(tblNameAudit).OrderBy(r.OrderByOpts{Index: r.Desc("id")}).Limit(1).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsNil() {
+		return nil, nil
+	}
+	var rec *shipyard.AuditRecord
+	if err := res.One(&rec); err != nil {
+		if err == r.ErrEmptyResult {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// SaveAuditRecord appends the record to the audit log.  The record id is
+// its sequence number so an insert conflicts instead of overwriting when
+// another controller appended first; in that case the record is chained
+// to the new tail and retried.
+func (m *Manager) SaveAuditRecord(rec *shipyard.AuditRecord) error {
+	m.auditLock.Lock()
+	defer m.auditLock.Unlock()
+
+	for i := 0; i < auditAppendRetries; i++ {
+		prev, err := m.lastAuditRecord()
+		if err != nil {
+			return err
+		}
+		rec.Chain(prev)
+		res, err := r.Table(tblNameAudit).Insert(rec).RunWrite(m.session)
+		if err != nil {
+			return err
+		}
+		if res.Errors == 0 {
+			return nil
+		}
+	}
+	return ErrAuditConflict
+}
+
+// AuditRecords returns matching records, newest first
+func (m *Manager) AuditRecords(q *AuditQuery) ([]*shipyard.AuditRecord, error) {
+	t := r.Table(tblNameAudit).OrderBy(r.OrderByOpts{Index: r.Desc("id")})
+	if q.Actor != "" {
+		t = t.Filter(r.Row.Field("actor").Eq(q.Actor))
+	}
+	if q.Method != "" {
+		t = t.Filter(r.Row.Field("method").Eq(q.Method))
+	}
+	if !q.Since.IsZero() {
+		t = t.Filter(r.Row.Field("time").Ge(q.Since))
+	}
+	if !q.Until.IsZero() {
+		t = t.Filter(r.Row.Field("time").Le(q.Until))
+	}
+	if q.Limit > 0 {
+		t = t.Limit(q.Limit)
+	}
+	res, err := t.Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	records := []*shipyard.AuditRecord{}
+	if err := res.All(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ExportAudit calls fn for every record in ascending order
+func (m *Manager) ExportAudit(fn func(*shipyard.AuditRecord) error) error {
+	res, err := r.Table(tblNameAudit).OrderBy(r.OrderByOpts{Index: r.Asc("id")}).Run(m.session)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	var rec *shipyard.AuditRecord
+	for res.Next(&rec) {
+		if err := fn(rec); err != nil {
+			return err
+		}
+		rec = nil
+	}
+	return res.Err()
+}
+
+// VerifyAudit walks the complete audit log and verifies the hash chain
+func (m *Manager) VerifyAudit() (int, error) {
+	count := 0
+	var prev *shipyard.AuditRecord
+	err := m.ExportAudit(func(rec *shipyard.AuditRecord) error {
+		chain := []*shipyard.AuditRecord{rec}
+		if prev != nil {
+			chain = []*shipyard.AuditRecord{prev, rec}
+		} else if rec.Sequence != 1 {
+			return ErrAuditIncomplete
+		}
+		if err := shipyard.VerifyAuditChain(chain); err != nil {
+			return err
+		}
+		prev = rec
+		count++
+		return nil
+	})
+	return count, err
+}
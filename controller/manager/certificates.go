@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/secrets"
+)
+
+const (
+	defaultCertExpiryWarning = time.Duration(30 * 24 * time.Hour)
+	certCheckFreq            = time.Duration(1 * time.Hour)
+	// certWarnFreq limits expiry warnings to one event per engine per day
+	certWarnFreq = time.Duration(24 * time.Hour)
+)
+
+func engineKeyName(e *shipyard.Engine) string {
+	return fmt.Sprintf("engine/%s/ssl_key", e.Engine.ID)
+}
+
+// sealEngineKey returns a copy of the engine with the private key sealed
+// for storage.  Keys are stored in plain text when no master key is
+// configured.
+func (m *Manager) sealEngineKey(e *shipyard.Engine) (*shipyard.Engine, error) {
+	rec := *e
+	rec.CertificateExpires = nil
+	if m.secretsBox == nil || rec.SSLKey == "" || secrets.IsSealed(rec.SSLKey) {
+		return &rec, nil
+	}
+	sealed, err := m.secretsBox.SealValue(engineKeyName(e), rec.SSLKey)
+	if err != nil {
+		return nil, err
+	}
+	rec.SSLKey = sealed
+	return &rec, nil
+}
+
+// openEngineKey decrypts the private key in place.  The sealed value is
+// kept on error so that saving the engine does not lose the key.
+func (m *Manager) openEngineKey(e *shipyard.Engine) error {
+	if !secrets.IsSealed(e.SSLKey) {
+		return nil
+	}
+	if m.secretsBox == nil {
+		return ErrSecretsNotConfigured
+	}
+	key, err := m.secretsBox.OpenValue(engineKeyName(e), e.SSLKey)
+	if err != nil {
+		return err
+	}
+	e.SSLKey = key
+	return nil
+}
+
+// encryptEngineKeys saves engines whose private keys were stored before a
+// master key was configured so the keys are sealed.  Without a master key
+// it only warns that the keys are stored in plain text.
+func (m *Manager) encryptEngineKeys(engines []*shipyard.Engine) {
+	if m.secretsBox == nil {
+		if len(engines) > 0 {
+			logger.Warnf("tls keys of %d engines are stored unencrypted; configure a master key (--secrets-key-file) to encrypt them", len(engines))
+		}
+		return
+	}
+	for _, e := range engines {
+		if err := m.SaveEngine(e); err != nil {
+			logger.Errorf("unable to encrypt tls key for engine %s: %s", e.Engine.ID, err)
+			continue
+		}
+		logger.Infof("encrypted tls key for engine %s", e.Engine.ID)
+	}
+}
+
+// RotateEngineCertificates replaces the client certificate and key of an
+// engine.  The new certificate must be able to reach the engine before it
+// is saved.  The CA certificate is kept when not given.
+func (m *Manager) RotateEngineCertificates(id string, certs *shipyard.EngineCertificates, actor string) error {
+	engine := m.Engine(id)
+	if engine == nil {
+		return ErrEngineDoesNotExist
+	}
+	if _, err := tls.X509KeyPair([]byte(certs.SSLCertificate), []byte(certs.SSLKey)); err != nil {
+		return fmt.Errorf("invalid certificate or key: %s", err)
+	}
+	rotated := *engine
+	rotated.SSLCertificate = certs.SSLCertificate
+	rotated.SSLKey = certs.SSLKey
+	if certs.CACertificate != "" {
+		rotated.CACertificate = certs.CACertificate
+	}
+	stat, err := rotated.Ping()
+	if err != nil {
+		return err
+	}
+	if stat != 200 {
+		return fmt.Errorf("Received status code '%d' when contacting %s", stat, engine.Engine.Addr)
+	}
+	if err := m.SaveEngine(&rotated); err != nil {
+		return err
+	}
+	m.certLock.Lock()
+	delete(m.certWarned, id)
+	m.certLock.Unlock()
+	if err := m.reloadEngine(id); err != nil {
+		return err
+	}
+	evt := &shipyard.Event{
+		Type:    "rotate-engine-certificates",
+		Message: fmt.Sprintf("addr=%s", engine.Engine.Addr),
+		Time:    time.Now(),
+		Engine:  engine.Engine,
+		Actor:   actor,
+		Tags:    []string{"cluster", "security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) certificateCheck() {
+	if m.IsLeader() {
+		m.checkCertificates()
+	}
+	t := time.NewTicker(certCheckFreq)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if !m.IsLeader() {
+				continue
+			}
+			m.checkCertificates()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *Manager) checkCertificates() {
+	now := time.Now()
+	for _, e := range m.Engines() {
+		notAfter, ok := e.CertificateNotAfter()
+		if !ok || notAfter.Sub(now) > m.certExpiryWarning {
+			continue
+		}
+		m.certLock.Lock()
+		last, warned := m.certWarned[e.ID]
+		if warned && now.Sub(last) < certWarnFreq {
+			m.certLock.Unlock()
+			continue
+		}
+		m.certWarned[e.ID] = now
+		m.certLock.Unlock()
+
+		logger.Warnf("tls certificate for engine %s expires %s", e.Engine.ID, notAfter.Format(time.RFC3339))
+		evt := &shipyard.Event{
+			Type:    "engine-certificate-expiring",
+			Message: fmt.Sprintf("addr=%s not_after=%s", e.Engine.Addr, notAfter.Format(time.RFC3339)),
+			Time:    now,
+			Engine:  e.Engine,
+			Tags:    []string{"cluster", "security"},
+		}
+		if err := m.SaveEvent(evt); err != nil {
+			logger.Errorf("error saving event: %s", err)
+		}
+	}
+}
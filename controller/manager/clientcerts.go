@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"crypto/tls"
+	"errors"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+var (
+	ErrClientCertificateNotMapped = errors.New("client certificate does not map to an account or service key")
+	ErrCommonNameExists           = errors.New("a service key already uses this common name")
+)
+
+// ClientCommonName returns the common name of a verified client
+// certificate or an empty string when the client did not present one
+func ClientCommonName(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+// VerifyClientCertificate maps the common name of a verified client
+// certificate to a service key with the same common name or, failing
+// that, to the account with the same username.  Exactly one of the
+// returned account and service key is set on success.  Accounts that
+// must change their password or enroll in two-factor authentication are
+// returned with ErrPasswordChangeRequired or ErrTOTPEnrollmentRequired,
+// the same as VerifyAuthToken.
+func (m *Manager) VerifyClientCertificate(cn string, addr string) (*shipyard.Account, *shipyard.ServiceKey, error) {
+	if cn == "" {
+		return nil, nil, ErrClientCertificateNotMapped
+	}
+	k, err := m.serviceKeyByCommonName(cn)
+	switch err {
+	case nil:
+		key, err := m.verifyServiceKey(k, addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, key, nil
+	case ErrServiceKeyDoesNotExist:
+	default:
+		return nil, nil, err
+	}
+	acct, err := m.Account(cn)
+	if err != nil {
+		if err == ErrAccountDoesNotExist {
+			return nil, nil, ErrClientCertificateNotMapped
+		}
+		return nil, nil, err
+	}
+	return acct, nil, accountRestriction(acct, false)
+}
+
+func (m *Manager) serviceKeyByCommonName(cn string) (*shipyard.ServiceKey, error) {
+	res, err := r.Table(tblNameServiceKeys).Filter(map[string]string{"common_name": cn}).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsNil() {
+		return nil, ErrServiceKeyDoesNotExist
+	}
+	var k *shipyard.ServiceKey
+	if err := res.One(&k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
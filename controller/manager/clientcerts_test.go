@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestClientCommonName(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci"}}
+	if cn := ClientCommonName(nil); cn != "" {
+		t.Errorf("expected no common name without tls; received %q", cn)
+	}
+	unverified := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if cn := ClientCommonName(unverified); cn != "" {
+		t.Errorf("expected no common name for an unverified certificate; received %q", cn)
+	}
+	verified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	if cn := ClientCommonName(verified); cn != "ci" {
+		t.Errorf("expected common name ci; received %q", cn)
+	}
+}
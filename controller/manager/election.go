@@ -0,0 +1,237 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	defaultLeaseTTL = 15 * time.Second
+	leaseID         = "controller"
+	// controllers that have not been seen for memberTimeout leases are
+	// no longer members
+	memberTimeout = 3
+)
+
+type (
+	// LeaseStore grants a lease to one holder at a time
+	LeaseStore interface {
+		// Acquire takes the lease for holder when it is free or expired,
+		// renews it when holder already has it and returns the holder
+		Acquire(holder string, ttl time.Duration) (string, error)
+		// Release expires the lease when it is held by holder
+		Release(holder string) error
+	}
+
+	// Elector elects one leader among the controllers that share a lease
+	// store.  A controller that cannot reach the store steps down, and a
+	// leader that has not renewed the lease within TTL is no longer the
+	// leader even if its campaign is stuck.
+	Elector struct {
+		ID  string
+		TTL time.Duration
+
+		store    LeaseStore
+		now      func() time.Time
+		mux      sync.RWMutex
+		leader   string
+		isLeader bool
+		deadline time.Time
+	}
+)
+
+func NewElector(id string, store LeaseStore, ttl time.Duration) *Elector {
+	return &Elector{
+		ID:    id,
+		TTL:   ttl,
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Campaign takes or renews the lease and reports whether this controller
+// is the leader
+func (e *Elector) Campaign() bool {
+	// the lease may expire TTL after it was requested
+	acquired := e.now()
+	holder, err := e.store.Acquire(e.ID, e.TTL)
+	if err != nil {
+		logger.Warnf("unable to acquire controller lease: %s", err)
+		holder = ""
+	}
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	was := e.isLeader
+	e.leader = holder
+	e.isLeader = holder == e.ID
+	e.deadline = acquired.Add(e.TTL)
+	switch {
+	case e.isLeader && !was:
+		logger.Infof("controller %s is the leader", e.ID)
+	case was && !e.isLeader:
+		logger.Warnf("controller %s is no longer the leader", e.ID)
+	}
+	return e.isLeader
+}
+
+// Resign gives up the lease so that another controller can lead
+func (e *Elector) Resign() error {
+	e.mux.Lock()
+	was := e.isLeader
+	e.isLeader = false
+	e.leader = ""
+	e.mux.Unlock()
+	if !was {
+		return nil
+	}
+	return e.store.Release(e.ID)
+}
+
+// IsLeader reports whether this controller holds an unexpired lease
+func (e *Elector) IsLeader() bool {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+	return e.isLeader && e.now().Before(e.deadline)
+}
+
+// Leader returns the id of the leader as of the last campaign
+func (e *Elector) Leader() string {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+	return e.leader
+}
+
+// rethinkLeases keeps the lease in the store.  Expiry uses the time of
+// the database so that controllers do not depend on their clocks.
+type rethinkLeases struct {
+	session *r.Session
+}
+
+func (l *rethinkLeases) Acquire(holder string, ttl time.Duration) (string, error) {
+	lease := map[string]interface{}{
+		"id":      leaseID,
+		"holder":  holder,
+		"expires": r.Now().Add(ttl.Seconds()),
+	}
+	// fails without an error when the lease exists
+	if _, err := r.Table(tblNameLeases).Insert(lease).RunWrite(l.session); err != nil {
+		return "", err
+	}
+	takeover := r.Row.Field("holder").Eq(holder).Or(r.Row.Field("expires").Lt(r.Now()))
+	if _, err := r.Table(tblNameLeases).Get(leaseID).Update(r.Branch(takeover, lease, map[string]interface{}{})).RunWrite(l.session); err != nil {
+		return "", err
+	}
+	res, err := r.Table(tblNameLeases).Get(leaseID).Run(l.session)
+	if err != nil {
+		return "", err
+	}
+	var current struct {
+		Holder string `gorethink:"holder"`
+	}
+	if err := res.One(&current); err != nil {
+		return "", err
+	}
+	return current.Holder, nil
+}
+
+func (l *rethinkLeases) Release(holder string) error {
+	expire := map[string]interface{}{"expires": r.Now()}
+	_, err := r.Table(tblNameLeases).Get(leaseID).Update(r.Branch(r.Row.Field("holder").Eq(holder), expire, map[string]interface{}{})).RunWrite(l.session)
+	return err
+}
+
+func newControllerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "controller"
+	}
+	return fmt.Sprintf("%s-%s", hostname, generateId(8))
+}
+
+// IsLeader reports whether this controller runs the background checks
+func (m *Manager) IsLeader() bool {
+	return m.elector.IsLeader()
+}
+
+// ControllerID returns the id of this controller
+func (m *Manager) ControllerID() string {
+	return m.controller.ID
+}
+
+// leaderElection campaigns for the lease and records this controller as
+// a member until the manager is closed
+func (m *Manager) leaderElection() {
+	t := time.NewTicker(m.elector.TTL / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.elector.Campaign()
+			m.heartbeat()
+		case <-m.done:
+			if err := m.elector.Resign(); err != nil {
+				logger.Warnf("unable to release controller lease: %s", err)
+			}
+			if _, err := r.Table(tblNameControllers).Get(m.controller.ID).Delete().RunWrite(m.session); err != nil {
+				logger.Warnf("unable to remove controller %s: %s", m.controller.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// heartbeat records this controller as a live member.  The leader removes
+// members that have not been seen for a while.
+func (m *Manager) heartbeat() {
+	m.controller.LastSeen = time.Now()
+	if _, err := r.Table(tblNameControllers).Insert(m.controller, r.InsertOpts{Conflict: "replace"}).RunWrite(m.session); err != nil {
+		logger.Warnf("unable to record controller %s: %s", m.controller.ID, err)
+		return
+	}
+	if !m.IsLeader() {
+		return
+	}
+	stale := time.Now().Add(-memberTimeout * m.elector.TTL)
+	if _, err := r.Table(tblNameControllers).Filter(r.Row.Field("last_seen").Lt(stale)).Delete().RunWrite(m.session); err != nil {
+		logger.Warnf("unable to remove stale controllers: %s", err)
+	}
+}
+
+// Controllers returns the live controllers and the leader
+func (m *Manager) Controllers() (*shipyard.ControllerMembership, error) {
+	res, err := r.Table(tblNameControllers).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	controllers := []*shipyard.Controller{}
+	if err := res.All(&controllers); err != nil {
+		return nil, err
+	}
+	leader := m.elector.Leader()
+	stale := time.Now().Add(-memberTimeout * m.elector.TTL)
+	membership := &shipyard.ControllerMembership{
+		Leader:      leader,
+		Controllers: []*shipyard.Controller{},
+	}
+	for _, c := range controllers {
+		if c.LastSeen.Before(stale) {
+			continue
+		}
+		c.Leader = c.ID == leader
+		membership.Controllers = append(membership.Controllers, c)
+	}
+	sort.Sort(controllersByID(membership.Controllers))
+	return membership, nil
+}
+
+type controllersByID []*shipyard.Controller
+
+func (c controllersByID) Len() int           { return len(c) }
+func (c controllersByID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c controllersByID) Less(i, j int) bool { return c[i].ID < c[j].ID }
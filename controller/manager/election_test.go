@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLeases keeps the lease in memory with a settable clock
+type memoryLeases struct {
+	mux     sync.Mutex
+	now     time.Time
+	holder  string
+	expires time.Time
+	err     error
+}
+
+func (l *memoryLeases) Acquire(holder string, ttl time.Duration) (string, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.err != nil {
+		return "", l.err
+	}
+	if l.holder == "" || l.holder == holder || l.expires.Before(l.now) {
+		l.holder = holder
+		l.expires = l.now.Add(ttl)
+	}
+	return l.holder, nil
+}
+
+func (l *memoryLeases) Release(holder string) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.holder == holder {
+		l.expires = l.now
+	}
+	return nil
+}
+
+func (l *memoryLeases) advance(d time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.now = l.now.Add(d)
+}
+
+func TestElectorSingleLeader(t *testing.T) {
+	leases := &memoryLeases{now: time.Now()}
+	a := NewElector("a", leases, time.Second*15)
+	b := NewElector("b", leases, time.Second*15)
+	if !a.Campaign() {
+		t.Fatal("expected a to lead")
+	}
+	if b.Campaign() {
+		t.Fatal("expected b to follow")
+	}
+	if b.Leader() != "a" {
+		t.Errorf("expected b to see a as the leader; received %q", b.Leader())
+	}
+	leases.advance(time.Second * 10)
+	if !a.Campaign() || b.Campaign() {
+		t.Fatal("expected a to renew the lease")
+	}
+}
+
+func TestElectorTakeoverAfterExpiry(t *testing.T) {
+	leases := &memoryLeases{now: time.Now()}
+	a := NewElector("a", leases, time.Second*15)
+	b := NewElector("b", leases, time.Second*15)
+	a.Campaign()
+	leases.advance(time.Second * 16)
+	if !b.Campaign() {
+		t.Fatal("expected b to take the expired lease")
+	}
+	if a.Campaign() || a.IsLeader() {
+		t.Fatal("expected a to step down")
+	}
+}
+
+func TestElectorResign(t *testing.T) {
+	leases := &memoryLeases{now: time.Now()}
+	a := NewElector("a", leases, time.Second*15)
+	b := NewElector("b", leases, time.Second*15)
+	a.Campaign()
+	if err := a.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	leases.advance(time.Millisecond)
+	if !b.Campaign() {
+		t.Fatal("expected b to lead after a resigned")
+	}
+}
+
+func TestElectorStepsDownWithoutStore(t *testing.T) {
+	leases := &memoryLeases{now: time.Now()}
+	a := NewElector("a", leases, time.Second*15)
+	a.Campaign()
+	leases.err = errors.New("connection refused")
+	if a.Campaign() || a.IsLeader() || a.Leader() != "" {
+		t.Fatal("expected a to step down when the store is unavailable")
+	}
+}
+
+func TestElectorLeadershipExpires(t *testing.T) {
+	leases := &memoryLeases{now: time.Now()}
+	a := NewElector("a", leases, time.Second*15)
+	a.now = func() time.Time {
+		leases.mux.Lock()
+		defer leases.mux.Unlock()
+		return leases.now
+	}
+	if !a.Campaign() {
+		t.Fatal("expected a to lead")
+	}
+	leases.advance(time.Second * 16)
+	if a.IsLeader() {
+		t.Fatal("expected a to step down when the lease was not renewed")
+	}
+}
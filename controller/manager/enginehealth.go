@@ -0,0 +1,269 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	engineCheckFreq    = 10 * time.Second
+	engineCheckTimeout = 5 * time.Second
+	// engines are flapping after flapThreshold transitions in flapWindow
+	flapWindow             = 10 * time.Minute
+	flapThreshold          = 4
+	healthPruneFreq        = 10 * time.Minute
+	defaultHealthRetention = 7 * 24 * time.Hour
+)
+
+// FlapDetector counts the up and down transitions of each engine and
+// reports engines with Threshold or more transitions within Window as
+// flapping
+type FlapDetector struct {
+	Window    time.Duration
+	Threshold int
+
+	mux         sync.Mutex
+	transitions map[string][]time.Time
+	flapping    map[string]bool
+}
+
+func NewFlapDetector(window time.Duration, threshold int) *FlapDetector {
+	return &FlapDetector{
+		Window:      window,
+		Threshold:   threshold,
+		transitions: make(map[string][]time.Time),
+		flapping:    make(map[string]bool),
+	}
+}
+
+// Observe records a check at now and whether it was a transition.  It
+// returns whether the engine is flapping and whether that changed with
+// this check.
+func (d *FlapDetector) Observe(id string, transition bool, now time.Time) (flapping bool, changed bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	recent := []time.Time{}
+	for _, t := range d.transitions[id] {
+		if now.Sub(t) < d.Window {
+			recent = append(recent, t)
+		}
+	}
+	if transition {
+		recent = append(recent, now)
+	}
+	d.transitions[id] = recent
+
+	flapping = len(recent) >= d.Threshold
+	changed = flapping != d.flapping[id]
+	d.flapping[id] = flapping
+	return flapping, changed
+}
+
+// Forget drops the transitions of a removed engine
+func (d *FlapDetector) Forget(id string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	delete(d.transitions, id)
+	delete(d.flapping, id)
+}
+
+func (m *Manager) engineCheck() {
+	t := time.NewTicker(engineCheckFreq)
+	defer t.Stop()
+	prune := time.NewTicker(healthPruneFreq)
+	defer prune.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			if !m.IsLeader() {
+				continue
+			}
+			m.checkEngines()
+		case <-prune.C:
+			if !m.IsLeader() {
+				continue
+			}
+			m.pruneEngineHealth()
+		}
+	}
+}
+
+// checkEngines checks all engines in parallel and stores the results
+func (m *Manager) checkEngines() {
+	engs := m.Engines()
+	checks := make([]*shipyard.HealthCheck, len(engs))
+	var wg sync.WaitGroup
+	for i, eng := range engs {
+		wg.Add(1)
+		go func(i int, eng *shipyard.Engine) {
+			defer wg.Done()
+			checks[i] = m.checkEngine(eng)
+		}(i, eng)
+	}
+	wg.Wait()
+
+	if len(checks) == 0 {
+		return
+	}
+	if _, err := r.Table(tblNameEngineHealth).Insert(checks).RunWrite(m.session); err != nil {
+		logger.Errorf("unable to save engine health checks: %s", err)
+	}
+}
+
+// pingEngine pings the engine and gives up after engineCheckTimeout
+func pingEngine(eng *shipyard.Engine) (int, error) {
+	type result struct {
+		status int
+		err    error
+	}
+	res := make(chan result, 1)
+	go func() {
+		stat, err := eng.Ping()
+		res <- result{stat, err}
+	}()
+	select {
+	case r := <-res:
+		return r.status, r.err
+	case <-time.After(engineCheckTimeout):
+		return 0, fmt.Errorf("no response within %s", engineCheckTimeout)
+	}
+}
+
+// checkEngine updates the health, version and inventory of the engine and
+// records transitions and flapping as events
+func (m *Manager) checkEngine(eng *shipyard.Engine) *shipyard.HealthCheck {
+	start := time.Now()
+	check := &shipyard.HealthCheck{
+		EngineID: eng.ID,
+		Time:     start,
+		Status:   EngineHealthUp,
+	}
+	stat, err := pingEngine(eng)
+	if err != nil {
+		logger.Warnf("unable to ping engine %s: %s", eng.Engine.ID, err)
+		check.Error = err.Error()
+	}
+	if stat != 200 {
+		check.Status = EngineHealthDown
+	} else {
+		check.ResponseTime = int64(time.Since(start) / time.Nanosecond)
+	}
+
+	prev := eng.Health
+	health := &shipyard.Health{
+		Status:       check.Status,
+		ResponseTime: check.ResponseTime,
+		Error:        check.Error,
+	}
+	// pending engines have not been checked; only a first failure is
+	// worth an event
+	known := prev != nil && (prev.Status == EngineHealthUp || prev.Status == EngineHealthDown)
+	transition := known && prev.Status != check.Status
+	if known && !transition {
+		health.Since = prev.Since
+	} else {
+		health.Since = &start
+	}
+	flapping, flapChanged := m.flaps.Observe(eng.ID, transition, start)
+	health.Flapping = flapping
+	eng.Health = health
+
+	if transition || (!known && check.Status == EngineHealthDown) {
+		m.engineHealthEvent(eng, "engine-"+check.Status, check.Error)
+	}
+	if flapChanged {
+		if flapping {
+			m.engineHealthEvent(eng, "engine-flapping", fmt.Sprintf("%d transitions in %s", m.flaps.Threshold, m.flaps.Window))
+		} else {
+			m.engineHealthEvent(eng, "engine-stable", "")
+		}
+	}
+
+	if check.Status == EngineHealthUp {
+		version, err := eng.Engine.Version()
+		if err != nil {
+			logger.Warnf("unable to detect docker version: %s", err)
+		} else if version != nil {
+			eng.DockerVersion = version.Version
+		}
+		inv, err := engineInventory(eng)
+		if err != nil {
+			logger.Warnf("unable to detect capacity of engine %s: %s", eng.Engine.ID, err)
+		} else {
+			eng.Inventory = inv
+			m.checkCapacity(eng)
+		}
+	}
+	if err := m.saveEngineStatus(eng); err != nil {
+		logger.Errorf("unable to save engine %s: %s", eng.Engine.ID, err)
+	}
+	return check
+}
+
+// saveEngineStatus writes the health, docker version and inventory of an
+// engine.  The rest of the record is left alone; saving it would reseal the
+// key with a new nonce and every controller would reconnect the engine.
+func (m *Manager) saveEngineStatus(eng *shipyard.Engine) error {
+	_, err := r.Table(tblNameConfig).Get(eng.ID).Update(map[string]interface{}{
+		"health":        eng.Health,
+		"DockerVersion": eng.DockerVersion,
+		"inventory":     eng.Inventory,
+	}).RunWrite(m.session)
+	return err
+}
+
+func (m *Manager) engineHealthEvent(eng *shipyard.Engine, typ string, detail string) {
+	msg := fmt.Sprintf("addr=%s", eng.Engine.Addr)
+	if detail != "" {
+		msg = fmt.Sprintf("%s %s", msg, detail)
+	}
+	logger.Infof("%s id=%s %s", typ, eng.Engine.ID, msg)
+	evt := &shipyard.Event{
+		Type:    typ,
+		Message: msg,
+		Time:    time.Now(),
+		Engine:  eng.Engine,
+		Tags:    []string{"cluster", "health"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		logger.Errorf("unable to save engine health event: %s", err)
+	}
+}
+
+// pruneEngineHealth removes the checks older than the retention
+func (m *Manager) pruneEngineHealth() {
+	cutoff := time.Now().Add(-m.healthRetention)
+	if _, err := r.Table(tblNameEngineHealth).Between(time.Unix(0, 0), cutoff, r.BetweenOpts{Index: "time"}).Delete().RunWrite(m.session); err != nil {
+		logger.Errorf("unable to prune engine health checks: %s", err)
+	}
+}
+
+// EngineHealth returns the uptime of the engine since the time and its
+// latest limit health checks
+func (m *Manager) EngineHealth(id string, since time.Time, limit int) (*shipyard.EngineHealthHistory, error) {
+	eng := m.Engine(id)
+	if eng == nil {
+		return nil, ErrEngineDoesNotExist
+	}
+	res, err := r.Table(tblNameEngineHealth).Between([]interface{}{id, since}, []interface{}{id, time.Now().Add(time.Hour)}, r.BetweenOpts{Index: "engine_time"}).OrderBy(r.OrderByOpts{Index: r.Asc("engine_time")}).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	checks := []*shipyard.HealthCheck{}
+	if err := res.All(&checks); err != nil {
+		return nil, err
+	}
+	history := shipyard.NewEngineHealthHistory(id, eng.Health, since, checks)
+	if limit >= 0 && len(history.Checks) > limit {
+		history.Checks = history.Checks[len(history.Checks)-limit:]
+	}
+	return history, nil
+}
@@ -0,0 +1,40 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlapDetector(t *testing.T) {
+	d := NewFlapDetector(time.Minute*10, 3)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if flapping, _ := d.Observe("e1", true, now.Add(time.Duration(i)*time.Minute)); flapping {
+			t.Fatalf("expected no flapping after %d transitions", i+1)
+		}
+	}
+	flapping, changed := d.Observe("e1", true, now.Add(time.Minute*2))
+	if !flapping || !changed {
+		t.Fatal("expected flapping to start with the third transition")
+	}
+	if flapping, changed := d.Observe("e1", false, now.Add(time.Minute*3)); !flapping || changed {
+		t.Error("expected flapping to continue without a change")
+	}
+	if flapping, _ := d.Observe("e2", false, now); flapping {
+		t.Error("expected engines to be tracked separately")
+	}
+	flapping, changed = d.Observe("e1", false, now.Add(time.Minute*11))
+	if flapping || !changed {
+		t.Error("expected flapping to stop once transitions leave the window")
+	}
+}
+
+func TestFlapDetectorForget(t *testing.T) {
+	d := NewFlapDetector(time.Minute, 1)
+	now := time.Now()
+	d.Observe("e1", true, now)
+	d.Forget("e1")
+	if flapping, changed := d.Observe("e1", false, now); flapping || changed {
+		t.Error("expected a forgotten engine to start over")
+	}
+}
@@ -0,0 +1,328 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/logsink"
+)
+
+const (
+	eventPruneFreq        = 10 * time.Minute
+	defaultEventRetention = 30 * 24 * time.Hour
+	// maxEventID sorts after every generated event id
+	maxEventID = "\uffff"
+)
+
+type (
+	// EventRetention removes events older than MaxAge and all but the
+	// newest MaxCount events; zero values keep everything.  Events are
+	// appended to a JSON lines file in ArchiveDir before they are removed.
+	EventRetention struct {
+		MaxAge     time.Duration
+		MaxCount   int
+		ArchiveDir string
+	}
+
+	// eventKey is a position in the time index of the events table
+	eventKey struct {
+		Time time.Time
+		ID   string
+	}
+)
+
+// eventsRange selects the events in the time range of the query from the
+// most selective index, excluding events at or after the cursor
+func eventsRange(q *shipyard.EventQuery) (r.Term, string, error) {
+	index, prefix := "time", []interface{}{}
+	switch {
+	case q.Engine != "":
+		index, prefix = "engine_time", []interface{}{q.Engine}
+	case q.Type != "":
+		index, prefix = "type_time", []interface{}{q.Type}
+	}
+	key := func(t time.Time, id string) []interface{} {
+		return append(append([]interface{}{}, prefix...), t, id)
+	}
+
+	since := q.Since
+	if since.IsZero() {
+		since = time.Unix(0, 0)
+	}
+	until := q.Until
+	if until.IsZero() {
+		until = time.Now().Add(time.Hour)
+	}
+	upper, rightBound := key(until, maxEventID), "closed"
+	if q.Cursor != "" {
+		t, id, err := shipyard.ParseEventCursor(q.Cursor)
+		if err != nil {
+			return r.Term{}, "", err
+		}
+		if !t.After(until) {
+			upper, rightBound = key(t, id), "open"
+		}
+	}
+	return r.Table(tblNameEvents).Between(key(since, ""), upper, r.BetweenOpts{Index: index, RightBound: rightBound}), index, nil
+}
+
+// filterEvents applies the filters of the query not covered by the index
+func filterEvents(t r.Term, q *shipyard.EventQuery, index string) r.Term {
+	if q.Type != "" && index != "type_time" {
+		t = t.Filter(r.Row.Field("Type").Eq(q.Type))
+	}
+	if q.Tag != "" {
+		t = t.Filter(r.Row.Field("Tags").Contains(q.Tag))
+	}
+	if q.Container != "" {
+		t = t.Filter(r.Row.Field("Container").Field("ID").Match("^" + regexp.QuoteMeta(q.Container)))
+	}
+	if q.Actor != "" {
+		t = t.Filter(r.Row.Field("Actor").Eq(q.Actor))
+	}
+	return t
+}
+
+// QueryEvents returns a page of matching events, newest first, and the
+// cursor of the next page if there is one
+func (m *Manager) QueryEvents(q *shipyard.EventQuery) ([]*shipyard.Event, string, error) {
+	t, index, err := eventsRange(q)
+	if err != nil {
+		return nil, "", err
+	}
+	t = filterEvents(t.OrderBy(r.OrderByOpts{Index: r.Desc(index)}), q, index)
+	if q.Limit > 0 {
+		t = t.Limit(q.Limit + 1)
+	}
+	res, err := t.Run(m.session)
+	if err != nil {
+		return nil, "", err
+	}
+	events := []*shipyard.Event{}
+	if err := res.All(&events); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[:q.Limit]
+		next = shipyard.NewEventCursor(events[len(events)-1])
+	}
+	return events, next, nil
+}
+
+// CountEvents returns the number of events matching the query, ignoring
+// the cursor and limit
+func (m *Manager) CountEvents(q *shipyard.EventQuery) (int, error) {
+	all := *q
+	all.Cursor = ""
+	t, index, err := eventsRange(&all)
+	if err != nil {
+		return 0, err
+	}
+	res, err := filterEvents(t, &all, index).Count().Run(m.session)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	if err := res.One(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ExportEvents calls fn for every matching event, oldest first
+func (m *Manager) ExportEvents(q *shipyard.EventQuery, fn func(*shipyard.Event) error) error {
+	t, index, err := eventsRange(q)
+	if err != nil {
+		return err
+	}
+	res, err := filterEvents(t.OrderBy(r.OrderByOpts{Index: r.Asc(index)}), q, index).Run(m.session)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	var evt *shipyard.Event
+	for res.Next(&evt) {
+		if err := fn(evt); err != nil {
+			return err
+		}
+		evt = nil
+	}
+	return res.Err()
+}
+
+// forwardEvents forwards saved events to the sinks until the manager is
+// closed.  Like notifications, docker events are only forwarded by the
+// leader.
+func (m *Manager) forwardEvents(sinks []logsink.Sink) {
+	events := m.SubscribeEvents()
+	defer m.UnsubscribeEvents(events)
+	failing := make([]bool, len(sinks))
+	for {
+		select {
+		case <-m.done:
+			for _, s := range sinks {
+				s.Close()
+			}
+			return
+		case evt := <-events:
+			if hasTag(evt.Tags, "docker") && !m.IsLeader() {
+				continue
+			}
+			msg := logsink.EventMessage(evt)
+			for i, s := range sinks {
+				err := s.Send(msg)
+				// only the first failure of a series is logged
+				if err != nil && !failing[i] {
+					logger.Warnf("unable to forward events: %s", err)
+				}
+				failing[i] = err != nil
+			}
+		}
+	}
+}
+
+func (m *Manager) eventRetention() {
+	t := time.NewTicker(eventPruneFreq)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			if !m.IsLeader() {
+				continue
+			}
+			if err := m.pruneEvents(time.Now()); err != nil {
+				logger.Errorf("unable to prune events: %s", err)
+			}
+		}
+	}
+}
+
+// pruneBoundary returns the newest event key to remove: the later of the
+// age cutoff and the oldest event over the count.  An age cutoff has no
+// id so that events at the cutoff are kept.
+func pruneBoundary(now time.Time, maxAge time.Duration, overCount *shipyard.Event) *eventKey {
+	var boundary *eventKey
+	if maxAge > 0 {
+		boundary = &eventKey{Time: now.Add(-maxAge)}
+	}
+	if overCount != nil {
+		k := &eventKey{Time: overCount.Time, ID: overCount.ID}
+		if boundary == nil || k.Time.After(boundary.Time) || (k.Time.Equal(boundary.Time) && k.ID > boundary.ID) {
+			boundary = k
+		}
+	}
+	return boundary
+}
+
+// pruneEvents removes the events outside the retention, archiving them
+// first when an archive directory is set.  Nothing is removed if the
+// archive cannot be written.
+func (m *Manager) pruneEvents(now time.Time) error {
+	retention := m.events
+	if retention == nil {
+		return nil
+	}
+	var overCount *shipyard.Event
+	if retention.MaxCount > 0 {
+		res, err := r.Table(tblNameEvents).OrderBy(r.OrderByOpts{Index: r.Desc("time")}).Skip(retention.MaxCount).Limit(1).Run(m.session)
+		if err != nil {
+			return err
+		}
+		if !res.IsNil() {
+			if err := res.One(&overCount); err != nil && err != r.ErrEmptyResult {
+				return err
+			}
+		}
+	}
+	boundary := pruneBoundary(now, retention.MaxAge, overCount)
+	if boundary == nil {
+		return nil
+	}
+	rightBound := "open"
+	if boundary.ID != "" {
+		rightBound = "closed"
+	}
+	expired := r.Table(tblNameEvents).Between([]interface{}{time.Unix(0, 0), ""}, []interface{}{boundary.Time, boundary.ID}, r.BetweenOpts{Index: "time", RightBound: rightBound})
+
+	if retention.ArchiveDir != "" {
+		archived, err := m.archiveEvents(expired, retention.ArchiveDir, now)
+		if err != nil {
+			return fmt.Errorf("unable to archive events: %s", err)
+		}
+		if archived == 0 {
+			return nil
+		}
+	}
+	res, err := expired.Delete().RunWrite(m.session)
+	if err != nil {
+		return err
+	}
+	if res.Deleted > 0 {
+		logger.Infof("removed %d events before %s", res.Deleted, boundary.Time.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// archiveEvents writes the events as JSON lines to a new file in dir and
+// returns the number of events written.  No file is left behind if there
+// are no events or the archive fails.
+func (m *Manager) archiveEvents(events r.Term, dir string, now time.Time) (int, error) {
+	res, err := events.OrderBy(r.OrderByOpts{Index: r.Asc("time")}).Run(m.session)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	path := filepath.Join(dir, fmt.Sprintf("events-%s.jsonl", now.UTC().Format("20060102T150405Z")))
+	var f *os.File
+	count := 0
+	fail := func(err error) (int, error) {
+		if f != nil {
+			f.Close()
+			os.Remove(path)
+		}
+		return 0, err
+	}
+	var evt *shipyard.Event
+	for res.Next(&evt) {
+		if f == nil {
+			if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+				return 0, err
+			}
+		}
+		b, err := json.Marshal(evt)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			return fail(err)
+		}
+		count++
+		evt = nil
+	}
+	if err := res.Err(); err != nil {
+		return fail(err)
+	}
+	if f == nil {
+		return 0, nil
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		f = nil
+		os.Remove(path)
+		return 0, err
+	}
+	logger.Infof("archived %d events to %s", count, path)
+	return count, nil
+}
@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shipyard/shipyard"
+)
+
+func TestPruneBoundary(t *testing.T) {
+	now := time.Now()
+	if b := pruneBoundary(now, 0, nil); b != nil {
+		t.Errorf("expected nothing to prune without retention; received %+v", b)
+	}
+
+	b := pruneBoundary(now, time.Hour, nil)
+	if b == nil || !b.Time.Equal(now.Add(-time.Hour)) || b.ID != "" {
+		t.Errorf("expected the age cutoff; received %+v", b)
+	}
+
+	older := &shipyard.Event{ID: "e1", Time: now.Add(-2 * time.Hour)}
+	if b := pruneBoundary(now, time.Hour, older); b.ID != "" {
+		t.Errorf("expected the later age cutoff; received %+v", b)
+	}
+
+	newer := &shipyard.Event{ID: "e2", Time: now.Add(-time.Minute)}
+	if b := pruneBoundary(now, time.Hour, newer); b.ID != "e2" || !b.Time.Equal(newer.Time) {
+		t.Errorf("expected the event over the count; received %+v", b)
+	}
+	if b := pruneBoundary(now, 0, older); b.ID != "e1" {
+		t.Errorf("expected the event over the count without an age; received %+v", b)
+	}
+}
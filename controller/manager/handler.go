@@ -20,7 +20,12 @@ func (h *EventHandler) Handle(e *citadel.Event) error {
 	return nil
 }
 
+// logDockerEvent saves the event on the leader; every controller
+// receives the events of every engine
 func (h *EventHandler) logDockerEvent(e *citadel.Event) error {
+	if !h.Manager.IsLeader() {
+		return nil
+	}
 	evt := &shipyard.Event{
 		Type: e.Type,
 		Message: fmt.Sprintf("action=%s container=%s",
@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+var ErrStoreTimeout = errors.New("store did not respond in time")
+
+// pingStore makes a round trip to the store.  The query runs in the
+// background so that an unreachable store cannot block the caller for
+// longer than storeTimeout.
+func (m *Manager) pingStore() *shipyard.StoreHealth {
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		res, err := r.Expr(true).Run(m.session)
+		if err == nil {
+			err = res.Close()
+		}
+		errs <- err
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(storeTimeout):
+		err = ErrStoreTimeout
+	}
+
+	health := &shipyard.StoreHealth{
+		Status:       shipyard.HealthOK,
+		ResponseTime: time.Since(start).Nanoseconds() / int64(time.Millisecond),
+	}
+	if err != nil {
+		health.Status = shipyard.HealthUnavailable
+		health.Error = err.Error()
+	}
+	return health
+}
+
+// engineSummary counts the loaded engines by their last health check
+func (m *Manager) engineSummary() *shipyard.EngineSummary {
+	engines := m.Engines()
+	summary := &shipyard.EngineSummary{Total: len(engines)}
+	for _, e := range engines {
+		switch {
+		case e.Health == nil:
+			summary.Unknown++
+		case e.Health.Status == EngineHealthUp:
+			summary.Up++
+		case e.Health.Status == EngineHealthDown:
+			summary.Down++
+		default:
+			summary.Unknown++
+		}
+	}
+	return summary
+}
+
+// Workers returns the status of the background workers
+func (m *Manager) Workers() []*shipyard.WorkerStatus {
+	m.workerLock.Lock()
+	defer m.workerLock.Unlock()
+
+	workers := make([]*shipyard.WorkerStatus, len(m.workerStatus))
+	for i, w := range m.workerStatus {
+		status := *w
+		workers[i] = &status
+	}
+	return workers
+}
+
+// Health reports the store connectivity, the engines and the background
+// workers.  The controller is unavailable when the store cannot be
+// reached, a worker has stopped or the manager is closing.  Unreachable
+// engines are reported but do not make the controller unavailable.
+func (m *Manager) Health() *shipyard.ControllerHealth {
+	health := &shipyard.ControllerHealth{
+		Status:     shipyard.HealthOK,
+		Controller: m.controller.ID,
+		Version:    m.version,
+		Leader:     m.IsLeader(),
+		Store:      m.pingStore(),
+		Engines:    m.engineSummary(),
+		Workers:    m.Workers(),
+	}
+	if health.Store.Status != shipyard.HealthOK {
+		health.Status = shipyard.HealthUnavailable
+	}
+	for _, w := range health.Workers {
+		if !w.Running {
+			health.Status = shipyard.HealthUnavailable
+		}
+	}
+	select {
+	case <-m.done:
+		health.Status = shipyard.HealthUnavailable
+	default:
+	}
+	return health
+}
@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"net/http"
+
+	"github.com/gorilla/context"
+	"github.com/shipyard/shipyard"
+)
+
+type ctxKey int
+
+const (
+	ctxIdentity ctxKey = iota
+)
+
+// Identity is the authenticated caller of an api request.  Exactly one of
+// Account and ServiceKey is set.
+type Identity struct {
+	// Name is the account username or the service key description
+	Name       string
+	Account    *shipyard.Account
+	ServiceKey *shipyard.ServiceKey
+	// MultiFactor is set when the account token was issued by a single
+	// sign-on login that asserted a second factor
+	MultiFactor bool
+}
+
+// NewAccountIdentity returns the identity of an account
+func NewAccountIdentity(acct *shipyard.Account) *Identity {
+	return &Identity{
+		Name:    acct.Username,
+		Account: acct,
+	}
+}
+
+// NewServiceKeyIdentity returns the identity of a service key; keys
+// without a description are named by the start of the key
+func NewServiceKeyIdentity(key *shipyard.ServiceKey) *Identity {
+	name := key.Description
+	if name == "" {
+		name = key.Key
+		if len(name) > 8 {
+			name = name[:8]
+		}
+		name += "..."
+	}
+	return &Identity{
+		Name:       name,
+		ServiceKey: key,
+	}
+}
+
+// Type returns the kind of caller: user or service-key
+func (i *Identity) Type() string {
+	if i.ServiceKey != nil {
+		return "service-key"
+	}
+	return "user"
+}
+
+// AllowsImage returns true if the caller can create containers from the
+// image; only service keys can be limited to images
+func (i *Identity) AllowsImage(image string) bool {
+	if i == nil || i.ServiceKey == nil {
+		return true
+	}
+	return i.ServiceKey.AllowsImage(image)
+}
+
+// AllowsSecret returns true if the caller can run containers that
+// reference the secret
+func (i *Identity) AllowsSecret(s *shipyard.Secret) bool {
+	if i == nil {
+		return s.Allows("", "")
+	}
+	role, key := "", ""
+	if i.Account != nil && i.Account.Role != nil {
+		role = i.Account.Role.Name
+	}
+	if i.ServiceKey != nil {
+		key = i.ServiceKey.Key
+	}
+	return s.Allows(role, key)
+}
+
+// SecondFactor returns true if the caller is an account that has enabled
+// two-factor authentication or logged in through single sign-on with a
+// second factor.  Service keys never have a second factor.
+func (i *Identity) SecondFactor() bool {
+	if i == nil || i.Account == nil {
+		return false
+	}
+	return i.Account.TOTPEnabled || i.MultiFactor
+}
+
+// CanCancel reports whether the caller can cancel the operation; admins
+// can cancel any operation and others only the operations they started
+func (i *Identity) CanCancel(op *shipyard.Operation) bool {
+	if i == nil {
+		return false
+	}
+	if i.Account != nil && i.Account.Role != nil && i.Account.Role.Name == "admin" {
+		return true
+	}
+	return op.Actor != "" && op.Actor == i.Name
+}
+
+// TrackIdentity returns the identity holder of the request which is
+// filled in once the request is authenticated.  Middleware that runs
+// before authentication keeps the holder since the router clears the
+// request context when it returns.
+func TrackIdentity(r *http.Request) *Identity {
+	if id, ok := context.Get(r, ctxIdentity).(*Identity); ok {
+		return id
+	}
+	id := &Identity{}
+	context.Set(r, ctxIdentity, id)
+	return id
+}
+
+// SetIdentity records the authenticated caller of the request
+func SetIdentity(r *http.Request, id *Identity) {
+	*TrackIdentity(r) = *id
+}
+
+// RequestIdentity returns the authenticated caller of the request or nil
+// if the request has not been authenticated
+func RequestIdentity(r *http.Request) *Identity {
+	id, ok := context.Get(r, ctxIdentity).(*Identity)
+	if !ok || (id.Account == nil && id.ServiceKey == nil) {
+		return nil
+	}
+	return id
+}
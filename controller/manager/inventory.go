@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/shipyard/shipyard"
+)
+
+var ErrEngineCapacityUnknown = errors.New("unable to detect engine cpus and memory; specify them")
+
+// engineInventory asks docker on the engine for its capacity and
+// platform.  Engines that have not been loaded are connected with their
+// certificates first.
+func engineInventory(e *shipyard.Engine) (*shipyard.EngineInventory, error) {
+	docker := e.Engine
+	if !docker.IsConnected() {
+		tlsConfig, err := e.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		docker = &citadel.Engine{Addr: e.Engine.Addr}
+		if err := setEngineClient(docker, tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	info, err := docker.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &shipyard.EngineInventory{
+		Cpus:            float64(info.NCPU),
+		Memory:          float64(info.MemTotal / 1024 / 1024),
+		KernelVersion:   info.KernelVersion,
+		OperatingSystem: info.OperatingSystem,
+		StorageDriver:   info.Driver,
+		DockerRootDir:   info.DockerRootDir,
+		Updated:         time.Now(),
+	}, nil
+}
+
+// detectCapacity sets the inventory of a new engine and fills in the cpus
+// and memory that were not configured
+func detectCapacity(e *shipyard.Engine) error {
+	inv, err := engineInventory(e)
+	if err != nil {
+		logger.Warnf("unable to detect capacity of engine %s: %s", e.Engine.ID, err)
+		if e.Engine.Cpus <= 0 || e.Engine.Memory <= 0 {
+			return ErrEngineCapacityUnknown
+		}
+		return nil
+	}
+	e.Inventory = inv
+	if e.Engine.Cpus <= 0 {
+		e.Engine.Cpus = inv.Cpus
+	}
+	if e.Engine.Memory <= 0 {
+		e.Engine.Memory = inv.Memory
+	}
+	return nil
+}
+
+// checkCapacity warns once when the configured capacity of an engine
+// starts to disagree with its inventory and again when the disagreement
+// changes
+func (m *Manager) checkCapacity(e *shipyard.Engine) {
+	msg := strings.Join(e.CapacityMismatches(), "; ")
+
+	m.capacityLock.Lock()
+	last := m.capacityWarned[e.ID]
+	if msg == "" {
+		delete(m.capacityWarned, e.ID)
+	} else {
+		m.capacityWarned[e.ID] = msg
+	}
+	m.capacityLock.Unlock()
+
+	if msg == "" || msg == last {
+		return
+	}
+	logger.Warnf("engine %s: %s", e.Engine.ID, msg)
+	evt := &shipyard.Event{
+		Type:    "engine-capacity-mismatch",
+		Message: fmt.Sprintf("addr=%s %s", e.Engine.Addr, msg),
+		Time:    time.Now(),
+		Engine:  e.Engine,
+		Tags:    []string{"cluster"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		logger.Errorf("unable to save capacity event: %s", err)
+	}
+}
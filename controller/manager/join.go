@@ -0,0 +1,188 @@
+package manager
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	defaultJoinTokenTTL = 24 * time.Hour
+	maxJoinTokenTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	ErrJoinTokenDoesNotExist = errors.New("join token does not exist")
+	ErrJoinTokenExpired      = errors.New("join token has expired")
+	ErrJoinTokenUsed         = errors.New("join token has been used up")
+	ErrInvalidJoinTokenTTL   = errors.New("join token ttl must be between 0 and 30 days")
+	ErrEngineExists          = errors.New("engine already exists")
+)
+
+// NewJoinToken creates a token that expires after the requested ttl or a
+// day
+func (m *Manager) NewJoinToken(t *shipyard.JoinToken, actor string) (*shipyard.JoinToken, error) {
+	ttl := defaultJoinTokenTTL
+	if t.TTL != 0 {
+		ttl = time.Duration(t.TTL) * time.Second
+	}
+	if ttl <= 0 || ttl > maxJoinTokenTTL || t.MaxUses < 0 {
+		return nil, ErrInvalidJoinTokenTTL
+	}
+	if t.CACertificate != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(t.CACertificate)) {
+		return nil, shipyard.ErrInvalidCACertificate
+	}
+	tk, err := m.authenticator.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	token := &shipyard.JoinToken{
+		Token:         tk[24:],
+		Description:   t.Description,
+		Labels:        t.Labels,
+		Expires:       now.Add(ttl),
+		MaxUses:       t.MaxUses,
+		Created:       now,
+		CACertificate: t.CACertificate,
+		Insecure:      t.Insecure,
+	}
+	res, err := r.Table(tblNameJoinTokens).Insert(token).RunWrite(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		token.ID = res.GeneratedKeys[0]
+	}
+	evt := &shipyard.Event{
+		Type:    "add-join-token",
+		Time:    now,
+		Message: fmt.Sprintf("id=%s labels=%s expires=%s insecure=%t", token.ID, strings.Join(token.Labels, ","), token.Expires.Format(time.RFC3339), token.Insecure),
+		Actor:   actor,
+		Tags:    []string{"cluster", "security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (m *Manager) JoinTokens() ([]*shipyard.JoinToken, error) {
+	res, err := r.Table(tblNameJoinTokens).OrderBy(r.Asc("created")).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []*shipyard.JoinToken{}
+	if err := res.All(&tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// joinToken returns the token with the value token
+func (m *Manager) joinToken(token string) (*shipyard.JoinToken, error) {
+	res, err := r.Table(tblNameJoinTokens).Filter(map[string]string{"token": token}).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsNil() {
+		return nil, ErrJoinTokenDoesNotExist
+	}
+	var t *shipyard.JoinToken
+	if err := res.One(&t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (m *Manager) RemoveJoinToken(id string, actor string) error {
+	res, err := r.Table(tblNameJoinTokens).Get(id).Delete().RunWrite(m.session)
+	if err != nil {
+		return err
+	}
+	if res.Deleted == 0 {
+		return ErrJoinTokenDoesNotExist
+	}
+	evt := &shipyard.Event{
+		Type:    "remove-join-token",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("id=%s", id),
+		Actor:   actor,
+		Tags:    []string{"cluster", "security"},
+	}
+	return m.SaveEvent(evt)
+}
+
+// useJoinToken counts a use of the token unless it has been used up.  The
+// check and the increment are a single update so that concurrent joins
+// cannot exceed MaxUses.
+func (m *Manager) useJoinToken(t *shipyard.JoinToken, delta int) error {
+	uses := r.Row.Field("uses").Default(0)
+	available := r.Row.Field("max_uses").Default(0).Eq(0).Or(uses.Lt(r.Row.Field("max_uses")))
+	if delta < 0 {
+		available = uses.Gt(0)
+	}
+	res, err := r.Table(tblNameJoinTokens).Get(t.ID).Update(r.Branch(available, map[string]interface{}{"uses": uses.Add(delta)}, map[string]interface{}{})).RunWrite(m.session)
+	if err != nil {
+		return err
+	}
+	if delta > 0 && res.Replaced == 0 {
+		return ErrJoinTokenUsed
+	}
+	return nil
+}
+
+// Join adds the engine of a host that presents a valid join token.  The
+// engine gets the labels and the certificate verification of the token
+// and must not already be in the cluster; it is verified to be reachable
+// by AddEngine.
+func (m *Manager) Join(req *shipyard.JoinRequest, remoteAddr string) (*shipyard.Engine, error) {
+	t, err := m.joinToken(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if t.Expired(time.Now()) {
+		return nil, ErrJoinTokenExpired
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	for _, e := range m.Engines() {
+		if e.Engine.ID == req.Engine.Engine.ID || e.Engine.Addr == req.Engine.Engine.Addr {
+			return nil, ErrEngineExists
+		}
+	}
+
+	engine := req.Engine
+	engine.ID = ""
+	engine.Health = &shipyard.Health{Status: "pending"}
+	engine.Engine.Labels = shipyard.MergeLabels(t.Labels, engine.Engine.Labels)
+	engine.CACertificate = t.CACertificate
+	engine.Insecure = t.Insecure
+
+	if err := m.useJoinToken(t, 1); err != nil {
+		return nil, err
+	}
+	if err := m.AddEngine(engine, ""); err != nil {
+		if rerr := m.useJoinToken(t, -1); rerr != nil {
+			logger.Warnf("unable to return use of join token %s: %s", t.ID, rerr)
+		}
+		return nil, err
+	}
+	evt := &shipyard.Event{
+		Type:    "join-engine",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("token=%s addr=%s from=%s", t.ID, engine.Engine.Addr, remoteAddr),
+		Engine:  engine.Engine,
+		Tags:    []string{"cluster", "security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLimiterEntries caps the failures tracked per account and per
+	// address
+	maxLimiterEntries = 10000
+)
+
+type (
+	// LockoutError is returned when logins are locked for an account or
+	// address after repeated failures
+	LockoutError struct {
+		Until time.Time
+	}
+
+	// LoginLimiter tracks failed logins per account and per source address.
+	// After MaxAttempts failures further logins are refused for Lockout,
+	// doubling for every additional failure up to MaxLockout.  Failures
+	// are forgotten after a successful login or MaxLockout without one.
+	// Failures are also recorded for usernames that do not exist, so the
+	// number of tracked accounts and addresses is capped by evicting the
+	// least recent failures that are not locked.  Locked entries are never
+	// evicted; the cap is exceeded while every tracked entry is locked.
+	//
+	// Failures are kept in memory by each controller.  Behind a load
+	// balancer a client can make MaxAttempts failed logins on every
+	// controller before it is locked out of all of them.
+	LoginLimiter struct {
+		MaxAttempts     int
+		MaxAddrAttempts int
+		Lockout         time.Duration
+		MaxLockout      time.Duration
+
+		mux        sync.Mutex
+		maxEntries int
+		accounts   map[string]*loginFailures
+		addrs      map[string]*loginFailures
+	}
+
+	loginFailures struct {
+		count       int
+		last        time.Time
+		lockedUntil time.Time
+	}
+)
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed logins; try again in %s", e.RetryAfter())
+}
+
+// RetryAfter returns the remaining lockout rounded up to the second
+func (e *LockoutError) RetryAfter() time.Duration {
+	d := e.Until.Sub(time.Now())
+	if d < 0 {
+		return 0
+	}
+	return (d + time.Second - 1) / time.Second * time.Second
+}
+
+func NewLoginLimiter(maxAttempts int, maxAddrAttempts int, lockout time.Duration, maxLockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		MaxAttempts:     maxAttempts,
+		MaxAddrAttempts: maxAddrAttempts,
+		Lockout:         lockout,
+		MaxLockout:      maxLockout,
+		maxEntries:      maxLimiterEntries,
+		accounts:        make(map[string]*loginFailures),
+		addrs:           make(map[string]*loginFailures),
+	}
+}
+
+// Check returns a LockoutError if the account or address is locked
+func (l *LoginLimiter) Check(username string, addr string) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := time.Now()
+	until := time.Time{}
+	for _, f := range []*loginFailures{l.accounts[username], l.addrs[addr]} {
+		if f != nil && f.lockedUntil.After(now) && f.lockedUntil.After(until) {
+			until = f.lockedUntil
+		}
+	}
+	if !until.IsZero() {
+		return &LockoutError{Until: until}
+	}
+	return nil
+}
+
+// Failure records a failed login.  The returned flags report whether the
+// account or address became locked by this failure.
+func (l *LoginLimiter) Failure(username string, addr string) (bool, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.expire()
+	return l.fail(l.accounts, username, l.MaxAttempts), l.fail(l.addrs, addr, l.MaxAddrAttempts)
+}
+
+// Success clears failures for the account and address
+func (l *LoginLimiter) Success(username string, addr string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	delete(l.accounts, username)
+	delete(l.addrs, addr)
+}
+
+func (l *LoginLimiter) fail(failures map[string]*loginFailures, key string, max int) bool {
+	if max <= 0 {
+		return false
+	}
+	now := time.Now()
+	f, ok := failures[key]
+	if !ok {
+		if len(failures) >= l.maxEntries {
+			evictOldest(failures, now)
+		}
+		f = &loginFailures{}
+		failures[key] = f
+	}
+	f.count++
+	f.last = now
+	if f.count < max {
+		return false
+	}
+	lockout := l.Lockout
+	for i := max; i < f.count && lockout < l.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.MaxLockout {
+		lockout = l.MaxLockout
+	}
+	f.lockedUntil = now.Add(lockout)
+	return true
+}
+
+func (l *LoginLimiter) expire() {
+	now := time.Now()
+	for _, failures := range []map[string]*loginFailures{l.accounts, l.addrs} {
+		for k, f := range failures {
+			if now.Sub(f.last) > l.MaxLockout && now.After(f.lockedUntil) {
+				delete(failures, k)
+			}
+		}
+	}
+}
+
+// evictOldest removes the unlocked failures with the least recent attempt
+func evictOldest(failures map[string]*loginFailures, now time.Time) {
+	oldest := ""
+	var last time.Time
+	for k, f := range failures {
+		if f.lockedUntil.After(now) {
+			continue
+		}
+		if oldest == "" || f.last.Before(last) {
+			oldest = k
+			last = f.last
+		}
+	}
+	if oldest != "" {
+		delete(failures, oldest)
+	}
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterLocksAccount(t *testing.T) {
+	l := NewLoginLimiter(3, 10, time.Minute, time.Hour)
+	for i := 0; i < 2; i++ {
+		if locked, _ := l.Failure("admin", "10.0.0.1"); locked {
+			t.Fatalf("expected account to not be locked after %d failures", i+1)
+		}
+	}
+	if err := l.Check("admin", "10.0.0.1"); err != nil {
+		t.Fatalf("expected login to be allowed: %s", err)
+	}
+	if locked, _ := l.Failure("admin", "10.0.0.1"); !locked {
+		t.Fatal("expected account to be locked")
+	}
+	err := l.Check("admin", "10.0.0.2")
+	lerr, ok := err.(*LockoutError)
+	if !ok {
+		t.Fatalf("expected lockout error; received %v", err)
+	}
+	if d := lerr.RetryAfter(); d <= 0 || d > time.Minute {
+		t.Errorf("expected retry after of at most a minute; received %s", d)
+	}
+	if err := l.Check("guest", "10.0.0.2"); err != nil {
+		t.Errorf("expected other accounts to be allowed: %s", err)
+	}
+}
+
+func TestLoginLimiterBackoff(t *testing.T) {
+	l := NewLoginLimiter(1, 0, time.Minute, 5*time.Minute)
+	l.Failure("admin", "10.0.0.1")
+	first := l.accounts["admin"].lockedUntil
+	l.Failure("admin", "10.0.0.1")
+	second := l.accounts["admin"].lockedUntil
+	if second.Sub(first) < 50*time.Second {
+		t.Errorf("expected lockout to double; received %s then %s", first, second)
+	}
+	for i := 0; i < 10; i++ {
+		l.Failure("admin", "10.0.0.1")
+	}
+	if d := l.accounts["admin"].lockedUntil.Sub(time.Now()); d > 5*time.Minute {
+		t.Errorf("expected lockout to be capped; received %s", d)
+	}
+	l.Success("admin", "10.0.0.1")
+	if err := l.Check("admin", "10.0.0.1"); err != nil {
+		t.Errorf("expected success to clear failures: %s", err)
+	}
+}
+
+func TestLoginLimiterLocksAddress(t *testing.T) {
+	l := NewLoginLimiter(10, 2, time.Minute, time.Hour)
+	l.Failure("a", "10.0.0.1")
+	if _, locked := l.Failure("b", "10.0.0.1"); !locked {
+		t.Fatal("expected address to be locked")
+	}
+	if err := l.Check("c", "10.0.0.1"); err == nil {
+		t.Error("expected locked address to be refused for any account")
+	}
+}
+
+func TestLoginLimiterCapsEntries(t *testing.T) {
+	l := NewLoginLimiter(2, 0, time.Minute, time.Hour)
+	l.maxEntries = 2
+	l.Failure("admin", "10.0.0.1")
+	l.accounts["admin"].last = time.Now().Add(-time.Minute)
+	l.Failure("nobody-1", "10.0.0.1")
+	l.Failure("nobody-2", "10.0.0.1")
+	if len(l.accounts) != 2 {
+		t.Fatalf("expected 2 tracked accounts; received %d", len(l.accounts))
+	}
+	if _, ok := l.accounts["admin"]; ok {
+		t.Error("expected the least recent failure to be evicted")
+	}
+}
+
+func TestLoginLimiterKeepsLockedEntries(t *testing.T) {
+	l := NewLoginLimiter(1, 0, time.Minute, time.Hour)
+	l.maxEntries = 2
+	l.Failure("admin", "10.0.0.1")
+	l.accounts["admin"].last = time.Now().Add(-time.Minute)
+	l.Failure("nobody-1", "10.0.0.1")
+	l.Failure("nobody-2", "10.0.0.1")
+	if err := l.Check("admin", "10.0.0.2"); err == nil {
+		t.Error("expected the locked account to stay locked when the cap is reached")
+	}
+	if len(l.accounts) != 3 {
+		t.Errorf("expected the cap to be exceeded by locked entries; received %d", len(l.accounts))
+	}
+}
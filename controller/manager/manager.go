@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -21,20 +22,39 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/shipyard/shipyard"
 	"github.com/shipyard/shipyard/dockerhub"
+	"github.com/shipyard/shipyard/logsink"
+	"github.com/shipyard/shipyard/notify"
+	"github.com/shipyard/shipyard/secrets"
 )
 
 const (
-	tblNameConfig      = "config"
-	tblNameEvents      = "events"
-	tblNameAccounts    = "accounts"
-	tblNameRoles       = "roles"
-	tblNameServiceKeys = "service_keys"
-	tblNameExtensions  = "extensions"
-	tblNameWebhookKeys = "webhook_keys"
-	storeKey           = "shipyard"
-	trackerHost        = "http://tracker.shipyard-project.com"
-	EngineHealthUp     = "up"
-	EngineHealthDown   = "down"
+	tblNameConfig       = "config"
+	tblNameEvents       = "events"
+	tblNameAccounts     = "accounts"
+	tblNameRoles        = "roles"
+	tblNameServiceKeys  = "service_keys"
+	tblNameExtensions   = "extensions"
+	tblNameWebhookKeys  = "webhook_keys"
+	tblNameAudit        = "audit"
+	tblNameSecrets      = "secrets"
+	tblNameLeases       = "leases"
+	tblNameControllers  = "controllers"
+	tblNameJoinTokens   = "join_tokens"
+	tblNameEngineHealth = "engine_health"
+	storeKey            = "shipyard"
+	serviceKeyUsedFreq  = time.Duration(1 * time.Minute)
+	defaultAdminPass    = "shipyard"
+	trackerHost         = "http://tracker.shipyard-project.com"
+	EngineHealthUp      = shipyard.EngineHealthUp
+	EngineHealthDown    = shipyard.EngineHealthDown
+	// clusterSyncFreq is how often the cached container state is
+	// resynced with the engines to catch missed events
+	clusterSyncFreq = time.Duration(30 * time.Second)
+	changefeedRetry = time.Duration(5 * time.Second)
+	// workerRetry is how long a stopped worker waits before it restarts
+	workerRetry = time.Duration(5 * time.Second)
+	// storeTimeout bounds connecting to the store and the health check
+	storeTimeout = time.Duration(5 * time.Second)
 )
 
 var (
@@ -42,34 +62,105 @@ var (
 	ErrAccountDoesNotExist    = errors.New("account does not exist")
 	ErrRoleDoesNotExist       = errors.New("role does not exist")
 	ErrServiceKeyDoesNotExist = errors.New("service key does not exist")
+	ErrServiceKeyExpired      = errors.New("service key has expired")
+	ErrServiceKeyNotAllowed   = errors.New("service key is not allowed from this address")
+	ErrImageNotAllowed        = errors.New("service key is not allowed to use this image")
 	ErrInvalidAuthToken       = errors.New("invalid auth token")
+	ErrInvalidLogin           = errors.New("invalid username/password")
+	ErrPasswordChangeRequired = errors.New("password change required")
+	ErrSSOAccountConflict     = errors.New("username belongs to an account that is not linked to the identity provider")
 	ErrExtensionDoesNotExist  = errors.New("extension does not exist")
 	ErrWebhookKeyDoesNotExist = errors.New("webhook key does not exist")
+	ErrEngineDoesNotExist     = errors.New("engine does not exist")
 	logger                    = logrus.New()
 	store                     = sessions.NewCookieStore([]byte(storeKey))
 )
 
+// SetLogger replaces the package logger; the controller shares its logger
+// so that entries reach the configured log sinks
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
 type (
 	Manager struct {
-		address          string
-		database         string
-		authKey          string
-		session          *r.Session
-		clusterManager   *cluster.Cluster
-		engines          []*shipyard.Engine
-		authenticator    *shipyard.Authenticator
-		store            *sessions.CookieStore
-		StoreKey         string
-		version          string
-		disableUsageInfo bool
+		address           string
+		database          string
+		authKey           string
+		session           *r.Session
+		clusterManager    *cluster.Cluster
+		engines           []*shipyard.Engine
+		authenticator     *shipyard.Authenticator
+		store             *sessions.CookieStore
+		StoreKey          string
+		version           string
+		disableUsageInfo  bool
+		auditLock         sync.Mutex
+		passwordPolicy    *shipyard.PasswordPolicy
+		loginLimiter      *LoginLimiter
+		secretsBox        *secrets.Box
+		certExpiryWarning time.Duration
+		certWarned        map[string]time.Time
+		certLock          sync.Mutex
+		capacityWarned    map[string]string
+		capacityLock      sync.Mutex
+		flaps             *FlapDetector
+		healthRetention   time.Duration
+		eventSubscribers  map[chan *shipyard.Event]bool
+		eventSubLock      sync.Mutex
+		notifier          *notify.Notifier
+		events            *EventRetention
+		operations        *OperationTracker
+		runWorkers        int
+		logConfig         *citadel.LogConfig
+		engineLock        sync.RWMutex
+		done              chan struct{}
+		closeOnce         sync.Once
+		workers           sync.WaitGroup
+		workerStatus      []*shipyard.WorkerStatus
+		workerLock        sync.Mutex
+		controller        *shipyard.Controller
+		elector           *Elector
+	}
+
+	// Options configure a manager before its background workers start.
+	// Zero values use the defaults.
+	Options struct {
+		// SecretsBox encrypts secrets and engine tls keys at rest
+		SecretsBox *secrets.Box
+		// EventRetention sets how long and how many events are kept
+		EventRetention *EventRetention
+		// EventSinks receive every saved event
+		EventSinks []logsink.Sink
+		// HealthRetention is how long engine health checks are kept
+		HealthRetention time.Duration
+		// CertificateExpiryWarning is how long before expiry an event
+		// is raised for engine client certificates
+		CertificateExpiryWarning time.Duration
+		// RunWorkers is the number of containers started concurrently
+		// by a run
+		RunWorkers int
+		// ContainerLogConfig is the docker log driver for containers
+		// run from images without one
+		ContainerLogConfig *citadel.LogConfig
+		// PasswordPolicy applies to new and changed passwords
+		PasswordPolicy *shipyard.PasswordPolicy
+		// LoginLimiter locks out repeated failed logins
+		LoginLimiter *LoginLimiter
 	}
 )
 
-func NewManager(addr string, database string, authKey string, version string, disableUsageInfo bool) (*Manager, error) {
+// NewManager connects to the database and starts the background workers.
+// opts can be nil to use the defaults.
+func NewManager(addr string, database string, authKey string, version string, disableUsageInfo bool, opts *Options) (*Manager, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
 	session, err := r.Connect(r.ConnectOpts{
 		Address:     addr,
 		Database:    database,
 		AuthKey:     authKey,
+		Timeout:     storeTimeout,
 		MaxIdle:     10,
 		IdleTimeout: time.Second * 30,
 	})
@@ -79,21 +170,160 @@ func NewManager(addr string, database string, authKey string, version string, di
 	logger.Info("checking database")
 	r.DbCreate(database).Run(session)
 	m := &Manager{
-		address:          addr,
-		database:         database,
-		authKey:          authKey,
-		session:          session,
-		authenticator:    &shipyard.Authenticator{},
-		store:            store,
-		StoreKey:         storeKey,
-		version:          version,
-		disableUsageInfo: disableUsageInfo,
-	}
+		address:           addr,
+		database:          database,
+		authKey:           authKey,
+		session:           session,
+		authenticator:     &shipyard.Authenticator{},
+		store:             store,
+		StoreKey:          storeKey,
+		version:           version,
+		disableUsageInfo:  disableUsageInfo,
+		certExpiryWarning: defaultCertExpiryWarning,
+		certWarned:        make(map[string]time.Time),
+		capacityWarned:    make(map[string]string),
+		flaps:             NewFlapDetector(flapWindow, flapThreshold),
+		healthRetention:   defaultHealthRetention,
+		eventSubscribers:  make(map[chan *shipyard.Event]bool),
+		notifier:          notify.NewNotifier(),
+		events:            &EventRetention{MaxAge: defaultEventRetention},
+		passwordPolicy:    &shipyard.PasswordPolicy{MinLength: 8},
+		loginLimiter:      NewLoginLimiter(5, 20, time.Second*30, time.Hour),
+		operations:        NewOperationTracker(defaultOperationRetention),
+		runWorkers:        defaultRunWorkers,
+		secretsBox:        opts.SecretsBox,
+		logConfig:         opts.ContainerLogConfig,
+		done:              make(chan struct{}),
+	}
+	if opts.EventRetention != nil {
+		m.events = opts.EventRetention
+	}
+	if opts.HealthRetention > 0 {
+		m.healthRetention = opts.HealthRetention
+	}
+	if opts.CertificateExpiryWarning > 0 {
+		m.certExpiryWarning = opts.CertificateExpiryWarning
+	}
+	if opts.RunWorkers > 0 {
+		m.runWorkers = opts.RunWorkers
+	}
+	if opts.PasswordPolicy != nil {
+		m.passwordPolicy = opts.PasswordPolicy
+	}
+	if opts.LoginLimiter != nil {
+		m.loginLimiter = opts.LoginLimiter
+	}
+	hostname, _ := os.Hostname()
+	m.controller = &shipyard.Controller{
+		ID:       newControllerID(),
+		Hostname: hostname,
+		Version:  version,
+		Started:  time.Now(),
+	}
+	m.elector = NewElector(m.controller.ID, &rethinkLeases{session: session}, defaultLeaseTTL)
 	m.initdb()
 	m.init()
+	m.elector.Campaign()
+	m.heartbeat()
+	// leader election
+	m.runWorker("leader-election", false, m.leaderElection)
+	// follow engine changes from other controllers
+	m.runWorker("engine-changes", false, m.watchEngines)
+	// background checks only run on the leader
+	// start extension health check
+	m.runWorker("extension-health-check", true, m.extensionHealthCheck)
+	// start engine check
+	m.runWorker("engine-check", true, m.engineCheck)
+	// start cluster state sync
+	m.runWorker("cluster-sync", false, m.clusterSync)
+	// start engine certificate expiry check
+	m.runWorker("certificate-check", true, m.certificateCheck)
+	// event notifications
+	m.runWorker("notifications", false, m.notifications)
+	// event retention
+	m.runWorker("event-retention", true, m.eventRetention)
+	// event forwarding
+	if len(opts.EventSinks) > 0 {
+		m.runWorker("event-sinks", false, func() {
+			m.forwardEvents(opts.EventSinks)
+		})
+	}
+	// anonymous usage info
+	if !m.disableUsageInfo {
+		m.runWorker("usage-report", true, m.usageReport)
+	}
 	return m, nil
 }
 
+// runWorker runs fn in the background until the manager is closed and
+// records its status for the health report.  A worker that returns or
+// panics before the manager is closed is restarted after workerRetry.
+func (m *Manager) runWorker(name string, leader bool, fn func()) {
+	status := &shipyard.WorkerStatus{
+		Name:    name,
+		Leader:  leader,
+		Running: true,
+		Started: time.Now(),
+	}
+	m.workerLock.Lock()
+	m.workerStatus = append(m.workerStatus, status)
+	m.workerLock.Unlock()
+
+	setRunning := func(running bool) {
+		now := time.Now()
+		m.workerLock.Lock()
+		defer m.workerLock.Unlock()
+		status.Running = running
+		if running {
+			status.Started = now
+			status.Stopped = nil
+		} else {
+			status.Stopped = &now
+		}
+	}
+
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		for {
+			runWorkerOnce(name, fn)
+			setRunning(false)
+			select {
+			case <-m.done:
+				return
+			default:
+			}
+			logger.Errorf("worker %s stopped; restarting in %s", name, workerRetry)
+			select {
+			case <-m.done:
+				return
+			case <-time.After(workerRetry):
+			}
+			setRunning(true)
+		}
+	}()
+}
+
+// runWorkerOnce runs fn and logs a panic instead of stopping the
+// controller
+func runWorkerOnce(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("worker %s panicked: %v", name, r)
+		}
+	}()
+	fn()
+}
+
+// Close stops the background workers and the event streams of the
+// engines and closes the database session
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() { close(m.done) })
+	m.workers.Wait()
+	m.clusterManager.Close()
+	return m.session.Close()
+}
+
 func (m *Manager) ClusterManager() *cluster.Cluster {
 	return m.clusterManager
 }
@@ -104,7 +334,7 @@ func (m *Manager) Store() *sessions.CookieStore {
 
 func (m *Manager) initdb() {
 	// create tables if needed
-	tables := []string{tblNameConfig, tblNameEvents, tblNameAccounts, tblNameRoles, tblNameServiceKeys, tblNameExtensions, tblNameWebhookKeys}
+	tables := []string{tblNameConfig, tblNameEvents, tblNameAccounts, tblNameRoles, tblNameServiceKeys, tblNameExtensions, tblNameWebhookKeys, tblNameAudit, tblNameSecrets, tblNameLeases, tblNameControllers, tblNameJoinTokens, tblNameEngineHealth, tblNameNotificationChannels, tblNameNotificationDeliveries}
 	for _, tbl := range tables {
 		_, err := r.Table(tbl).Run(m.session)
 		if err != nil {
@@ -113,38 +343,43 @@ func (m *Manager) initdb() {
 			}
 		}
 	}
+	m.createIndex(tblNameEngineHealth, "time", r.Row.Field("time"))
+	m.createIndex(tblNameEngineHealth, "engine_time", []interface{}{r.Row.Field("engine_id"), r.Row.Field("time")})
+	m.createIndex(tblNameNotificationDeliveries, "created", r.Row.Field("created"))
+	// events are stored with the field names of shipyard.Event
+	m.createIndex(tblNameEvents, "time", []interface{}{r.Row.Field("Time"), r.Row.Field("id")})
+	m.createIndex(tblNameEvents, "type_time", []interface{}{r.Row.Field("Type"), r.Row.Field("Time"), r.Row.Field("id")})
+	m.createIndex(tblNameEvents, "engine_time", []interface{}{r.Row.Field("Engine").Field("ID"), r.Row.Field("Time"), r.Row.Field("id")})
 }
 
-func (m *Manager) init() []*shipyard.Engine {
-	engines := []*shipyard.Engine{}
-	res, err := r.Table(tblNameConfig).Run(m.session)
+// createIndex creates a secondary index unless it exists and waits for it
+// to be ready
+func (m *Manager) createIndex(tbl string, name string, fn interface{}) {
+	res, err := r.Table(tbl).IndexList().Run(m.session)
 	if err != nil {
-		logger.Fatalf("error getting configuration: %s", err)
+		logger.Fatalf("error listing indexes of %s: %s", tbl, err)
 	}
-	if err := res.All(&engines); err != nil {
-		logger.Fatalf("error loading configuration: %s", err)
+	indexes := []string{}
+	if err := res.All(&indexes); err != nil {
+		logger.Fatalf("error listing indexes of %s: %s", tbl, err)
 	}
-	m.engines = engines
-	var engs []*citadel.Engine
-	for _, d := range engines {
-		tlsConfig := &tls.Config{}
-		if d.CACertificate != "" && d.SSLCertificate != "" && d.SSLKey != "" {
-			caCert := []byte(d.CACertificate)
-			sslCert := []byte(d.SSLCertificate)
-			sslKey := []byte(d.SSLKey)
-			c, err := getTLSConfig(caCert, sslCert, sslKey)
-			if err != nil {
-				logger.Errorf("error getting tls config: %s", err)
-			}
-			tlsConfig = c
-		}
-		if err := setEngineClient(d.Engine, tlsConfig); err != nil {
-			logger.Errorf("error setting tls config for engine: %s", err)
+	for _, i := range indexes {
+		if i == name {
+			return
 		}
-		engs = append(engs, d.Engine)
-		logger.Infof("loaded engine id=%s addr=%s", d.Engine.ID, d.Engine.Addr)
 	}
-	clusterManager, err := cluster.New(scheduler.NewResourceManager(), engs...)
+	if _, err := r.Table(tbl).IndexCreateFunc(name, fn).Run(m.session); err != nil {
+		logger.Fatalf("error creating index %s on %s: %s", name, tbl, err)
+	}
+	if _, err := r.Table(tbl).IndexWait(name).Run(m.session); err != nil {
+		logger.Fatalf("error waiting for index %s on %s: %s", name, tbl, err)
+	}
+}
+
+// init creates the cluster and loads the engines.  It is called once;
+// engines are then added to and removed from the cluster one at a time.
+func (m *Manager) init() {
+	clusterManager, err := cluster.New(scheduler.NewResourceManager())
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -167,25 +402,240 @@ func (m *Manager) init() []*shipyard.Engine {
 	clusterManager.RegisterScheduler("multi", multiScheduler)
 	clusterManager.RegisterScheduler("host", hostScheduler)
 	m.clusterManager = clusterManager
-	// start extension health check
-	go m.extensionHealthCheck()
-	// start engine check
-	go m.engineCheck()
-	// anonymous usage info
-	go m.usageReport()
-	return engines
+	m.loadEngines()
+	if err := clusterManager.Sync(); err != nil {
+		logger.Warnf("error syncing cluster state: %s", err)
+	}
+}
+
+// loadEngines (re)loads every engine from the database into the cluster
+// and removes the engines that no longer exist
+func (m *Manager) loadEngines() {
+	engines := []*shipyard.Engine{}
+	res, err := r.Table(tblNameConfig).Run(m.session)
+	if err != nil {
+		logger.Fatalf("error getting configuration: %s", err)
+	}
+	if err := res.All(&engines); err != nil {
+		logger.Fatalf("error loading configuration: %s", err)
+	}
+	stored := make(map[string]bool)
+	plain := []*shipyard.Engine{}
+	for _, d := range engines {
+		if d.SSLKey != "" && !secrets.IsSealed(d.SSLKey) {
+			plain = append(plain, d)
+		}
+		stored[d.ID] = true
+		m.loadEngine(d)
+	}
+	for _, d := range m.Engines() {
+		if !stored[d.ID] {
+			m.unloadEngine(d.ID)
+		}
+	}
+	m.encryptEngineKeys(plain)
+}
+
+// reloadEngine reconnects an engine with its configuration from the
+// database
+func (m *Manager) reloadEngine(id string) error {
+	var engine *shipyard.Engine
+	res, err := r.Table(tblNameConfig).Filter(map[string]string{"id": id}).Run(m.session)
+	if err != nil {
+		return err
+	}
+	if err := res.One(&engine); err != nil {
+		if err == r.ErrEmptyResult {
+			return ErrEngineDoesNotExist
+		}
+		return err
+	}
+	m.loadEngine(engine)
+	return nil
+}
+
+// loadEngine connects the engine and adds it to the cluster, replacing a
+// loaded engine with the same id
+func (m *Manager) loadEngine(d *shipyard.Engine) {
+	if err := m.openEngineKey(d); err != nil {
+		logger.Errorf("unable to decrypt tls key for engine %s: %s", d.Engine.ID, err)
+	}
+	tlsConfig, err := d.TLSConfig()
+	if err != nil {
+		logger.Errorf("error getting tls config for engine %s: %s", d.Engine.ID, err)
+		tlsConfig = &tls.Config{ServerName: d.ServerName}
+	}
+	if d.Insecure {
+		logger.Warnf("tls verification is disabled for engine %s", d.Engine.ID)
+	}
+	if err := setEngineClient(d.Engine, tlsConfig); err != nil {
+		logger.Errorf("error setting tls config for engine: %s", err)
+	}
+	d.Engine.SetEnvironmentResolver(m)
+
+	m.engineLock.Lock()
+	defer m.engineLock.Unlock()
+	for i, e := range m.engines {
+		if e.ID == d.ID {
+			if e.Engine.ID != d.Engine.ID {
+				m.clusterManager.RemoveEngine(e.Engine)
+			}
+			m.engines = append(m.engines[:i], m.engines[i+1:]...)
+			break
+		}
+	}
+	if err := m.clusterManager.AddEngine(d.Engine); err != nil {
+		logger.Errorf("unable to watch events for engine %s: %s", d.Engine.ID, err)
+	}
+	m.engines = append(m.engines, d)
+	logger.Infof("loaded engine id=%s addr=%s", d.Engine.ID, d.Engine.Addr)
+}
+
+// reconcileEngines loads the engines from the database that are not
+// loaded and removes the engines that no longer exist
+func (m *Manager) reconcileEngines() error {
+	engines := []*shipyard.Engine{}
+	res, err := r.Table(tblNameConfig).Run(m.session)
+	if err != nil {
+		return err
+	}
+	if err := res.All(&engines); err != nil {
+		return err
+	}
+	stored := make(map[string]bool)
+	for _, d := range engines {
+		stored[d.ID] = true
+		if m.Engine(d.ID) == nil {
+			m.loadEngine(d)
+		}
+	}
+	for _, d := range m.Engines() {
+		if !stored[d.ID] {
+			m.unloadEngine(d.ID)
+		}
+	}
+	return nil
+}
+
+// engineChange is an entry of the engine changefeed
+type engineChange struct {
+	Old *shipyard.Engine `gorethink:"old_val"`
+	New *shipyard.Engine `gorethink:"new_val"`
+}
+
+// watchEngines follows the engine changefeed so that engines added,
+// changed or removed through another controller are loaded here.  Changes
+// missed while the feed is down are reconciled when it restarts.
+func (m *Manager) watchEngines() {
+	for {
+		if err := m.reconcileEngines(); err != nil {
+			logger.Warnf("error reconciling engines: %s", err)
+		}
+		if err := m.followEngineChanges(); err != nil {
+			logger.Warnf("engine changefeed stopped: %s", err)
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(changefeedRetry):
+		}
+	}
+}
+
+func (m *Manager) followEngineChanges() error {
+	res, err := r.Table(tblNameConfig).Changes().Run(m.session)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-m.done:
+		case <-stop:
+		}
+		res.Close()
+	}()
+	for {
+		var change engineChange
+		if !res.Next(&change) {
+			break
+		}
+		m.applyEngineChange(change.Old, change.New)
+	}
+	return res.Err()
+}
+
+func (m *Manager) applyEngineChange(old, cur *shipyard.Engine) {
+	switch {
+	case cur == nil:
+		if old != nil {
+			m.unloadEngine(old.ID)
+		}
+	case m.Engine(cur.ID) == nil:
+		m.loadEngine(cur)
+	case old != nil && engineConfigChanged(old, cur):
+		m.loadEngine(cur)
+	default:
+		// status saved by the leader's engine check
+		if e := m.Engine(cur.ID); e != nil {
+			e.Health = cur.Health
+			e.DockerVersion = cur.DockerVersion
+			e.Inventory = cur.Inventory
+		}
+	}
+}
+
+// engineConfigChanged reports whether the engine must be reconnected
+func engineConfigChanged(old, cur *shipyard.Engine) bool {
+	if old.Engine == nil || cur.Engine == nil {
+		return true
+	}
+	return old.Engine.ID != cur.Engine.ID ||
+		old.Engine.Addr != cur.Engine.Addr ||
+		old.Engine.Cpus != cur.Engine.Cpus ||
+		old.Engine.Memory != cur.Engine.Memory ||
+		strings.Join(old.Engine.Labels, ",") != strings.Join(cur.Engine.Labels, ",") ||
+		old.SSLCertificate != cur.SSLCertificate ||
+		old.SSLKey != cur.SSLKey ||
+		old.CACertificate != cur.CACertificate ||
+		old.ServerName != cur.ServerName ||
+		old.Insecure != cur.Insecure
+}
+
+// unloadEngine removes the engine from the cluster
+func (m *Manager) unloadEngine(id string) {
+	m.engineLock.Lock()
+	defer m.engineLock.Unlock()
+	for i, e := range m.engines {
+		if e.ID == id {
+			m.clusterManager.RemoveEngine(e.Engine)
+			m.engines = append(m.engines[:i], m.engines[i+1:]...)
+			m.capacityLock.Lock()
+			delete(m.capacityWarned, id)
+			m.capacityLock.Unlock()
+			m.flaps.Forget(id)
+			logger.Infof("removed engine id=%s addr=%s", e.Engine.ID, e.Engine.Addr)
+			return
+		}
+	}
 }
 
 func (m *Manager) usageReport() {
-	if m.disableUsageInfo {
-		return
+	if m.IsLeader() {
+		m.uploadUsage()
 	}
-	m.uploadUsage()
-	t := time.NewTicker(1 * time.Hour).C
+	t := time.NewTicker(1 * time.Hour)
+	defer t.Stop()
 	for {
 		select {
-		case <-t:
+		case <-t.C:
+			if !m.IsLeader() {
+				continue
+			}
 			go m.uploadUsage()
+		case <-m.done:
+			return
 		}
 	}
 }
@@ -223,14 +673,20 @@ func (m *Manager) uploadUsage() {
 }
 
 func (m *Manager) extensionHealthCheck() {
-	t := time.NewTicker(time.Second * 1).C
+	t := time.NewTicker(time.Second * 1)
+	defer t.Stop()
 	for {
 		select {
-		case <-t:
+		case <-m.done:
+			return
+		case <-t.C:
+			if !m.IsLeader() {
+				continue
+			}
 			exts, err := m.Extensions()
 			if err != nil {
 				logger.Warnf("error running extension health check: %s", err)
-				return
+				continue
 			}
 			for _, ext := range exts {
 				var once sync.Once
@@ -266,47 +722,32 @@ func (m *Manager) checkExtensionHealth(ext *shipyard.Extension) error {
 	return nil
 }
 
-func (m *Manager) engineCheck() {
-	t := time.NewTicker(time.Second * 10).C
+func (m *Manager) clusterSync() {
+	t := time.NewTicker(clusterSyncFreq)
+	defer t.Stop()
 	for {
 		select {
-		case <-t:
-			engs := m.Engines()
-			for _, eng := range engs {
-				health := &shipyard.Health{}
-				start_time := time.Now()
-				stat, err := eng.Ping()
-				if err != nil {
-					logger.Warnf("unable to ping engine: %s", err)
-				}
-				if stat != 200 {
-					health.Status = EngineHealthDown
-				} else {
-					health.Status = EngineHealthUp
-					health.ResponseTime = int64(time.Since(start_time) / time.Nanosecond)
-				}
-				eng.Health = health
-				// get version
-				version, err := eng.Engine.Version()
-				if err != nil {
-					logger.Warnf("unable to detect docker version: %s", err)
-				}
-				ver := ""
-				if version != nil {
-					ver = version.Version
-				}
-				eng.DockerVersion = ver
-				m.SaveEngine(eng)
+		case <-m.done:
+			return
+		case <-t.C:
+			if err := m.clusterManager.Sync(); err != nil {
+				logger.Warnf("error syncing cluster state: %s", err)
 			}
 		}
 	}
 }
 
 func (m *Manager) Engines() []*shipyard.Engine {
-	return m.engines
+	m.engineLock.RLock()
+	defer m.engineLock.RUnlock()
+	engines := make([]*shipyard.Engine, len(m.engines))
+	copy(engines, m.engines)
+	return engines
 }
 
 func (m *Manager) Engine(id string) *shipyard.Engine {
+	m.engineLock.RLock()
+	defer m.engineLock.RUnlock()
 	for _, e := range m.engines {
 		if e.ID == id {
 			return e
@@ -315,7 +756,7 @@ func (m *Manager) Engine(id string) *shipyard.Engine {
 	return nil
 }
 
-func (m *Manager) AddEngine(engine *shipyard.Engine) error {
+func (m *Manager) AddEngine(engine *shipyard.Engine, actor string) error {
 	stat, err := engine.Ping()
 	if err != nil {
 		return err
@@ -324,15 +765,30 @@ func (m *Manager) AddEngine(engine *shipyard.Engine) error {
 		err := fmt.Errorf("Received status code '%d' when contacting %s", stat, engine.Engine.Addr)
 		return err
 	}
-	if _, err := r.Table(tblNameConfig).Insert(engine).RunWrite(m.session); err != nil {
+	if err := detectCapacity(engine); err != nil {
 		return err
 	}
-	m.init()
+	rec, err := m.sealEngineKey(engine)
+	if err != nil {
+		return err
+	}
+	res, err := r.Table(tblNameConfig).Insert(rec).RunWrite(m.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		engine.ID = res.GeneratedKeys[0]
+	}
+	if err := m.reloadEngine(engine.ID); err != nil {
+		return err
+	}
+	m.checkCapacity(engine)
 	evt := &shipyard.Event{
 		Type:    "add-engine",
 		Message: fmt.Sprintf("addr=%s", engine.Engine.Addr),
 		Time:    time.Now(),
 		Engine:  engine.Engine,
+		Actor:   actor,
 		Tags:    []string{"cluster"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -342,13 +798,17 @@ func (m *Manager) AddEngine(engine *shipyard.Engine) error {
 }
 
 func (m *Manager) SaveEngine(engine *shipyard.Engine) error {
-	if _, err := r.Table(tblNameConfig).Replace(engine).RunWrite(m.session); err != nil {
+	rec, err := m.sealEngineKey(engine)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Table(tblNameConfig).Replace(rec).RunWrite(m.session); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (m *Manager) RemoveEngine(id string) error {
+func (m *Manager) RemoveEngine(id string, actor string) error {
 	var engine *shipyard.Engine
 	res, err := r.Table(tblNameConfig).Filter(map[string]string{"id": id}).Run(m.session)
 	if err != nil {
@@ -365,6 +825,7 @@ func (m *Manager) RemoveEngine(id string) error {
 		Message: fmt.Sprintf("addr=%s", engine.Engine.Addr),
 		Time:    time.Now(),
 		Engine:  engine.Engine,
+		Actor:   actor,
 		Tags:    []string{"cluster"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -373,7 +834,7 @@ func (m *Manager) RemoveEngine(id string) error {
 	if _, err := r.Table(tblNameConfig).Get(id).Delete().RunWrite(m.session); err != nil {
 		return err
 	}
-	m.init()
+	m.unloadEngine(id)
 	return nil
 }
 
@@ -451,15 +912,25 @@ func (m *Manager) Destroy(container *citadel.Container) error {
 	return nil
 }
 
-func (m *Manager) SaveServiceKey(key *shipyard.ServiceKey) error {
+func (m *Manager) Stop(container *citadel.Container) error {
+	return m.clusterManager.Stop(container)
+}
+
+// Restart restarts the container, killing it if it does not stop within
+// timeout seconds
+func (m *Manager) Restart(container *citadel.Container, timeout int) error {
+	return m.clusterManager.Restart(container, timeout)
+}
+
+func (m *Manager) SaveServiceKey(key *shipyard.ServiceKey, actor string) error {
 	if _, err := r.Table(tblNameServiceKeys).Insert(key).RunWrite(m.session); err != nil {
 		return err
 	}
-	m.init()
 	evt := &shipyard.Event{
 		Type:    "add-service-key",
 		Time:    time.Now(),
-		Message: fmt.Sprintf("description=%s", key.Description),
+		Message: fmt.Sprintf("description=%s scopes=%s", key.Description, strings.Join(key.Scopes, ",")),
+		Actor:   actor,
 		Tags:    []string{"cluster", "security"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -468,7 +939,7 @@ func (m *Manager) SaveServiceKey(key *shipyard.ServiceKey) error {
 	return nil
 }
 
-func (m *Manager) RemoveServiceKey(key string) error {
+func (m *Manager) RemoveServiceKey(key string, actor string) error {
 	k, err := m.ServiceKey(key)
 	if err != nil {
 		return err
@@ -477,6 +948,7 @@ func (m *Manager) RemoveServiceKey(key string) error {
 		Type:    "remove-service-key",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("description=%s", k.Description),
+		Actor:   actor,
 		Tags:    []string{"cluster", "security"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -489,16 +961,21 @@ func (m *Manager) RemoveServiceKey(key string) error {
 }
 
 func (m *Manager) SaveEvent(event *shipyard.Event) error {
-	if _, err := r.Table(tblNameEvents).Insert(event).RunWrite(m.session); err != nil {
+	res, err := r.Table(tblNameEvents).Insert(event).RunWrite(m.session)
+	if err != nil {
 		return err
 	}
+	if len(res.GeneratedKeys) > 0 {
+		event.ID = res.GeneratedKeys[0]
+	}
+	m.publishEvent(event)
 	return nil
 }
 
 func (m *Manager) Events(limit int) ([]*shipyard.Event, error) {
-	t := r.Table(tblNameEvents).OrderBy(r.Desc("Time"))
+	t := r.Table(tblNameEvents).OrderBy(r.OrderByOpts{Index: r.Desc("time")})
 	if limit > -1 {
-		t.Limit(limit)
+		t = t.Limit(limit)
 	}
 	res, err := t.Run(m.session)
 	if err != nil {
@@ -574,7 +1051,15 @@ func (m *Manager) Account(username string) (*shipyard.Account, error) {
 	return account, nil
 }
 
-func (m *Manager) SaveAccount(account *shipyard.Account) error {
+func (m *Manager) SaveAccount(account *shipyard.Account, actor string) error {
+	if err := m.passwordPolicy.Validate(account.Username, account.Password); err != nil {
+		return err
+	}
+	return m.saveAccount(account, actor)
+}
+
+// saveAccount saves the account without checking the password policy
+func (m *Manager) saveAccount(account *shipyard.Account, actor string) error {
 	pass := account.Password
 	hash, err := m.authenticator.Hash(pass)
 	if err != nil {
@@ -599,6 +1084,7 @@ func (m *Manager) SaveAccount(account *shipyard.Account) error {
 		Type:    "add-account",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("username=%s", account.Username),
+		Actor:   actor,
 		Tags:    []string{"cluster", "security"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -607,7 +1093,74 @@ func (m *Manager) SaveAccount(account *shipyard.Account) error {
 	return nil
 }
 
-func (m *Manager) DeleteAccount(account *shipyard.Account) error {
+// SSOAccount returns the account for a single sign-on user.  Accounts
+// are keyed on the identity (issuer and subject) of the user at the
+// provider rather than the username claim, which users can often change.
+// The account is created on first login and its role is kept in sync with
+// the role mapped from the identity provider claims.  A username that
+// already belongs to another account is refused so that an identity
+// provider user cannot take over a local account.
+func (m *Manager) SSOAccount(identity string, username string, roleName string) (*shipyard.Account, error) {
+	role, err := m.Role(roleName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.Table(tblNameAccounts).Filter(map[string]string{"sso_identity": identity}).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	var acct *shipyard.Account
+	if !res.IsNil() {
+		if err := res.One(&acct); err != nil {
+			return nil, err
+		}
+	}
+	if acct == nil {
+		existing, err := m.Account(username)
+		if err != nil && err != ErrAccountDoesNotExist {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrSSOAccountConflict
+		}
+		// sso accounts get an unusable random password; they can only
+		// login through the identity provider unless an admin sets one
+		pass, err := m.authenticator.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		account := &shipyard.Account{
+			Username:    username,
+			Password:    pass,
+			Role:        role,
+			SSO:         true,
+			SSOIdentity: identity,
+		}
+		if err := m.saveAccount(account, username); err != nil {
+			return nil, err
+		}
+		return m.Account(username)
+	}
+	if acct.Role == nil || acct.Role.Name != role.Name {
+		if _, err := r.Table(tblNameAccounts).Get(acct.ID).Update(map[string]interface{}{"role": role}).RunWrite(m.session); err != nil {
+			return nil, err
+		}
+		evt := &shipyard.Event{
+			Type:    "update-account-role",
+			Time:    time.Now(),
+			Message: fmt.Sprintf("username=%s role=%s", acct.Username, role.Name),
+			Actor:   acct.Username,
+			Tags:    []string{"cluster", "security"},
+		}
+		if err := m.SaveEvent(evt); err != nil {
+			return nil, err
+		}
+		acct.Role = role
+	}
+	return acct, nil
+}
+
+func (m *Manager) DeleteAccount(account *shipyard.Account, actor string) error {
 	res, err := r.Table(tblNameAccounts).Filter(map[string]string{"id": account.ID}).Delete().Run(m.session)
 	if err != nil {
 		return err
@@ -619,6 +1172,7 @@ func (m *Manager) DeleteAccount(account *shipyard.Account) error {
 		Type:    "delete-account",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("username=%s", account.Username),
+		Actor:   actor,
 		Tags:    []string{"cluster", "security"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -655,7 +1209,7 @@ func (m *Manager) Role(name string) (*shipyard.Role, error) {
 	return role, nil
 }
 
-func (m *Manager) SaveRole(role *shipyard.Role) error {
+func (m *Manager) SaveRole(role *shipyard.Role, actor string) error {
 	if _, err := r.Table(tblNameRoles).Insert(role).RunWrite(m.session); err != nil {
 		return err
 	}
@@ -663,6 +1217,7 @@ func (m *Manager) SaveRole(role *shipyard.Role) error {
 		Type:    "add-role",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("name=%s", role.Name),
+		Actor:   actor,
 		Tags:    []string{"cluster", "security"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -671,7 +1226,7 @@ func (m *Manager) SaveRole(role *shipyard.Role) error {
 	return nil
 }
 
-func (m *Manager) DeleteRole(role *shipyard.Role) error {
+func (m *Manager) DeleteRole(role *shipyard.Role, actor string) error {
 	res, err := r.Table(tblNameRoles).Get(role.ID).Delete().Run(m.session)
 	if err != nil {
 		return err
@@ -683,6 +1238,7 @@ func (m *Manager) DeleteRole(role *shipyard.Role) error {
 		Type:    "delete-role",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("name=%s", role.Name),
+		Actor:   actor,
 		Tags:    []string{"cluster", "security"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -700,7 +1256,111 @@ func (m *Manager) Authenticate(username, password string) bool {
 	return m.authenticator.Authenticate(password, acct.Password)
 }
 
-func (m *Manager) NewAuthToken(username string, userAgent string) (*shipyard.AuthToken, error) {
+// Login authenticates the account while enforcing the login limiter.  A
+// *LockoutError is returned while the account or source address is locked.
+// Accounts with two-factor authentication return ErrTOTPRequired until a
+// code is given; invalid codes count as failed logins.
+func (m *Manager) Login(username, password, code, addr string) (*shipyard.Account, error) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	if err := m.loginLimiter.Check(username, host); err != nil {
+		return nil, err
+	}
+	acct, err := m.Account(username)
+	if err != nil && err != ErrAccountDoesNotExist {
+		return nil, err
+	}
+	if acct == nil || !m.authenticator.Authenticate(password, acct.Password) {
+		m.loginFailure(username, host)
+		return nil, ErrInvalidLogin
+	}
+	if acct.TOTPEnabled {
+		if code == "" {
+			return nil, ErrTOTPRequired
+		}
+		if err := m.verifySecondFactor(acct, code); err != nil {
+			if err != ErrInvalidTOTPCode {
+				return nil, err
+			}
+			m.loginFailure(username, host)
+			return nil, err
+		}
+	}
+	m.loginLimiter.Success(username, host)
+	return acct, nil
+}
+
+func (m *Manager) loginFailure(username string, addr string) {
+	accountLocked, addrLocked := m.loginLimiter.Failure(username, addr)
+	if accountLocked {
+		m.saveLockoutEvent("account-locked", username, addr)
+	}
+	if addrLocked {
+		m.saveLockoutEvent("address-locked", username, addr)
+	}
+}
+
+func (m *Manager) saveLockoutEvent(eventType string, username string, addr string) {
+	logger.Warnf("%s: username=%s addr=%s", eventType, username, addr)
+	evt := &shipyard.Event{
+		Type:    eventType,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("username=%s addr=%s", username, addr),
+		Tags:    []string{"security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		logger.Errorf("error saving event: %s", err)
+	}
+}
+
+// Bootstrap creates the default roles and the admin account on first
+// start.  Without an admin password the well known default is used and
+// must be changed on first login.
+func (m *Manager) Bootstrap(adminPassword string) error {
+	if _, err := m.Account("admin"); err != ErrAccountDoesNotExist {
+		return err
+	}
+	for _, name := range []string{"admin", "user"} {
+		if _, err := m.Role(name); err == nil {
+			continue
+		} else if err != ErrRoleDoesNotExist {
+			return err
+		}
+		if err := m.SaveRole(&shipyard.Role{Name: name}, ""); err != nil {
+			return err
+		}
+	}
+	role, err := m.Role("admin")
+	if err != nil {
+		return err
+	}
+	acct := &shipyard.Account{
+		Username: "admin",
+		Password: adminPassword,
+		Role:     role,
+	}
+	if adminPassword == "" {
+		acct.Password = defaultAdminPass
+		acct.PasswordChangeRequired = true
+		if err := m.saveAccount(acct, ""); err != nil {
+			return err
+		}
+		logger.Warnf("created admin user: username: admin password: %s (must be changed on first login)", defaultAdminPass)
+		return nil
+	}
+	if err := m.SaveAccount(acct, ""); err != nil {
+		return err
+	}
+	logger.Info("created admin user")
+	return nil
+}
+
+// NewAuthToken issues a token for the account, replacing any token it
+// has for the user agent.  multiFactor records that the login asserted a
+// second factor outside of shipyard (i.e. at the identity provider).
+func (m *Manager) NewAuthToken(username string, userAgent string, multiFactor bool) (*shipyard.AuthToken, error) {
 	tk, err := m.authenticator.GenerateToken()
 	if err != nil {
 		return nil, err
@@ -719,14 +1379,16 @@ func (m *Manager) NewAuthToken(username string, userAgent string) (*shipyard.Aut
 		if t.UserAgent == userAgent {
 			found = true
 			t.Token = tk
+			t.MultiFactor = multiFactor
 			token = t
 			break
 		}
 	}
 	if !found {
 		token = &shipyard.AuthToken{
-			UserAgent: userAgent,
-			Token:     tk,
+			UserAgent:   userAgent,
+			Token:       tk,
+			MultiFactor: multiFactor,
 		}
 		tokens = append(tokens, token)
 	}
@@ -741,52 +1403,131 @@ func (m *Manager) NewAuthToken(username string, userAgent string) (*shipyard.Aut
 	return token, nil
 }
 
+// VerifyAuthToken checks the token for the account.  Valid tokens for
+// accounts that must change their password or enroll in two-factor
+// authentication return ErrPasswordChangeRequired or
+// ErrTOTPEnrollmentRequired.
 func (m *Manager) VerifyAuthToken(username, token string) error {
 	acct, err := m.Account(username)
 	if err != nil {
 		return err
 	}
-	found := false
-	for _, t := range acct.Tokens {
-		if token == t.Token {
-			found = true
-			break
-		}
-	}
-	if !found {
+	t := acct.AuthToken(token)
+	if t == nil {
 		return ErrInvalidAuthToken
 	}
-	return nil
+	return accountRestriction(acct, t.MultiFactor)
 }
 
-func (m *Manager) VerifyServiceKey(key string) error {
-	if _, err := m.ServiceKey(key); err != nil {
-		return err
+// accountRestriction returns ErrPasswordChangeRequired or
+// ErrTOTPEnrollmentRequired for accounts that must complete their setup
+// before using the api.  Enrollment is not required when the login
+// already asserted a second factor.
+func accountRestriction(acct *shipyard.Account, multiFactor bool) error {
+	if acct.PasswordChangeRequired {
+		return ErrPasswordChangeRequired
+	}
+	if acct.TOTPEnrollmentRequired() && !multiFactor {
+		return ErrTOTPEnrollmentRequired
 	}
 	return nil
 }
 
-func (m *Manager) NewServiceKey(description string) (*shipyard.ServiceKey, error) {
-	k, err := m.authenticator.GenerateToken()
+// VerifyServiceKey checks that the key exists, has not expired and is
+// used from an allowed address.  Key usage is recorded at most once per
+// minute to avoid a database write for every request.
+func (m *Manager) VerifyServiceKey(key string, addr string) (*shipyard.ServiceKey, error) {
+	k, err := m.ServiceKey(key)
 	if err != nil {
 		return nil, err
 	}
-	key := &shipyard.ServiceKey{
-		Key:         k[24:],
-		Description: description,
+	return m.verifyServiceKey(k, addr)
+}
+
+// verifyServiceKey checks the expiry and allowed networks of the key and
+// records its usage
+func (m *Manager) verifyServiceKey(k *shipyard.ServiceKey, addr string) (*shipyard.ServiceKey, error) {
+	if k.Expired() {
+		return nil, ErrServiceKeyExpired
+	}
+	if !k.AllowedFrom(addr) {
+		return nil, ErrServiceKeyNotAllowed
+	}
+	// clients use a new source port for every connection
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	now := time.Now()
+	if k.LastUsed == nil || now.Sub(*k.LastUsed) > serviceKeyUsedFreq || k.LastUsedAddr != host {
+		k.LastUsed = &now
+		k.LastUsedAddr = host
+		if _, err := r.Table(tblNameServiceKeys).Filter(map[string]string{"key": k.Key}).Update(map[string]interface{}{"last_used": now, "last_used_addr": host}).RunWrite(m.session); err != nil {
+			logger.Warnf("unable to update service key usage: %s", err)
+		}
 	}
-	if err := m.SaveServiceKey(key); err != nil {
+	return k, nil
+}
+
+func (m *Manager) NewServiceKey(k *shipyard.ServiceKey, actor string) (*shipyard.ServiceKey, error) {
+	for _, s := range k.Scopes {
+		if err := shipyard.ValidatePermission(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range k.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			return nil, err
+		}
+	}
+	if k.CommonName != "" {
+		if _, err := m.serviceKeyByCommonName(k.CommonName); err == nil {
+			return nil, ErrCommonNameExists
+		} else if err != ErrServiceKeyDoesNotExist {
+			return nil, err
+		}
+	}
+	tk, err := m.authenticator.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	key := &shipyard.ServiceKey{
+		Key:          tk[24:],
+		Description:  k.Description,
+		Scopes:       k.Scopes,
+		Images:       k.Images,
+		Expires:      k.Expires,
+		AllowedCIDRs: k.AllowedCIDRs,
+		CommonName:   k.CommonName,
+	}
+	if err := m.SaveServiceKey(key, actor); err != nil {
 		return nil, err
 	}
 	return key, nil
 }
 
+// ChangePassword sets a new password for the account.  The default
+// admin password and the current password are refused so that a forced
+// password change cannot be skipped.
 func (m *Manager) ChangePassword(username, password string) error {
+	if err := m.passwordPolicy.Validate(username, password); err != nil {
+		return err
+	}
+	if password == defaultAdminPass {
+		return shipyard.ErrPasswordIsDefault
+	}
+	acct, err := m.Account(username)
+	if err != nil {
+		return err
+	}
+	if m.authenticator.Authenticate(password, acct.Password) {
+		return shipyard.ErrPasswordUnchanged
+	}
 	hash, err := m.authenticator.Hash(password)
 	if err != nil {
 		return err
 	}
-	if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": username}).Update(map[string]string{"password": hash}).Run(m.session); err != nil {
+	if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": username}).Update(map[string]interface{}{"password": hash, "password_change_required": false}).Run(m.session); err != nil {
 		return err
 	}
 	return nil
@@ -820,7 +1561,14 @@ func (m *Manager) Extension(id string) (*shipyard.Extension, error) {
 	return ext, nil
 }
 
-func (m *Manager) SaveExtension(ext *shipyard.Extension) error {
+func (m *Manager) SaveExtension(ext *shipyard.Extension, actor string) error {
+	if err := m.saveExtension(ext, actor); err != nil {
+		return err
+	}
+	return m.RegisterExtension(ext)
+}
+
+func (m *Manager) saveExtension(ext *shipyard.Extension, actor string) error {
 	res, err := r.Table(tblNameExtensions).Insert(ext).RunWrite(m.session)
 	if err != nil {
 		return err
@@ -829,6 +1577,7 @@ func (m *Manager) SaveExtension(ext *shipyard.Extension) error {
 		Type:    "add-extension",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("name=%s version=%s author=%s", ext.Name, ext.Version, ext.Author),
+		Actor:   actor,
 		Tags:    []string{"cluster"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -836,14 +1585,14 @@ func (m *Manager) SaveExtension(ext *shipyard.Extension) error {
 	}
 	key := res.GeneratedKeys[0]
 	ext.ID = key
-	// register
-	if err := m.RegisterExtension(ext); err != nil {
-		return err
-	}
 	return nil
 }
 
 func (m *Manager) RegisterExtension(ext *shipyard.Extension) error {
+	return m.registerExtension(ext, nil)
+}
+
+func (m *Manager) registerExtension(ext *shipyard.Extension, task *OperationTask) error {
 	if ext.Config.Environment == nil {
 		env := make(map[string]string)
 		ext.Config.Environment = env
@@ -878,7 +1627,11 @@ func (m *Manager) RegisterExtension(ext *shipyard.Extension) error {
 				}
 			}
 		}
+		task.SetTotal(len(engs))
 		for _, eng := range engs {
+			if task.Cancelled() {
+				break
+			}
 			// skip if already present
 			for _, xe := range extEngines {
 				if xe == eng {
@@ -889,6 +1642,7 @@ func (m *Manager) RegisterExtension(ext *shipyard.Extension) error {
 			labels := []string{fmt.Sprintf("host:%s", eng.ID)}
 			image.Labels = labels
 			container, err := m.clusterManager.Start(image, true)
+			task.containerResult(container, err)
 			if err != nil {
 				logger.Errorf("error running %s for extension image %s: %s", image.Name, ext.Name, err)
 				return err
@@ -896,7 +1650,9 @@ func (m *Manager) RegisterExtension(ext *shipyard.Extension) error {
 			logger.Infof("started %s (%s) for extension %s", container.ID[:8], image.Name, ext.Name)
 		}
 	} else {
+		task.SetTotal(1)
 		container, err := m.clusterManager.Start(image, true)
+		task.containerResult(container, err)
 		if err != nil {
 			logger.Errorf("error running %s for extension image %s: %s", image.Name, ext.Name, err)
 			return err
@@ -948,36 +1704,50 @@ func (m *Manager) DeleteExtension(id string) error {
 }
 
 func (m *Manager) RedeployContainers(image string) error {
+	return m.redeployContainers(image, nil)
+}
+
+func (m *Manager) redeployContainers(image string, task *OperationTask) error {
 	var img *citadel.Image
-	containers := m.Containers(false)
-	deployed := false
-	for _, c := range containers {
+	matched := []*citadel.Container{}
+	for _, c := range m.Containers(false) {
 		if strings.Index(c.Image.Name, image) > -1 {
-			img = c.Image
-			logger.Infof("pulling latest image for %s", image)
-			if err := c.Engine.Pull(image); err != nil {
-				return err
-			}
-			m.Destroy(c)
-			// in order to keep fast deploys, we must deploy
-			// to the same host that the image was running on previously
-			img.Type = "host"
-			lbl := fmt.Sprintf("host:%s", c.Engine.ID)
-			img.Labels = []string{lbl}
-			nc, err := m.ClusterManager().Start(img, false)
-			if err != nil {
-				return err
-			}
-			deployed = true
-			logger.Infof("deployed updated container %s via webhook for %s", nc.ID[:8], image)
+			matched = append(matched, c)
 		}
 	}
+	task.SetTotal(len(matched))
+	deployed := false
+	for _, c := range matched {
+		if task.Cancelled() {
+			break
+		}
+		img = c.Image
+		logger.Infof("pulling latest image for %s", image)
+		if err := c.Engine.Pull(image); err != nil {
+			task.Result(c.ID, c.Engine.ID, err)
+			return err
+		}
+		m.Destroy(c)
+		// in order to keep fast deploys, we must deploy
+		// to the same host that the image was running on previously
+		img.Type = "host"
+		lbl := fmt.Sprintf("host:%s", c.Engine.ID)
+		img.Labels = []string{lbl}
+		nc, err := m.ClusterManager().Start(img, false)
+		task.containerResult(nc, err)
+		if err != nil {
+			return err
+		}
+		deployed = true
+		logger.Infof("deployed updated container %s via webhook for %s", nc.ID[:8], image)
+	}
 	if deployed {
 		evt := &shipyard.Event{
 			Type:    "deploy",
 			Message: fmt.Sprintf("%s deployed", image),
 			Time:    time.Now(),
 			Tags:    []string{"deploy"},
+			Actor:   task.Actor(),
 		}
 		if err := m.SaveEvent(evt); err != nil {
 			return err
@@ -998,13 +1768,13 @@ func (m *Manager) WebhookKeys() ([]*dockerhub.WebhookKey, error) {
 	return keys, nil
 }
 
-func (m *Manager) NewWebhookKey(image string) (*dockerhub.WebhookKey, error) {
+func (m *Manager) NewWebhookKey(image string, actor string) (*dockerhub.WebhookKey, error) {
 	k := generateId(16)
 	key := &dockerhub.WebhookKey{
 		Key:   k,
 		Image: image,
 	}
-	if err := m.SaveWebhookKey(key); err != nil {
+	if err := m.SaveWebhookKey(key, actor); err != nil {
 		return nil, err
 	}
 	return key, nil
@@ -1026,7 +1796,7 @@ func (m *Manager) WebhookKey(key string) (*dockerhub.WebhookKey, error) {
 	return k, nil
 }
 
-func (m *Manager) SaveWebhookKey(key *dockerhub.WebhookKey) error {
+func (m *Manager) SaveWebhookKey(key *dockerhub.WebhookKey, actor string) error {
 	if _, err := r.Table(tblNameWebhookKeys).Insert(key).RunWrite(m.session); err != nil {
 		return err
 	}
@@ -1034,6 +1804,7 @@ func (m *Manager) SaveWebhookKey(key *dockerhub.WebhookKey) error {
 		Type:    "add-webhook-key",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("image=%s", key.Image),
+		Actor:   actor,
 		Tags:    []string{"docker", "webhook"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -1042,7 +1813,7 @@ func (m *Manager) SaveWebhookKey(key *dockerhub.WebhookKey) error {
 	return nil
 }
 
-func (m *Manager) DeleteWebhookKey(id string) error {
+func (m *Manager) DeleteWebhookKey(id string, actor string) error {
 	key, err := m.WebhookKey(id)
 	if err != nil {
 		return err
@@ -1058,6 +1829,7 @@ func (m *Manager) DeleteWebhookKey(id string) error {
 		Type:    "delete-webhook-key",
 		Time:    time.Now(),
 		Message: fmt.Sprintf("image=%s key=%s", key.Image, key.Key),
+		Actor:   actor,
 		Tags:    []string{"docker", "webhook"},
 	}
 	if err := m.SaveEvent(evt); err != nil {
@@ -1066,27 +1838,14 @@ func (m *Manager) DeleteWebhookKey(id string) error {
 	return nil
 }
 
-func (m *Manager) Run(image *citadel.Image, count int, pull bool) ([]*citadel.Container, error) {
-	launched := []*citadel.Container{}
-
-	var wg sync.WaitGroup
-	wg.Add(count)
-	var runErr error
-	for i := 0; i < count; i++ {
-		go func(wg *sync.WaitGroup) {
-			container, err := m.ClusterManager().Start(image, pull)
-			if err != nil {
-				runErr = err
-			}
-			launched = append(launched, container)
-			wg.Done()
-		}(&wg)
-	}
-	wg.Wait()
-	return launched, runErr
+func (m *Manager) Scale(container *citadel.Container, count int) error {
+	return m.scale(container, count, nil)
 }
 
-func (m *Manager) Scale(container *citadel.Container, count int) error {
+func (m *Manager) scale(container *citadel.Container, count int, task *OperationTask) error {
+	if count < 0 {
+		return ErrInvalidCount
+	}
 	imageContainers, err := m.IdenticalContainers(container, true)
 	if err != nil {
 		return err
@@ -1096,8 +1855,14 @@ func (m *Manager) Scale(container *citadel.Container, count int) error {
 	if containerCount > count { // down
 		numKill := containerCount - count
 		delContainers := imageContainers[0:numKill]
+		task.SetTotal(numKill)
 		for _, c := range delContainers {
-			if err := m.Destroy(c); err != nil {
+			if task.Cancelled() {
+				break
+			}
+			err := m.Destroy(c)
+			task.Result(c.ID, c.Engine.ID, err)
+			if err != nil {
 				return err
 			}
 		}
@@ -1120,7 +1885,8 @@ func (m *Manager) Scale(container *citadel.Container, count int) error {
 		}
 		// reset hostname
 		img.Hostname = ""
-		if _, err := m.Run(img, numAdd, false); err != nil {
+		task.SetTotal(numAdd)
+		if _, err := m.run(img, numAdd, RunOptions{}, task); err != nil {
 			return err
 		}
 	} else { // none
@@ -0,0 +1,376 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/notify"
+)
+
+const (
+	tblNameNotificationChannels   = "notification_channels"
+	tblNameNotificationDeliveries = "notification_deliveries"
+	deliveryPruneFreq             = time.Hour
+	defaultDeliveryRetention      = 7 * 24 * time.Hour
+	// deliveryQueueSize bounds the events waiting for a channel; events
+	// for a channel with a full queue are dropped
+	deliveryQueueSize = 100
+)
+
+var (
+	ErrNotificationChannelDoesNotExist = errors.New("notification channel does not exist")
+)
+
+func (m *Manager) NotificationChannels() ([]*shipyard.NotificationChannel, error) {
+	res, err := r.Table(tblNameNotificationChannels).OrderBy(r.Asc("name")).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	channels := []*shipyard.NotificationChannel{}
+	if err := res.All(&channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (m *Manager) NotificationChannel(id string) (*shipyard.NotificationChannel, error) {
+	res, err := r.Table(tblNameNotificationChannels).Get(id).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsNil() {
+		return nil, ErrNotificationChannelDoesNotExist
+	}
+	var c *shipyard.NotificationChannel
+	if err := res.One(&c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func validateNotificationChannel(c *shipyard.NotificationChannel) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.Type == shipyard.NotificationWebhook && c.Template != "" {
+		if _, err := notify.ParseTemplate(c.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) AddNotificationChannel(c *shipyard.NotificationChannel, actor string) error {
+	if err := validateNotificationChannel(c); err != nil {
+		return err
+	}
+	c.ID = ""
+	c.Created = time.Now()
+	res, err := r.Table(tblNameNotificationChannels).Insert(c).RunWrite(m.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		c.ID = res.GeneratedKeys[0]
+	}
+	evt := &shipyard.Event{
+		Type:    "add-notification-channel",
+		Time:    c.Created,
+		Message: fmt.Sprintf("id=%s name=%s type=%s", c.ID, c.Name, c.Type),
+		Actor:   actor,
+		Tags:    []string{"cluster"},
+	}
+	return m.SaveEvent(evt)
+}
+
+// UpdateNotificationChannel replaces the channel; an empty smtp password
+// keeps the current one since passwords are not returned by the api
+func (m *Manager) UpdateNotificationChannel(c *shipyard.NotificationChannel, actor string) error {
+	existing, err := m.NotificationChannel(c.ID)
+	if err != nil {
+		return err
+	}
+	if err := validateNotificationChannel(c); err != nil {
+		return err
+	}
+	if c.SMTP != nil && c.SMTP.Password == "" && existing.SMTP != nil {
+		c.SMTP.Password = existing.SMTP.Password
+	}
+	c.Created = existing.Created
+	if _, err := r.Table(tblNameNotificationChannels).Get(c.ID).Replace(c).RunWrite(m.session); err != nil {
+		return err
+	}
+	evt := &shipyard.Event{
+		Type:    "update-notification-channel",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("id=%s name=%s type=%s disabled=%v", c.ID, c.Name, c.Type, c.Disabled),
+		Actor:   actor,
+		Tags:    []string{"cluster"},
+	}
+	return m.SaveEvent(evt)
+}
+
+func (m *Manager) RemoveNotificationChannel(id string, actor string) error {
+	res, err := r.Table(tblNameNotificationChannels).Get(id).Delete().RunWrite(m.session)
+	if err != nil {
+		return err
+	}
+	if res.Deleted == 0 {
+		return ErrNotificationChannelDoesNotExist
+	}
+	evt := &shipyard.Event{
+		Type:    "remove-notification-channel",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("id=%s", id),
+		Actor:   actor,
+		Tags:    []string{"cluster"},
+	}
+	return m.SaveEvent(evt)
+}
+
+// NotificationDeliveries returns the latest limit deliveries to the
+// channel, or to any channel if id is empty
+func (m *Manager) NotificationDeliveries(id string, limit int) ([]*shipyard.NotificationDelivery, error) {
+	t := r.Table(tblNameNotificationDeliveries).OrderBy(r.OrderByOpts{Index: r.Desc("created")})
+	if id != "" {
+		if _, err := m.NotificationChannel(id); err != nil {
+			return nil, err
+		}
+		t = t.Filter(map[string]string{"channel_id": id})
+	}
+	if limit > -1 {
+		t = t.Limit(limit)
+	}
+	res, err := t.Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []*shipyard.NotificationDelivery{}
+	if err := res.All(&deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// TestNotificationChannel sends a test event to the channel once, without
+// retries, and returns the delivery
+func (m *Manager) TestNotificationChannel(id string, actor string) (*shipyard.NotificationDelivery, error) {
+	c, err := m.NotificationChannel(id)
+	if err != nil {
+		return nil, err
+	}
+	evt := &shipyard.Event{
+		Type:    "notification-test",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("test notification from controller %s", m.controller.Hostname),
+		Actor:   actor,
+		Tags:    []string{"cluster"},
+	}
+	n := *m.notifier
+	n.Retry = notify.Backoff{Attempts: 1}
+	return m.deliver(&n, c, evt)
+}
+
+// notifications delivers saved events to the channels with a matching
+// rule.  Events are delivered by the controller that saved them, except
+// for docker events which every controller receives from the engines; those
+// are only delivered by the leader.
+func (m *Manager) notifications() {
+	events := m.SubscribeEvents()
+	defer m.UnsubscribeEvents(events)
+	prune := time.NewTicker(deliveryPruneFreq)
+	defer prune.Stop()
+	queues := newDeliveryQueues(deliveryQueueSize, m.done, func(c *shipyard.NotificationChannel, evt *shipyard.Event) {
+		if _, err := m.deliver(m.notifier, c, evt); err != nil {
+			logger.Errorf("unable to save notification delivery: %s", err)
+		}
+	})
+	for {
+		select {
+		case <-m.done:
+			// wait for the deliveries in progress to record their status
+			queues.wait()
+			return
+		case <-prune.C:
+			if !m.IsLeader() {
+				continue
+			}
+			m.pruneNotificationDeliveries()
+		case evt := <-events:
+			if hasTag(evt.Tags, "docker") && !m.IsLeader() {
+				continue
+			}
+			channels, err := m.NotificationChannels()
+			if err != nil {
+				logger.Errorf("unable to load notification channels: %s", err)
+				continue
+			}
+			for _, c := range channels {
+				if !c.Matches(evt) {
+					continue
+				}
+				if !queues.enqueue(c, evt) {
+					logger.Warnf("notification queue of channel %s is full; dropped %s", c.Name, evt.Type)
+				}
+			}
+		}
+	}
+}
+
+type (
+	// deliveryQueues delivers the events of each channel in order on a
+	// goroutine per channel so that a slow channel holds up neither the
+	// event loop nor the other channels
+	deliveryQueues struct {
+		size    int
+		done    <-chan struct{}
+		deliver func(c *shipyard.NotificationChannel, evt *shipyard.Event)
+		queues  map[string]chan *queuedDelivery
+		workers sync.WaitGroup
+	}
+
+	queuedDelivery struct {
+		channel *shipyard.NotificationChannel
+		event   *shipyard.Event
+	}
+)
+
+func newDeliveryQueues(size int, done <-chan struct{}, deliver func(c *shipyard.NotificationChannel, evt *shipyard.Event)) *deliveryQueues {
+	return &deliveryQueues{
+		size:    size,
+		done:    done,
+		deliver: deliver,
+		queues:  make(map[string]chan *queuedDelivery),
+	}
+}
+
+// enqueue queues the event for the channel without blocking; it returns
+// false when the queue of the channel is full
+func (q *deliveryQueues) enqueue(c *shipyard.NotificationChannel, evt *shipyard.Event) bool {
+	queue, ok := q.queues[c.ID]
+	if !ok {
+		queue = make(chan *queuedDelivery, q.size)
+		q.queues[c.ID] = queue
+		q.workers.Add(1)
+		go q.run(queue)
+	}
+	select {
+	case queue <- &queuedDelivery{channel: c, event: evt}:
+		return true
+	default:
+		return false
+	}
+}
+
+// run delivers the queued events until done is closed
+func (q *deliveryQueues) run(queue chan *queuedDelivery) {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.done:
+			return
+		case d := <-queue:
+			q.deliver(d.channel, d.event)
+		}
+	}
+}
+
+// wait waits for the deliveries in progress once done is closed
+func (q *deliveryQueues) wait() {
+	q.workers.Wait()
+}
+
+// deliver sends the event to the channel and records the status of the
+// delivery after every attempt.  It returns an error if the delivery
+// could not be recorded; failed deliveries are not an error.
+func (m *Manager) deliver(n *notify.Notifier, c *shipyard.NotificationChannel, evt *shipyard.Event) (*shipyard.NotificationDelivery, error) {
+	now := time.Now()
+	d := &shipyard.NotificationDelivery{
+		ChannelID:    c.ID,
+		EventType:    evt.Type,
+		EventMessage: evt.Message,
+		Status:       shipyard.DeliveryPending,
+		Created:      now,
+		Updated:      now,
+	}
+	res, err := r.Table(tblNameNotificationDeliveries).Insert(d).RunWrite(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		d.ID = res.GeneratedKeys[0]
+	}
+
+	resolved, err := m.resolveChannel(c)
+	if err != nil {
+		d.Status = shipyard.DeliveryFailed
+		d.LastError = err.Error()
+		d.Updated = time.Now()
+		return d, m.saveDelivery(d)
+	}
+	var saveErr error
+	n.Deliver(resolved, evt, m.done, func(attempt int, err error, next *time.Time) {
+		d.Attempts = attempt
+		d.NextAttempt = next
+		d.Updated = time.Now()
+		switch {
+		case err == nil:
+			d.Status = shipyard.DeliveryDelivered
+			d.LastError = ""
+		case next == nil:
+			d.Status = shipyard.DeliveryFailed
+			d.LastError = err.Error()
+			logger.Warnf("notification %s to channel %s failed after %d attempts: %s", evt.Type, c.Name, attempt, err)
+		default:
+			d.LastError = err.Error()
+		}
+		if err := m.saveDelivery(d); err != nil {
+			saveErr = err
+		}
+	})
+	return d, saveErr
+}
+
+func (m *Manager) saveDelivery(d *shipyard.NotificationDelivery) error {
+	_, err := r.Table(tblNameNotificationDeliveries).Get(d.ID).Replace(d).RunWrite(m.session)
+	return err
+}
+
+// resolveChannel returns a copy of the channel with a secret reference in
+// the smtp password replaced by its value
+func (m *Manager) resolveChannel(c *shipyard.NotificationChannel) (*shipyard.NotificationChannel, error) {
+	if c.SMTP == nil {
+		return c, nil
+	}
+	password, _, err := m.ResolveEnvironment(c.SMTP.Password)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *c
+	smtp := *c.SMTP
+	smtp.Password = password
+	resolved.SMTP = &smtp
+	return &resolved, nil
+}
+
+// pruneNotificationDeliveries removes the deliveries older than the
+// retention
+func (m *Manager) pruneNotificationDeliveries() {
+	cutoff := time.Now().Add(-defaultDeliveryRetention)
+	if _, err := r.Table(tblNameNotificationDeliveries).Between(time.Unix(0, 0), cutoff, r.BetweenOpts{Index: "created"}).Delete().RunWrite(m.session); err != nil {
+		logger.Errorf("unable to prune notification deliveries: %s", err)
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shipyard/shipyard"
+)
+
+func TestDeliveryQueuesDoNotBlock(t *testing.T) {
+	done := make(chan struct{})
+	release := make(chan struct{})
+	delivered := make(chan string, 10)
+	var mux sync.Mutex
+	order := []string{}
+	q := newDeliveryQueues(1, done, func(c *shipyard.NotificationChannel, evt *shipyard.Event) {
+		if c.ID == "slow" {
+			<-release
+		}
+		mux.Lock()
+		order = append(order, evt.Type)
+		mux.Unlock()
+		delivered <- c.ID
+	})
+	slow := &shipyard.NotificationChannel{ID: "slow"}
+	fast := &shipyard.NotificationChannel{ID: "fast"}
+
+	// the first event is taken by the worker and the second is queued
+	if !q.enqueue(slow, &shipyard.Event{Type: "first"}) {
+		t.Fatal("expected the first event to be queued")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !q.enqueue(slow, &shipyard.Event{Type: "second"}) {
+		t.Fatal("expected the second event to be queued")
+	}
+	if q.enqueue(slow, &shipyard.Event{Type: "third"}) {
+		t.Error("expected the event to be dropped when the queue is full")
+	}
+	if !q.enqueue(fast, &shipyard.Event{Type: "other"}) {
+		t.Fatal("expected the event for another channel to be queued")
+	}
+	select {
+	case id := <-delivered:
+		if id != "fast" {
+			t.Errorf("expected the fast channel to be delivered first; received %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the slow channel not to hold up the fast channel")
+	}
+
+	close(release)
+	<-delivered
+	<-delivered
+	close(done)
+	q.wait()
+	mux.Lock()
+	defer mux.Unlock()
+	if len(order) != 3 || order[1] != "first" || order[2] != "second" {
+		t.Errorf("expected the events of a channel in order; received %v", order)
+	}
+}
@@ -0,0 +1,414 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	defaultOperationRetention = time.Hour
+)
+
+var (
+	ErrOperationDoesNotExist = errors.New("operation does not exist")
+	ErrOperationFinished     = errors.New("operation has already finished")
+	ErrOperationNotAllowed   = errors.New("only admins can cancel operations started by others")
+	ErrOperationsDraining    = errors.New("controller is shutting down")
+)
+
+type (
+	// OperationTracker runs long running actions in the background and
+	// keeps their progress for Retention after they finish.  Operations
+	// are kept in memory and are lost when the controller restarts.
+	OperationTracker struct {
+		Retention time.Duration
+
+		mux      sync.Mutex
+		ops      map[string]*OperationTask
+		running  sync.WaitGroup
+		draining bool
+	}
+
+	// OperationTask is the handle of a running operation.  A nil task
+	// ignores progress updates and is never cancelled.
+	OperationTask struct {
+		tracker   *OperationTracker
+		op        *shipyard.Operation
+		cancel    chan struct{}
+		cancelled bool
+		changed   chan struct{}
+	}
+)
+
+func NewOperationTracker(retention time.Duration) *OperationTracker {
+	return &OperationTracker{
+		Retention: retention,
+		ops:       make(map[string]*OperationTask),
+	}
+}
+
+// Start runs fn in the background as a new operation and returns a
+// snapshot of it.  The operation fails when fn returns an error or any
+// result records an error.  Once the tracker is draining, operations fail
+// without running fn.
+func (t *OperationTracker) Start(opType string, target string, actor string, fn func(task *OperationTask) error) *shipyard.Operation {
+	now := time.Now()
+	task := &OperationTask{
+		tracker: t,
+		op: &shipyard.Operation{
+			ID:      generateId(16),
+			Type:    opType,
+			Target:  target,
+			Actor:   actor,
+			Status:  shipyard.OperationRunning,
+			Results: []*shipyard.OperationResult{},
+			Created: now,
+			Updated: now,
+		},
+		cancel:  make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	t.mux.Lock()
+	t.prune(now)
+	t.ops[task.op.ID] = task
+	if t.draining {
+		task.op.Status = shipyard.OperationFailed
+		task.op.Error = ErrOperationsDraining.Error()
+		task.op.Finished = &now
+		snapshot := copyOperation(task.op)
+		t.mux.Unlock()
+		return snapshot
+	}
+	t.running.Add(1)
+	snapshot := copyOperation(task.op)
+	t.mux.Unlock()
+
+	go func() {
+		defer t.running.Done()
+		err := runTask(fn, task)
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		op := task.op
+		switch {
+		case task.cancelled:
+			op.Status = shipyard.OperationCancelled
+		case err != nil:
+			op.Status = shipyard.OperationFailed
+			op.Error = err.Error()
+		case op.Failed > 0:
+			op.Status = shipyard.OperationFailed
+		default:
+			op.Status = shipyard.OperationSucceeded
+		}
+		finished := time.Now()
+		op.Finished = &finished
+		task.notify()
+		logger.Infof("operation %s (%s %s) %s", op.ID, op.Type, op.Target, op.Status)
+	}()
+	return snapshot
+}
+
+// Drain stops the tracker from starting operations and waits until the
+// running operations finish or the deadline passes
+func (t *OperationTracker) Drain(deadline time.Time) error {
+	t.mux.Lock()
+	t.draining = true
+	t.mux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(deadline.Sub(time.Now())):
+		return fmt.Errorf("operations did not finish by %s", deadline.Format(time.RFC3339))
+	}
+}
+
+// runTask runs fn and returns a panic in fn as an error so that the
+// operation fails instead of the controller
+func runTask(fn func(task *OperationTask) error, task *OperationTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("operation %s panicked: %v", task.op.ID, r)
+			err = fmt.Errorf("operation failed: %v", r)
+		}
+	}()
+	return fn(task)
+}
+
+// prune removes finished operations older than the retention; the
+// caller must hold the lock
+func (t *OperationTracker) prune(now time.Time) {
+	for id, task := range t.ops {
+		if f := task.op.Finished; f != nil && now.Sub(*f) > t.Retention {
+			delete(t.ops, id)
+		}
+	}
+}
+
+func (t *OperationTracker) Operations() []*shipyard.Operation {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	ops := []*shipyard.Operation{}
+	for _, task := range t.ops {
+		ops = append(ops, copyOperation(task.op))
+	}
+	sort.Sort(operationsByCreated(ops))
+	return ops
+}
+
+func (t *OperationTracker) Operation(id string) (*shipyard.Operation, error) {
+	op, _, err := t.Watch(id)
+	return op, err
+}
+
+// Watch returns a snapshot of the operation and a channel that is closed
+// on its next change
+func (t *OperationTracker) Watch(id string) (*shipyard.Operation, <-chan struct{}, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	task, ok := t.ops[id]
+	if !ok {
+		return nil, nil, ErrOperationDoesNotExist
+	}
+	return copyOperation(task.op), task.changed, nil
+}
+
+// Cancel stops an operation from starting further work.  Work already
+// in progress is completed and kept.
+func (t *OperationTracker) Cancel(id string) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	task, ok := t.ops[id]
+	if !ok {
+		return ErrOperationDoesNotExist
+	}
+	if task.op.Done() {
+		return ErrOperationFinished
+	}
+	if !task.cancelled {
+		task.cancelled = true
+		close(task.cancel)
+	}
+	return nil
+}
+
+// notify wakes watchers; the caller must hold the lock
+func (task *OperationTask) notify() {
+	task.op.Updated = time.Now()
+	close(task.changed)
+	task.changed = make(chan struct{})
+}
+
+// Cancelled reports whether the operation has been cancelled
+func (task *OperationTask) Cancelled() bool {
+	if task == nil {
+		return false
+	}
+	select {
+	case <-task.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// Actor returns the account or service key that started the operation
+func (task *OperationTask) Actor() string {
+	if task == nil {
+		return ""
+	}
+	return task.op.Actor
+}
+
+// SetTotal sets the number of results the operation expects
+func (task *OperationTask) SetTotal(total int) {
+	if task == nil {
+		return
+	}
+	task.tracker.mux.Lock()
+	defer task.tracker.mux.Unlock()
+	task.op.Total = total
+	task.notify()
+}
+
+// Result records the outcome for a container or engine
+func (task *OperationTask) Result(containerID string, engine string, err error) {
+	if task == nil {
+		return
+	}
+	task.tracker.mux.Lock()
+	defer task.tracker.mux.Unlock()
+	res := &shipyard.OperationResult{
+		ContainerID: containerID,
+		Engine:      engine,
+	}
+	if err != nil {
+		res.Error = err.Error()
+		task.op.Failed++
+	} else {
+		task.op.Completed++
+	}
+	task.op.Results = append(task.op.Results, res)
+	task.notify()
+}
+
+// runResult records the outcome of a run instance
+func (task *OperationTask) runResult(r *RunResult) {
+	if task == nil {
+		return
+	}
+	task.tracker.mux.Lock()
+	defer task.tracker.mux.Unlock()
+	res := &shipyard.OperationResult{Instance: r.Instance}
+	if c := r.Container; c != nil {
+		res.ContainerID = c.ID
+		if c.Engine != nil {
+			res.Engine = c.Engine.ID
+		}
+	}
+	if r.Err != nil {
+		res.Error = r.Err.Error()
+		task.op.Failed++
+	} else {
+		task.op.Completed++
+	}
+	task.op.Results = append(task.op.Results, res)
+	task.notify()
+}
+
+// rolledBack marks the result of a run instance as removed
+func (task *OperationTask) rolledBack(instance int) {
+	if task == nil {
+		return
+	}
+	task.tracker.mux.Lock()
+	defer task.tracker.mux.Unlock()
+	for _, res := range task.op.Results {
+		if res.Instance == instance {
+			res.RolledBack = true
+		}
+	}
+	task.notify()
+}
+
+// containerResult records the outcome of starting a container
+func (task *OperationTask) containerResult(c *citadel.Container, err error) {
+	id, engine := "", ""
+	if c != nil {
+		id = c.ID
+		if c.Engine != nil {
+			engine = c.Engine.ID
+		}
+	}
+	task.Result(id, engine, err)
+}
+
+func copyOperation(op *shipyard.Operation) *shipyard.Operation {
+	o := *op
+	o.Results = make([]*shipyard.OperationResult, len(op.Results))
+	for i, r := range op.Results {
+		res := *r
+		o.Results[i] = &res
+	}
+	if op.Finished != nil {
+		f := *op.Finished
+		o.Finished = &f
+	}
+	return &o
+}
+
+type operationsByCreated []*shipyard.Operation
+
+func (o operationsByCreated) Len() int           { return len(o) }
+func (o operationsByCreated) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o operationsByCreated) Less(i, j int) bool { return o[i].Created.After(o[j].Created) }
+
+func (m *Manager) Operations() []*shipyard.Operation {
+	return m.operations.Operations()
+}
+
+func (m *Manager) Operation(id string) (*shipyard.Operation, error) {
+	return m.operations.Operation(id)
+}
+
+func (m *Manager) WatchOperation(id string) (*shipyard.Operation, <-chan struct{}, error) {
+	return m.operations.Watch(id)
+}
+
+func (m *Manager) CancelOperation(id string) error {
+	return m.operations.Cancel(id)
+}
+
+// DrainOperations refuses new operations and waits for the running ones
+// until the deadline
+func (m *Manager) DrainOperations(deadline time.Time) error {
+	return m.operations.Drain(deadline)
+}
+
+// RunOperation runs containers in the background
+func (m *Manager) RunOperation(image *citadel.Image, count int, opts RunOptions, actor string) *shipyard.Operation {
+	return m.operations.Start("run", image.Name, actor, func(task *OperationTask) error {
+		task.SetTotal(count)
+		_, err := m.run(image, count, opts, task)
+		return err
+	})
+}
+
+// ScaleOperation scales a container in the background
+func (m *Manager) ScaleOperation(container *citadel.Container, count int, actor string) *shipyard.Operation {
+	return m.operations.Start("scale", container.ID, actor, func(task *OperationTask) error {
+		return m.scale(container, count, task)
+	})
+}
+
+// RedeployOperation redeploys the containers of an image in the background
+func (m *Manager) RedeployOperation(image string, actor string) *shipyard.Operation {
+	return m.operations.Start("redeploy", image, actor, func(task *OperationTask) error {
+		return m.redeployContainers(image, task)
+	})
+}
+
+// RegisterExtensionOperation saves an extension and starts its
+// containers in the background
+func (m *Manager) RegisterExtensionOperation(ext *shipyard.Extension, actor string) (*shipyard.Operation, error) {
+	if err := m.saveExtension(ext, actor); err != nil {
+		return nil, err
+	}
+	return m.operations.Start("register-extension", ext.ID, actor, func(task *OperationTask) error {
+		return m.registerExtension(ext, task)
+	}), nil
+}
+
+// PullOperation pulls an image on every engine in the background
+func (m *Manager) PullOperation(image string, actor string) *shipyard.Operation {
+	return m.operations.Start("pull", image, actor, func(task *OperationTask) error {
+		return m.pull(image, task)
+	})
+}
+
+func (m *Manager) pull(image string, task *OperationTask) error {
+	engines := m.clusterManager.Engines()
+	task.SetTotal(len(engines))
+	for _, eng := range engines {
+		if task.Cancelled() {
+			break
+		}
+		err := eng.Pull(image)
+		if err != nil {
+			logger.Warnf("error pulling %s on %s: %s", image, eng.ID, err)
+		}
+		task.Result("", eng.ID, err)
+	}
+	return nil
+}
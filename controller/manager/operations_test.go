@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shipyard/shipyard"
+)
+
+// waitOperation waits for an operation to finish using its change channel
+func waitOperation(t *testing.T, tr *OperationTracker, id string) *shipyard.Operation {
+	timeout := time.After(5 * time.Second)
+	for {
+		op, changed, err := tr.Watch(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.Done() {
+			return op
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("operation %s did not finish", id)
+		}
+	}
+}
+
+func TestOperationResults(t *testing.T) {
+	tr := NewOperationTracker(time.Hour)
+	op := tr.Start("run", "nginx", "admin", func(task *OperationTask) error {
+		task.SetTotal(2)
+		task.Result("abc", "local-01", nil)
+		task.Result("", "local-02", errors.New("no resources"))
+		return nil
+	})
+	if op.Status != shipyard.OperationRunning || op.Actor != "admin" {
+		t.Errorf("unexpected initial operation %+v", op)
+	}
+	op = waitOperation(t, tr, op.ID)
+	if op.Status != shipyard.OperationFailed {
+		t.Errorf("expected failed operation; received %s", op.Status)
+	}
+	if op.Total != 2 || op.Completed != 1 || op.Failed != 1 || len(op.Results) != 2 {
+		t.Errorf("unexpected progress %+v", op)
+	}
+	if op.Finished == nil {
+		t.Error("expected finished time")
+	}
+	if err := tr.Cancel(op.ID); err != ErrOperationFinished {
+		t.Errorf("expected %s; received %v", ErrOperationFinished, err)
+	}
+}
+
+func TestOperationCancel(t *testing.T) {
+	tr := NewOperationTracker(time.Hour)
+	started := make(chan struct{})
+	op := tr.Start("scale", "abc", "", func(task *OperationTask) error {
+		close(started)
+		<-task.cancel
+		if !task.Cancelled() {
+			t.Error("expected task to be cancelled")
+		}
+		return nil
+	})
+	<-started
+	if err := tr.Cancel(op.ID); err != nil {
+		t.Fatal(err)
+	}
+	if op := waitOperation(t, tr, op.ID); op.Status != shipyard.OperationCancelled {
+		t.Errorf("expected cancelled operation; received %s", op.Status)
+	}
+	if err := tr.Cancel("missing"); err != ErrOperationDoesNotExist {
+		t.Errorf("expected %s; received %v", ErrOperationDoesNotExist, err)
+	}
+}
+
+func TestOperationRetention(t *testing.T) {
+	tr := NewOperationTracker(time.Millisecond)
+	op := tr.Start("pull", "nginx", "", func(task *OperationTask) error {
+		return errors.New("unreachable")
+	})
+	if op := waitOperation(t, tr, op.ID); op.Error != "unreachable" {
+		t.Errorf("expected operation error; received %q", op.Error)
+	}
+	time.Sleep(5 * time.Millisecond)
+	tr.Start("pull", "redis", "", func(task *OperationTask) error { return nil })
+	if _, err := tr.Operation(op.ID); err != ErrOperationDoesNotExist {
+		t.Errorf("expected expired operation to be pruned; received %v", err)
+	}
+}
+
+func TestNilOperationTask(t *testing.T) {
+	var task *OperationTask
+	task.SetTotal(1)
+	task.Result("abc", "local-01", nil)
+	if task.Cancelled() {
+		t.Error("expected nil task to never be cancelled")
+	}
+}
+
+func TestOperationPanic(t *testing.T) {
+	tr := NewOperationTracker(time.Hour)
+	op := tr.Start("scale", "abc", "", func(task *OperationTask) error {
+		var containers []string
+		_ = containers[1]
+		return nil
+	})
+	if op = waitOperation(t, tr, op.ID); op.Status != shipyard.OperationFailed || op.Error == "" {
+		t.Errorf("expected the panic to fail the operation; received %+v", op)
+	}
+}
+
+func TestOperationDrain(t *testing.T) {
+	tr := NewOperationTracker(time.Hour)
+	release := make(chan struct{})
+	running := tr.Start("pull", "nginx", "", func(task *OperationTask) error {
+		<-release
+		return nil
+	})
+	if err := tr.Drain(time.Now().Add(10 * time.Millisecond)); err == nil {
+		t.Error("expected drain to time out while the operation runs")
+	}
+	op := tr.Start("pull", "redis", "", func(task *OperationTask) error {
+		t.Error("expected no operations to start while draining")
+		return nil
+	})
+	if op.Status != shipyard.OperationFailed || op.Error != ErrOperationsDraining.Error() {
+		t.Errorf("expected the operation to be refused; received %+v", op)
+	}
+	close(release)
+	if err := tr.Drain(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if op, _ := tr.Operation(running.ID); op.Status != shipyard.OperationSucceeded {
+		t.Errorf("expected the running operation to finish; received %s", op.Status)
+	}
+}
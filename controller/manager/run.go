@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/citadel/citadel"
+)
+
+const (
+	defaultRunWorkers = 8
+)
+
+var (
+	ErrRunAborted   = errors.New("not started because another instance failed")
+	ErrInvalidCount = errors.New("invalid container count")
+)
+
+type (
+	// RunOptions control how containers are started by Run
+	RunOptions struct {
+		// Pull pulls the image before starting each container
+		Pull bool
+		// Atomic stops starting instances after the first failure and
+		// removes the containers that were already started
+		Atomic bool
+	}
+
+	// RunResult is the outcome of starting one instance.  Instances are
+	// numbered from 1.
+	RunResult struct {
+		Instance   int
+		Container  *citadel.Container
+		Err        error
+		RolledBack bool
+	}
+
+	// RunError is returned when one or more instances failed to start
+	RunError struct {
+		Results    []*RunResult
+		RolledBack bool
+	}
+)
+
+func (e *RunError) Error() string {
+	failed := []string{}
+	for _, r := range e.Results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("instance %d: %s", r.Instance, r.Err))
+		}
+	}
+	msg := fmt.Sprintf("%d of %d instances failed: %s", len(failed), len(e.Results), strings.Join(failed, "; "))
+	if e.RolledBack {
+		msg += "; started containers were removed"
+	}
+	return msg
+}
+
+// Run starts count containers of the image and returns the started
+// containers.  When some instances fail the containers that started are
+// kept and a *RunError describing every instance is returned.
+func (m *Manager) Run(image *citadel.Image, count int, pull bool) ([]*citadel.Container, error) {
+	results, err := m.RunInstances(image, count, RunOptions{Pull: pull})
+	return Launched(results), err
+}
+
+// Launched returns the containers of the results that started and were
+// not rolled back
+func Launched(results []*RunResult) []*citadel.Container {
+	launched := []*citadel.Container{}
+	for _, r := range results {
+		if r.Err == nil && !r.RolledBack {
+			launched = append(launched, r.Container)
+		}
+	}
+	return launched
+}
+
+// RunInstances starts count containers of the image and returns the
+// result of every instance
+func (m *Manager) RunInstances(image *citadel.Image, count int, opts RunOptions) ([]*RunResult, error) {
+	return m.run(image, count, opts, nil)
+}
+
+// CreateContainer places a container of the image on an engine and
+// creates it without starting it
+func (m *Manager) CreateContainer(image *citadel.Image, pull bool) (*citadel.Container, error) {
+	return m.ClusterManager().Create(m.withLogConfig(image), pull)
+}
+
+// withLogConfig returns the image with the default log driver when it
+// has none
+func (m *Manager) withLogConfig(image *citadel.Image) *citadel.Image {
+	if image.LogConfig != nil || m.logConfig == nil {
+		return image
+	}
+	img := *image
+	img.LogConfig = m.logConfig
+	return &img
+}
+
+func (m *Manager) run(image *citadel.Image, count int, opts RunOptions, task *OperationTask) ([]*RunResult, error) {
+	image = m.withLogConfig(image)
+	start := func() (*citadel.Container, error) {
+		return m.ClusterManager().Start(image, opts.Pull)
+	}
+	return runInstances(count, m.runWorkers, opts.Atomic, start, m.Destroy, task)
+}
+
+// runInstances starts count instances with at most workers running
+// concurrently.  Instances that were not started because the task was
+// cancelled have no result.
+func runInstances(count int, workers int, atomic bool, start func() (*citadel.Container, error), destroy func(*citadel.Container) error, task *OperationTask) ([]*RunResult, error) {
+	if count < 1 {
+		return nil, ErrInvalidCount
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > count {
+		workers = count
+	}
+	results := make([]*RunResult, count)
+	instances := make(chan int)
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		aborted bool
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range instances {
+				res := &RunResult{Instance: i + 1}
+				// each worker only writes its own instances
+				results[i] = res
+				lock.Lock()
+				abort := aborted
+				lock.Unlock()
+				if abort {
+					res.Err = ErrRunAborted
+				} else {
+					res.Container, res.Err = start()
+				}
+				if res.Err != nil && atomic {
+					lock.Lock()
+					aborted = true
+					lock.Unlock()
+				}
+				task.runResult(res)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		if task.Cancelled() {
+			break
+		}
+		instances <- i
+	}
+	close(instances)
+	wg.Wait()
+
+	started := []*RunResult{}
+	failed := false
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		started = append(started, r)
+		if r.Err != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		return started, nil
+	}
+	runErr := &RunError{Results: started}
+	if atomic {
+		for _, r := range started {
+			if r.Err != nil {
+				continue
+			}
+			if err := destroy(r.Container); err != nil {
+				logger.Errorf("error removing container %s after failed run: %s", r.Container.ID, err)
+				continue
+			}
+			r.RolledBack = true
+			task.rolledBack(r.Instance)
+		}
+		runErr.RolledBack = true
+	}
+	return started, runErr
+}
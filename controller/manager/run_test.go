@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/shipyard/shipyard"
+)
+
+// fakeStarter starts containers and fails the instances in fail
+type fakeStarter struct {
+	mux       sync.Mutex
+	started   int
+	running   int
+	maxActive int
+	fail      map[int]bool
+	destroyed []string
+}
+
+func (s *fakeStarter) start() (*citadel.Container, error) {
+	s.mux.Lock()
+	s.started++
+	n := s.started
+	s.running++
+	if s.running > s.maxActive {
+		s.maxActive = s.running
+	}
+	s.mux.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.mux.Lock()
+	s.running--
+	s.mux.Unlock()
+	if s.fail[n] {
+		return nil, errors.New("no resources available")
+	}
+	return &citadel.Container{ID: fmt.Sprintf("c%d", n), Engine: &citadel.Engine{ID: "local"}}, nil
+}
+
+func (s *fakeStarter) destroy(c *citadel.Container) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.destroyed = append(s.destroyed, c.ID)
+	return nil
+}
+
+func TestRunInstancesBoundedWorkers(t *testing.T) {
+	s := &fakeStarter{}
+	results, err := runInstances(20, 4, false, s.start, s.destroy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 20 || len(Launched(results)) != 20 {
+		t.Fatalf("expected 20 results; received %d", len(results))
+	}
+	for i, r := range results {
+		if r.Instance != i+1 || r.Container == nil {
+			t.Errorf("unexpected result %d: %+v", i, r)
+		}
+	}
+	if s.maxActive > 4 {
+		t.Errorf("expected at most 4 concurrent starts; received %d", s.maxActive)
+	}
+}
+
+func TestRunInstancesPartialFailure(t *testing.T) {
+	s := &fakeStarter{fail: map[int]bool{2: true}}
+	results, err := runInstances(3, 1, false, s.start, s.destroy, nil)
+	runErr, ok := err.(*RunError)
+	if !ok {
+		t.Fatalf("expected run error; received %v", err)
+	}
+	if runErr.RolledBack || len(s.destroyed) != 0 {
+		t.Error("expected started containers to be kept")
+	}
+	if len(results) != 3 || results[1].Err == nil || len(Launched(results)) != 2 {
+		t.Errorf("expected instance 2 to fail and 2 to start: %+v", results)
+	}
+	if msg := err.Error(); msg != "1 of 3 instances failed: instance 2: no resources available" {
+		t.Errorf("unexpected error %q", msg)
+	}
+}
+
+func TestRunInstancesAtomic(t *testing.T) {
+	s := &fakeStarter{fail: map[int]bool{2: true}}
+	tr := NewOperationTracker(time.Hour)
+	var results []*RunResult
+	var err error
+	op := tr.Start("run", "nginx", "", func(task *OperationTask) error {
+		results, err = runInstances(4, 1, true, s.start, s.destroy, task)
+		return err
+	})
+	op = waitOperation(t, tr, op.ID)
+	runErr, ok := err.(*RunError)
+	if !ok || !runErr.RolledBack {
+		t.Fatalf("expected rolled back run error; received %v", err)
+	}
+	if s.started != 2 {
+		t.Errorf("expected no starts after the failure; received %d", s.started)
+	}
+	if len(s.destroyed) != 1 || s.destroyed[0] != "c1" {
+		t.Errorf("expected c1 to be removed; received %v", s.destroyed)
+	}
+	if len(Launched(results)) != 0 {
+		t.Error("expected no launched containers")
+	}
+	if results[2].Err != ErrRunAborted || results[3].Err != ErrRunAborted {
+		t.Errorf("expected remaining instances to be aborted: %+v", results)
+	}
+	if op.Status != shipyard.OperationFailed || !op.Results[0].RolledBack {
+		t.Errorf("expected failed operation with rolled back instance: %+v", op)
+	}
+}
+
+func TestRunInstancesCancelled(t *testing.T) {
+	s := &fakeStarter{}
+	tr := NewOperationTracker(time.Hour)
+	var results []*RunResult
+	op := tr.Start("run", "nginx", "", func(task *OperationTask) error {
+		tr.Cancel(task.op.ID)
+		var err error
+		results, err = runInstances(5, 1, false, s.start, s.destroy, task)
+		return err
+	})
+	if op = waitOperation(t, tr, op.ID); op.Status != shipyard.OperationCancelled {
+		t.Errorf("expected cancelled operation; received %s", op.Status)
+	}
+	if len(results) != 0 || s.started != 0 {
+		t.Errorf("expected no instances after cancel; received %d", len(results))
+	}
+}
+
+func TestRunInstancesInvalidCount(t *testing.T) {
+	s := &fakeStarter{}
+	for _, count := range []int{0, -1} {
+		if _, err := runInstances(count, 1, false, s.start, s.destroy, nil); err != ErrInvalidCount {
+			t.Errorf("count %d: expected %s; received %v", count, ErrInvalidCount, err)
+		}
+	}
+	if s.started != 0 {
+		t.Errorf("expected no instances; received %d", s.started)
+	}
+}
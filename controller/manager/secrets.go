@@ -0,0 +1,198 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/citadel/citadel"
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+)
+
+var (
+	ErrSecretDoesNotExist   = errors.New("secret does not exist")
+	ErrSecretsNotConfigured = errors.New("secrets require a master key (--secrets-key-file)")
+	ErrSecretNotAllowed     = errors.New("not allowed to use a secret referenced by the image")
+)
+
+// Secrets returns the secrets without values
+func (m *Manager) Secrets() ([]*shipyard.Secret, error) {
+	res, err := r.Table(tblNameSecrets).OrderBy(r.Asc("name")).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	s := []*shipyard.Secret{}
+	if err := res.All(&s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *Manager) secret(name string) (*shipyard.Secret, error) {
+	res, err := r.Table(tblNameSecrets).Filter(map[string]string{"name": name}).Run(m.session)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsNil() {
+		return nil, ErrSecretDoesNotExist
+	}
+	var s *shipyard.Secret
+	if err := res.One(&s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveSecret encrypts and stores the secret value, replacing the value of
+// an existing secret with the same name
+func (m *Manager) SaveSecret(s *shipyard.Secret, actor string) error {
+	if m.secretsBox == nil {
+		return ErrSecretsNotConfigured
+	}
+	if err := shipyard.ValidateSecretName(s.Name); err != nil {
+		return err
+	}
+	sealed, err := m.secretsBox.Seal(s.Name, []byte(s.Value))
+	if err != nil {
+		return err
+	}
+	existing, err := m.secret(s.Name)
+	if err != nil && err != ErrSecretDoesNotExist {
+		return err
+	}
+	now := time.Now()
+	eventType := "add-secret"
+	if existing != nil {
+		eventType = "update-secret"
+		update := map[string]interface{}{
+			"ciphertext":   sealed,
+			"key_id":       m.secretsBox.KeyID(),
+			"roles":        s.Roles,
+			"service_keys": s.ServiceKeys,
+			"updated":      now,
+		}
+		if _, err := r.Table(tblNameSecrets).Get(existing.ID).Update(update).RunWrite(m.session); err != nil {
+			return err
+		}
+	} else {
+		secret := &shipyard.Secret{
+			Name:        s.Name,
+			Ciphertext:  sealed,
+			KeyID:       m.secretsBox.KeyID(),
+			Roles:       s.Roles,
+			ServiceKeys: s.ServiceKeys,
+			Created:     now,
+			Updated:     now,
+		}
+		if _, err := r.Table(tblNameSecrets).Insert(secret).RunWrite(m.session); err != nil {
+			return err
+		}
+	}
+	evt := &shipyard.Event{
+		Type:    eventType,
+		Time:    now,
+		Message: fmt.Sprintf("name=%s", s.Name),
+		Actor:   actor,
+		Tags:    []string{"cluster", "security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) DeleteSecret(name string, actor string) error {
+	s, err := m.secret(name)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Table(tblNameSecrets).Get(s.ID).Delete().RunWrite(m.session); err != nil {
+		return err
+	}
+	evt := &shipyard.Event{
+		Type:    "delete-secret",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("name=%s", name),
+		Actor:   actor,
+		Tags:    []string{"cluster", "security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) secretValue(name string) (string, error) {
+	if m.secretsBox == nil {
+		return "", ErrSecretsNotConfigured
+	}
+	s, err := m.secret(name)
+	if err != nil {
+		return "", err
+	}
+	v, err := m.secretsBox.Open(s.Name, s.Ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// CheckSecrets returns ErrSecretNotAllowed if the image references a
+// secret the caller cannot use.  References to missing secrets are left
+// to fail when the container is started.
+func (m *Manager) CheckSecrets(id *Identity, image *citadel.Image) error {
+	for _, v := range image.Environment {
+		name, ok := shipyard.ParseSecretRef(v)
+		if !ok {
+			continue
+		}
+		s, err := m.secret(name)
+		if err != nil {
+			if err == ErrSecretDoesNotExist {
+				continue
+			}
+			return err
+		}
+		if !id.AllowsSecret(s) {
+			return ErrSecretNotAllowed
+		}
+	}
+	return nil
+}
+
+// ResolveEnvironment resolves secret references for citadel when
+// containers are started
+func (m *Manager) ResolveEnvironment(value string) (string, bool, error) {
+	name, ok := shipyard.ParseSecretRef(value)
+	if !ok {
+		return value, false, nil
+	}
+	v, err := m.secretValue(name)
+	if err != nil {
+		return "", false, fmt.Errorf("secret %s: %s", name, err)
+	}
+	return v, true, nil
+}
+
+// SecretValues returns the values of the secrets referenced by the
+// container so they can be redacted from its output
+func (m *Manager) SecretValues(c *citadel.Container) []string {
+	values := []string{}
+	if c.Image == nil {
+		return values
+	}
+	for _, v := range c.Image.Environment {
+		name, ok := shipyard.ParseSecretRef(v)
+		if !ok {
+			continue
+		}
+		sv, err := m.secretValue(name)
+		if err != nil {
+			logger.Warnf("unable to resolve secret %s for redaction: %s", name, err)
+			continue
+		}
+		values = append(values, sv)
+	}
+	return values
+}
@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	eventSubscriberBuffer = 64
+)
+
+// SubscribeEvents returns a channel that receives every saved event until
+// it is passed to UnsubscribeEvents.  Events are dropped for subscribers
+// that do not keep up.
+func (m *Manager) SubscribeEvents() chan *shipyard.Event {
+	ch := make(chan *shipyard.Event, eventSubscriberBuffer)
+	m.eventSubLock.Lock()
+	m.eventSubscribers[ch] = true
+	m.eventSubLock.Unlock()
+	return ch
+}
+
+func (m *Manager) UnsubscribeEvents(ch chan *shipyard.Event) {
+	m.eventSubLock.Lock()
+	defer m.eventSubLock.Unlock()
+	if m.eventSubscribers[ch] {
+		delete(m.eventSubscribers, ch)
+		close(ch)
+	}
+}
+
+func (m *Manager) publishEvent(event *shipyard.Event) {
+	m.eventSubLock.Lock()
+	defer m.eventSubLock.Unlock()
+	for ch := range m.eventSubscribers {
+		select {
+		case ch <- event:
+		default:
+			logger.Warnf("dropping event %s for slow subscriber", event.Type)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/secrets"
+)
+
+var (
+	ErrTOTPRequired           = errors.New("two-factor code required")
+	ErrInvalidTOTPCode        = errors.New("invalid two-factor code")
+	ErrTOTPNotEnrolled        = errors.New("two-factor authentication is not enrolled")
+	ErrTOTPAlreadyEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPEnrollmentRequired = errors.New("two-factor enrollment required")
+)
+
+// EnrollTOTP generates a new secret for the account.  Two-factor
+// authentication is not enabled until a code is confirmed with
+// ActivateTOTP.
+func (m *Manager) EnrollTOTP(username string) (*shipyard.TOTPEnrollment, error) {
+	acct, err := m.Account(username)
+	if err != nil {
+		return nil, err
+	}
+	if acct.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	secret, err := shipyard.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := m.sealTOTPSecret(acct, secret)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": username}).Update(map[string]interface{}{"totp_secret": sealed}).RunWrite(m.session); err != nil {
+		return nil, err
+	}
+	return &shipyard.TOTPEnrollment{
+		Secret: secret,
+		URI:    shipyard.TOTPProvisioningURI(username, secret),
+	}, nil
+}
+
+// ActivateTOTP confirms enrollment with a code from the device and
+// returns the recovery codes.  The codes are only stored hashed.
+func (m *Manager) ActivateTOTP(username string, code string) (*shipyard.RecoveryCodes, error) {
+	acct, err := m.Account(username)
+	if err != nil {
+		return nil, err
+	}
+	if acct.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if acct.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	secret, err := m.openTOTPSecret(acct)
+	if err != nil {
+		return nil, err
+	}
+	step := shipyard.ValidateTOTP(secret, code, time.Now())
+	if step == 0 {
+		return nil, ErrInvalidTOTPCode
+	}
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": username}).Update(map[string]interface{}{"totp_enabled": true, "totp_last_step": step, "recovery_codes": hashes}).RunWrite(m.session); err != nil {
+		return nil, err
+	}
+	m.saveTOTPEvent("enable-totp", username, username)
+	return codes, nil
+}
+
+// DisableTOTP disables two-factor authentication after checking a code
+// or recovery code
+func (m *Manager) DisableTOTP(username string, code string) error {
+	acct, err := m.Account(username)
+	if err != nil {
+		return err
+	}
+	if !acct.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+	if err := m.verifySecondFactor(acct, code); err != nil {
+		return err
+	}
+	return m.ResetTOTP(username, username)
+}
+
+// ResetTOTP removes two-factor authentication from the account without a
+// code; used by admins when a device is lost
+func (m *Manager) ResetTOTP(username string, actor string) error {
+	if _, err := m.Account(username); err != nil {
+		return err
+	}
+	if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": username}).Update(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0, "recovery_codes": []string{}}).RunWrite(m.session); err != nil {
+		return err
+	}
+	m.saveTOTPEvent("disable-totp", username, actor)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a
+// code or recovery code
+func (m *Manager) RegenerateRecoveryCodes(username string, code string) (*shipyard.RecoveryCodes, error) {
+	acct, err := m.Account(username)
+	if err != nil {
+		return nil, err
+	}
+	if !acct.TOTPEnabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if err := m.verifySecondFactor(acct, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": username}).Update(map[string]interface{}{"recovery_codes": hashes}).RunWrite(m.session); err != nil {
+		return nil, err
+	}
+	m.saveTOTPEvent("regenerate-recovery-codes", username, username)
+	return codes, nil
+}
+
+// SetRoleTOTP sets whether accounts with the role must use two-factor
+// authentication.  The role is also updated on the accounts that embed it.
+func (m *Manager) SetRoleTOTP(name string, required bool, actor string) error {
+	role, err := m.Role(name)
+	if err != nil {
+		return err
+	}
+	if role.RequireTOTP == required {
+		return nil
+	}
+	if _, err := r.Table(tblNameRoles).Get(role.ID).Update(map[string]interface{}{"require_totp": required}).RunWrite(m.session); err != nil {
+		return err
+	}
+	if _, err := r.Table(tblNameAccounts).Filter(r.Row.Field("role").Field("name").Eq(name)).Update(map[string]interface{}{"role": map[string]interface{}{"require_totp": required}}).RunWrite(m.session); err != nil {
+		return err
+	}
+	evt := &shipyard.Event{
+		Type:    "update-role",
+		Time:    time.Now(),
+		Message: fmt.Sprintf("name=%s require_totp=%v", name, required),
+		Actor:   actor,
+		Tags:    []string{"cluster", "security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		return err
+	}
+	return nil
+}
+
+// verifySecondFactor checks a totp code or consumes a recovery code.  Totp
+// codes can only be used once so a code seen on the wire cannot be
+// replayed within its validity window.
+func (m *Manager) verifySecondFactor(acct *shipyard.Account, code string) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	secret, err := m.openTOTPSecret(acct)
+	if err != nil {
+		return err
+	}
+	if step := shipyard.ValidateTOTP(secret, code, time.Now()); step != 0 {
+		if step <= acct.TOTPLastStep {
+			return ErrInvalidTOTPCode
+		}
+		update := map[string]interface{}{"totp_last_step": step}
+		// secrets enrolled before a master key was configured are
+		// sealed on their next use
+		if !secrets.IsSealed(acct.TOTPSecret) && m.secretsBox != nil {
+			sealed, err := m.sealTOTPSecret(acct, secret)
+			if err != nil {
+				return err
+			}
+			update["totp_secret"] = sealed
+		}
+		if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": acct.Username}).Update(update).RunWrite(m.session); err != nil {
+			return err
+		}
+		acct.TOTPLastStep = step
+		return nil
+	}
+	for i, h := range acct.RecoveryCodes {
+		if !m.authenticator.Authenticate(code, h) {
+			continue
+		}
+		remaining := append(append([]string{}, acct.RecoveryCodes[:i]...), acct.RecoveryCodes[i+1:]...)
+		if _, err := r.Table(tblNameAccounts).Filter(map[string]string{"username": acct.Username}).Update(map[string]interface{}{"recovery_codes": remaining}).RunWrite(m.session); err != nil {
+			return err
+		}
+		acct.RecoveryCodes = remaining
+		logger.Warnf("recovery code used for %s; %d remaining", acct.Username, len(remaining))
+		m.saveTOTPEvent("use-recovery-code", acct.Username, acct.Username)
+		return nil
+	}
+	return ErrInvalidTOTPCode
+}
+
+func (m *Manager) newRecoveryCodes() (*shipyard.RecoveryCodes, []string, error) {
+	codes, err := shipyard.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := []string{}
+	for _, c := range codes {
+		h, err := m.authenticator.Hash(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return &shipyard.RecoveryCodes{Codes: codes}, hashes, nil
+}
+
+func (m *Manager) saveTOTPEvent(eventType string, username string, actor string) {
+	evt := &shipyard.Event{
+		Type:    eventType,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("username=%s", username),
+		Actor:   actor,
+		Tags:    []string{"security"},
+	}
+	if err := m.SaveEvent(evt); err != nil {
+		logger.Errorf("error saving event: %s", err)
+	}
+}
+
+func totpSecretName(acct *shipyard.Account) string {
+	return fmt.Sprintf("account/%s/totp_secret", acct.ID)
+}
+
+// sealTOTPSecret seals the secret of the account for storage.  Secrets
+// are stored in plain text when no master key is configured.
+func (m *Manager) sealTOTPSecret(acct *shipyard.Account, secret string) (string, error) {
+	if m.secretsBox == nil {
+		return secret, nil
+	}
+	return m.secretsBox.SealValue(totpSecretName(acct), secret)
+}
+
+// openTOTPSecret returns the decrypted secret of the account
+func (m *Manager) openTOTPSecret(acct *shipyard.Account) (string, error) {
+	if !secrets.IsSealed(acct.TOTPSecret) {
+		return acct.TOTPSecret, nil
+	}
+	if m.secretsBox == nil {
+		return "", ErrSecretsNotConfigured
+	}
+	return m.secretsBox.OpenValue(totpSecretName(acct), acct.TOTPSecret)
+}
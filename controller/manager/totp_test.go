@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/secrets"
+)
+
+func TestTOTPSecretSealing(t *testing.T) {
+	box, err := secrets.NewBox(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{secretsBox: box}
+	acct := &shipyard.Account{ID: "1", Username: "admin"}
+	sealed, err := m.sealTOTPSecret(acct, "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsSealed(sealed) {
+		t.Fatalf("expected a sealed secret; received %s", sealed)
+	}
+	acct.TOTPSecret = sealed
+	if s, err := m.openTOTPSecret(acct); err != nil || s != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected the secret to open; received %q %v", s, err)
+	}
+	if _, err := m.openTOTPSecret(&shipyard.Account{ID: "2", TOTPSecret: sealed}); err == nil {
+		t.Error("expected a secret sealed for another account to be refused")
+	}
+	if _, err := (&Manager{}).openTOTPSecret(acct); err != ErrSecretsNotConfigured {
+		t.Errorf("expected sealed secrets to need the master key; received %v", err)
+	}
+	acct.TOTPSecret = "JBSWY3DPEHPK3PXP"
+	if s, _ := (&Manager{}).openTOTPSecret(acct); s != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected plain text secrets to be returned; received %q", s)
+	}
+}
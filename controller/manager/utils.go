@@ -3,7 +3,6 @@ package manager
 import (
 	"crypto/sha256"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/hex"
 	"net/url"
 	"time"
@@ -11,23 +10,6 @@ import (
 	"github.com/citadel/citadel"
 )
 
-func getTLSConfig(caCert, sslCert, sslKey []byte) (*tls.Config, error) {
-	// TLS config
-	var tlsConfig tls.Config
-	tlsConfig.InsecureSkipVerify = true
-	certPool := x509.NewCertPool()
-
-	certPool.AppendCertsFromPEM(caCert)
-	tlsConfig.RootCAs = certPool
-	cert, err := tls.X509KeyPair(sslCert, sslKey)
-	if err != nil {
-		return &tlsConfig, err
-	}
-	tlsConfig.Certificates = []tls.Certificate{cert}
-
-	return &tlsConfig, nil
-}
-
 func setEngineClient(docker *citadel.Engine, tlsConfig *tls.Config) error {
 	var tc *tls.Config
 	u, err := url.Parse(docker.Addr)
@@ -3,7 +3,6 @@ package access
 import (
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/shipyard/shipyard"
@@ -14,14 +13,22 @@ var (
 	logger = logrus.New()
 )
 
-func defaultDeniedHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "access denied", http.StatusForbidden)
+// SetLogger replaces the logger of the access middleware
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
+// ErrorFunc writes an access failure for the request
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int, msg string)
+
+func defaultError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	http.Error(w, msg, status)
 }
 
 type AccessRequired struct {
-	deniedHandler http.Handler
-	manager       *manager.Manager
-	acl           map[string][]string
+	errorFunc ErrorFunc
+	manager   *manager.Manager
+	acl       map[string][]string
 }
 
 func defaultAccessLevels() map[string][]string {
@@ -32,6 +39,12 @@ func defaultAccessLevels() map[string][]string {
 		"/api/cluster/info",
 		"/api/events",
 		"/api/engines",
+		"/api/operations",
+		"/api/v2/containers",
+		"/api/v2/cluster/info",
+		"/api/v2/events",
+		"/api/v2/engines",
+		"/api/v2/operations",
 	}
 	return acl
 }
@@ -39,13 +52,18 @@ func defaultAccessLevels() map[string][]string {
 func NewAccessRequired(m *manager.Manager) *AccessRequired {
 	acl := defaultAccessLevels()
 	a := &AccessRequired{
-		deniedHandler: http.HandlerFunc(defaultDeniedHandler),
-		manager:       m,
-		acl:           acl,
+		errorFunc: defaultError,
+		manager:   m,
+		acl:       acl,
 	}
 	return a
 }
 
+// SetErrorFunc replaces the plain text error responses
+func (a *AccessRequired) SetErrorFunc(fn ErrorFunc) {
+	a.errorFunc = fn
+}
+
 func (a *AccessRequired) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		err := a.handleRequest(w, r)
@@ -57,44 +75,31 @@ func (a *AccessRequired) Handler(h http.Handler) http.Handler {
 	})
 }
 
+// handleRequest checks the caller recorded by the auth middleware, which
+// has already verified its service key, token or client certificate
 func (a *AccessRequired) handleRequest(w http.ResponseWriter, r *http.Request) error {
 	valid := false
-	authHeader := r.Header.Get("X-Access-Token")
-	parts := strings.Split(authHeader, ":")
-	if len(parts) == 2 {
-		// validate
-		u := parts[0]
-		token := parts[1]
-		if err := a.manager.VerifyAuthToken(u, token); err == nil {
-			acct, err := a.manager.Account(u)
-			if err != nil {
-				return err
-			}
-			role := acct.Role
-			// check role
-			valid = a.checkAccess(r.URL.Path, role)
+	if id := manager.RequestIdentity(r); id != nil {
+		if id.ServiceKey != nil {
+			valid = id.ServiceKey.Allows(r.Method, r.URL.Path)
+		} else {
+			valid = a.checkAccess(r.Method, r.URL.Path, id.Account.Role)
 		}
-	} else { // only check access for users; not service keys
-		valid = true
 	}
 
 	if !valid {
-		a.deniedHandler.ServeHTTP(w, r)
+		a.errorFunc(w, r, http.StatusForbidden, "access denied")
 		return fmt.Errorf("access denied %s", r.RemoteAddr)
 	}
 
 	return nil
 }
 
-func (a *AccessRequired) checkAccess(path string, role *shipyard.Role) bool {
-	valid := false
-	for _, v := range a.acl[role.Name] {
-		if v == "*" || strings.HasPrefix(path, v) {
-			valid = true
-			break
-		}
+func (a *AccessRequired) checkAccess(method string, path string, role *shipyard.Role) bool {
+	if role == nil {
+		return false
 	}
-	return valid
+	return shipyard.CheckPermissions(a.acl[role.Name], method, path)
 }
 
 func (a *AccessRequired) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -0,0 +1,44 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+)
+
+var testHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("testing"))
+})
+
+func TestAccessUsesRequestIdentity(t *testing.T) {
+	a := NewAccessRequired(nil)
+	serve := func(id *manager.Identity, path string) int {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if id != nil {
+			manager.SetIdentity(req, id)
+		}
+		a.Handler(testHandler).ServeHTTP(res, req)
+		return res.Code
+	}
+	user := manager.NewAccountIdentity(&shipyard.Account{Username: "jdoe", Role: &shipyard.Role{Name: "user"}})
+	if code := serve(user, "/api/containers"); code != http.StatusOK {
+		t.Errorf("expected a user to list containers; got %d", code)
+	}
+	if code := serve(user, "/api/accounts"); code != http.StatusForbidden {
+		t.Errorf("expected a user to be refused accounts; got %d", code)
+	}
+	key := manager.NewServiceKeyIdentity(&shipyard.ServiceKey{Key: "abc", Scopes: []string{"/api/events"}})
+	if code := serve(key, "/api/events"); code != http.StatusOK {
+		t.Errorf("expected the key to read events; got %d", code)
+	}
+	if code := serve(key, "/api/containers"); code != http.StatusForbidden {
+		t.Errorf("expected the key to be refused containers; got %d", code)
+	}
+	if code := serve(nil, "/api/containers"); code != http.StatusForbidden {
+		t.Errorf("expected an unauthenticated request to be refused; got %d", code)
+	}
+}
@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+)
+
+const (
+	maxBodyRead   = 64 * 1024
+	maxSummaryLen = 1024
+	redacted      = "********"
+)
+
+var (
+	logger = logrus.New()
+	// request fields that are never written to the audit log
+	sensitiveFields = []string{"password", "secret", "key", "token", "code", "value"}
+	// GET routes of the v1 api that change the cluster
+	mutatingGETRoutes = map[string]bool{
+		"/api/containers/{id}/stop":    true,
+		"/api/containers/{id}/restart": true,
+		"/api/containers/{id}/scale":   true,
+	}
+)
+
+// SetLogger replaces the logger of the audit middleware
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
+// Audit records every request that changes the cluster with the actor and
+// result status.  Requests are audited by route: every non-GET route and
+// the GET routes of the v1 api that stop, restart or scale containers.
+type Audit struct {
+	manager *manager.Manager
+	router  *mux.Router
+}
+
+func NewAudit(m *manager.Manager, router *mux.Router) *Audit {
+	return &Audit{
+		manager: m,
+		router:  router,
+	}
+}
+
+func (a *Audit) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	route, target := a.route(r)
+	if !audited(r.Method, route) {
+		if next != nil {
+			next(w, r)
+		}
+		return
+	}
+
+	// read the start of the body for the summary and replay it to the handler
+	body, _ := ioutil.ReadAll(io.LimitReader(r.Body, maxBodyRead))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	// the identity is filled in by the auth middleware further down the
+	// chain
+	id := manager.TrackIdentity(r)
+	rec := &shipyard.AuditRecord{
+		Time:     time.Now(),
+		SourceIP: sourceIP(r.RemoteAddr),
+		Method:   r.Method,
+		Route:    route,
+		Target:   target,
+		Summary:  Summarize(r.URL.RawQuery, body),
+	}
+
+	if next != nil {
+		next(w, r)
+	}
+
+	rec.Actor, rec.ActorType = actor(r, id)
+
+	rec.Status = http.StatusOK
+	if rw, ok := w.(negroni.ResponseWriter); ok && rw.Status() != 0 {
+		rec.Status = rw.Status()
+	}
+	if err := a.manager.SaveAuditRecord(rec); err != nil {
+		logger.Errorf("unable to save audit record for %s %s by %s: %s", rec.Method, rec.Route, rec.Actor, err)
+	}
+}
+
+// actor returns the caller authenticated for the request.  Requests that
+// were not authenticated are recorded with the name they claimed and the
+// unverified type.
+func actor(r *http.Request, id *manager.Identity) (string, string) {
+	if id.Account != nil || id.ServiceKey != nil {
+		return id.Name, id.Type()
+	}
+	if key := r.Header.Get("X-Service-Key"); key != "" {
+		// never log the complete key
+		if len(key) > 8 {
+			key = key[:8]
+		}
+		return key + "...", "unverified"
+	}
+	parts := strings.Split(r.Header.Get("X-Access-Token"), ":")
+	if len(parts) == 2 && parts[0] != "" {
+		return parts[0], "unverified"
+	}
+	if cn := manager.ClientCommonName(r.TLS); cn != "" {
+		return cn, "unverified"
+	}
+	return "", "anonymous"
+}
+
+// audited reports whether requests to the route are recorded
+func audited(method string, route string) bool {
+	switch method {
+	case "GET":
+		return mutatingGETRoutes[route]
+	case "HEAD", "OPTIONS":
+		return false
+	}
+	return true
+}
+
+// route returns the route template and the target resource from the
+// route variables, i.e. /api/containers/{id} and the container id
+func (a *Audit) route(r *http.Request) (string, string) {
+	route := r.URL.Path
+	if a.router == nil {
+		return route, ""
+	}
+	var match mux.RouteMatch
+	if !a.router.Match(r, &match) {
+		return route, ""
+	}
+	keys := []string{}
+	for k := range match.Vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	targets := []string{}
+	for _, k := range keys {
+		v := match.Vars[k]
+		route = strings.Replace(route, "/"+v, "/{"+k+"}", 1)
+		targets = append(targets, v)
+	}
+	return route, strings.Join(targets, ",")
+}
+
+func sourceIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Summarize returns a short description of the request with sensitive
+// query parameters and fields redacted.  JSON bodies are re-encoded
+// compactly; other bodies are only described by their size.
+func Summarize(query string, body []byte) string {
+	summary := ""
+	if query != "" {
+		summary = "?" + redactQuery(query)
+	}
+	if len(body) > 0 {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			b, _ := json.Marshal(redact(v))
+			summary = strings.TrimSpace(summary + " " + string(b))
+		} else {
+			summary = strings.TrimSpace(summary + " <non-json body>")
+		}
+	}
+	if len(summary) > maxSummaryLen {
+		summary = summary[:maxSummaryLen] + "..."
+	}
+	return summary
+}
+
+// redactQuery returns the query with the values of sensitive parameters
+// redacted; parameters are sorted by name
+func redactQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "<invalid query>"
+	}
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		for _, v := range values[k] {
+			v = url.QueryEscape(v)
+			if isSensitive(k) {
+				v = redacted
+			}
+			params = append(params, url.QueryEscape(k)+"="+v)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, f := range val {
+			if isSensitive(k) {
+				val[k] = redacted
+				continue
+			}
+			if isEnvironment(k) {
+				val[k] = redactEnvironment(f)
+				continue
+			}
+			val[k] = redact(f)
+		}
+	case []interface{}:
+		for i, f := range val {
+			val[i] = redact(f)
+		}
+	}
+	return v
+}
+
+// redactEnvironment keeps the variable names of a container environment
+// and redacts every value; environments are either lists of NAME=value
+// entries or maps
+func redactEnvironment(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = redacted
+		}
+	case []interface{}:
+		for i, f := range val {
+			s, _ := f.(string)
+			val[i] = strings.SplitN(s, "=", 2)[0] + "=" + redacted
+		}
+	default:
+		return redacted
+	}
+	return v
+}
+
+func isEnvironment(field string) bool {
+	f := strings.ToLower(field)
+	return f == "env" || f == "environment"
+}
+
+func isSensitive(field string) bool {
+	f := strings.ToLower(field)
+	for _, s := range sensitiveFields {
+		if strings.Contains(f, s) {
+			return true
+		}
+	}
+	return false
+}
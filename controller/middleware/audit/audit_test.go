@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSummarizeRedactsSensitiveFields(t *testing.T) {
+	body := []byte(`{"username":"ci","password":"s3cret","role":{"name":"admin"},"ssl_key":"PEM"}`)
+	s := Summarize("count=2", body)
+	if strings.Contains(s, "s3cret") || strings.Contains(s, "PEM") {
+		t.Errorf("expected sensitive fields to be redacted: %s", s)
+	}
+	if !strings.Contains(s, `"username":"ci"`) {
+		t.Errorf("expected username in summary: %s", s)
+	}
+	if !strings.HasPrefix(s, "?count=2") {
+		t.Errorf("expected query in summary: %s", s)
+	}
+}
+
+func TestSummarizeTruncates(t *testing.T) {
+	s := Summarize("", []byte(`"`+strings.Repeat("a", 4096)+`"`))
+	if len(s) > maxSummaryLen+3 {
+		t.Errorf("expected summary to be truncated; length %d", len(s))
+	}
+}
+
+func TestSummarizeRedactsEnvironment(t *testing.T) {
+	s := Summarize("", []byte(`{"Image":"redis","Env":["DB_PASS=s3cret","PORT=6379"]}`))
+	if strings.Contains(s, "s3cret") || strings.Contains(s, "6379") {
+		t.Errorf("expected environment values to be redacted: %s", s)
+	}
+	if !strings.Contains(s, "DB_PASS=") || !strings.Contains(s, `"Image":"redis"`) {
+		t.Errorf("expected environment names in summary: %s", s)
+	}
+	s = Summarize("", []byte(`{"name":"redis","environment":{"DB_PASS":"s3cret"}}`))
+	if strings.Contains(s, "s3cret") || !strings.Contains(s, "DB_PASS") {
+		t.Errorf("expected environment values to be redacted: %s", s)
+	}
+}
+
+func TestSummarizeRedactsQuery(t *testing.T) {
+	s := Summarize("token=s3cret&count=2&access_key=abc", nil)
+	if strings.Contains(s, "s3cret") || strings.Contains(s, "abc") {
+		t.Errorf("expected sensitive parameters to be redacted: %s", s)
+	}
+	if s != "?access_key=********&count=2&token=********" {
+		t.Errorf("unexpected summary: %s", s)
+	}
+}
+
+func TestAuditedRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		method  string
+		route   string
+		audited bool
+	}{
+		{"POST", "/api/containers", true},
+		{"DELETE", "/api/containers/{id}", true},
+		{"GET", "/api/containers/{id}/stop", true},
+		{"GET", "/api/containers/{id}/restart", true},
+		{"GET", "/api/containers/{id}/scale", true},
+		{"GET", "/api/containers/{id}", false},
+		{"HEAD", "/api/containers", false},
+	} {
+		if audited(tc.method, tc.route) != tc.audited {
+			t.Errorf("%s %s: expected audited %v", tc.method, tc.route, tc.audited)
+		}
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/containers/{id}/stop", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	a := NewAudit(nil, router)
+	r, _ := http.NewRequest("GET", "/api/containers/abc123/stop", nil)
+	route, target := a.route(r)
+	if route != "/api/containers/{id}/stop" || target != "abc123" {
+		t.Errorf("unexpected route %s and target %s", route, target)
+	}
+	if !audited(r.Method, route) {
+		t.Error("expected stopping a container to be audited")
+	}
+}
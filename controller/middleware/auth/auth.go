@@ -9,26 +9,48 @@ import (
 	"github.com/shipyard/shipyard/controller/manager"
 )
 
+const (
+	// changePasswordPath is the only path allowed for accounts that must
+	// change their password
+	changePasswordPath = "/account/changepassword"
+	// totpPathPrefix is allowed for accounts that must enroll in
+	// two-factor authentication
+	totpPathPrefix = "/account/totp/"
+)
+
 var (
 	logger = logrus.New()
 )
 
-func defaultDeniedHostHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "unauthorized", http.StatusUnauthorized)
+// SetLogger replaces the logger of the auth middleware
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
+// ErrorFunc writes an authentication failure for the request
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int, msg string)
+
+func defaultError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	http.Error(w, msg, status)
 }
 
 type AuthRequired struct {
-	deniedHostHandler http.Handler
-	manager           *manager.Manager
+	errorFunc ErrorFunc
+	manager   *manager.Manager
 }
 
 func NewAuthRequired(m *manager.Manager) *AuthRequired {
 	return &AuthRequired{
-		deniedHostHandler: http.HandlerFunc(defaultDeniedHostHandler),
-		manager:           m,
+		errorFunc: defaultError,
+		manager:   m,
 	}
 }
 
+// SetErrorFunc replaces the plain text error responses
+func (a *AuthRequired) SetErrorFunc(fn ErrorFunc) {
+	a.errorFunc = fn
+}
+
 func (a *AuthRequired) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		err := a.handleRequest(w, r)
@@ -45,34 +67,94 @@ func (a *AuthRequired) handleRequest(w http.ResponseWriter, r *http.Request) err
 	// service key takes priority
 	serviceKey := r.Header.Get("X-Service-Key")
 	if serviceKey != "" {
-		if err := a.manager.VerifyServiceKey(serviceKey); err == nil {
+		if key, err := a.manager.VerifyServiceKey(serviceKey, r.RemoteAddr); err == nil {
 			valid = true
+			manager.SetIdentity(r, manager.NewServiceKeyIdentity(key))
+		} else {
+			logger.Warnf("invalid service key from %s: %s", r.RemoteAddr, err)
 		}
-	} else { // check for authHeader
-		authHeader := r.Header.Get("X-Access-Token")
+	} else if authHeader := r.Header.Get("X-Access-Token"); authHeader != "" {
 		parts := strings.Split(authHeader, ":")
 		if len(parts) == 2 {
 			// validate
 			user := parts[0]
 			token := parts[1]
-			if err := a.manager.VerifyAuthToken(user, token); err == nil {
+			err := a.manager.VerifyAuthToken(user, token)
+			if restricted(err) {
+				if !restrictedAllowed(err, r.URL.Path) {
+					a.errorFunc(w, r, http.StatusForbidden, err.Error())
+					return err
+				}
+				err = nil
+			}
+			if err == nil {
+				acct, err := a.manager.Account(user)
+				if err != nil {
+					a.errorFunc(w, r, http.StatusUnauthorized, "unauthorized")
+					return err
+				}
 				valid = true
+				id := manager.NewAccountIdentity(acct)
+				if t := acct.AuthToken(token); t != nil {
+					id.MultiFactor = t.MultiFactor
+				}
+				manager.SetIdentity(r, id)
 				// set current user
 				session, _ := a.manager.Store().Get(r, a.manager.StoreKey)
 				session.Values["username"] = user
 				session.Save(r, w)
 			}
 		}
+	} else if cn := manager.ClientCommonName(r.TLS); cn != "" {
+		// client certificate verified against the controller ca
+		acct, key, err := a.manager.VerifyClientCertificate(cn, r.RemoteAddr)
+		if restricted(err) {
+			if !restrictedAllowed(err, r.URL.Path) {
+				a.errorFunc(w, r, http.StatusForbidden, err.Error())
+				return err
+			}
+			err = nil
+		}
+		if err == nil {
+			valid = true
+			if key != nil {
+				manager.SetIdentity(r, manager.NewServiceKeyIdentity(key))
+			}
+			if acct != nil {
+				manager.SetIdentity(r, manager.NewAccountIdentity(acct))
+				session, _ := a.manager.Store().Get(r, a.manager.StoreKey)
+				session.Values["username"] = acct.Username
+				session.Save(r, w)
+			}
+		} else {
+			logger.Warnf("invalid client certificate %s from %s: %s", cn, r.RemoteAddr, err)
+		}
 	}
 
 	if !valid {
-		a.deniedHostHandler.ServeHTTP(w, r)
+		a.errorFunc(w, r, http.StatusUnauthorized, "unauthorized")
 		return fmt.Errorf("unauthorized %s", r.RemoteAddr)
 	}
 
 	return nil
 }
 
+// restricted returns true for valid tokens that may only be used to
+// complete account setup
+func restricted(err error) bool {
+	return err == manager.ErrPasswordChangeRequired || err == manager.ErrTOTPEnrollmentRequired
+}
+
+func restrictedAllowed(err error, path string) bool {
+	switch err {
+	case manager.ErrPasswordChangeRequired:
+		return path == changePasswordPath
+	case manager.ErrTOTPEnrollmentRequired:
+		return strings.HasPrefix(path, totpPathPrefix)
+	}
+	return false
+}
+
 func (a *AuthRequired) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	err := a.handleRequest(w, r)
 
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/shipyard/shipyard/controller/manager"
 )
 
 var testHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,6 +20,24 @@ func TestNoAuthToken(t *testing.T) {
 	a.Handler(testHandler).ServeHTTP(res, req)
 
 	if res.Code != http.StatusUnauthorized {
-		t.Fatalf("expected 401; got %s", res.Code)
+		t.Fatalf("expected 401; got %d", res.Code)
+	}
+}
+
+func TestRestrictedAllowed(t *testing.T) {
+	if !restrictedAllowed(manager.ErrPasswordChangeRequired, "/account/changepassword") {
+		t.Error("expected password change to be allowed")
+	}
+	if restrictedAllowed(manager.ErrPasswordChangeRequired, "/api/containers") {
+		t.Error("expected api to be denied until the password is changed")
+	}
+	if !restrictedAllowed(manager.ErrTOTPEnrollmentRequired, "/account/totp/enroll") {
+		t.Error("expected totp enrollment to be allowed")
+	}
+	if restrictedAllowed(manager.ErrTOTPEnrollmentRequired, "/account/changepassword") {
+		t.Error("expected password change to be denied until enrolled")
+	}
+	if restricted(manager.ErrInvalidAuthToken) {
+		t.Error("expected invalid tokens to not be restricted")
 	}
 }
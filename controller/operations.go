@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/controller/manager"
+)
+
+// Long running actions (run, scale, redeploy, extension registration and
+// image pulls) can run as operations.  They return 202 with the operation
+// and a Location header; progress is available at /api/operations/{id}.
+
+type PullRequest struct {
+	Image string `json:"image"`
+}
+
+// asyncRequested reports whether the v1 request asked for an operation
+func asyncRequested(r *http.Request) (bool, error) {
+	a := r.FormValue("async")
+	if a == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(a)
+}
+
+func writeOperation(w http.ResponseWriter, op *shipyard.Operation, prefix string) {
+	w.Header().Set("Location", fmt.Sprintf("%s/operations/%s", prefix, op.ID))
+	writeJSON(w, http.StatusAccepted, op)
+}
+
+func operationError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrOperationDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrOperationFinished:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrOperationNotAllowed:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// cancelOperationAs cancels the operation if the caller of the request
+// started it or is an admin
+func cancelOperationAs(r *http.Request, id string) error {
+	op, err := controllerManager.Operation(id)
+	if err != nil {
+		return err
+	}
+	if !manager.RequestIdentity(r).CanCancel(op) {
+		return manager.ErrOperationNotAllowed
+	}
+	return controllerManager.CancelOperation(id)
+}
+
+func operations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, controllerManager.Operations())
+}
+
+func operation(w http.ResponseWriter, r *http.Request) {
+	op, err := controllerManager.Operation(mux.Vars(r)["id"])
+	if err != nil {
+		operationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, op)
+}
+
+func cancelOperation(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := cancelOperationAs(r, id); err != nil {
+		operationError(w, err)
+		return
+	}
+	logger.Infof("cancelled operation %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// operationStream writes the operation as json lines on every change
+// until it finishes or the client disconnects
+func operationStream(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	op, changed, err := controllerManager.WatchOperation(id)
+	if err != nil {
+		operationError(w, err)
+		return
+	}
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for {
+		if err := enc.Encode(op); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if op.Done() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		}
+		if op, changed, err = controllerManager.WatchOperation(id); err != nil {
+			return
+		}
+	}
+}
+
+func pullImage(w http.ResponseWriter, r *http.Request) {
+	image := r.FormValue("image")
+	if image == "" {
+		http.Error(w, "you must specify an image", http.StatusBadRequest)
+		return
+	}
+	op := controllerManager.PullOperation(image, requestActor(r))
+	logger.Infof("pulling %s on all engines: operation %s", image, op.ID)
+	writeOperation(w, op, "/api")
+}
+
+func v2Operations(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(w, r)
+	if !ok {
+		return
+	}
+	status := r.FormValue("status")
+	ops := []*shipyard.Operation{}
+	for _, op := range controllerManager.Operations() {
+		if status != "" && op.Status != status {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	start, end := pageBounds(len(ops), limit, offset)
+	writeList(w, ops[start:end], len(ops), limit, offset)
+}
+
+func v2Operation(w http.ResponseWriter, r *http.Request) {
+	op, err := controllerManager.Operation(mux.Vars(r)["id"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, op)
+}
+
+func v2OperationStream(w http.ResponseWriter, r *http.Request) {
+	if _, err := controllerManager.Operation(mux.Vars(r)["id"]); err != nil {
+		apiError(w, err)
+		return
+	}
+	operationStream(w, r)
+}
+
+func v2CancelOperation(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := cancelOperationAs(r, id); err != nil {
+		apiError(w, err)
+		return
+	}
+	logger.Infof("cancelled operation %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func v2PullImage(w http.ResponseWriter, r *http.Request) {
+	var req *PullRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req == nil || req.Image == "" {
+		writeAPIError(w, statusUnprocessableEntity, codeValidation, "image is required")
+		return
+	}
+	op := controllerManager.PullOperation(req.Image, requestActor(r))
+	logger.Infof("pulling %s on all engines: operation %s", req.Image, op.ID)
+	writeOperation(w, op, "/api/v2")
+}
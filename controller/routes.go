@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/citadel/citadel"
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/dockerhub"
+	"github.com/shipyard/shipyard/oidc"
+)
+
+// route describes an api route for the router and the api specification.
+// Request and Response are zero values of the body types; nil means no
+// JSON body.
+type route struct {
+	Method      string
+	Path        string
+	Handler     http.HandlerFunc
+	Summary     string
+	Request     interface{}
+	Response    interface{}
+	Status      int
+	ContentType string
+}
+
+// asyncRoutes return 202 with an operation when called with async=true
+var asyncRoutes = map[string]bool{
+	"POST /api/containers":           true,
+	"GET /api/containers/{id}/scale": true,
+	"POST /api/extensions":           true,
+}
+
+// register adds the routes to the router
+func register(router *mux.Router, routes []*route) {
+	for _, rt := range routes {
+		router.HandleFunc(rt.Path, rt.Handler).Methods(rt.Method)
+	}
+}
+
+// apiRoutes are the authenticated /api routes
+func apiRoutes() []*route {
+	return []*route{
+		{"GET", "/api/accounts", accounts, "list accounts", nil, []*shipyard.Account{}, http.StatusOK, ""},
+		{"POST", "/api/accounts", addAccount, "create or update an account", &shipyard.Account{}, nil, http.StatusNoContent, ""},
+		{"DELETE", "/api/accounts", deleteAccount, "delete an account", &shipyard.Account{}, nil, http.StatusNoContent, ""},
+		{"DELETE", "/api/accounts/{username}/totp", resetAccountTOTP, "reset two-factor authentication for an account", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/roles", roles, "list roles", nil, []*shipyard.Role{}, http.StatusOK, ""},
+		{"GET", "/api/roles/{name}", role, "inspect a role", nil, &shipyard.Role{}, http.StatusOK, ""},
+		{"POST", "/api/roles", addRole, "create a role", &shipyard.Role{}, nil, http.StatusNoContent, ""},
+		{"POST", "/api/roles/{name}/totp", setRoleTOTP, "require two-factor authentication for a role", &RoleTOTP{}, nil, http.StatusNoContent, ""},
+		{"DELETE", "/api/roles", deleteRole, "delete a role", &shipyard.Role{}, nil, http.StatusOK, ""},
+		{"GET", "/api/audit", auditRecords, "query the audit log", nil, []*shipyard.AuditRecord{}, http.StatusOK, ""},
+		{"GET", "/api/audit/export", exportAudit, "export the audit log as json lines", nil, nil, http.StatusOK, "application/x-ndjson"},
+		{"GET", "/api/audit/verify", verifyAudit, "verify the audit log hash chain", nil, &shipyard.AuditVerification{}, http.StatusOK, ""},
+		{"GET", "/api/cluster/info", clusterInfo, "cluster information", nil, &shipyard.ClusterInfo{}, http.StatusOK, ""},
+		{"GET", "/api/cluster/controllers", clusterControllers, "list controllers and the leader", nil, &shipyard.ControllerMembership{}, http.StatusOK, ""},
+		{"GET", "/api/containers", containers, "list containers", nil, []*citadel.Container{}, http.StatusOK, ""},
+		{"POST", "/api/containers", run, "run containers", &citadel.Image{}, []*citadel.Container{}, http.StatusCreated, ""},
+		{"GET", "/api/containers/{id}", inspectContainer, "inspect a container", nil, &citadel.Container{}, http.StatusOK, ""},
+		{"DELETE", "/api/containers/{id}", destroy, "destroy a container", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/containers/{id}/stop", stopContainer, "stop a container", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/containers/{id}/restart", restartContainer, "restart a container", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/containers/{id}/scale", scaleContainer, "scale a container", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/containers/{id}/logs", containerLogs, "container logs", nil, nil, http.StatusOK, "text/plain"},
+		{"GET", "/api/events", events, "query events (since, until, type, tag, engine, container, actor, limit, cursor)", nil, []*shipyard.Event{}, http.StatusOK, ""},
+		{"GET", "/api/events/export", exportEvents, "export events as json lines", nil, nil, http.StatusOK, "application/x-ndjson"},
+		{"DELETE", "/api/events", purgeEvents, "purge events", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/engines", engines, "list engines", nil, []*shipyard.Engine{}, http.StatusOK, ""},
+		{"POST", "/api/engines", addEngine, "add an engine", &shipyard.Engine{}, nil, http.StatusCreated, ""},
+		{"GET", "/api/engines/{id}", inspectEngine, "inspect an engine", nil, &shipyard.Engine{}, http.StatusOK, ""},
+		{"DELETE", "/api/engines/{id}", removeEngine, "remove an engine", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/engines/{id}/health", engineHealth, "engine health checks and uptime; since is a duration (default 24h)", nil, &shipyard.EngineHealthHistory{}, http.StatusOK, ""},
+		{"POST", "/api/engines/{id}/certificates", rotateEngineCertificates, "rotate engine certificates", &shipyard.EngineCertificates{}, nil, http.StatusNoContent, ""},
+		{"GET", "/api/extensions", extensions, "list extensions", nil, []*shipyard.Extension{}, http.StatusOK, ""},
+		{"GET", "/api/extensions/{id}", extension, "inspect an extension", nil, &shipyard.Extension{}, http.StatusOK, ""},
+		{"POST", "/api/extensions", addExtension, "add an extension", &shipyard.Extension{}, nil, http.StatusNoContent, ""},
+		{"DELETE", "/api/extensions/{id}", deleteExtension, "remove an extension", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/secrets", listSecrets, "list secrets", nil, []*shipyard.Secret{}, http.StatusOK, ""},
+		{"POST", "/api/secrets", addSecret, "create or update a secret", &shipyard.Secret{}, nil, http.StatusNoContent, ""},
+		{"DELETE", "/api/secrets/{name:.+}", deleteSecret, "delete a secret", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/servicekeys", serviceKeys, "list service keys", nil, []*shipyard.ServiceKey{}, http.StatusOK, ""},
+		{"POST", "/api/servicekeys", addServiceKey, "create a service key", &shipyard.ServiceKey{}, &shipyard.ServiceKey{}, http.StatusOK, ""},
+		{"DELETE", "/api/servicekeys", removeServiceKey, "remove a service key", &shipyard.ServiceKey{}, nil, http.StatusNoContent, ""},
+		{"POST", "/api/images/pull", pullImage, "pull an image on every engine", nil, &shipyard.Operation{}, http.StatusAccepted, ""},
+		{"GET", "/api/operations", operations, "list operations", nil, []*shipyard.Operation{}, http.StatusOK, ""},
+		{"GET", "/api/operations/{id}", operation, "inspect an operation", nil, &shipyard.Operation{}, http.StatusOK, ""},
+		{"GET", "/api/operations/{id}/stream", operationStream, "stream operation progress as json lines", nil, nil, http.StatusOK, "application/x-ndjson"},
+		{"DELETE", "/api/operations/{id}", cancelOperation, "cancel an operation", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/webhookkeys", webhookKeys, "list webhook keys", nil, []*dockerhub.WebhookKey{}, http.StatusOK, ""},
+		{"GET", "/api/webhookkeys/{id}", webhookKey, "inspect a webhook key", nil, &dockerhub.WebhookKey{}, http.StatusOK, ""},
+		{"POST", "/api/webhookkeys", addWebhookKey, "create a webhook key", &dockerhub.WebhookKey{}, &dockerhub.WebhookKey{}, http.StatusOK, ""},
+		{"DELETE", "/api/webhookkeys/{id}", deleteWebhookKey, "remove a webhook key", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/jointokens", joinTokens, "list engine join tokens", nil, []*shipyard.JoinToken{}, http.StatusOK, ""},
+		{"POST", "/api/jointokens", addJoinToken, "create an engine join token", &shipyard.JoinToken{}, &shipyard.JoinToken{}, http.StatusCreated, ""},
+		{"DELETE", "/api/jointokens/{id}", removeJoinToken, "remove an engine join token", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/notifications", notificationChannels, "list notification channels", nil, []*shipyard.NotificationChannel{}, http.StatusOK, ""},
+		{"POST", "/api/notifications", addNotificationChannel, "add a notification channel", &shipyard.NotificationChannel{}, &shipyard.NotificationChannel{}, http.StatusCreated, ""},
+		{"GET", "/api/notifications/{id}", notificationChannel, "inspect a notification channel", nil, &shipyard.NotificationChannel{}, http.StatusOK, ""},
+		{"PUT", "/api/notifications/{id}", updateNotificationChannel, "update a notification channel", &shipyard.NotificationChannel{}, nil, http.StatusNoContent, ""},
+		{"DELETE", "/api/notifications/{id}", removeNotificationChannel, "remove a notification channel", nil, nil, http.StatusNoContent, ""},
+		{"POST", "/api/notifications/{id}/test", testNotificationChannel, "send a test notification", nil, &shipyard.NotificationDelivery{}, http.StatusOK, ""},
+		{"GET", "/api/notifications/{id}/deliveries", notificationDeliveries, "latest deliveries to a notification channel", nil, []*shipyard.NotificationDelivery{}, http.StatusOK, ""},
+	}
+}
+
+// v2Routes are the authenticated /api/v2 routes
+func v2Routes() []*route {
+	return []*route{
+		{"GET", "/api/v2/accounts", v2Accounts, "list accounts", nil, listOf([]*shipyard.Account{}), http.StatusOK, ""},
+		{"POST", "/api/v2/accounts", v2AddAccount, "create an account", &shipyard.Account{}, nil, http.StatusCreated, ""},
+		{"GET", "/api/v2/accounts/{username}", v2Account, "inspect an account", nil, &shipyard.Account{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/accounts/{username}", v2DeleteAccount, "delete an account", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/roles", v2Roles, "list roles", nil, listOf([]*shipyard.Role{}), http.StatusOK, ""},
+		{"POST", "/api/v2/roles", v2AddRole, "create a role", &shipyard.Role{}, nil, http.StatusCreated, ""},
+		{"GET", "/api/v2/roles/{name}", v2Role, "inspect a role", nil, &shipyard.Role{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/roles/{name}", v2DeleteRole, "delete a role", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/cluster/info", v2ClusterInfo, "cluster information", nil, &shipyard.ClusterInfo{}, http.StatusOK, ""},
+		{"GET", "/api/v2/cluster/controllers", v2ClusterControllers, "list controllers and the leader", nil, &shipyard.ControllerMembership{}, http.StatusOK, ""},
+		{"GET", "/api/v2/containers", v2Containers, "list containers", nil, listOf([]*citadel.Container{}), http.StatusOK, ""},
+		{"POST", "/api/v2/containers", v2Run, "run containers", &citadel.Image{}, &shipyard.Operation{}, http.StatusAccepted, ""},
+		{"GET", "/api/v2/containers/{id}", v2InspectContainer, "inspect a container", nil, &citadel.Container{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/containers/{id}", v2DestroyContainer, "destroy a container", nil, nil, http.StatusNoContent, ""},
+		{"POST", "/api/v2/containers/{id}/stop", v2StopContainer, "stop a container", nil, nil, http.StatusNoContent, ""},
+		{"POST", "/api/v2/containers/{id}/restart", v2RestartContainer, "restart a container", nil, nil, http.StatusNoContent, ""},
+		{"POST", "/api/v2/containers/{id}/scale", v2ScaleContainer, "scale a container", &ScaleRequest{}, &shipyard.Operation{}, http.StatusAccepted, ""},
+		{"GET", "/api/v2/containers/{id}/logs", v2ContainerLogs, "container logs", nil, nil, http.StatusOK, "text/plain"},
+		{"GET", "/api/v2/events", v2Events, "query events by offset or cursor", nil, listOf([]*shipyard.Event{}), http.StatusOK, ""},
+		{"DELETE", "/api/v2/events", v2PurgeEvents, "purge events", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/engines", v2Engines, "list engines", nil, listOf([]*shipyard.Engine{}), http.StatusOK, ""},
+		{"POST", "/api/v2/engines", v2AddEngine, "add an engine", &shipyard.Engine{}, &shipyard.Engine{}, http.StatusCreated, ""},
+		{"GET", "/api/v2/engines/{id}", v2InspectEngine, "inspect an engine", nil, &shipyard.Engine{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/engines/{id}", v2RemoveEngine, "remove an engine", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/engines/{id}/health", v2EngineHealth, "engine health checks and uptime; since is a duration (default 24h)", nil, &shipyard.EngineHealthHistory{}, http.StatusOK, ""},
+		{"POST", "/api/v2/engines/{id}/certificates", v2RotateEngineCertificates, "rotate engine certificates", &shipyard.EngineCertificates{}, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/extensions", v2Extensions, "list extensions", nil, listOf([]*shipyard.Extension{}), http.StatusOK, ""},
+		{"POST", "/api/v2/extensions", v2AddExtension, "add an extension", &shipyard.Extension{}, &shipyard.Operation{}, http.StatusAccepted, ""},
+		{"GET", "/api/v2/extensions/{id}", v2Extension, "inspect an extension", nil, &shipyard.Extension{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/extensions/{id}", v2DeleteExtension, "remove an extension", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/secrets", v2Secrets, "list secrets", nil, listOf([]*shipyard.Secret{}), http.StatusOK, ""},
+		{"POST", "/api/v2/secrets", v2AddSecret, "create or update a secret", &shipyard.Secret{}, nil, http.StatusCreated, ""},
+		{"DELETE", "/api/v2/secrets/{name:.+}", v2DeleteSecret, "delete a secret", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/servicekeys", v2ServiceKeys, "list service keys", nil, listOf([]*shipyard.ServiceKey{}), http.StatusOK, ""},
+		{"POST", "/api/v2/servicekeys", v2AddServiceKey, "create a service key", &shipyard.ServiceKey{}, &shipyard.ServiceKey{}, http.StatusCreated, ""},
+		{"DELETE", "/api/v2/servicekeys/{key}", v2RemoveServiceKey, "remove a service key", nil, nil, http.StatusNoContent, ""},
+		{"POST", "/api/v2/images/pull", v2PullImage, "pull an image on every engine", &PullRequest{}, &shipyard.Operation{}, http.StatusAccepted, ""},
+		{"GET", "/api/v2/operations", v2Operations, "list operations", nil, listOf([]*shipyard.Operation{}), http.StatusOK, ""},
+		{"GET", "/api/v2/operations/{id}", v2Operation, "inspect an operation", nil, &shipyard.Operation{}, http.StatusOK, ""},
+		{"GET", "/api/v2/operations/{id}/stream", v2OperationStream, "stream operation progress as json lines", nil, nil, http.StatusOK, "application/x-ndjson"},
+		{"POST", "/api/v2/operations/{id}/cancel", v2CancelOperation, "cancel an operation", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/webhookkeys", v2WebhookKeys, "list webhook keys", nil, listOf([]*dockerhub.WebhookKey{}), http.StatusOK, ""},
+		{"POST", "/api/v2/webhookkeys", v2AddWebhookKey, "create a webhook key", &dockerhub.WebhookKey{}, &dockerhub.WebhookKey{}, http.StatusCreated, ""},
+		{"GET", "/api/v2/webhookkeys/{id}", v2WebhookKey, "inspect a webhook key", nil, &dockerhub.WebhookKey{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/webhookkeys/{id}", v2DeleteWebhookKey, "remove a webhook key", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/jointokens", v2JoinTokens, "list engine join tokens", nil, listOf([]*shipyard.JoinToken{}), http.StatusOK, ""},
+		{"POST", "/api/v2/jointokens", v2AddJoinToken, "create an engine join token", &shipyard.JoinToken{}, &shipyard.JoinToken{}, http.StatusCreated, ""},
+		{"DELETE", "/api/v2/jointokens/{id}", v2RemoveJoinToken, "remove an engine join token", nil, nil, http.StatusNoContent, ""},
+		{"GET", "/api/v2/notifications", v2NotificationChannels, "list notification channels", nil, listOf([]*shipyard.NotificationChannel{}), http.StatusOK, ""},
+		{"POST", "/api/v2/notifications", v2AddNotificationChannel, "add a notification channel", &shipyard.NotificationChannel{}, &shipyard.NotificationChannel{}, http.StatusCreated, ""},
+		{"GET", "/api/v2/notifications/{id}", v2NotificationChannel, "inspect a notification channel", nil, &shipyard.NotificationChannel{}, http.StatusOK, ""},
+		{"PUT", "/api/v2/notifications/{id}", v2UpdateNotificationChannel, "update a notification channel", &shipyard.NotificationChannel{}, &shipyard.NotificationChannel{}, http.StatusOK, ""},
+		{"DELETE", "/api/v2/notifications/{id}", v2RemoveNotificationChannel, "remove a notification channel", nil, nil, http.StatusNoContent, ""},
+		{"POST", "/api/v2/notifications/{id}/test", v2TestNotificationChannel, "send a test notification", nil, &shipyard.NotificationDelivery{}, http.StatusOK, ""},
+		{"GET", "/api/v2/notifications/{id}/deliveries", v2NotificationDeliveries, "list deliveries to a notification channel, newest first", nil, listOf([]*shipyard.NotificationDelivery{}), http.StatusOK, ""},
+	}
+}
+
+// accountRoutes are the /account routes for the current user
+func accountRoutes() []*route {
+	return []*route{
+		{"POST", "/account/changepassword", changePassword, "change the password", &Credentials{}, nil, http.StatusOK, ""},
+		{"POST", "/account/totp/enroll", enrollTOTP, "start two-factor enrollment", nil, &shipyard.TOTPEnrollment{}, http.StatusOK, ""},
+		{"POST", "/account/totp/activate", activateTOTP, "activate two-factor authentication", &shipyard.TOTPCode{}, &shipyard.RecoveryCodes{}, http.StatusOK, ""},
+		{"POST", "/account/totp/disable", disableTOTP, "disable two-factor authentication", &shipyard.TOTPCode{}, nil, http.StatusNoContent, ""},
+		{"POST", "/account/totp/recovery-codes", regenerateRecoveryCodes, "regenerate recovery codes", &shipyard.TOTPCode{}, &shipyard.RecoveryCodes{}, http.StatusOK, ""},
+	}
+}
+
+// authRoutes are the public login routes
+func authRoutes() []*route {
+	return []*route{
+		{"POST", "/auth/login", login, "login", &Credentials{}, &shipyard.AuthToken{}, http.StatusOK, ""},
+		{"GET", "/auth/sso/config", ssoConfig, "single sign-on configuration", nil, &oidc.Config{}, http.StatusOK, ""},
+		{"GET", "/auth/sso/login", ssoLogin, "start a single sign-on login", nil, nil, http.StatusFound, ""},
+		{"GET", "/auth/sso/callback", ssoCallback, "single sign-on callback; redirects to the ui with the token", nil, nil, http.StatusFound, ""},
+		{"POST", "/auth/sso/request", ssoRequest, "start a single sign-on login for a client", nil, &shipyard.SSORequest{}, http.StatusOK, ""},
+		{"POST", "/auth/sso/token", ssoToken, "exchange an id token", &SSOCredentials{}, &shipyard.SSOLogin{}, http.StatusOK, ""},
+	}
+}
+
+// joinRoutes are authenticated by the join token in the request
+func joinRoutes() []*route {
+	return []*route{
+		{"POST", "/join", joinEngine, "join an engine to the cluster with a join token", &shipyard.JoinRequest{}, &shipyard.Engine{}, http.StatusCreated, ""},
+	}
+}
+
+// hubRoutes are the public docker hub webhook routes
+func hubRoutes() []*route {
+	return []*route{
+		{"POST", "/hub/webhook/{id}", hubWebhook, "docker hub webhook", &dockerhub.Webhook{}, &shipyard.Operation{}, http.StatusAccepted, ""},
+	}
+}
+
+// allRoutes returns every route in the api specification
+func allRoutes() []*route {
+	routes := []*route{}
+	for _, group := range [][]*route{apiRoutes(), v2Routes(), accountRoutes(), authRoutes(), hubRoutes(), joinRoutes()} {
+		routes = append(routes, group...)
+	}
+	return routes
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/context"
+)
+
+// drainPoll is how often shutdown checks for active connections
+const drainPoll = 100 * time.Millisecond
+
+// server is an http server that can be shut down gracefully: it stops
+// accepting connections, closes idle ones and waits for the requests in
+// flight to finish
+type server struct {
+	name   string
+	server *http.Server
+
+	mux      sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]http.ConnState
+	closing  bool
+}
+
+func newServer(name string, addr string, h http.Handler) *server {
+	s := &server{
+		name:  name,
+		conns: make(map[net.Conn]http.ConnState),
+	}
+	s.server = &http.Server{
+		Addr:      addr,
+		Handler:   context.ClearHandler(h),
+		ConnState: s.track,
+	}
+	return s
+}
+
+// track records the state of the connections; once closing, connections
+// are closed as soon as they are idle
+func (s *server) track(c net.Conn, state http.ConnState) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(s.conns, c)
+		return
+	case http.StateIdle:
+		if s.closing {
+			c.Close()
+		}
+	}
+	s.conns[c] = state
+}
+
+// listen serves over https when the tls flags are set.  It returns nil
+// once the server has been shut down.
+func (s *server) listen() error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	if tlsCertPath == "" {
+		logger.Infof("%s listening on %s", s.name, s.server.Addr)
+	} else {
+		tlsConfig, err := serverTLSConfig(tlsCACertPath)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("unable to configure tls: %s", err)
+		}
+		cert, err := tls.LoadX509KeyPair(tlsCertPath, tlsKeyPath)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("unable to configure tls: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		s.server.TLSConfig = tlsConfig
+		ln = tls.NewListener(ln, tlsConfig)
+		logger.Infof("%s listening on %s (tls)", s.name, s.server.Addr)
+	}
+
+	return s.serve(ln)
+}
+
+// serve accepts connections on ln until the server is shut down
+func (s *server) serve(ln net.Listener) error {
+	s.mux.Lock()
+	if s.closing {
+		s.mux.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listener = ln
+	s.mux.Unlock()
+
+	err := s.server.Serve(ln)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closing {
+		return nil
+	}
+	return err
+}
+
+// shutdown stops accepting connections and waits until the active
+// connections are closed or the deadline passes; the remaining
+// connections are then closed
+func (s *server) shutdown(deadline time.Time) error {
+	s.mux.Lock()
+	s.closing = true
+	s.server.SetKeepAlivesEnabled(false)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c, state := range s.conns {
+		if state == http.StateIdle || state == http.StateNew {
+			c.Close()
+		}
+	}
+	s.mux.Unlock()
+
+	for {
+		s.mux.Lock()
+		active := len(s.conns)
+		if active == 0 {
+			s.mux.Unlock()
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			for c := range s.conns {
+				c.Close()
+			}
+			s.mux.Unlock()
+			return fmt.Errorf("%s closed %d active connections", s.name, active)
+		}
+		s.mux.Unlock()
+		time.Sleep(drainPoll)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T, h http.Handler) (*server, string, chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer("test", ln.Addr().String(), h)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.serve(ln)
+	}()
+	return s, "http://" + ln.Addr().String(), errs
+}
+
+func TestServerShutdownDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, url, errs := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	}))
+
+	bodies := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		bodies <- string(b)
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.shutdown(time.Now().Add(5 * time.Second))
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("expected shutdown to wait for the request in flight")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("expected new connections to be refused while draining")
+	}
+
+	close(release)
+	if body := <-bodies; body != "done" {
+		t.Errorf("expected the request in flight to finish; received %q", body)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("expected serve to return nil after shutdown; received %s", err)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s, url, _ := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go http.Get(url)
+	<-started
+
+	if err := s.shutdown(time.Now().Add(200 * time.Millisecond)); err == nil {
+		t.Fatal("expected an error when requests do not finish before the deadline")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shipyard/shipyard"
+)
+
+// pathParam matches mux path variables with an optional pattern
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// pagedList is the response type of v2 list routes
+type pagedList struct {
+	items interface{}
+}
+
+func listOf(items interface{}) *pagedList {
+	return &pagedList{items: items}
+}
+
+// specRoutes returns the routes described by the api specification
+func specRoutes() []*route {
+	routes := allRoutes()
+	routes = append(routes, &route{"GET", "/api/spec", apiSpec, "openapi specification", nil, map[string]interface{}{}, http.StatusOK, ""})
+	routes = append(routes, &route{"GET", "/_ping", ping, "controller liveness", nil, nil, http.StatusOK, "text/plain"})
+	routes = append(routes, &route{"GET", "/_health", health, "controller readiness; 503 when unavailable", nil, &shipyard.ControllerHealth{}, http.StatusOK, ""})
+	return routes
+}
+
+// schemaBuilder collects component schemas while building a specification
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name := b.componentName(t)
+		if _, ok := b.components[name]; !ok {
+			// reserve the name before recursing for self referencing types
+			b.components[name] = nil
+			b.components[name] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		props[name] = b.schema(f.Type)
+	}
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (b *schemaBuilder) body(v interface{}) map[string]interface{} {
+	if l, ok := v.(*pagedList); ok {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"items":  b.schema(reflect.TypeOf(l.items)),
+				"total":  map[string]interface{}{"type": "integer"},
+				"limit":  map[string]interface{}{"type": "integer"},
+				"offset": map[string]interface{}{"type": "integer"},
+			},
+		}
+	}
+	return b.schema(reflect.TypeOf(v))
+}
+
+func parameters(op map[string]interface{}) []interface{} {
+	params, _ := op["parameters"].([]interface{})
+	return params
+}
+
+// specPath converts a mux path to an openapi path and its parameters
+func specPath(path string) (string, []string) {
+	params := []string{}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		params = append(params, m[1])
+	}
+	return pathParam.ReplaceAllString(path, "{$1}"), params
+}
+
+// buildSpec returns an openapi 3.0 document describing the routes
+func buildSpec(routes []*route) map[string]interface{} {
+	b := &schemaBuilder{components: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+	errorSchema := b.schema(reflect.TypeOf(APIError{}))
+	for _, rt := range routes {
+		p, names := specPath(rt.Path)
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"operationId": strings.ToLower(rt.Method) + strings.Replace(strings.Replace(p, "{", "", -1), "}", "", -1),
+		}
+		if len(names) > 0 {
+			params := []interface{}{}
+			for _, n := range names {
+				params = append(params, map[string]interface{}{
+					"name":     n,
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.body(rt.Request)},
+				},
+			}
+		}
+		resp := map[string]interface{}{"description": http.StatusText(rt.Status)}
+		switch {
+		case rt.ContentType != "":
+			resp["content"] = map[string]interface{}{
+				rt.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			}
+		case rt.Response != nil:
+			resp["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": b.body(rt.Response)},
+			}
+		}
+		responses := map[string]interface{}{strconv.Itoa(rt.Status): resp}
+		if strings.HasPrefix(rt.Path, "/api/v2/") {
+			responses["default"] = map[string]interface{}{
+				"description": "error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorSchema},
+				},
+			}
+		}
+		if asyncRoutes[rt.Method+" "+rt.Path] {
+			op["parameters"] = append(parameters(op), map[string]interface{}{
+				"name":   "async",
+				"in":     "query",
+				"schema": map[string]interface{}{"type": "boolean"},
+			})
+			responses[strconv.Itoa(http.StatusAccepted)] = map[string]interface{}{
+				"description": http.StatusText(http.StatusAccepted),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(shipyard.Operation{}))},
+				},
+			}
+		}
+		op["responses"] = responses
+		if paths[p] == nil {
+			paths[p] = map[string]interface{}{}
+		}
+		paths[p][strings.ToLower(rt.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "Shipyard",
+			"version": VERSION,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"accessToken": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Access-Token"},
+				"serviceKey":  map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Service-Key"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"accessToken": []string{}},
+			map[string]interface{}{"serviceKey": []string{}},
+		},
+	}
+}
+
+func apiSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildSpec(specRoutes())); err != nil {
+		logger.Errorf("error encoding api spec: %s", err)
+	}
+}
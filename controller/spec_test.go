@@ -0,0 +1,654 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/gorilla/mux"
+	"github.com/shipyard/shipyard"
+	"github.com/shipyard/shipyard/client"
+	"github.com/shipyard/shipyard/controller/manager"
+	"github.com/shipyard/shipyard/dockerhub"
+	"github.com/shipyard/shipyard/oidc"
+)
+
+func TestSpecDescribesEveryRoute(t *testing.T) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/spec", nil)
+	apiSpec(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200; received %d", w.Code)
+	}
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	body := w.Body.Bytes()
+	if err := json.Unmarshal(body, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OpenAPI != "3.0.0" {
+		t.Errorf("expected openapi 3.0.0; received %q", spec.OpenAPI)
+	}
+	for _, rt := range specRoutes() {
+		p, params := specPath(rt.Path)
+		op, ok := spec.Paths[p][strings.ToLower(rt.Method)]
+		if !ok {
+			t.Errorf("%s %s is not described", rt.Method, rt.Path)
+			continue
+		}
+		if _, ok := op["responses"].(map[string]interface{})[strconv.Itoa(rt.Status)]; !ok {
+			t.Errorf("%s %s does not describe status %d", rt.Method, rt.Path, rt.Status)
+		}
+		if len(params) > 0 && op["parameters"] == nil {
+			t.Errorf("%s %s does not describe its parameters", rt.Method, rt.Path)
+		}
+		if (rt.Request != nil) != (op["requestBody"] != nil) {
+			t.Errorf("%s %s request body mismatch", rt.Method, rt.Path)
+		}
+	}
+	if _, ok := spec.Paths["/api/secrets/{name}"]; !ok {
+		t.Error("expected path patterns to be removed from the spec")
+	}
+
+	var doc interface{}
+	json.Unmarshal(body, &doc)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				if spec.Components.Schemas[name] == nil {
+					t.Errorf("unresolved reference %s", ref)
+				}
+			}
+			for _, c := range v {
+				walk(c)
+			}
+		case []interface{}:
+			for _, c := range v {
+				walk(c)
+			}
+		}
+	}
+	walk(doc)
+}
+
+// testIssuer is an openid connect provider that signs id tokens with its
+// key
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key}
+	m := http.NewServeMux()
+	m.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&oidc.Discovery{
+			Issuer:                iss.URL,
+			AuthorizationEndpoint: iss.URL + "/authorize",
+			TokenEndpoint:         iss.URL + "/token",
+			JWKSURI:               iss.URL + "/keys",
+		})
+	})
+	m.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   oidc.EncodeSegment(key.N.Bytes()),
+				"e":   oidc.EncodeSegment(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	// the code is the nonce of the login so the token can carry it
+	m.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&oidc.TokenResponse{
+			AccessToken: "access",
+			IDToken:     iss.idToken(t, r.FormValue("code")),
+		})
+	})
+	iss.Server = httptest.NewServer(m)
+	return iss
+}
+
+// idToken returns a signed id token for jdoe in the developers group
+func (iss *testIssuer) idToken(t *testing.T, nonce string) string {
+	h, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	c, _ := json.Marshal(map[string]interface{}{
+		"iss":                iss.URL,
+		"sub":                "1234",
+		"aud":                "shipyard",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "jdoe",
+		"groups":             []string{"developers"},
+	})
+	data := oidc.EncodeSegment(h) + "." + oidc.EncodeSegment(c)
+	d := sha256.Sum256([]byte(data))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, d[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data + "." + oidc.EncodeSegment(sig)
+}
+
+func TestSSOCallbackRedirectsToUI(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+	provider, err := oidc.NewProvider(&oidc.Config{Issuer: issuer.URL, ClientID: "shipyard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(m Controller, p *oidc.Provider, roles *oidc.RoleMapper, out io.Writer) {
+		controllerManager, ssoProvider, ssoRoles, logger.Out = m, p, roles, out
+	}(controllerManager, ssoProvider, ssoRoles, logger.Out)
+	controllerManager = newMemController("shipyard")
+	ssoProvider = provider
+	ssoRoles = &oidc.RoleMapper{Claim: "groups", Mapping: map[string]string{"developers": "user"}}
+	logger.Out = ioutil.Discard
+
+	get := func(h http.HandlerFunc, path string) *url.URL {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != http.StatusFound {
+			t.Fatalf("expected a redirect from %s; received %d", path, w.Code)
+		}
+		u, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	auth := get(ssoLogin, "/auth/sso/login").Query()
+	v := url.Values{}
+	v.Set("state", auth.Get("state"))
+	v.Set("code", auth.Get("nonce"))
+	u := get(ssoCallback, "/auth/sso/callback?"+v.Encode())
+	if u.Path != "/" || !strings.HasPrefix(u.Fragment, "/sso?") {
+		t.Fatalf("expected a redirect to the ui; received %s", u)
+	}
+	q, _ := url.ParseQuery(strings.TrimPrefix(u.Fragment, "/sso?"))
+	if q.Get("username") != "jdoe" || q.Get("token") == "" {
+		t.Errorf("expected the login in the fragment; received %s", u.Fragment)
+	}
+
+	// replaying the state is refused
+	u = get(ssoCallback, "/auth/sso/callback?"+v.Encode())
+	if !strings.HasPrefix(u.Fragment, "/login?error=") {
+		t.Errorf("expected a redirect to the login page with an error; received %s", u)
+	}
+}
+
+// conformanceServer serves the api handlers with the routes of the route
+// table.  Requests to /api and /account are made by the admin account in
+// place of the auth middleware.  Request bodies are checked against the
+// declared request types and responses against the declared status,
+// content type and response types.
+func conformanceServer(t *testing.T, c *memController) *httptest.Server {
+	router := mux.NewRouter()
+	for _, rt := range allRoutes() {
+		rt := rt
+		router.HandleFunc(rt.Path, func(w http.ResponseWriter, r *http.Request) {
+			name := rt.Method + " " + rt.Path
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case rt.Request == nil && len(body) > 0:
+				t.Errorf("%s does not accept a body; received %s", name, body)
+			case rt.Request != nil:
+				v := reflect.New(reflect.TypeOf(rt.Request)).Interface()
+				if err := json.Unmarshal(body, v); err != nil {
+					t.Errorf("%s invalid body: %s", name, err)
+				}
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			if strings.HasPrefix(rt.Path, "/api/") || strings.HasPrefix(rt.Path, "/account/") {
+				session, _ := c.Store().Get(r, STORE_KEY)
+				session.Values["username"] = "admin"
+				acct, _ := c.Account("admin")
+				manager.SetIdentity(r, manager.NewAccountIdentity(acct))
+			}
+
+			rec := httptest.NewRecorder()
+			rt.Handler(rec, r)
+			checkResponse(t, rt, r, rec)
+
+			for k, v := range rec.HeaderMap {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.Write(rec.Body.Bytes())
+		}).Methods(rt.Method)
+	}
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("no route for %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	})
+	return httptest.NewServer(router)
+}
+
+// checkResponse reports responses that do not match the route
+func checkResponse(t *testing.T, rt *route, r *http.Request, rec *httptest.ResponseRecorder) {
+	name := rt.Method + " " + rt.Path
+	status, resp, contentType := rt.Status, rt.Response, rt.ContentType
+	if asyncRoutes[name] && r.FormValue("async") == "true" {
+		status, resp = http.StatusAccepted, &shipyard.Operation{}
+	}
+	if resp != nil && contentType == "" {
+		contentType = "application/json"
+	}
+	if rec.Code != status {
+		t.Errorf("%s: expected status %d; received %d: %s", name, status, rec.Code, rec.Body)
+		return
+	}
+	if ct := rec.HeaderMap.Get("content-type"); contentType != "" && !strings.HasPrefix(ct, contentType) {
+		t.Errorf("%s: expected content type %s; received %q", name, contentType, ct)
+	}
+	switch {
+	case contentType == "application/json":
+		if l, ok := resp.(*pagedList); ok {
+			resp = &ListResponse{Items: l.items}
+		}
+		v := reflect.New(reflect.TypeOf(resp)).Interface()
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Errorf("%s: response does not match %T: %s", name, resp, err)
+		}
+	case contentType == "" && rec.Body.Len() > 0:
+		t.Errorf("%s: expected no body; received %s", name, rec.Body)
+	}
+}
+
+func TestClientConformance(t *testing.T) {
+	c := newMemController("shipyard")
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+	provider, err := oidc.NewProvider(&oidc.Config{Issuer: issuer.URL, ClientID: "shipyard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(m Controller, p *oidc.Provider, roles *oidc.RoleMapper, out io.Writer) {
+		controllerManager, ssoProvider, ssoRoles, logger.Out = m, p, roles, out
+	}(controllerManager, ssoProvider, ssoRoles, logger.Out)
+	controllerManager = c
+	ssoProvider = provider
+	ssoRoles = &oidc.RoleMapper{Claim: "groups", Mapping: map[string]string{"developers": "user"}}
+	logger.Out = ioutil.Discard
+
+	srv := conformanceServer(t, c)
+	defer srv.Close()
+
+	m := client.NewManager(&client.ShipyardConfig{
+		Url:      srv.URL,
+		Username: "admin",
+		Token:    "token",
+	})
+
+	var (
+		ssoRequest  *shipyard.SSORequest
+		totpSecret  string
+		role        *shipyard.Role
+		engine      *shipyard.Engine
+		container   *citadel.Container
+		runOp       *shipyard.Operation
+		pullOp      *shipyard.Operation
+		serviceKey  *shipyard.ServiceKey
+		ext         *shipyard.Extension
+		webhookKey  *dockerhub.WebhookKey
+		joinToken   *shipyard.JoinToken
+		channel     *shipyard.NotificationChannel
+		expectError = func(format string, args ...interface{}) error { return fmt.Errorf(format, args...) }
+	)
+	totpCode := func() string {
+		code, err := shipyard.GenerateTOTP(totpSecret, shipyard.TOTPStep(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// the calls run in order against the same controller
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"Login", func() error {
+			token, err := m.Login("admin", "shipyard", "")
+			if err == nil && token.Token == "" {
+				return expectError("expected a token")
+			}
+			return err
+		}},
+		{"SSOConfig", func() error {
+			cfg, err := m.SSOConfig()
+			if err == nil && cfg.Issuer != issuer.URL {
+				return expectError("unexpected issuer %s", cfg.Issuer)
+			}
+			return err
+		}},
+		{"SSORequest", func() (err error) {
+			ssoRequest, err = m.SSORequest()
+			return err
+		}},
+		{"SSOLogin", func() error {
+			login, err := m.SSOLogin(issuer.idToken(t, ssoRequest.Nonce), ssoRequest.State)
+			if err == nil && login.Username != "jdoe" {
+				return expectError("unexpected username %s", login.Username)
+			}
+			return err
+		}},
+		{"ChangePassword", func() error { return m.ChangePassword("Secret123") }},
+		{"EnrollTOTP", func() error {
+			enrollment, err := m.EnrollTOTP()
+			if err == nil {
+				totpSecret = enrollment.Secret
+			}
+			return err
+		}},
+		{"ActivateTOTP", func() error {
+			codes, err := m.ActivateTOTP(totpCode())
+			if err == nil && len(codes.Codes) == 0 {
+				return expectError("expected recovery codes")
+			}
+			return err
+		}},
+		{"RegenerateRecoveryCodes", func() error { _, err := m.RegenerateRecoveryCodes(totpCode()); return err }},
+		{"DisableTOTP", func() error { return m.DisableTOTP(totpCode()) }},
+		{"AddRole", func() error { return m.AddRole(&shipyard.Role{Name: "ops"}) }},
+		{"SetRoleTOTP", func() error { return m.SetRoleTOTP("ops", true) }},
+		{"Role", func() (err error) {
+			role, err = m.Role("ops")
+			if err == nil && !role.RequireTOTP {
+				return expectError("expected ops to require two-factor authentication")
+			}
+			return err
+		}},
+		{"Roles", func() error {
+			roles, err := m.Roles()
+			if err == nil && len(roles) != 3 {
+				return expectError("expected 3 roles; received %d", len(roles))
+			}
+			return err
+		}},
+		{"AddAccount", func() error {
+			return m.AddAccount(&shipyard.Account{Username: "test", Password: "Secret123", Role: &shipyard.Role{Name: "ops"}})
+		}},
+		{"Accounts", func() error {
+			accounts, err := m.Accounts()
+			if err == nil && len(accounts) != 3 {
+				return expectError("expected admin, jdoe and test; received %d accounts", len(accounts))
+			}
+			return err
+		}},
+		{"ResetTOTP", func() error { return m.ResetTOTP("test") }},
+		{"DeleteAccount", func() error { return m.DeleteAccount(&shipyard.Account{Username: "test"}) }},
+		{"DeleteRole", func() error { return m.DeleteRole(role) }},
+		{"Engines", func() error {
+			engines, err := m.Engines()
+			if err != nil {
+				return err
+			}
+			if len(engines) != 2 {
+				return expectError("expected 2 engines; received %d", len(engines))
+			}
+			engine = engines[0]
+			if engine.SSLKey != "" {
+				return expectError("expected the engine key to be redacted")
+			}
+			return nil
+		}},
+		{"GetEngine", func() error {
+			e, err := m.GetEngine(engine.ID)
+			if err == nil && e.Engine.Addr != "tcp://10.0.0.1:2375" {
+				return expectError("unexpected engine %+v", e.Engine)
+			}
+			return err
+		}},
+		{"RotateEngineCertificates", func() error {
+			return m.RotateEngineCertificates(engine.ID, &shipyard.EngineCertificates{SSLCertificate: "cert", SSLKey: "key"})
+		}},
+		{"EngineHealth", func() error { _, err := m.EngineHealth(engine.ID, "1h"); return err }},
+		{"AddEngine", func() error {
+			if err := m.AddEngine(&shipyard.Engine{Engine: &citadel.Engine{ID: "local-03", Addr: "tcp://10.0.0.3:2375", Cpus: 1, Memory: 1024}}); err != nil {
+				return err
+			}
+			events, _, _ := c.QueryEvents(&shipyard.EventQuery{Type: "add-engine"})
+			if len(events) != 1 || events[0].Actor != "admin" {
+				return expectError("expected an add-engine event by admin; received %+v", events)
+			}
+			return nil
+		}},
+		{"RemoveEngine", func() error {
+			for _, e := range c.Engines() {
+				if e.Engine.ID == "local-03" {
+					return m.RemoveEngine(e)
+				}
+			}
+			return expectError("engine local-03 was not added")
+		}},
+		{"Info", func() error {
+			info, err := m.Info()
+			if err == nil && info.EngineCount != 2 {
+				return expectError("expected 2 engines; received %d", info.EngineCount)
+			}
+			return err
+		}},
+		{"Controllers", func() error { _, err := m.Controllers(); return err }},
+		{"Containers", func() error {
+			containers, err := m.Containers()
+			if err != nil {
+				return err
+			}
+			if len(containers) != 1 {
+				return expectError("expected 1 container; received %d", len(containers))
+			}
+			container = containers[0]
+			return nil
+		}},
+		{"Container", func() error { _, err := m.Container(container.ID); return err }},
+		{"GetContainer", func() error { _, err := m.GetContainer(container.ID[:12]); return err }},
+		{"Logs", func() error {
+			rc, err := m.Logs(container, true, true)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			logs, err := ioutil.ReadAll(rc)
+			if err == nil && string(logs) != "DB_PASSWORD=********\n" {
+				return expectError("expected the secret to be redacted; received %q", logs)
+			}
+			return err
+		}},
+		{"Stop", func() error { return m.Stop(container) }},
+		{"Restart", func() error { return m.Restart(container) }},
+		{"Run", func() error {
+			containers, err := m.Run(&citadel.Image{Name: "redis"}, 1, false)
+			if err == nil && len(containers) != 1 {
+				return expectError("expected 1 container; received %d", len(containers))
+			}
+			return err
+		}},
+		{"RunAsync", func() (err error) {
+			runOp, err = m.RunAsync(&citadel.Image{Name: "redis"}, 3, true, true)
+			return err
+		}},
+		{"WatchOperation", func() error {
+			updates := 0
+			op, err := m.WatchOperation(runOp.ID, func(op *shipyard.Operation) { updates++ })
+			if err == nil && (updates == 0 || op.Status != shipyard.OperationSucceeded || op.Completed != 3) {
+				return expectError("expected updates and 3 completed; received %d %+v", updates, op)
+			}
+			return err
+		}},
+		{"Scale", func() error { return m.Scale(container, 2) }},
+		{"ScaleAsync", func() error { _, err := m.ScaleAsync(container, 1); return err }},
+		{"Destroy", func() error { return m.Destroy(container) }},
+		{"PullImage", func() (err error) {
+			pullOp, err = m.PullImage("nginx:latest")
+			return err
+		}},
+		{"Operation", func() error {
+			op, err := m.Operation(pullOp.ID)
+			if err == nil && op.Type != "pull" {
+				return expectError("unexpected operation %+v", op)
+			}
+			return err
+		}},
+		{"Operations", func() error {
+			ops, err := m.Operations()
+			if err == nil && len(ops) < 3 {
+				return expectError("expected at least 3 operations; received %d", len(ops))
+			}
+			return err
+		}},
+		{"CancelOperation", func() error { return m.CancelOperation(pullOp.ID) }},
+		{"Events", func() error { _, err := m.Events(); return err }},
+		{"QueryEvents", func() error {
+			events, _, err := m.QueryEvents(&shipyard.EventQuery{Type: "start", Limit: 10})
+			if err == nil && len(events) != 1 {
+				return expectError("expected 1 start event; received %d", len(events))
+			}
+			return err
+		}},
+		{"ExportEvents", func() error {
+			rc, err := m.ExportEvents(&shipyard.EventQuery{Engine: "local-01"})
+			if err == nil {
+				rc.Close()
+			}
+			return err
+		}},
+		{"PurgeEvents", func() error { return m.PurgeEvents() }},
+		{"AuditRecords", func() error { _, err := m.AuditRecords("admin", 10); return err }},
+		{"ExportAudit", func() error {
+			rc, err := m.ExportAudit()
+			if err == nil {
+				rc.Close()
+			}
+			return err
+		}},
+		{"VerifyAudit", func() error { _, err := m.VerifyAudit(); return err }},
+		{"SaveSecret", func() error { return m.SaveSecret(&shipyard.Secret{Name: "db/password", Value: "s3cret"}) }},
+		{"Secrets", func() error {
+			secrets, err := m.Secrets()
+			if err == nil && (len(secrets) != 1 || secrets[0].Value != "") {
+				return expectError("expected 1 secret without a value; received %+v", secrets)
+			}
+			return err
+		}},
+		{"DeleteSecret", func() error { return m.DeleteSecret("db/password") }},
+		{"NewServiceKey", func() (err error) {
+			serviceKey, err = m.NewServiceKey(&shipyard.ServiceKey{Description: "ci", Images: []string{"nginx"}})
+			return err
+		}},
+		{"ServiceKeys", func() error { _, err := m.ServiceKeys(); return err }},
+		{"RemoveServiceKey", func() error { return m.RemoveServiceKey(serviceKey) }},
+		{"AddExtension", func() error { return m.AddExtension(&shipyard.Extension{Name: "ext", Image: "ext"}) }},
+		{"Extensions", func() error {
+			exts, err := m.Extensions()
+			if err == nil && len(exts) == 1 {
+				ext = exts[0]
+			} else if err == nil {
+				return expectError("expected 1 extension; received %d", len(exts))
+			}
+			return err
+		}},
+		{"Extension", func() error { _, err := m.Extension(ext.ID); return err }},
+		{"RemoveExtension", func() error { return m.RemoveExtension(ext.ID) }},
+		{"NewWebhookKey", func() (err error) {
+			webhookKey, err = m.NewWebhookKey("nginx")
+			return err
+		}},
+		{"WebhookKeys", func() error { _, err := m.WebhookKeys(); return err }},
+		{"WebhookKey", func() error { _, err := m.WebhookKey(webhookKey.Key); return err }},
+		{"RemoveWebhookKey", func() error { return m.RemoveWebhookKey(webhookKey.Key) }},
+		{"NewJoinToken", func() (err error) {
+			joinToken, err = m.NewJoinToken(&shipyard.JoinToken{Labels: []string{"zone-a"}, TTL: 3600})
+			return err
+		}},
+		{"JoinTokens", func() error { _, err := m.JoinTokens(); return err }},
+		{"Join", func() error {
+			e, err := m.Join(&shipyard.JoinRequest{
+				Token:  joinToken.Token,
+				Engine: &shipyard.Engine{Engine: &citadel.Engine{ID: "node-1", Addr: "tcp://10.0.0.4:2375", Cpus: 2, Memory: 2048}},
+			})
+			if err == nil && (len(e.Engine.Labels) != 1 || e.Engine.Labels[0] != "zone-a") {
+				return expectError("expected the token labels; received %v", e.Engine.Labels)
+			}
+			return err
+		}},
+		{"RemoveJoinToken", func() error { return m.RemoveJoinToken(joinToken.ID) }},
+		{"AddNotificationChannel", func() (err error) {
+			channel, err = m.AddNotificationChannel(&shipyard.NotificationChannel{
+				Name:  "oncall",
+				Type:  shipyard.NotificationSlack,
+				URL:   "https://hooks.slack.com/services/x",
+				Rules: []*shipyard.NotificationRule{{Types: []string{"engine-down"}}},
+			})
+			return err
+		}},
+		{"NotificationChannels", func() error { _, err := m.NotificationChannels(); return err }},
+		{"UpdateNotificationChannel", func() error {
+			channel.Disabled = true
+			return m.UpdateNotificationChannel(channel)
+		}},
+		{"TestNotificationChannel", func() error { _, err := m.TestNotificationChannel(channel.ID); return err }},
+		{"NotificationDeliveries", func() error {
+			deliveries, err := m.NotificationDeliveries(channel.ID)
+			if err == nil && len(deliveries) != 1 {
+				return expectError("expected 1 delivery; received %d", len(deliveries))
+			}
+			return err
+		}},
+		{"RemoveNotificationChannel", func() error { return m.RemoveNotificationChannel(channel.ID) }},
+	}
+
+	// every exported client method must be exercised
+	covered := map[string]bool{}
+	for _, c := range calls {
+		covered[c.name] = true
+	}
+	mt := reflect.TypeOf(m)
+	for i := 0; i < mt.NumMethod(); i++ {
+		if !covered[mt.Method(i).Name] {
+			t.Errorf("client method %s is not covered by the conformance test", mt.Method(i).Name)
+		}
+	}
+	for _, c := range calls {
+		if err := c.call(); err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+	}
+}
@@ -13,6 +13,10 @@
                 templateUrl: 'templates/login.html',
                 controller: 'LoginController'
             });
+            $routeProvider.when('/sso', {
+                template: "",
+                controller: 'SSOController'
+            });
             $routeProvider.when('/logout', {
                 template: "",
                 controller: 'LogoutController'
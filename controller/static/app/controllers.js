@@ -1,18 +1,41 @@
 'use strict';
 
 angular.module('shipyard.controllers', ['ngCookies'])
-        .controller('LoginController', function($scope, $cookieStore, $window, flash, Login, authtoken) {
+        .controller('LoginController', function($scope, $cookieStore, $window, $location, flash, Login, SSOConfig, authtoken) {
             $scope.template = 'templates/login.html';
+            $scope.ssoEnabled = false;
+            SSOConfig.query().$promise.then(function() {
+                $scope.ssoEnabled = true;
+            });
+            if ($location.search().error) {
+                flash.error = $location.search().error;
+            }
             $scope.login = function() {
-                Login.login({username: $scope.username, password: $scope.password}).$promise.then(function(data){
+                Login.login({username: $scope.username, password: $scope.password, code: $scope.code}).$promise.then(function(data){
+                    if (data.totp_required) {
+                        $scope.totpRequired = true;
+                        return;
+                    }
                     authtoken.save($scope.username, data.auth_token);
                     $window.location.href = '/#/dashboard';
                     $window.location.reload();
                 }, function() {
-                    flash.error = 'invalid username/password';
+                    flash.error = $scope.totpRequired ? 'invalid code' : 'invalid username/password';
                 });
             }
         })
+        .controller('SSOController', function($scope, $window, $location, authtoken) {
+            // the callback passes the token in the url fragment; replace
+            // the location so it does not stay in the browser history
+            var params = $location.search();
+            if (params.username && params.token) {
+                authtoken.save(params.username, params.token);
+                $window.location.replace('/#/dashboard');
+            } else {
+                $window.location.replace('/#/login');
+            }
+            $window.location.reload();
+        })
         .controller('LogoutController', function($scope, $window, authtoken) {
             authtoken.delete();
             $window.location.href = '/#/login';
@@ -16,6 +16,8 @@
         $scope.ssl_cert = "";
         $scope.ssl_key = "";
         $scope.ca_cert = "";
+        $scope.server_name = "";
+        $scope.insecure = false;
         $scope.addEngine = function() {
             var valid = $(".ui.form").form('validate form');
             if (!valid) {
@@ -31,7 +33,9 @@
                 },
                 ssl_cert: $scope.ssl_cert,
                 ssl_key: $scope.ssl_key,
-                ca_cert: $scope.ca_cert
+                ca_cert: $scope.ca_cert,
+                server_name: $scope.server_name,
+                insecure: $scope.insecure
             };
             Engines.save({}, params).$promise.then(function(c){
                 $location.path("/engines");
@@ -7,6 +7,11 @@ angular.module('shipyard.services', ['ngResource', 'ngRoute'])
             'login': { method: 'POST', isArray: false }
         });
     })
+    .factory('SSOConfig', function($resource) {
+        return $resource('/auth/sso/config', [], {
+            query: { isArray: false }
+        });
+    })
     .factory('ClusterInfo', function($resource) {
         return $resource('/api/cluster/info', [], {
             query: { isArray: false }
@@ -3,7 +3,10 @@ package shipyard
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
 	"strings"
@@ -14,12 +17,53 @@ import (
 
 const (
 	httpTimeout = time.Duration(1 * time.Second)
+	// memoryTolerance is how far the configured memory may be from the
+	// memory reported by docker, which excludes memory reserved by the
+	// kernel
+	memoryTolerance = 0.1
+)
+
+var (
+	ErrInvalidCACertificate = errors.New("unable to parse ca certificate")
+)
+
+const (
+	EngineHealthUp   = "up"
+	EngineHealthDown = "down"
 )
 
 type (
 	Health struct {
 		Status       string `json:"status,omitempty" gorethink:"status,omitempty"`
 		ResponseTime int64  `json:"response_time,omitempty" gorethink:"response_time,omitempty"`
+		// Error is the reason the last check failed, such as a tls
+		// verification failure
+		Error string `json:"error,omitempty" gorethink:"error,omitempty"`
+		// Since is when the engine last went up or down
+		Since *time.Time `json:"since,omitempty" gorethink:"since,omitempty"`
+		// Flapping is set while the engine goes up and down repeatedly
+		Flapping bool `json:"flapping,omitempty" gorethink:"flapping,omitempty"`
+	}
+
+	// HealthCheck is the result of one health check of an engine
+	HealthCheck struct {
+		EngineID     string    `json:"engine_id" gorethink:"engine_id"`
+		Time         time.Time `json:"time" gorethink:"time"`
+		Status       string    `json:"status" gorethink:"status"`
+		ResponseTime int64     `json:"response_time,omitempty" gorethink:"response_time,omitempty"`
+		Error        string    `json:"error,omitempty" gorethink:"error,omitempty"`
+	}
+
+	// EngineHealthHistory summarizes the health checks of an engine since
+	// a point in time.  Uptime is the percentage of checks that found the
+	// engine up.
+	EngineHealthHistory struct {
+		EngineID    string         `json:"engine_id"`
+		Health      *Health        `json:"health"`
+		Since       time.Time      `json:"since"`
+		Uptime      float64        `json:"uptime"`
+		Transitions int            `json:"transitions"`
+		Checks      []*HealthCheck `json:"checks"`
 	}
 
 	Engine struct {
@@ -30,6 +74,34 @@ type (
 		Engine         *citadel.Engine `json:"engine,omitempty" gorethink:"engine,omitempty"`
 		Health         *Health         `json:"health,omitempty" gorethink:"health,omitempty"`
 		DockerVersion  string          `json:"docker_version,omitempty"`
+		// ServerName overrides the name verified in the engine certificate
+		// i.e. when the engine is addressed by ip
+		ServerName string `json:"server_name,omitempty" gorethink:"server_name,omitempty"`
+		// Insecure disables verification of the engine certificate
+		Insecure bool `json:"insecure,omitempty" gorethink:"insecure,omitempty"`
+		// CertificateExpires is only set in api responses
+		CertificateExpires *time.Time `json:"cert_expires,omitempty" gorethink:"-"`
+		// Inventory is the host as last reported by docker
+		Inventory *EngineInventory `json:"inventory,omitempty" gorethink:"inventory,omitempty"`
+	}
+
+	// EngineInventory is the capacity and platform of an engine host as
+	// reported by docker /info.  Memory is in MB like Engine.Memory.
+	EngineInventory struct {
+		Cpus            float64   `json:"cpus" gorethink:"cpus"`
+		Memory          float64   `json:"memory" gorethink:"memory"`
+		KernelVersion   string    `json:"kernel_version,omitempty" gorethink:"kernel_version,omitempty"`
+		OperatingSystem string    `json:"operating_system,omitempty" gorethink:"operating_system,omitempty"`
+		StorageDriver   string    `json:"storage_driver,omitempty" gorethink:"storage_driver,omitempty"`
+		DockerRootDir   string    `json:"docker_root_dir,omitempty" gorethink:"docker_root_dir,omitempty"`
+		Updated         time.Time `json:"updated" gorethink:"updated"`
+	}
+
+	// EngineCertificates replaces the tls client certificate of an engine
+	EngineCertificates struct {
+		SSLCertificate string `json:"ssl_cert,omitempty"`
+		SSLKey         string `json:"ssl_key,omitempty"`
+		CACertificate  string `json:"ca_cert,omitempty"`
 	}
 )
 
@@ -46,6 +118,98 @@ func (e *Engine) Certificate() (*tls.Certificate, error) {
 	return &cert, err
 }
 
+// CertificateNotAfter returns the expiry of the client certificate
+func (e *Engine) CertificateNotAfter() (time.Time, bool) {
+	block, _ := pem.Decode([]byte(e.SSLCertificate))
+	if block == nil {
+		return time.Time{}, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return cert.NotAfter, true
+}
+
+// Redacted returns a copy of the engine without the private key for api
+// responses
+func (e *Engine) Redacted() *Engine {
+	c := *e
+	c.SSLKey = ""
+	if t, ok := e.CertificateNotAfter(); ok {
+		c.CertificateExpires = &t
+	}
+	return &c
+}
+
+// NewEngineHealthHistory computes the uptime and the number of up and down
+// transitions from checks in time order
+func NewEngineHealthHistory(engineID string, health *Health, since time.Time, checks []*HealthCheck) *EngineHealthHistory {
+	h := &EngineHealthHistory{
+		EngineID: engineID,
+		Health:   health,
+		Since:    since,
+		Checks:   checks,
+	}
+	if len(checks) == 0 {
+		return h
+	}
+	up := 0
+	for i, c := range checks {
+		if c.Status == EngineHealthUp {
+			up++
+		}
+		if i > 0 && c.Status != checks[i-1].Status {
+			h.Transitions++
+		}
+	}
+	h.Uptime = float64(up) / float64(len(checks)) * 100
+	return h
+}
+
+// CapacityMismatches describes where the configured cpus and memory
+// disagree with the inventory.  The scheduler uses the configured values,
+// so a mismatch over or under commits the engine.
+func (e *Engine) CapacityMismatches() []string {
+	mismatches := []string{}
+	if e.Inventory == nil || e.Engine == nil {
+		return mismatches
+	}
+	inv := e.Inventory
+	if inv.Cpus > 0 && e.Engine.Cpus != inv.Cpus {
+		mismatches = append(mismatches, fmt.Sprintf("configured cpus %.2f but docker reports %.0f", e.Engine.Cpus, inv.Cpus))
+	}
+	if inv.Memory > 0 && math.Abs(e.Engine.Memory-inv.Memory) > inv.Memory*memoryTolerance {
+		mismatches = append(mismatches, fmt.Sprintf("configured memory %.0f MB but docker reports %.0f MB", e.Engine.Memory, inv.Memory))
+	}
+	return mismatches
+}
+
+// TLSConfig returns the client tls configuration for the engine.  The
+// engine certificate is verified against the CA certificate, or the
+// system roots without one, unless the engine is explicitly insecure.
+func (e *Engine) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         e.ServerName,
+		InsecureSkipVerify: e.Insecure,
+	}
+	cert, err := e.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+	if e.CACertificate != "" {
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM([]byte(e.CACertificate)) {
+			return nil, ErrInvalidCACertificate
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	return tlsConfig, nil
+}
+
 func (e *Engine) Ping() (int, error) {
 	status := 0
 	addr := e.Engine.Addr
@@ -53,24 +217,12 @@ func (e *Engine) Ping() (int, error) {
 
 	// check for https
 	if strings.Index(addr, "https") != -1 {
-		cert, err := e.Certificate()
+		c, err := e.TLSConfig()
 		if err != nil {
 			return 0, err
 		}
-
-		tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{*cert},
-		}
-
-		// use custom ca cert if specified
-		if e.CACertificate != "" {
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM([]byte(e.CACertificate))
-			tlsConfig.RootCAs = caCertPool
-		}
+		tlsConfig = c
 	}
-	// allow insecure
-	tlsConfig.InsecureSkipVerify = true
 
 	transport := http.Transport{
 		Dial:            dialTimeout,
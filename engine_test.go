@@ -0,0 +1,92 @@
+package shipyard
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/citadel/citadel"
+)
+
+func testCertificate(t *testing.T, notAfter time.Time) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "shipyard"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestEngineRedacted(t *testing.T) {
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	e := &Engine{
+		SSLCertificate: testCertificate(t, notAfter),
+		SSLKey:         "PRIVATE KEY",
+	}
+	r := e.Redacted()
+	if r.SSLKey != "" {
+		t.Error("expected private key to be removed")
+	}
+	if e.SSLKey == "" {
+		t.Error("expected original engine to keep its key")
+	}
+	if r.CertificateExpires == nil || !r.CertificateExpires.Equal(notAfter) {
+		t.Errorf("expected certificate expiry %s; received %v", notAfter, r.CertificateExpires)
+	}
+	if _, ok := (&Engine{}).CertificateNotAfter(); ok {
+		t.Error("expected no expiry without a certificate")
+	}
+}
+
+func TestEngineCapacityMismatches(t *testing.T) {
+	e := &Engine{
+		Engine:    &citadel.Engine{Cpus: 4, Memory: 4096},
+		Inventory: &EngineInventory{Cpus: 4, Memory: 3900},
+	}
+	if m := e.CapacityMismatches(); len(m) != 0 {
+		t.Errorf("expected memory within tolerance to match; received %v", m)
+	}
+	e.Engine.Cpus = 40
+	e.Engine.Memory = 40960
+	if m := e.CapacityMismatches(); len(m) != 2 {
+		t.Errorf("expected cpus and memory mismatches; received %v", m)
+	}
+	e.Inventory = nil
+	if m := e.CapacityMismatches(); len(m) != 0 {
+		t.Errorf("expected no mismatches without an inventory; received %v", m)
+	}
+}
+
+func TestNewEngineHealthHistory(t *testing.T) {
+	now := time.Now()
+	checks := []*HealthCheck{
+		{Time: now, Status: EngineHealthUp},
+		{Time: now.Add(time.Second * 10), Status: EngineHealthDown},
+		{Time: now.Add(time.Second * 20), Status: EngineHealthUp},
+		{Time: now.Add(time.Second * 30), Status: EngineHealthUp},
+	}
+	h := NewEngineHealthHistory("e1", &Health{Status: EngineHealthUp}, now, checks)
+	if h.Uptime != 75 {
+		t.Errorf("expected 75%% uptime; received %.2f", h.Uptime)
+	}
+	if h.Transitions != 2 {
+		t.Errorf("expected 2 transitions; received %d", h.Transitions)
+	}
+	if empty := NewEngineHealthHistory("e1", nil, now, nil); empty.Uptime != 0 || empty.Transitions != 0 {
+		t.Error("expected no uptime without checks")
+	}
+}
@@ -1,16 +1,140 @@
 package shipyard
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/citadel/citadel"
 )
 
-type Event struct {
-	Type      string             `json:"type,omitempty"`
-	Container *citadel.Container `json:"container,omitempty"`
-	Engine    *citadel.Engine    `json:"engine,omitempty"`
-	Time      time.Time          `json:"time,omitempty"`
-	Message   string             `json:"message,omitempty"`
-	Tags      []string           `json:"tags,omitempty"`
+var (
+	ErrInvalidEventCursor = errors.New("invalid event cursor")
+)
+
+type (
+	Event struct {
+		ID        string             `json:"id,omitempty" gorethink:"id,omitempty"`
+		Type      string             `json:"type,omitempty"`
+		Container *citadel.Container `json:"container,omitempty"`
+		Engine    *citadel.Engine    `json:"engine,omitempty"`
+		Time      time.Time          `json:"time,omitempty"`
+		Message   string             `json:"message,omitempty"`
+		Tags      []string           `json:"tags,omitempty"`
+		// Actor is the account or service that caused the event, when known
+		Actor string `json:"actor,omitempty"`
+	}
+
+	// EventQuery filters events; zero values match everything.  Events are
+	// returned newest first and Cursor continues after the last event of
+	// the previous page.
+	EventQuery struct {
+		Since     time.Time
+		Until     time.Time
+		Type      string
+		Tag       string
+		Engine    string
+		Container string
+		Actor     string
+		Limit     int
+		Cursor    string
+	}
+)
+
+// NewEventCursor returns the cursor of the page after the event
+func NewEventCursor(e *Event) string {
+	return base64.URLEncoding.EncodeToString([]byte(e.Time.UTC().Format(time.RFC3339Nano) + "|" + e.ID))
+}
+
+// ParseEventCursor returns the time and id of the event of the cursor
+func ParseEventCursor(cursor string) (time.Time, string, error) {
+	b, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidEventCursor
+	}
+	parts := strings.SplitN(string(b), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", ErrInvalidEventCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", ErrInvalidEventCursor
+	}
+	return t, parts[1], nil
+}
+
+// ParseEventQuery reads a query from url parameters.  since and until are
+// RFC3339 times or durations before now (i.e. 24h).
+func ParseEventQuery(v url.Values, now time.Time) (*EventQuery, error) {
+	q := &EventQuery{
+		Type:      v.Get("type"),
+		Tag:       v.Get("tag"),
+		Engine:    v.Get("engine"),
+		Container: v.Get("container"),
+		Actor:     v.Get("actor"),
+		Cursor:    v.Get("cursor"),
+	}
+	var err error
+	if q.Since, err = parseEventTime(v.Get("since"), now); err != nil {
+		return nil, fmt.Errorf("since: %s", err)
+	}
+	if q.Until, err = parseEventTime(v.Get("until"), now); err != nil {
+		return nil, fmt.Errorf("until: %s", err)
+	}
+	if l := v.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 0 {
+			return nil, fmt.Errorf("limit must be a non-negative integer")
+		}
+	}
+	if q.Cursor != "" {
+		if _, _, err := ParseEventCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func parseEventTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("must be an RFC3339 time or a duration (i.e. 24h)")
+	}
+	return now.Add(-d), nil
+}
+
+// Values returns the url parameters of the query
+func (q *EventQuery) Values() url.Values {
+	v := url.Values{}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		v.Set("until", q.Until.Format(time.RFC3339))
+	}
+	for k, s := range map[string]string{
+		"type":      q.Type,
+		"tag":       q.Tag,
+		"engine":    q.Engine,
+		"container": q.Container,
+		"actor":     q.Actor,
+		"cursor":    q.Cursor,
+	} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
 }
@@ -0,0 +1,63 @@
+package shipyard
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventCursor(t *testing.T) {
+	e := &Event{ID: "2b6c1d1e-4b1a-4cf4-9d62-59d3c4a8a7a1", Time: time.Date(2015, 3, 1, 12, 0, 0, 123000000, time.UTC)}
+	ts, id, err := ParseEventCursor(NewEventCursor(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(e.Time) || id != e.ID {
+		t.Errorf("expected %s %s; received %s %s", e.Time, e.ID, ts, id)
+	}
+	for _, c := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "MjAxNXww"} {
+		if _, _, err := ParseEventCursor(c); err != ErrInvalidEventCursor {
+			t.Errorf("%s: expected %s; received %v", c, ErrInvalidEventCursor, err)
+		}
+	}
+}
+
+func TestParseEventQuery(t *testing.T) {
+	now := time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC)
+	v := url.Values{
+		"since":  {"24h"},
+		"until":  {"2015-03-01T18:00:00Z"},
+		"type":   {"die"},
+		"engine": {"node-1"},
+		"limit":  {"50"},
+	}
+	q, err := ParseEventQuery(v, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &EventQuery{
+		Since:  now.Add(-24 * time.Hour),
+		Until:  time.Date(2015, 3, 1, 18, 0, 0, 0, time.UTC),
+		Type:   "die",
+		Engine: "node-1",
+		Limit:  50,
+	}
+	if !reflect.DeepEqual(q, expected) {
+		t.Errorf("expected %+v; received %+v", expected, q)
+	}
+	if !reflect.DeepEqual(q.Values()["type"], []string{"die"}) || q.Values().Get("since") != "2015-03-01T00:00:00Z" {
+		t.Errorf("unexpected values %v", q.Values())
+	}
+
+	for _, bad := range []url.Values{
+		{"since": {"yesterday"}},
+		{"until": {"-1h"}},
+		{"limit": {"-1"}},
+		{"cursor": {"bad"}},
+	} {
+		if _, err := ParseEventQuery(bad, now); err == nil {
+			t.Errorf("expected %v to be invalid", bad)
+		}
+	}
+}
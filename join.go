@@ -0,0 +1,81 @@
+package shipyard
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrJoinEngineRequired = errors.New("engine id and address are required")
+	ErrJoinCapacity       = errors.New("engine cpus and memory must be greater than zero")
+	ErrJoinTrustSettings  = errors.New("the ca certificate, server name and verification of joined engines are set by the join token")
+)
+
+type (
+	// JoinToken lets hosts register themselves as engines until it expires
+	// or has been used MaxUses times.  Joined engines get its labels.
+	JoinToken struct {
+		ID          string    `json:"id,omitempty" gorethink:"id,omitempty"`
+		Token       string    `json:"token,omitempty" gorethink:"token"`
+		Description string    `json:"description,omitempty" gorethink:"description,omitempty"`
+		Labels      []string  `json:"labels,omitempty" gorethink:"labels,omitempty"`
+		Expires     time.Time `json:"expires" gorethink:"expires"`
+		// MaxUses limits the number of engines that can join; 0 is unlimited
+		MaxUses int       `json:"max_uses" gorethink:"max_uses"`
+		Uses    int       `json:"uses" gorethink:"uses"`
+		Created time.Time `json:"created" gorethink:"created"`
+		// TTL sets Expires when creating a token, in seconds
+		TTL int `json:"ttl,omitempty" gorethink:"-"`
+		// CACertificate verifies the docker certificates of joined
+		// engines; the system roots are used without one
+		CACertificate string `json:"ca_cert,omitempty" gorethink:"ca_cert,omitempty"`
+		// Insecure disables verification of the docker certificates of
+		// joined engines
+		Insecure bool `json:"insecure,omitempty" gorethink:"insecure,omitempty"`
+	}
+
+	// JoinRequest is sent by the agent on a new host.  The engine address
+	// must be reachable from the controller.  The agent may send client
+	// certificates but not how the engine is verified; that comes from the
+	// token.
+	JoinRequest struct {
+		Token  string  `json:"token"`
+		Engine *Engine `json:"engine"`
+	}
+)
+
+// Expired reports whether the token can no longer be used at now
+func (t *JoinToken) Expired(now time.Time) bool {
+	return !now.Before(t.Expires)
+}
+
+// Validate checks that the request describes an engine the cluster can
+// schedule on
+func (r *JoinRequest) Validate() error {
+	if r.Engine == nil || r.Engine.Engine == nil || r.Engine.Engine.ID == "" || r.Engine.Engine.Addr == "" {
+		return ErrJoinEngineRequired
+	}
+	if r.Engine.Engine.Cpus <= 0 || r.Engine.Engine.Memory <= 0 {
+		return ErrJoinCapacity
+	}
+	if r.Engine.CACertificate != "" || r.Engine.ServerName != "" || r.Engine.Insecure {
+		return ErrJoinTrustSettings
+	}
+	return nil
+}
+
+// MergeLabels returns the labels in order without duplicates
+func MergeLabels(labels ...[]string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, l := range labels {
+		for _, label := range l {
+			if label == "" || seen[label] {
+				continue
+			}
+			seen[label] = true
+			merged = append(merged, label)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,57 @@
+package shipyard
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/citadel/citadel"
+)
+
+func TestJoinTokenExpired(t *testing.T) {
+	now := time.Now()
+	tk := &JoinToken{Expires: now.Add(time.Minute)}
+	if tk.Expired(now) {
+		t.Error("expected token to be valid before it expires")
+	}
+	if !tk.Expired(now.Add(time.Minute)) {
+		t.Error("expected token to expire")
+	}
+}
+
+func TestJoinRequestValidate(t *testing.T) {
+	valid := &JoinRequest{Engine: &Engine{Engine: &citadel.Engine{ID: "node-1", Addr: "tcp://10.0.0.1:2375", Cpus: 2, Memory: 2048}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected request to be valid; received %s", err)
+	}
+	for _, r := range []*JoinRequest{
+		{},
+		{Engine: &Engine{}},
+		{Engine: &Engine{Engine: &citadel.Engine{Addr: "tcp://10.0.0.1:2375", Cpus: 2, Memory: 2048}}},
+	} {
+		if err := r.Validate(); err != ErrJoinEngineRequired {
+			t.Errorf("expected %s; received %v", ErrJoinEngineRequired, err)
+		}
+	}
+	noMemory := &JoinRequest{Engine: &Engine{Engine: &citadel.Engine{ID: "node-1", Addr: "tcp://10.0.0.1:2375", Cpus: 2}}}
+	if err := noMemory.Validate(); err != ErrJoinCapacity {
+		t.Errorf("expected %s; received %v", ErrJoinCapacity, err)
+	}
+	for _, e := range []*Engine{
+		{CACertificate: "-----BEGIN CERTIFICATE-----"},
+		{ServerName: "docker.example.com"},
+		{Insecure: true},
+	} {
+		e.Engine = &citadel.Engine{ID: "node-1", Addr: "tcp://10.0.0.1:2376", Cpus: 2, Memory: 2048}
+		if err := (&JoinRequest{Engine: e}).Validate(); err != ErrJoinTrustSettings {
+			t.Errorf("expected %s; received %v", ErrJoinTrustSettings, err)
+		}
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	labels := MergeLabels([]string{"zone-a", "ssd"}, []string{"ssd", "", "gpu"})
+	if !reflect.DeepEqual(labels, []string{"zone-a", "ssd", "gpu"}) {
+		t.Errorf("unexpected labels %v", labels)
+	}
+}
@@ -0,0 +1,142 @@
+package logsink
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	hookQueueSize = 1024
+)
+
+// Hook forwards the entries of logrus loggers to sinks.  Entries are
+// queued and sent in the background so that logging does not wait on a
+// collector; entries are dropped while the queue is full.  Fatal and panic
+// entries are sent before Fire returns since the process exits after them.
+type Hook struct {
+	sinks   []Sink
+	queue   chan *hookEntry
+	done    chan struct{}
+	mux     sync.Mutex
+	closed  bool
+	failing []bool
+}
+
+type hookEntry struct {
+	msg *Message
+	// sent is closed once the entry has been sent when the caller waits
+	sent chan struct{}
+}
+
+func NewHook(sinks []Sink) *Hook {
+	h := &Hook{
+		sinks:   sinks,
+		queue:   make(chan *hookEntry, hookQueueSize),
+		done:    make(chan struct{}),
+		failing: make([]bool, len(sinks)),
+	}
+	go h.run()
+	return h
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.WarnLevel,
+		logrus.InfoLevel,
+		logrus.DebugLevel,
+	}
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	m := &Message{
+		Time:     entry.Time,
+		Severity: levelSeverity(entry.Level),
+		Kind:     "log",
+		Text:     entry.Message,
+		Fields:   map[string]string{},
+	}
+	for k, v := range entry.Data {
+		m.Fields[k] = fmt.Sprint(v)
+	}
+	e := &hookEntry{msg: m}
+	if entry.Level <= logrus.FatalLevel {
+		e.sent = make(chan struct{})
+	}
+	h.mux.Lock()
+	if h.closed {
+		h.mux.Unlock()
+		return nil
+	}
+	if e.sent != nil {
+		// sent after the entries queued before it
+		h.queue <- e
+	} else {
+		select {
+		case h.queue <- e:
+		default:
+		}
+	}
+	h.mux.Unlock()
+	if e.sent != nil {
+		<-e.sent
+	}
+	return nil
+}
+
+// Close sends the queued entries and closes the sinks
+func (h *Hook) Close() error {
+	h.mux.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mux.Unlock()
+	<-h.done
+
+	var err error
+	for _, s := range h.sinks {
+		if cerr := s.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (h *Hook) run() {
+	defer close(h.done)
+	for e := range h.queue {
+		for i, s := range h.sinks {
+			err := s.Send(e.msg)
+			// errors are written to stderr since logging them would queue
+			// more entries for the failing sink; only the first of a
+			// series is reported for each sink
+			if err != nil && !h.failing[i] {
+				fmt.Fprintf(os.Stderr, "unable to send log to sink: %s\n", err)
+			}
+			h.failing[i] = err != nil
+		}
+		if e.sent != nil {
+			close(e.sent)
+		}
+	}
+}
+
+func levelSeverity(l logrus.Level) int {
+	switch l {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return SeverityCritical
+	case logrus.ErrorLevel:
+		return SeverityError
+	case logrus.WarnLevel:
+		return SeverityWarning
+	case logrus.InfoLevel:
+		return SeverityInfo
+	}
+	return SeverityDebug
+}
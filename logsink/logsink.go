@@ -0,0 +1,511 @@
+package logsink
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shipyard/shipyard"
+)
+
+// syslog severities of messages
+const (
+	SeverityCritical = 2
+	SeverityError    = 3
+	SeverityWarning  = 4
+	SeverityNotice   = 5
+	SeverityInfo     = 6
+	SeverityDebug    = 7
+)
+
+const (
+	defaultTag   = "shipyard"
+	writeTimeout = 5 * time.Second
+	// gelfChunkSize keeps udp datagrams under a typical mtu
+	gelfChunkSize = 1420
+	gelfMaxChunks = 128
+	syslogSDID    = "shipyard@32473"
+	syslogTimeFmt = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var (
+	ErrGELFMessageTooLarge = errors.New("gelf message is too large to send over udp")
+
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+		"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+		"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+)
+
+type (
+	// Message is a log entry or event sent to a sink
+	Message struct {
+		Time time.Time
+		// Severity is the syslog severity from 0 (emergency) to 7 (debug)
+		Severity int
+		// Kind is "log" or "event"
+		Kind   string
+		Text   string
+		Fields map[string]string
+	}
+
+	// Sink sends messages to a log collector.  Sinks reconnect on the next
+	// message after a failure and are safe for concurrent use.
+	Sink interface {
+		Send(m *Message) error
+		Close() error
+	}
+
+	// conn is a lazily dialed connection that is redialed after an error
+	conn struct {
+		network string
+		addr    string
+		tls     *tls.Config
+		mux     sync.Mutex
+		c       net.Conn
+	}
+
+	syslogSink struct {
+		conn     *conn
+		framed   bool
+		facility int
+		host     string
+		app      string
+	}
+
+	gelfSink struct {
+		conn *conn
+		udp  bool
+		host string
+		app  string
+	}
+
+	fluentdSink struct {
+		conn *conn
+		host string
+		tag  string
+	}
+)
+
+// New returns the sink for a url:
+//
+//	syslog://host:514, syslog+tcp://host:514, syslog+tls://host:6514
+//	gelf://host:12201, gelf+tcp://host:12201
+//	fluentd://host:24224
+//
+// The tag parameter sets the syslog app name and fluentd tag prefix
+// (default shipyard), facility the syslog facility (default daemon) and
+// ca a ca certificate file for syslog over tls.
+func New(rawurl string) (Sink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("log sink %s has no host", rawurl)
+	}
+	q := u.Query()
+	tag := q.Get("tag")
+	if tag == "" {
+		tag = defaultTag
+	}
+	host, _ := os.Hostname()
+	addr := func(port string) string {
+		if _, _, err := net.SplitHostPort(u.Host); err == nil {
+			return u.Host
+		}
+		return net.JoinHostPort(u.Host, port)
+	}
+
+	switch u.Scheme {
+	case "syslog", "syslog+udp", "syslog+tcp", "syslog+tls":
+		facility := syslogFacilities["daemon"]
+		if f := q.Get("facility"); f != "" {
+			v, ok := syslogFacilities[f]
+			if !ok {
+				return nil, fmt.Errorf("unknown syslog facility %s", f)
+			}
+			facility = v
+		}
+		s := &syslogSink{facility: facility, host: host, app: tag}
+		switch u.Scheme {
+		case "syslog+tcp":
+			s.conn, s.framed = &conn{network: "tcp", addr: addr("514")}, true
+		case "syslog+tls":
+			cfg, err := tlsConfig(u.Host, q.Get("ca"))
+			if err != nil {
+				return nil, err
+			}
+			s.conn, s.framed = &conn{network: "tcp", addr: addr("6514"), tls: cfg}, true
+		default:
+			s.conn = &conn{network: "udp", addr: addr("514")}
+		}
+		return s, nil
+	case "gelf", "gelf+udp":
+		return &gelfSink{conn: &conn{network: "udp", addr: addr("12201")}, udp: true, host: host, app: tag}, nil
+	case "gelf+tcp":
+		return &gelfSink{conn: &conn{network: "tcp", addr: addr("12201")}, host: host, app: tag}, nil
+	case "fluentd", "fluentd+tcp":
+		return &fluentdSink{conn: &conn{network: "tcp", addr: addr("24224")}, host: host, tag: tag}, nil
+	}
+	return nil, fmt.Errorf("unknown log sink %s (expected syslog, gelf or fluentd)", u.Scheme)
+}
+
+// Parse returns the sinks of a comma separated list of urls
+func Parse(urls string) ([]Sink, error) {
+	sinks := []Sink{}
+	for _, u := range strings.Split(urls, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		s, err := New(u)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func tlsConfig(host string, caPath string) (*tls.Config, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	cfg := &tls.Config{ServerName: host}
+	if caPath == "" {
+		return cfg, nil
+	}
+	ca, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", caPath)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// EventMessage returns the message for a shipyard event
+func EventMessage(e *shipyard.Event) *Message {
+	m := &Message{
+		Time:     e.Time,
+		Severity: SeverityNotice,
+		Kind:     "event",
+		Text:     e.Message,
+		Fields: map[string]string{
+			"type": e.Type,
+		},
+	}
+	if m.Text == "" {
+		m.Text = e.Type
+	}
+	if e.ID != "" {
+		m.Fields["event_id"] = e.ID
+	}
+	if len(e.Tags) > 0 {
+		m.Fields["tags"] = strings.Join(e.Tags, ",")
+	}
+	if e.Engine != nil && e.Engine.ID != "" {
+		m.Fields["engine"] = e.Engine.ID
+	}
+	if e.Container != nil && e.Container.ID != "" {
+		m.Fields["container"] = e.Container.ID
+	}
+	if e.Actor != "" {
+		m.Fields["actor"] = e.Actor
+	}
+	return m
+}
+
+func (c *conn) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: writeTimeout}
+	if c.tls != nil {
+		return tls.DialWithDialer(d, c.network, c.addr, c.tls)
+	}
+	return d.Dial(c.network, c.addr)
+}
+
+// write sends the packets, redialing once if the connection was closed
+// by the collector since the last message
+func (c *conn) write(packets ...[]byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for attempt := 0; ; attempt++ {
+		if c.c == nil {
+			nc, err := c.dial()
+			if err != nil {
+				return err
+			}
+			c.c = nc
+		}
+		err := c.send(packets)
+		if err == nil {
+			return nil
+		}
+		c.c.Close()
+		c.c = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (c *conn) send(packets [][]byte) error {
+	c.c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	for _, p := range packets {
+		if _, err := c.c.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.c == nil {
+		return nil
+	}
+	err := c.c.Close()
+	c.c = nil
+	return err
+}
+
+func (s *syslogSink) Send(m *Message) error {
+	return s.conn.write(s.format(m))
+}
+
+func (s *syslogSink) Close() error {
+	return s.conn.Close()
+}
+
+// format returns the RFC5424 message, with octet counting framing for
+// stream transports (RFC6587)
+func (s *syslogSink) format(m *Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
+		s.facility*8+severity(m.Severity),
+		m.Time.Format(syslogTimeFmt),
+		syslogName(s.host, 255),
+		syslogName(s.app, 48),
+		os.Getpid(),
+		syslogName(m.Kind, 32),
+	)
+	if len(m.Fields) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + syslogSDID)
+		for _, k := range sortedKeys(m.Fields) {
+			fmt.Fprintf(&b, ` %s="%s"`, syslogParamName(k), syslogParamValue(m.Fields[k]))
+		}
+		b.WriteString("]")
+	}
+	if m.Text != "" {
+		b.WriteString(" " + m.Text)
+	}
+	if !s.framed {
+		return b.Bytes()
+	}
+	return append([]byte(strconv.Itoa(b.Len())+" "), b.Bytes()...)
+}
+
+func severity(s int) int {
+	if s < 0 || s > 7 {
+		return SeverityInfo
+	}
+	return s
+}
+
+// syslogName returns s as printable ascii without spaces, or the nil
+// value for an empty string
+func syslogName(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+func syslogParamName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, syslogName(s, 32))
+}
+
+func syslogParamValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+func (s *gelfSink) Send(m *Message) error {
+	b, err := s.format(m)
+	if err != nil {
+		return err
+	}
+	if !s.udp {
+		return s.conn.write(append(b, 0))
+	}
+	chunks, err := gelfChunks(b)
+	if err != nil {
+		return err
+	}
+	return s.conn.write(chunks...)
+}
+
+func (s *gelfSink) Close() error {
+	return s.conn.Close()
+}
+
+// format returns the GELF 1.1 message; fields are additional fields
+func (s *gelfSink) format(m *Message) ([]byte, error) {
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          s.host,
+		"short_message": m.Text,
+		"timestamp":     float64(m.Time.UnixNano()/int64(time.Millisecond)) / 1000,
+		"level":         severity(m.Severity),
+		"_app":          s.app,
+		"_kind":         m.Kind,
+	}
+	if m.Text == "" {
+		msg["short_message"] = "-"
+	}
+	for k, v := range m.Fields {
+		// _id is reserved by graylog
+		if k == "id" {
+			k = "id_"
+		}
+		msg["_"+k] = v
+	}
+	return json.Marshal(msg)
+}
+
+// gelfChunks splits a message into udp datagrams
+func gelfChunks(b []byte) ([][]byte, error) {
+	if len(b) <= gelfChunkSize {
+		return [][]byte{b}, nil
+	}
+	const header = 12
+	size := gelfChunkSize - header
+	count := (len(b) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, ErrGELFMessageTooLarge
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	chunks := [][]byte{}
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(b) {
+			end = len(b)
+		}
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, b[i*size:end]...))
+	}
+	return chunks, nil
+}
+
+func (s *fluentdSink) Send(m *Message) error {
+	return s.conn.write(s.format(m))
+}
+
+func (s *fluentdSink) Close() error {
+	return s.conn.Close()
+}
+
+// format returns the forward protocol message [tag, time, record] where
+// the tag is the prefix and the kind of the message (i.e. shipyard.event)
+func (s *fluentdSink) format(m *Message) []byte {
+	record := map[string]string{}
+	for k, v := range m.Fields {
+		record[k] = v
+	}
+	record["message"] = m.Text
+	record["host"] = s.host
+	record["severity"] = strconv.Itoa(severity(m.Severity))
+
+	var b bytes.Buffer
+	b.WriteByte(0x93)
+	msgpackString(&b, s.tag+"."+m.Kind)
+	b.WriteByte(0xd3)
+	binary.Write(&b, binary.BigEndian, m.Time.Unix())
+	keys := sortedKeys(record)
+	msgpackMapHeader(&b, len(keys))
+	for _, k := range keys {
+		msgpackString(&b, k)
+		msgpackString(&b, record[k])
+	}
+	return b.Bytes()
+}
+
+func msgpackString(b *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		b.WriteByte(0xa0 | byte(n))
+	case n < 1<<8:
+		b.WriteByte(0xd9)
+		b.WriteByte(byte(n))
+	case n < 1<<16:
+		b.WriteByte(0xda)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdb)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+	b.WriteString(s)
+}
+
+func msgpackMapHeader(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x80 | byte(n))
+	case n < 1<<16:
+		b.WriteByte(0xde)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdf)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
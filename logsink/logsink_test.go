@@ -0,0 +1,405 @@
+package logsink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/citadel/citadel"
+	"github.com/shipyard/shipyard"
+)
+
+func testMessage() *Message {
+	return EventMessage(&shipyard.Event{
+		ID:      "e1",
+		Type:    "die",
+		Time:    time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC),
+		Message: `exit code 137 "oom"`,
+		Engine:  &citadel.Engine{ID: "node-1"},
+		Tags:    []string{"docker"},
+	})
+}
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+func readUDP(t *testing.T, c *net.UDPConn) []byte {
+	b := make([]byte, 65536)
+	n, err := c.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b[:n]
+}
+
+// acceptTCP returns the first connection to a local listener
+func acceptTCP(t *testing.T) (string, <-chan net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan net.Conn, 1)
+	go func() {
+		defer ln.Close()
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		conns <- c
+	}()
+	return ln.Addr().String(), conns
+}
+
+func newSink(t *testing.T, rawurl string) Sink {
+	s, err := New(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{
+		"kafka://127.0.0.1:9092",
+		"syslog:///var/run/syslog",
+		"syslog://127.0.0.1?facility=mainframe",
+	} {
+		if _, err := New(u); err == nil {
+			t.Errorf("expected an error for %s", u)
+		}
+	}
+	sinks, err := Parse("syslog://127.0.0.1, gelf+tcp://127.0.0.1:12201,fluentd://127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sinks) != 3 {
+		t.Fatalf("expected 3 sinks; received %d", len(sinks))
+	}
+	if addr := sinks[0].(*syslogSink).conn.addr; addr != "127.0.0.1:514" {
+		t.Errorf("expected the default syslog port; received %s", addr)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	l := listenUDP(t)
+	defer l.Close()
+	s := newSink(t, fmt.Sprintf("syslog://%s?tag=controller&facility=local0", l.LocalAddr()))
+	defer s.Close()
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	msg := string(readUDP(t, l))
+
+	// local0 (16) * 8 + notice (5)
+	if !strings.HasPrefix(msg, "<133>1 2015-03-01T12:00:00.000000Z ") {
+		t.Errorf("unexpected header: %s", msg)
+	}
+	if fields := strings.Fields(msg); len(fields) < 6 || fields[3] != "controller" || fields[5] != "event" {
+		t.Errorf("expected app name and msgid: %s", msg)
+	}
+	if !strings.HasSuffix(msg, ` [shipyard@32473 engine="node-1" event_id="e1" tags="docker" type="die"] exit code 137 "oom"`) {
+		t.Errorf("unexpected structured data or message: %s", msg)
+	}
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	addr, conns := acceptTCP(t)
+	s := newSink(t, "syslog+tcp://"+addr)
+	defer s.Close()
+	m := &Message{Time: time.Now(), Severity: SeverityError, Kind: "log", Text: "first"}
+	if err := s.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	m.Text = "second"
+	if err := s.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	c := <-conns
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for _, expected := range []string{"first", "second"} {
+		l, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(l))
+		if err != nil {
+			t.Fatalf("expected an octet count; received %q", l)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(b), "<27>1 ") || !strings.HasSuffix(string(b), " - "+expected) {
+			t.Errorf("unexpected message %q", b)
+		}
+	}
+}
+
+func TestGELFUDP(t *testing.T) {
+	l := listenUDP(t)
+	defer l.Close()
+	s := newSink(t, "gelf://"+l.LocalAddr().String())
+	defer s.Close()
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(readUDP(t, l), &msg); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]interface{}{
+		"version":       "1.1",
+		"short_message": `exit code 137 "oom"`,
+		"timestamp":     float64(1425211200),
+		"level":         float64(SeverityNotice),
+		"_engine":       "node-1",
+		"_kind":         "event",
+	} {
+		if msg[k] != v {
+			t.Errorf("expected %s %v; received %v", k, v, msg[k])
+		}
+	}
+}
+
+func TestGELFChunks(t *testing.T) {
+	l := listenUDP(t)
+	defer l.Close()
+	s := newSink(t, "gelf+udp://"+l.LocalAddr().String())
+	defer s.Close()
+	m := testMessage()
+	m.Text = strings.Repeat("x", 3*gelfChunkSize)
+	if err := s.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	var id []byte
+	for i := 0; i < 4; i++ {
+		chunk := readUDP(t, l)
+		if chunk[0] != 0x1e || chunk[1] != 0x0f || int(chunk[10]) != i || chunk[11] != 4 {
+			t.Fatalf("unexpected chunk header % x", chunk[:12])
+		}
+		if id != nil && !bytes.Equal(id, chunk[2:10]) {
+			t.Fatal("expected the same message id in every chunk")
+		}
+		id = chunk[2:10]
+		body.Write(chunk[12:])
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["short_message"] != m.Text {
+		t.Error("expected the chunks to reassemble the message")
+	}
+
+	m.Text = strings.Repeat("x", gelfMaxChunks*gelfChunkSize)
+	if err := s.Send(m); err != ErrGELFMessageTooLarge {
+		t.Errorf("expected %s; received %v", ErrGELFMessageTooLarge, err)
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	addr, conns := acceptTCP(t)
+	s := newSink(t, "gelf+tcp://"+addr)
+	defer s.Close()
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	c := <-conns
+	defer c.Close()
+	b, err := bufio.NewReader(c).ReadBytes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(b[:len(b)-1], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["_type"] != "die" {
+		t.Errorf("unexpected message %v", msg)
+	}
+}
+
+// readMsgpack decodes the subset of msgpack written by the fluentd sink
+func readMsgpack(r *bufio.Reader) (interface{}, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readString := func(n int) (interface{}, error) {
+		s := make([]byte, n)
+		_, err := io.ReadFull(r, s)
+		return string(s), err
+	}
+	switch {
+	case b&0xf0 == 0x90:
+		a := []interface{}{}
+		for i := 0; i < int(b&0x0f); i++ {
+			v, err := readMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case b&0xf0 == 0x80:
+		m := map[string]interface{}{}
+		for i := 0; i < int(b&0x0f); i++ {
+			k, err := readMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			m[k.(string)] = v
+		}
+		return m, nil
+	case b&0xe0 == 0xa0:
+		return readString(int(b & 0x1f))
+	case b == 0xd9:
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		return readString(int(n))
+	case b == 0xd3:
+		var i int64
+		err := binary.Read(r, binary.BigEndian, &i)
+		return i, err
+	}
+	return nil, fmt.Errorf("unexpected msgpack type %x", b)
+}
+
+func TestFluentd(t *testing.T) {
+	addr, conns := acceptTCP(t)
+	s := newSink(t, "fluentd://"+addr+"?tag=cluster")
+	defer s.Close()
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	c := <-conns
+	defer c.Close()
+	v, err := readMsgpack(bufio.NewReader(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) != 3 {
+		t.Fatalf("expected [tag, time, record]; received %v", v)
+	}
+	if msg[0] != "cluster.event" || msg[1] != int64(1425211200) {
+		t.Errorf("unexpected tag or time %v %v", msg[0], msg[1])
+	}
+	record := msg[2].(map[string]interface{})
+	if record["message"] != `exit code 137 "oom"` || record["engine"] != "node-1" || record["severity"] != "5" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+func TestHook(t *testing.T) {
+	l := listenUDP(t)
+	defer l.Close()
+	hook := NewHook([]Sink{newSink(t, "syslog://"+l.LocalAddr().String())})
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.Hooks.Add(hook)
+	log.WithField("engine", "node-1").Warn("engine slow to respond")
+
+	msg := string(readUDP(t, l))
+	// daemon (3) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<28>1 ") || !strings.HasSuffix(msg, ` [shipyard@32473 engine="node-1"] engine slow to respond`) {
+		t.Errorf("unexpected message %s", msg)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("after close")
+}
+
+// recordingSink keeps the messages it receives and fails when err is set
+type recordingSink struct {
+	mux   sync.Mutex
+	delay time.Duration
+	err   error
+	texts []string
+}
+
+func (s *recordingSink) Send(m *Message) error {
+	time.Sleep(s.delay)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.texts = append(s.texts, m.Text)
+	return s.err
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) received() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string{}, s.texts...)
+}
+
+func TestHookSendsFatalEntries(t *testing.T) {
+	sink := &recordingSink{delay: 20 * time.Millisecond}
+	hook := NewHook([]Sink{sink})
+	defer hook.Close()
+	log := logrus.New()
+	info := logrus.NewEntry(log).WithField("engine", "node-1")
+	info.Level = logrus.InfoLevel
+	info.Message = "engine slow to respond"
+	hook.Fire(info)
+	if len(sink.received()) != 0 {
+		t.Fatal("expected info entries to be sent in the background")
+	}
+	entry := logrus.NewEntry(log)
+	entry.Level = logrus.FatalLevel
+	entry.Message = "unable to connect to the store"
+	hook.Fire(entry)
+
+	texts := sink.received()
+	if len(texts) != 2 || texts[1] != "unable to connect to the store" {
+		t.Errorf("expected the fatal entry to be sent after the queued entry before Fire returned; received %v", texts)
+	}
+}
+
+func TestHookTracksFailurePerSink(t *testing.T) {
+	failing := &recordingSink{err: fmt.Errorf("connection refused")}
+	working := &recordingSink{}
+	hook := NewHook([]Sink{failing, working})
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	entry.Message = "engine added"
+	hook.Fire(entry)
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !hook.failing[0] || hook.failing[1] {
+		t.Errorf("expected only the first sink to be failing; received %v", hook.failing)
+	}
+	if len(working.received()) != 1 {
+		t.Error("expected the working sink to receive the entry")
+	}
+}
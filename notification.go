@@ -0,0 +1,153 @@
+package shipyard
+
+import (
+	"errors"
+	"path"
+	"time"
+)
+
+const (
+	NotificationWebhook = "webhook"
+	NotificationSlack   = "slack"
+	NotificationEmail   = "email"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+var (
+	ErrInvalidNotificationType   = errors.New("notification type must be webhook, slack or email")
+	ErrNotificationNameRequired  = errors.New("notification channel name is required")
+	ErrNotificationURLRequired   = errors.New("webhook and slack notifications require a url")
+	ErrNotificationSMTPRequired  = errors.New("email notifications require an smtp address, a sender and recipients")
+	ErrNotificationRulesRequired = errors.New("notification channels require at least one rule")
+)
+
+type (
+	// NotificationChannel delivers the events matching any of its rules to
+	// a webhook, a Slack incoming webhook or by email
+	NotificationChannel struct {
+		ID   string `json:"id,omitempty" gorethink:"id,omitempty"`
+		Name string `json:"name,omitempty" gorethink:"name"`
+		Type string `json:"type,omitempty" gorethink:"type"`
+		URL  string `json:"url,omitempty" gorethink:"url,omitempty"`
+		// Template is a text/template for the JSON body of webhooks; the
+		// event is posted as JSON without one
+		Template string              `json:"template,omitempty" gorethink:"template,omitempty"`
+		SMTP     *SMTPSettings       `json:"smtp,omitempty" gorethink:"smtp,omitempty"`
+		Rules    []*NotificationRule `json:"rules,omitempty" gorethink:"rules"`
+		Disabled bool                `json:"disabled" gorethink:"disabled"`
+		Created  time.Time           `json:"created" gorethink:"created"`
+	}
+
+	SMTPSettings struct {
+		// Addr is the host:port of the mail server
+		Addr     string   `json:"addr,omitempty" gorethink:"addr"`
+		From     string   `json:"from,omitempty" gorethink:"from"`
+		To       []string `json:"to,omitempty" gorethink:"to"`
+		Username string   `json:"username,omitempty" gorethink:"username,omitempty"`
+		// Password may be a secret reference i.e. secret:smtp
+		Password string `json:"password,omitempty" gorethink:"password,omitempty"`
+	}
+
+	// NotificationRule matches events with one of the types and one of the
+	// tags; an empty list matches anything.  Types may be glob patterns
+	// i.e. engine-*
+	NotificationRule struct {
+		Types []string `json:"types,omitempty" gorethink:"types,omitempty"`
+		Tags  []string `json:"tags,omitempty" gorethink:"tags,omitempty"`
+	}
+
+	// NotificationDelivery is the status of the delivery of an event to a
+	// channel
+	NotificationDelivery struct {
+		ID           string     `json:"id,omitempty" gorethink:"id,omitempty"`
+		ChannelID    string     `json:"channel_id" gorethink:"channel_id"`
+		EventType    string     `json:"event_type" gorethink:"event_type"`
+		EventMessage string     `json:"event_message,omitempty" gorethink:"event_message,omitempty"`
+		Status       string     `json:"status" gorethink:"status"`
+		Attempts     int        `json:"attempts" gorethink:"attempts"`
+		LastError    string     `json:"last_error,omitempty" gorethink:"last_error,omitempty"`
+		NextAttempt  *time.Time `json:"next_attempt,omitempty" gorethink:"next_attempt,omitempty"`
+		Created      time.Time  `json:"created" gorethink:"created"`
+		Updated      time.Time  `json:"updated" gorethink:"updated"`
+	}
+)
+
+// Validate checks that the channel has a destination and rules
+func (c *NotificationChannel) Validate() error {
+	if c.Name == "" {
+		return ErrNotificationNameRequired
+	}
+	switch c.Type {
+	case NotificationWebhook, NotificationSlack:
+		if c.URL == "" {
+			return ErrNotificationURLRequired
+		}
+	case NotificationEmail:
+		if c.SMTP == nil || c.SMTP.Addr == "" || c.SMTP.From == "" || len(c.SMTP.To) == 0 {
+			return ErrNotificationSMTPRequired
+		}
+	default:
+		return ErrInvalidNotificationType
+	}
+	if len(c.Rules) == 0 {
+		return ErrNotificationRulesRequired
+	}
+	return nil
+}
+
+// Matches reports whether the channel is enabled and one of its rules
+// matches the event
+func (c *NotificationChannel) Matches(e *Event) bool {
+	if c.Disabled {
+		return false
+	}
+	for _, r := range c.Rules {
+		if r != nil && r.Matches(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the channel without a plain smtp password
+// for api responses; secret references are kept
+func (c *NotificationChannel) Redacted() *NotificationChannel {
+	r := *c
+	if c.SMTP != nil && c.SMTP.Password != "" {
+		if _, ok := ParseSecretRef(c.SMTP.Password); !ok {
+			smtp := *c.SMTP
+			smtp.Password = ""
+			r.SMTP = &smtp
+		}
+	}
+	return &r
+}
+
+func (r *NotificationRule) Matches(e *Event) bool {
+	if len(r.Types) > 0 {
+		matched := false
+		for _, t := range r.Types {
+			if ok, _ := path.Match(t, e.Type); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Tags) > 0 {
+		for _, tag := range r.Tags {
+			for _, et := range e.Tags {
+				if tag == et {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package shipyard
+
+import (
+	"testing"
+)
+
+func TestNotificationRuleMatches(t *testing.T) {
+	down := &Event{Type: "engine-down", Tags: []string{"cluster", "health"}}
+	login := &Event{Type: "login-locked", Tags: []string{"security"}}
+	die := &Event{Type: "die", Tags: []string{"docker"}}
+
+	for _, tc := range []struct {
+		rule    *NotificationRule
+		matches []*Event
+	}{
+		{&NotificationRule{}, []*Event{down, login, die}},
+		{&NotificationRule{Types: []string{"engine-*"}}, []*Event{down}},
+		{&NotificationRule{Tags: []string{"security", "docker"}}, []*Event{login, die}},
+		{&NotificationRule{Types: []string{"die"}, Tags: []string{"cluster"}}, nil},
+	} {
+		for _, e := range []*Event{down, login, die} {
+			expected := false
+			for _, m := range tc.matches {
+				if m == e {
+					expected = true
+				}
+			}
+			if tc.rule.Matches(e) != expected {
+				t.Errorf("rule %v on %s: expected %v", tc.rule, e.Type, expected)
+			}
+		}
+	}
+}
+
+func TestNotificationChannelMatches(t *testing.T) {
+	c := &NotificationChannel{Rules: []*NotificationRule{{Types: []string{"die"}}, {Tags: []string{"security"}}}}
+	if !c.Matches(&Event{Type: "login-locked", Tags: []string{"security"}}) {
+		t.Error("expected any rule to match")
+	}
+	c.Disabled = true
+	if c.Matches(&Event{Type: "die"}) {
+		t.Error("expected disabled channel not to match")
+	}
+}
+
+func TestNotificationChannelValidate(t *testing.T) {
+	rules := []*NotificationRule{{Tags: []string{"health"}}}
+	for _, tc := range []struct {
+		c   *NotificationChannel
+		err error
+	}{
+		{&NotificationChannel{Name: "oncall", Type: NotificationSlack, URL: "https://hooks.slack.com/services/x", Rules: rules}, nil},
+		{&NotificationChannel{Name: "oncall", Type: "pager", Rules: rules}, ErrInvalidNotificationType},
+		{&NotificationChannel{Type: NotificationWebhook, URL: "http://alerts", Rules: rules}, ErrNotificationNameRequired},
+		{&NotificationChannel{Name: "oncall", Type: NotificationWebhook, Rules: rules}, ErrNotificationURLRequired},
+		{&NotificationChannel{Name: "oncall", Type: NotificationEmail, SMTP: &SMTPSettings{Addr: "mail:25", From: "shipyard@example.com"}, Rules: rules}, ErrNotificationSMTPRequired},
+		{&NotificationChannel{Name: "oncall", Type: NotificationWebhook, URL: "http://alerts"}, ErrNotificationRulesRequired},
+	} {
+		if err := tc.c.Validate(); err != tc.err {
+			t.Errorf("%s channel: expected %v; received %v", tc.c.Type, tc.err, err)
+		}
+	}
+}
+
+func TestNotificationChannelRedacted(t *testing.T) {
+	c := &NotificationChannel{SMTP: &SMTPSettings{Password: "hunter2"}}
+	if r := c.Redacted(); r.SMTP.Password != "" || c.SMTP.Password != "hunter2" {
+		t.Error("expected a copy without the password")
+	}
+	c.SMTP.Password = "secret:smtp"
+	if r := c.Redacted(); r.SMTP.Password != "secret:smtp" {
+		t.Error("expected secret reference to be kept")
+	}
+}
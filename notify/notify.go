@@ -0,0 +1,274 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shipyard/shipyard"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+)
+
+type (
+	// Notifier sends events to notification channels.  Secret references
+	// in the channel must be resolved before sending.
+	Notifier struct {
+		Client *http.Client
+		Retry  Backoff
+	}
+
+	// Backoff retries failed deliveries up to Attempts times, waiting
+	// Initial after the first failure and twice as long after each
+	// following one, up to Max
+	Backoff struct {
+		Attempts int
+		Initial  time.Duration
+		Max      time.Duration
+	}
+
+	// TemplateError is returned for webhook templates that do not parse
+	// or execute
+	TemplateError struct {
+		Err error
+	}
+
+	// slackMessage is the body of a Slack incoming webhook
+	slackMessage struct {
+		Text string `json:"text"`
+	}
+)
+
+// DefaultBackoff gives up after about five minutes
+var DefaultBackoff = Backoff{
+	Attempts: 6,
+	Initial:  10 * time.Second,
+	Max:      2 * time.Minute,
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{
+		Client: &http.Client{Timeout: defaultTimeout},
+		Retry:  DefaultBackoff,
+	}
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("invalid notification template: %s", e.Err)
+}
+
+// Delay returns how long to wait after the failed attempt (starting at 1)
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			return b.Max
+		}
+	}
+	return d
+}
+
+// ParseTemplate parses a webhook body template.  The event is the data of
+// the template and the json function quotes values i.e.
+// {"text": {{json .Message}}}
+func ParseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("notification").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, &TemplateError{err}
+	}
+	return t, nil
+}
+
+// Summary is a one line description of the event
+func Summary(e *shipyard.Event) string {
+	s := []string{fmt.Sprintf("[shipyard] %s", e.Type)}
+	if e.Engine != nil {
+		s = append(s, fmt.Sprintf("engine=%s", e.Engine.ID))
+	}
+	if e.Container != nil {
+		id := e.Container.ID
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		s = append(s, fmt.Sprintf("container=%s", id))
+		if e.Container.Image != nil && e.Container.Image.Name != "" {
+			s = append(s, fmt.Sprintf("image=%s", e.Container.Image.Name))
+		}
+	}
+	if e.Message != "" {
+		s = append(s, e.Message)
+	}
+	return strings.Join(s, " ")
+}
+
+// Body returns the request body of a webhook or Slack notification
+func Body(c *shipyard.NotificationChannel, e *shipyard.Event) ([]byte, error) {
+	switch {
+	case c.Type == shipyard.NotificationSlack:
+		return json.Marshal(&slackMessage{Text: Summary(e)})
+	case c.Template != "":
+		t, err := ParseTemplate(c.Template)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, e); err != nil {
+			return nil, &TemplateError{err}
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(e)
+}
+
+// Send makes a single attempt to deliver the event to the channel
+func (n *Notifier) Send(c *shipyard.NotificationChannel, e *shipyard.Event) error {
+	switch c.Type {
+	case shipyard.NotificationWebhook, shipyard.NotificationSlack:
+		body, err := Body(c, e)
+		if err != nil {
+			return err
+		}
+		return n.post(c.URL, body)
+	case shipyard.NotificationEmail:
+		return sendMail(c.SMTP, e)
+	}
+	return shipyard.ErrInvalidNotificationType
+}
+
+func (n *Notifier) post(url string, body []byte) error {
+	resp, err := n.Client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sendMail sends the message like smtp.SendMail, using STARTTLS when the
+// server supports it, but gives up after defaultTimeout
+func sendMail(s *shipyard.SMTPSettings, e *shipyard.Event) error {
+	if s == nil {
+		return shipyard.ErrNotificationSMTPRequired
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", s.Addr, defaultTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(defaultTimeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message(s, e)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func message(s *shipyard.SMTPSettings, e *shipyard.Event) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", Summary(e))
+	fmt.Fprintf(&buf, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&buf, "type: %s\r\n", e.Type)
+	fmt.Fprintf(&buf, "time: %s\r\n", e.Time.Format(time.RFC3339))
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(&buf, "tags: %s\r\n", strings.Join(e.Tags, ", "))
+	}
+	if e.Engine != nil {
+		fmt.Fprintf(&buf, "engine: %s (%s)\r\n", e.Engine.ID, e.Engine.Addr)
+	}
+	if e.Container != nil {
+		fmt.Fprintf(&buf, "container: %s\r\n", e.Container.ID)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&buf, "\r\n%s\r\n", e.Message)
+	}
+	return buf.Bytes()
+}
+
+// Deliver sends the event and retries with backoff until it is delivered,
+// the attempts are exhausted or done is closed.  report is called after
+// every attempt with the error and the time of the next attempt, if any.
+func (n *Notifier) Deliver(c *shipyard.NotificationChannel, e *shipyard.Event, done <-chan struct{}, report func(attempt int, err error, next *time.Time)) error {
+	attempts := n.Retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = n.Send(c, e)
+		if err == nil || attempt >= attempts {
+			report(attempt, err, nil)
+			return err
+		}
+		// template errors do not go away
+		if _, ok := err.(*TemplateError); ok {
+			report(attempt, err, nil)
+			return err
+		}
+		delay := n.Retry.Delay(attempt)
+		next := time.Now().Add(delay)
+		report(attempt, err, &next)
+		select {
+		case <-done:
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/citadel/citadel"
+	"github.com/shipyard/shipyard"
+)
+
+func testEvent() *shipyard.Event {
+	return &shipyard.Event{
+		Type:    "engine-down",
+		Time:    time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC),
+		Message: "addr=tcp://10.0.0.1:2375",
+		Engine:  &citadel.Engine{ID: "node-1", Addr: "tcp://10.0.0.1:2375"},
+		Tags:    []string{"cluster", "health"},
+	}
+}
+
+// smtpServer is a local stand-in for a mail server that records the
+// messages it receives
+type smtpServer struct {
+	ln       net.Listener
+	mux      sync.Mutex
+	messages []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(c)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	reply := func(line string) { c.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var msg []string
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.TrimRight(l, "\r\n") == "." {
+					break
+				}
+				msg = append(msg, l)
+			}
+			s.mux.Lock()
+			s.messages = append(s.messages, strings.Join(msg, ""))
+			s.mux.Unlock()
+			reply("250 ok")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpServer) received() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string{}, s.messages...)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Attempts: 5, Initial: time.Second, Max: 5 * time.Second}
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if d := b.Delay(attempt); d != expected {
+			t.Errorf("attempt %d: expected %s; received %s", attempt, expected, d)
+		}
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid json body: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	c := &shipyard.NotificationChannel{
+		Type:     shipyard.NotificationWebhook,
+		URL:      srv.URL,
+		Template: `{"alert": {{json .Type}}, "engine": {{json .Engine.ID}}, "message": {{json .Message}}}`,
+	}
+	if err := NewNotifier().Send(c, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if body["alert"] != "engine-down" || body["engine"] != "node-1" || body["message"] != "addr=tcp://10.0.0.1:2375" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	if _, err := ParseTemplate(`{"type": {{json .Type}`); err == nil {
+		t.Fatal("expected template error")
+	} else if _, ok := err.(*TemplateError); !ok {
+		t.Errorf("expected *TemplateError; received %T", err)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	var msg slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&msg)
+	}))
+	defer srv.Close()
+
+	c := &shipyard.NotificationChannel{Type: shipyard.NotificationSlack, URL: srv.URL}
+	if err := NewNotifier().Send(c, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "[shipyard] engine-down engine=node-1 addr=tcp://10.0.0.1:2375" {
+		t.Errorf("unexpected text %q", msg.Text)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.ln.Close()
+
+	c := &shipyard.NotificationChannel{
+		Type: shipyard.NotificationEmail,
+		SMTP: &shipyard.SMTPSettings{
+			Addr: srv.ln.Addr().String(),
+			From: "shipyard@example.com",
+			To:   []string{"oncall@example.com"},
+		},
+	}
+	if err := NewNotifier().Send(c, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	messages := srv.received()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message; received %d", len(messages))
+	}
+	for _, s := range []string{"To: oncall@example.com", "Subject: [shipyard] engine-down engine=node-1", "engine: node-1 (tcp://10.0.0.1:2375)"} {
+		if !strings.Contains(messages[0], s) {
+			t.Errorf("expected message to contain %q:\n%s", s, messages[0])
+		}
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		calls++
+		if calls < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	n := NewNotifier()
+	n.Retry = Backoff{Attempts: 5, Initial: time.Millisecond}
+	c := &shipyard.NotificationChannel{Type: shipyard.NotificationWebhook, URL: srv.URL}
+	reports := []error{}
+	err := n.Deliver(c, testEvent(), make(chan struct{}), func(attempt int, err error, next *time.Time) {
+		reports = append(reports, err)
+		if err != nil && next == nil {
+			t.Errorf("expected a next attempt after attempt %d", attempt)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || len(reports) != 3 || reports[2] != nil {
+		t.Errorf("expected 2 failures and a delivery; received %d calls %v", calls, reports)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	n := NewNotifier()
+	n.Retry = Backoff{Attempts: 3, Initial: time.Millisecond}
+	c := &shipyard.NotificationChannel{Type: shipyard.NotificationWebhook, URL: srv.URL}
+	attempts := 0
+	var last *time.Time
+	err := n.Deliver(c, testEvent(), make(chan struct{}), func(attempt int, err error, next *time.Time) {
+		attempts = attempt
+		last = next
+	})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected 503 error; received %v", err)
+	}
+	if attempts != 3 || last != nil {
+		t.Errorf("expected to give up after 3 attempts; received %d", attempts)
+	}
+}
@@ -0,0 +1,274 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	clockSkew = time.Duration(2 * time.Minute)
+)
+
+var (
+	ErrMalformedToken     = errors.New("malformed id token")
+	ErrUnsupportedAlg     = errors.New("unsupported id token signing algorithm")
+	ErrInvalidSignature   = errors.New("invalid id token signature")
+	ErrTokenExpired       = errors.New("id token is expired")
+	ErrInvalidAudience    = errors.New("id token audience does not match client id")
+	ErrInvalidTokenIssuer = errors.New("id token issuer does not match provider")
+	ErrInvalidNonce       = errors.New("id token nonce does not match")
+	ErrMissingSubject     = errors.New("id token is missing a subject")
+	ErrMissingIDToken     = errors.New("token response did not include an id token")
+	ErrNoUsernameClaim    = errors.New("id token has no usable username claim")
+	ErrTokenNotYetValid   = errors.New("id token is not yet valid")
+)
+
+type (
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		Typ string `json:"typ"`
+	}
+
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+
+	jsonWebKeySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	// Claims are the decoded claims of a verified id token
+	Claims map[string]interface{}
+)
+
+func fetchKeys(client *http.Client, uri string) (map[string]*rsa.PublicKey, error) {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch key set: status=%d", resp.StatusCode)
+	}
+	var set *jsonWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := DecodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := DecodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// Verify checks the signature of the raw id token against the provider
+// key set and validates the issuer, audience, expiry and nonce.  The
+// nonce is required and must be the one sent with the authorization
+// request.
+func (p *Provider) Verify(rawIDToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	var header *jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	var hash crypto.Hash
+	switch header.Alg {
+	case "RS256":
+		hash = crypto.SHA256
+	case "RS384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	key, err := p.signingKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := DecodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest(hash, parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := p.validate(claims, nonce); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (p *Provider) validate(claims Claims, nonce string) error {
+	if strings.TrimSuffix(claims.String("iss"), "/") != strings.TrimSuffix(p.Discovery.Issuer, "/") {
+		return ErrInvalidTokenIssuer
+	}
+	if claims.String("sub") == "" {
+		return ErrMissingSubject
+	}
+	found := false
+	for _, aud := range claims.Strings("aud") {
+		if aud == p.Config.ClientID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrInvalidAudience
+	}
+	now := time.Now()
+	exp, ok := claims.Time("exp")
+	if !ok || now.After(exp.Add(clockSkew)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+	if nonce == "" || claims.String("nonce") != nonce {
+		return ErrInvalidNonce
+	}
+	return nil
+}
+
+func digest(hash crypto.Hash, data string) []byte {
+	switch hash {
+	case crypto.SHA384:
+		h := sha512.Sum384([]byte(data))
+		return h[:]
+	case crypto.SHA512:
+		h := sha512.Sum512([]byte(data))
+		return h[:]
+	}
+	h := sha256.Sum256([]byte(data))
+	return h[:]
+}
+
+// EncodeSegment returns b as unpadded url safe base64 as used by JWT,
+// JWK and PKCE values
+func EncodeSegment(b []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "=")
+}
+
+// DecodeSegment decodes unpadded url safe base64
+func DecodeSegment(seg string) ([]byte, error) {
+	if n := len(seg) % 4; n != 0 {
+		seg += strings.Repeat("=", 4-n)
+	}
+	return base64.URLEncoding.DecodeString(seg)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := DecodeSegment(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// String returns the claim as a string or an empty string if it is
+// not present or not a string
+func (c Claims) String(name string) string {
+	if v, ok := c[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Strings returns the claim as a list of strings; single string
+// claims are returned as a list of one
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := []string{}
+		for _, i := range v {
+			if s, ok := i.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Time returns a numeric date claim
+func (c Claims) Time(name string) (time.Time, bool) {
+	if v, ok := c[name].(float64); ok {
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// Identity returns the issuer and subject which together identify the
+// user at the provider
+func (c Claims) Identity() string {
+	return strings.TrimSuffix(c.String("iss"), "/") + "#" + c.String("sub")
+}
+
+// MultiFactor returns true if one of the authentication methods (amr)
+// or the authentication context class (acr) of the token is in values.
+// Identity providers do not agree on the values they use, so the accepted
+// values must be configured; an empty list never matches.
+func (c Claims) MultiFactor(values []string) bool {
+	asserted := append(c.Strings("amr"), c.String("acr"))
+	for _, v := range values {
+		for _, a := range asserted {
+			if a != "" && a == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Username returns the first non-empty claim of preferred_username,
+// email and sub
+func (c Claims) Username() (string, error) {
+	for _, n := range []string{"preferred_username", "email", "sub"} {
+		if v := c.String(n); v != "" {
+			return v, nil
+		}
+	}
+	return "", ErrNoUsernameClaim
+}
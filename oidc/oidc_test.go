@@ -0,0 +1,251 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "shipyard"
+	testKeyID    = "test-key"
+)
+
+type mockIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&Discovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(key.E)).Bytes()
+		json.NewEncoder(w).Encode(&jsonWebKeySet{
+			Keys: []jsonWebKey{
+				{
+					Kty: "RSA",
+					Kid: testKeyID,
+					Use: "sig",
+					N:   EncodeSegment(key.N.Bytes()),
+					E:   EncodeSegment(e),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.FormValue("code") != "test-code" || CodeChallenge(r.FormValue("code_verifier")) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&TokenResponse{
+			AccessToken: "access",
+			TokenType:   "Bearer",
+			IDToken:     m.sign(t, m.idClaims()),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) idClaims() map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":                m.server.URL,
+		"sub":                "1234",
+		"aud":                testClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              m.nonce,
+		"preferred_username": "jdoe",
+		"groups":             []string{"developers", "ops"},
+	}
+	for k, v := range m.claims {
+		c[k] = v
+	}
+	return c
+}
+
+func (m *mockIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	h, _ := json.Marshal(&jwtHeader{Alg: "RS256", Kid: testKeyID, Typ: "JWT"})
+	c, _ := json.Marshal(claims)
+	data := EncodeSegment(h) + "." + EncodeSegment(c)
+	d := sha256.Sum256([]byte(data))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, d[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data + "." + EncodeSegment(sig)
+}
+
+func newTestProvider(t *testing.T, m *mockIssuer) *Provider {
+	p, err := NewProvider(&Config{
+		Issuer:   m.server.URL,
+		ClientID: testClientID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDiscovery(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.server.Close()
+
+	p := newTestProvider(t, m)
+	if p.Discovery.TokenEndpoint != m.server.URL+"/token" {
+		t.Errorf("expected token endpoint %s/token; received %s", m.server.URL, p.Discovery.TokenEndpoint)
+	}
+	u, err := url.Parse(p.AuthCodeURL("http://127.0.0.1:9999/callback", "state", "nonce", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge") != CodeChallenge("verifier") {
+		t.Error("expected code challenge for verifier")
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Error("expected S256 code challenge method")
+	}
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.server.Close()
+
+	p := newTestProvider(t, m)
+	store := NewStateStore()
+	req, err := store.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.challenge = CodeChallenge(req.Verifier)
+	m.nonce = req.Nonce
+
+	if store.Take(req.State) == nil {
+		t.Fatal("expected pending request for state")
+	}
+	if store.Take(req.State) != nil {
+		t.Error("expected state to only be usable once")
+	}
+
+	if _, err := p.Exchange("test-code", "http://localhost/cb", "wrong-verifier"); err == nil {
+		t.Error("expected exchange to fail with wrong verifier")
+	}
+	tr, err := p.Exchange("test-code", "http://localhost/cb", req.Verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(tr.IDToken, req.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	username, err := claims.Username()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "jdoe" {
+		t.Errorf("expected username jdoe; received %s", username)
+	}
+	if id := claims.Identity(); id != m.server.URL+"#1234" {
+		t.Errorf("expected the issuer and subject; received %s", id)
+	}
+	for _, nonce := range []string{"other-nonce", ""} {
+		if _, err := p.Verify(tr.IDToken, nonce); err != ErrInvalidNonce {
+			t.Errorf("expected %s; received %v", ErrInvalidNonce, err)
+		}
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.server.Close()
+
+	p := newTestProvider(t, m)
+	tests := map[error]map[string]interface{}{
+		ErrTokenExpired:       {"exp": time.Now().Add(-time.Hour).Unix()},
+		ErrInvalidAudience:    {"aud": "other-client"},
+		ErrInvalidTokenIssuer: {"iss": "http://evil.example.com"},
+		ErrMissingSubject:     {"sub": ""},
+	}
+	for expected, claims := range tests {
+		m.claims = claims
+		if _, err := p.Verify(m.sign(t, m.idClaims()), ""); err != expected {
+			t.Errorf("expected %s; received %v", expected, err)
+		}
+	}
+
+	m.claims = nil
+	token := m.sign(t, m.idClaims())
+	tampered := token[:len(token)-4] + "AAAA"
+	if _, err := p.Verify(tampered, ""); err != ErrInvalidSignature {
+		t.Errorf("expected %s; received %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestRoleMapper(t *testing.T) {
+	mapping, err := ParseRoleMapping("developers:user, ops:admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := &RoleMapper{
+		Claim:   "groups",
+		Mapping: mapping,
+	}
+	role, err := rm.Role(Claims{"groups": []interface{}{"developers", "ops"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "admin" {
+		t.Errorf("expected role admin; received %s", role)
+	}
+	if _, err := rm.Role(Claims{"groups": []interface{}{"sales"}}); err != ErrNoRoleMapping {
+		t.Errorf("expected %s; received %v", ErrNoRoleMapping, err)
+	}
+	rm.DefaultRole = "user"
+	if role, _ := rm.Role(Claims{}); role != "user" {
+		t.Errorf("expected default role user; received %s", role)
+	}
+	if _, err := ParseRoleMapping("bad"); err == nil {
+		t.Error("expected error for invalid mapping")
+	}
+}
+
+func TestMultiFactor(t *testing.T) {
+	values := []string{"mfa", "urn:example:loa:2"}
+	if !(Claims{"amr": []interface{}{"pwd", "mfa"}}).MultiFactor(values) {
+		t.Error("expected the mfa method to be accepted")
+	}
+	if !(Claims{"acr": "urn:example:loa:2"}).MultiFactor(values) {
+		t.Error("expected the acr value to be accepted")
+	}
+	if (Claims{"amr": []interface{}{"pwd"}, "acr": "0"}).MultiFactor(values) {
+		t.Error("expected a password login to be refused")
+	}
+	if (Claims{"amr": []interface{}{"mfa"}}).MultiFactor(nil) {
+		t.Error("expected no values to never match")
+	}
+}
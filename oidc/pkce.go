@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	// TokenResponse is the token endpoint response for the code grant
+	TokenResponse struct {
+		AccessToken string `json:"access_token,omitempty"`
+		TokenType   string `json:"token_type,omitempty"`
+		IDToken     string `json:"id_token,omitempty"`
+		ExpiresIn   int    `json:"expires_in,omitempty"`
+	}
+)
+
+// RandomString returns a url safe random string from n bytes of entropy
+// suitable for state, nonce and code verifier values
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return EncodeSegment(b), nil
+}
+
+// NewVerifier returns a PKCE code verifier (RFC 7636)
+func NewVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// CodeChallenge returns the S256 challenge for the verifier
+func CodeChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return EncodeSegment(h[:])
+}
+
+// Exchange redeems the authorization code at the token endpoint.  The
+// client secret is only sent when configured; public clients such as the
+// cli rely on the PKCE verifier alone.
+func (p *Provider) Exchange(code, redirectURL, verifier string) (*TokenResponse, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("client_id", p.Config.ClientID)
+	v.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest("POST", p.Discovery.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("token exchange failed: status=%d %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var tr *TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, err
+	}
+	if tr.IDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	return tr, nil
+}
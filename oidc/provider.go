@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	httpTimeout   = time.Duration(10 * time.Second)
+)
+
+var (
+	ErrInvalidIssuer   = errors.New("issuer does not match discovery document")
+	ErrUnknownKey      = errors.New("unable to find signing key")
+	ErrMissingEndpoint = errors.New("provider is missing a required endpoint")
+)
+
+type (
+	// Discovery is the subset of the OpenID Provider metadata used by shipyard
+	Discovery struct {
+		Issuer                        string   `json:"issuer"`
+		AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+		TokenEndpoint                 string   `json:"token_endpoint"`
+		UserinfoEndpoint              string   `json:"userinfo_endpoint,omitempty"`
+		JWKSURI                       string   `json:"jwks_uri"`
+		ScopesSupported               []string `json:"scopes_supported,omitempty"`
+		CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+	}
+
+	// Config is the relying party configuration
+	Config struct {
+		Issuer       string   `json:"issuer,omitempty"`
+		ClientID     string   `json:"client_id,omitempty"`
+		ClientSecret string   `json:"-"`
+		RedirectURL  string   `json:"redirect_url,omitempty"`
+		Scopes       []string `json:"scopes,omitempty"`
+	}
+
+	Provider struct {
+		Config    *Config
+		Discovery *Discovery
+
+		client *http.Client
+		mux    sync.Mutex
+		keys   map[string]*rsa.PublicKey
+	}
+)
+
+// NewProvider fetches the discovery document for the configured issuer
+// and validates that the advertised issuer matches
+func NewProvider(cfg *Config) (*Provider, error) {
+	p := &Provider{
+		Config: cfg,
+		client: &http.Client{Timeout: httpTimeout},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	p.Discovery = d
+	return p, nil
+}
+
+func (p *Provider) discover() (*Discovery, error) {
+	issuer := strings.TrimSuffix(p.Config.Issuer, "/")
+	resp, err := p.client.Get(issuer + discoveryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch discovery document: status=%d", resp.StatusCode)
+	}
+	var d *Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, ErrMissingEndpoint
+	}
+	return d, nil
+}
+
+// AuthCodeURL returns the authorization endpoint url for the code flow
+// using the S256 PKCE challenge for the specified verifier
+func (p *Provider) AuthCodeURL(redirectURL, state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.Config.ClientID)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("scope", strings.Join(p.Config.Scopes, " "))
+	v.Set("state", state)
+	if nonce != "" {
+		v.Set("nonce", nonce)
+	}
+	v.Set("code_challenge", CodeChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.Discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.Discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// signingKey returns the key for the specified key id.  The key set is
+// refreshed from the provider when the key is not known so that
+// provider key rotation does not require a restart.
+func (p *Provider) signingKey(kid string) (*rsa.PublicKey, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if k := p.lookupKey(kid); k != nil {
+		return k, nil
+	}
+	keys, err := fetchKeys(p.client, p.Discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if k := p.lookupKey(kid); k != nil {
+		return k, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (p *Provider) lookupKey(kid string) *rsa.PublicKey {
+	if kid != "" {
+		return p.keys[kid]
+	}
+	// tokens without a key id are only accepted for single key sets
+	if len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return nil
+}
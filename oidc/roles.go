@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNoRoleMapping = errors.New("no role mapping for id token claims")
+)
+
+type (
+	// RoleMapper maps values of a claim (i.e. groups) to shipyard roles
+	RoleMapper struct {
+		Claim       string
+		Mapping     map[string]string
+		DefaultRole string
+	}
+)
+
+// ParseRoleMapping parses a comma separated list of value:role pairs
+// i.e. "ops:admin,developers:user"
+func ParseRoleMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if s == "" {
+		return mapping, nil
+	}
+	for _, p := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(p), ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("role mappings must be in value:role pairs: %s", p)
+		}
+		mapping[parts[0]] = parts[1]
+	}
+	return mapping, nil
+}
+
+// Role returns the role for the claims.  When several values match, the
+// admin role wins so that membership in an extra group never reduces
+// access.  The default role is used when nothing matches; an empty
+// default denies the login.
+func (m *RoleMapper) Role(claims Claims) (string, error) {
+	role := ""
+	for _, v := range claims.Strings(m.Claim) {
+		r, ok := m.Mapping[v]
+		if !ok {
+			continue
+		}
+		if role == "" || r == "admin" {
+			role = r
+		}
+	}
+	if role == "" {
+		role = m.DefaultRole
+	}
+	if role == "" {
+		return "", ErrNoRoleMapping
+	}
+	return role, nil
+}
@@ -0,0 +1,82 @@
+package oidc
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	stateTTL = time.Duration(10 * time.Minute)
+)
+
+type (
+	// AuthRequest is a pending authorization request
+	AuthRequest struct {
+		State    string
+		Nonce    string
+		Verifier string
+		Created  time.Time
+	}
+
+	// StateStore keeps pending authorization requests in memory until the
+	// provider redirects back.  Requests can only be taken once.
+	StateStore struct {
+		mux      sync.Mutex
+		requests map[string]*AuthRequest
+	}
+)
+
+func NewStateStore() *StateStore {
+	return &StateStore{
+		requests: make(map[string]*AuthRequest),
+	}
+}
+
+// New creates and stores a request with random state, nonce and verifier
+func (s *StateStore) New() (*AuthRequest, error) {
+	state, err := RandomString(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomString(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := NewVerifier()
+	if err != nil {
+		return nil, err
+	}
+	req := &AuthRequest{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Created:  time.Now(),
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.expire()
+	s.requests[state] = req
+	return req, nil
+}
+
+// Take returns and removes the request for the state; nil is returned
+// for unknown or expired state
+func (s *StateStore) Take(state string) *AuthRequest {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.expire()
+	req := s.requests[state]
+	delete(s.requests, state)
+	return req
+}
+
+func (s *StateStore) expire() {
+	for k, v := range s.requests {
+		if time.Since(v.Created) > stateTTL {
+			delete(s.requests, k)
+		}
+	}
+}
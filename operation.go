@@ -0,0 +1,51 @@
+package shipyard
+
+import (
+	"time"
+)
+
+const (
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+)
+
+type (
+	// Operation is a long running action such as running, scaling or
+	// redeploying containers.  Progress and per container results are
+	// updated while it runs.
+	Operation struct {
+		ID        string             `json:"id"`
+		Type      string             `json:"type"`
+		Target    string             `json:"target,omitempty"`
+		Actor     string             `json:"actor,omitempty"`
+		Status    string             `json:"status"`
+		Total     int                `json:"total"`
+		Completed int                `json:"completed"`
+		Failed    int                `json:"failed"`
+		Results   []*OperationResult `json:"results"`
+		Error     string             `json:"error,omitempty"`
+		Created   time.Time          `json:"created"`
+		Updated   time.Time          `json:"updated"`
+		Finished  *time.Time         `json:"finished,omitempty"`
+	}
+
+	// OperationResult is the outcome of an operation for a single
+	// container or engine
+	OperationResult struct {
+		// Instance is the number of the container for runs starting at 1
+		Instance    int    `json:"instance,omitempty"`
+		ContainerID string `json:"container_id,omitempty"`
+		Engine      string `json:"engine,omitempty"`
+		Error       string `json:"error,omitempty"`
+		// RolledBack is set when the container was removed because
+		// another instance of an atomic run failed
+		RolledBack bool `json:"rolled_back,omitempty"`
+	}
+)
+
+// Done reports whether the operation has finished
+func (o *Operation) Done() bool {
+	return o.Status != OperationRunning
+}
@@ -0,0 +1,70 @@
+package shipyard
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrPasswordMatchesUsername = &PasswordPolicyError{"password must not match the username"}
+	ErrPasswordNoUpper         = &PasswordPolicyError{"password must contain an upper case letter"}
+	ErrPasswordNoLower         = &PasswordPolicyError{"password must contain a lower case letter"}
+	ErrPasswordNoDigit         = &PasswordPolicyError{"password must contain a digit"}
+	ErrPasswordNoSymbol        = &PasswordPolicyError{"password must contain a symbol"}
+	ErrPasswordIsDefault       = &PasswordPolicyError{"password must not be the default password"}
+	ErrPasswordUnchanged       = &PasswordPolicyError{"password must differ from the current password"}
+)
+
+type (
+	// PasswordPolicyError is returned for passwords rejected by the policy
+	PasswordPolicyError struct {
+		Reason string
+	}
+
+	PasswordPolicy struct {
+		MinLength     int  `json:"min_length,omitempty"`
+		RequireUpper  bool `json:"require_upper,omitempty"`
+		RequireLower  bool `json:"require_lower,omitempty"`
+		RequireDigit  bool `json:"require_digit,omitempty"`
+		RequireSymbol bool `json:"require_symbol,omitempty"`
+	}
+)
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Reason
+}
+
+// Validate checks the password against the policy
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if len(password) < p.MinLength || password == "" {
+		return &PasswordPolicyError{fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+	if strings.EqualFold(username, password) {
+		return ErrPasswordMatchesUsername
+	}
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return ErrPasswordNoUpper
+	case p.RequireLower && !lower:
+		return ErrPasswordNoLower
+	case p.RequireDigit && !digit:
+		return ErrPasswordNoDigit
+	case p.RequireSymbol && !symbol:
+		return ErrPasswordNoSymbol
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package shipyard
+
+import (
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	p := &PasswordPolicy{
+		MinLength:     8,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+	if err := p.Validate("admin", "Sh1pyard!"); err != nil {
+		t.Errorf("expected password to be valid: %s", err)
+	}
+	tests := map[string]string{
+		"":            "empty",
+		"Sh1p!":       "too short",
+		"sh1pyard!":   "no upper case",
+		"Shipyard!":   "no digit",
+		"Sh1pyard":    "no symbol",
+		"Sh1pyard!Ad": "",
+	}
+	for pass, reason := range tests {
+		err := p.Validate("admin", pass)
+		if reason == "" && err != nil {
+			t.Errorf("expected %s to be valid: %s", pass, err)
+		}
+		if reason != "" && err == nil {
+			t.Errorf("expected %s to be invalid (%s)", pass, reason)
+		}
+	}
+	if err := (&PasswordPolicy{}).Validate("admin", "Admin"); err != ErrPasswordMatchesUsername {
+		t.Errorf("expected %s; received %v", ErrPasswordMatchesUsername, err)
+	}
+	if err := (&PasswordPolicy{}).Validate("admin", ""); err == nil {
+		t.Error("expected empty password to be invalid")
+	}
+}
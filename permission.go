@@ -0,0 +1,58 @@
+package shipyard
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	permissionMethods = []string{"GET", "POST", "PUT", "DELETE"}
+)
+
+// Permissions are shared by roles and service keys.  Each permission is
+// an api path prefix that can optionally be restricted to an http method,
+// i.e. "/api/containers" or "POST /api/containers".  "*" allows everything.
+func ValidatePermission(perm string) error {
+	if perm == "*" {
+		return nil
+	}
+	path := perm
+	if parts := strings.SplitN(perm, " ", 2); len(parts) == 2 {
+		valid := false
+		for _, m := range permissionMethods {
+			if parts[0] == m {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid method in permission: %s", perm)
+		}
+		path = parts[1]
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("permission path must start with /: %s", perm)
+	}
+	return nil
+}
+
+// CheckPermissions returns true if any of the permissions allow the request
+func CheckPermissions(perms []string, method string, path string) bool {
+	for _, p := range perms {
+		if p == "*" {
+			return true
+		}
+		prefix := p
+		if parts := strings.SplitN(p, " ", 2); len(parts) == 2 {
+			if parts[0] != method {
+				continue
+			}
+			prefix = parts[1]
+		}
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
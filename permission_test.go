@@ -0,0 +1,95 @@
+package shipyard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	perms := []string{"POST /api/containers", "/api/events"}
+	tests := []struct {
+		method string
+		path   string
+		valid  bool
+	}{
+		{"POST", "/api/containers", true},
+		{"GET", "/api/containers", false},
+		{"DELETE", "/api/containers/1234", false},
+		{"GET", "/api/events", true},
+		{"DELETE", "/api/events", true},
+		{"GET", "/api/eventsfoo", false},
+		{"DELETE", "/api/accounts", false},
+	}
+	for _, test := range tests {
+		if v := CheckPermissions(perms, test.method, test.path); v != test.valid {
+			t.Errorf("expected %v for %s %s; received %v", test.valid, test.method, test.path, v)
+		}
+	}
+	if !CheckPermissions([]string{"*"}, "DELETE", "/api/accounts") {
+		t.Error("expected * to allow everything")
+	}
+}
+
+func TestValidatePermission(t *testing.T) {
+	for _, p := range []string{"*", "/api/containers", "POST /api/containers"} {
+		if err := ValidatePermission(p); err != nil {
+			t.Errorf("expected %s to be valid: %s", p, err)
+		}
+	}
+	for _, p := range []string{"api/containers", "FOO /api/containers", "POST api"} {
+		if err := ValidatePermission(p); err == nil {
+			t.Errorf("expected %s to be invalid", p)
+		}
+	}
+}
+
+func TestServiceKeyRestrictions(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	k := &ServiceKey{
+		Scopes:       []string{"POST /api/containers"},
+		AllowedCIDRs: []string{"10.0.0.0/8"},
+	}
+	if k.Expired() {
+		t.Error("expected key without expiry to be valid")
+	}
+	k.Expires = &past
+	if !k.Expired() {
+		t.Error("expected key to be expired")
+	}
+	if !k.AllowedFrom("10.1.2.3:52311") {
+		t.Error("expected key to be allowed from 10.1.2.3")
+	}
+	if k.AllowedFrom("192.168.1.1:52311") {
+		t.Error("expected key to be denied from 192.168.1.1")
+	}
+	if k.Allows("DELETE", "/api/accounts") {
+		t.Error("expected key to be denied account deletion")
+	}
+	if !(&ServiceKey{}).Allows("DELETE", "/api/accounts") {
+		t.Error("expected key without scopes to have full access")
+	}
+}
+
+func TestServiceKeyImages(t *testing.T) {
+	k := &ServiceKey{
+		Images: []string{"myorg/web", "registry:5000/worker:1.2"},
+	}
+	tests := map[string]bool{
+		"myorg/web":                  true,
+		"myorg/web:1.0":              true,
+		"myorg/website":              false,
+		"registry:5000/worker:1.2":   true,
+		"registry:5000/worker":       false,
+		"registry:5000/worker:1.3":   false,
+		"myorg/db":                   false,
+		"registry:5000/myorg/web:10": false,
+	}
+	for image, valid := range tests {
+		if v := k.AllowsImage(image); v != valid {
+			t.Errorf("expected %v for %s; received %v", valid, image, v)
+		}
+	}
+	if !(&ServiceKey{}).AllowsImage("myorg/db") {
+		t.Error("expected key without images to allow any image")
+	}
+}
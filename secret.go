@@ -0,0 +1,78 @@
+package shipyard
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretRefPrefix marks environment values that reference a secret
+	// i.e. DB_PASS=secret:prod/db
+	SecretRefPrefix = "secret:"
+)
+
+var (
+	ErrInvalidSecretName = errors.New("secret names may only contain letters, digits and _ . - /")
+
+	secretNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_./-]{0,127}$`)
+)
+
+type (
+	// Secret is a named value encrypted at rest.  The value is write only;
+	// it is never returned by the api.
+	Secret struct {
+		ID         string    `json:"id,omitempty" gorethink:"id,omitempty"`
+		Name       string    `json:"name,omitempty" gorethink:"name"`
+		Value      string    `json:"value,omitempty" gorethink:"-"`
+		Ciphertext string    `json:"-" gorethink:"ciphertext"`
+		KeyID      string    `json:"key_id,omitempty" gorethink:"key_id"`
+		Created    time.Time `json:"created,omitempty" gorethink:"created"`
+		Updated    time.Time `json:"updated,omitempty" gorethink:"updated"`
+		// Roles and ServiceKeys limit who can run containers that
+		// reference the secret; a secret with neither can be used by
+		// every account and service key
+		Roles       []string `json:"roles,omitempty" gorethink:"roles,omitempty"`
+		ServiceKeys []string `json:"service_keys,omitempty" gorethink:"service_keys,omitempty"`
+	}
+)
+
+// ValidateSecretName checks that the name can be used in a reference
+func ValidateSecretName(name string) error {
+	if !secretNameRegexp.MatchString(name) {
+		return ErrInvalidSecretName
+	}
+	return nil
+}
+
+// Allows returns true if an account with the role or the service key can
+// use the secret.  Either can be empty.
+func (s *Secret) Allows(role string, serviceKey string) bool {
+	if len(s.Roles) == 0 && len(s.ServiceKeys) == 0 {
+		return true
+	}
+	if role != "" {
+		for _, r := range s.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	if serviceKey != "" {
+		for _, k := range s.ServiceKeys {
+			if k == serviceKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseSecretRef returns the secret name if the value is a reference
+func ParseSecretRef(value string) (string, bool) {
+	if !strings.HasPrefix(value, SecretRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(value, SecretRefPrefix), true
+}
@@ -0,0 +1,45 @@
+package shipyard
+
+import (
+	"testing"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	name, ok := ParseSecretRef("secret:prod/db")
+	if !ok || name != "prod/db" {
+		t.Errorf("expected reference to prod/db; received %q %v", name, ok)
+	}
+	if _, ok := ParseSecretRef("plain"); ok {
+		t.Error("expected plain value to not be a reference")
+	}
+}
+
+func TestValidateSecretName(t *testing.T) {
+	for _, n := range []string{"db", "prod/db", "prod.db_pass-1"} {
+		if err := ValidateSecretName(n); err != nil {
+			t.Errorf("expected %s to be valid", n)
+		}
+	}
+	for _, n := range []string{"", "/db", "a,b", "a:b", "a b"} {
+		if err := ValidateSecretName(n); err == nil {
+			t.Errorf("expected %q to be invalid", n)
+		}
+	}
+}
+
+func TestSecretAllows(t *testing.T) {
+	open := &Secret{Name: "db"}
+	if !open.Allows("user", "") || !open.Allows("", "key") {
+		t.Error("expected a secret without an acl to be usable by everyone")
+	}
+	s := &Secret{Name: "db", Roles: []string{"admin"}, ServiceKeys: []string{"deploy"}}
+	if !s.Allows("admin", "") {
+		t.Error("expected the admin role to be allowed")
+	}
+	if !s.Allows("", "deploy") {
+		t.Error("expected the deploy key to be allowed")
+	}
+	if s.Allows("user", "") || s.Allows("", "other") || s.Allows("", "") {
+		t.Error("expected callers outside the acl to be denied")
+	}
+}
@@ -0,0 +1,147 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// KeySize is the size of the master key in bytes (AES-256)
+	KeySize = 32
+	// sealedPrefix marks string values sealed with SealValue so they can
+	// be told apart from plain values stored before encryption was enabled
+	sealedPrefix = "sealed:"
+)
+
+var (
+	ErrInvalidKey        = errors.New("master key must be 32 bytes encoded as base64 or hex")
+	ErrInvalidCiphertext = errors.New("unable to decrypt; wrong master key or corrupt data")
+)
+
+type (
+	// Box encrypts values with AES-256-GCM under a master key.  The name of
+	// the value is bound as additional data so a ciphertext cannot be
+	// moved to another name.
+	Box struct {
+		aead  cipher.AEAD
+		keyID string
+	}
+)
+
+// NewBox returns a box for the master key
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("shipyard-key-id:"), key...))
+	return &Box{
+		aead:  aead,
+		keyID: hex.EncodeToString(sum[:4]),
+	}, nil
+}
+
+// ParseKey decodes a base64 or hex encoded master key
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == KeySize {
+		return b, nil
+	}
+	if b, err := hex.DecodeString(s); err == nil && len(b) == KeySize {
+		return b, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// LoadKey reads an encoded master key from a file
+func LoadKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(b))
+}
+
+// NewKey returns a random base64 encoded master key
+func NewKey() (string, error) {
+	b := make([]byte, KeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Seal encrypts the plaintext and returns the base64 encoded nonce and
+// ciphertext
+func (b *Box) Seal(name string, plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := b.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Open decrypts a value sealed for the name
+func (b *Box) Open(name string, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	n := b.aead.NonceSize()
+	if len(data) < n {
+		return nil, ErrInvalidCiphertext
+	}
+	out, err := b.aead.Open(nil, data[:n], data[n:], []byte(name))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return out, nil
+}
+
+// SealValue seals a string value for storage in a plain text field
+func (b *Box) SealValue(name string, value string) (string, error) {
+	sealed, err := b.Seal(name, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + sealed, nil
+}
+
+// OpenValue opens a value sealed with SealValue; plain values are
+// returned unchanged
+func (b *Box) OpenValue(name string, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	v, err := b.Open(name, strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// IsSealed returns true if the value was sealed with SealValue
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// KeyID returns a short fingerprint of the master key so that stored
+// values can record which key sealed them without revealing it
+func (b *Box) KeyID() string {
+	return b.keyID
+}
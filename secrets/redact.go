@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	Redacted = "********"
+)
+
+type (
+	// Redactor replaces secret values in a stream.  Output is buffered per
+	// line so values split across writes are still replaced; Flush must be
+	// called to write a trailing partial line.
+	Redactor struct {
+		w      io.Writer
+		values [][]byte
+		buf    []byte
+	}
+)
+
+func NewRedactor(w io.Writer, values []string) *Redactor {
+	r := &Redactor{w: w}
+	for _, v := range values {
+		if v != "" {
+			r.values = append(r.values, []byte(v))
+		}
+	}
+	return r
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	if len(r.values) == 0 {
+		return r.w.Write(p)
+	}
+	r.buf = append(r.buf, p...)
+	i := bytes.LastIndex(r.buf, []byte{'\n'})
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := r.w.Write(r.redact(r.buf[:i+1])); err != nil {
+		return 0, err
+	}
+	r.buf = append([]byte{}, r.buf[i+1:]...)
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line
+func (r *Redactor) Flush() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.redact(r.buf))
+	r.buf = nil
+	return err
+}
+
+func (r *Redactor) redact(b []byte) []byte {
+	for _, v := range r.values {
+		b = bytes.Replace(b, v, []byte(Redacted), -1)
+	}
+	return b
+}
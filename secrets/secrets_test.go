@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testBox(t *testing.T) *Box {
+	k, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSealOpen(t *testing.T) {
+	b := testBox(t)
+	sealed, err := b.Seal("prod/db", []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains([]byte(sealed), []byte("s3cret")) {
+		t.Fatal("expected value to be encrypted")
+	}
+	v, err := b.Open("prod/db", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "s3cret" {
+		t.Errorf("expected s3cret; received %s", v)
+	}
+	if _, err := b.Open("prod/other", sealed); err != ErrInvalidCiphertext {
+		t.Errorf("expected value to be bound to its name; received %v", err)
+	}
+	if _, err := testBox(t).Open("prod/db", sealed); err != ErrInvalidCiphertext {
+		t.Errorf("expected other key to fail; received %v", err)
+	}
+}
+
+func TestSealValue(t *testing.T) {
+	b := testBox(t)
+	if v, err := b.OpenValue("engine", "plain"); err != nil || v != "plain" {
+		t.Errorf("expected plain values to be returned unchanged; received %q %v", v, err)
+	}
+	sealed, err := b.SealValue("engine", "PEM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) {
+		t.Fatalf("expected sealed value; received %s", sealed)
+	}
+	v, err := b.OpenValue("engine", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "PEM" {
+		t.Errorf("expected PEM; received %s", v)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey("short"); err != ErrInvalidKey {
+		t.Errorf("expected %s; received %v", ErrInvalidKey, err)
+	}
+	if _, err := ParseKey("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"); err != nil {
+		t.Errorf("expected hex key to parse: %s", err)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRedactor(&buf, []string{"hunter2", ""})
+	r.Write([]byte("password is hun"))
+	r.Write([]byte("ter2\nok\npartial hunter2"))
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "password is " + Redacted + "\nok\npartial " + Redacted
+	if buf.String() != expected {
+		t.Errorf("expected %q; received %q", expected, buf.String())
+	}
+}
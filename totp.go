@@ -0,0 +1,121 @@
+package shipyard
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TOTPIssuer = "Shipyard"
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is the number of periods accepted either side of now to
+	// allow for clock drift between the controller and the device
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+type (
+	// TOTPEnrollment is returned when enrolling an account in two-factor
+	// authentication.  The URI can be rendered as a QR code for
+	// authenticator apps.
+	TOTPEnrollment struct {
+		Secret string `json:"secret,omitempty"`
+		URI    string `json:"uri,omitempty"`
+	}
+
+	// TOTPCode is used to confirm or disable two-factor authentication
+	TOTPCode struct {
+		Code string `json:"code,omitempty"`
+	}
+
+	// RecoveryCodes are single use codes returned once on activation
+	RecoveryCodes struct {
+		Codes []string `json:"codes,omitempty"`
+	}
+)
+
+// NewTOTPSecret returns a random base32 encoded 160 bit secret (RFC 4226)
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI returns the otpauth uri for the secret
+func TOTPProvisioningURI(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", TOTPIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", totpDigits))
+	v.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", url.QueryEscape(TOTPIssuer), url.QueryEscape(username), v.Encode())
+}
+
+// TOTPStep returns the time step for t
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// GenerateTOTP returns the code for the secret at the time step (RFC 6238)
+func GenerateTOTP(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.DecodeString(strings.ToUpper(strings.Replace(secret, " ", "", -1)))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
+
+// ValidateTOTP checks the code against the secret at t.  The matching
+// time step is returned so callers can reject replayed codes; zero is
+// returned when the code is invalid.
+func ValidateTOTP(secret, code string, t time.Time) int64 {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0
+	}
+	now := TOTPStep(t)
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		expected, err := GenerateTOTP(secret, now+i)
+		if err != nil {
+			return 0
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return now + i
+		}
+	}
+	return 0
+}
+
+// NewRecoveryCodes returns a set of random recovery codes formatted as
+// two groups of five characters
+func NewRecoveryCodes() ([]string, error) {
+	codes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes = append(codes, c[:5]+"-"+c[5:])
+	}
+	return codes, nil
+}
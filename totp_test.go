@@ -0,0 +1,78 @@
+package shipyard
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// secret and codes from the RFC 6238 SHA1 test vectors
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTP(t *testing.T) {
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, expected := range tests {
+		code, err := GenerateTOTP(testTOTPSecret, TOTPStep(time.Unix(ts, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("expected %s at %d; received %s", expected, ts, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	if step := ValidateTOTP(testTOTPSecret, "081804", now); step != TOTPStep(now) {
+		t.Errorf("expected code to be valid at step %d; received %d", TOTPStep(now), step)
+	}
+	if step := ValidateTOTP(testTOTPSecret, "081804", now.Add(30*time.Second)); step == 0 {
+		t.Error("expected code from the previous period to be accepted")
+	}
+	if step := ValidateTOTP(testTOTPSecret, "081804", now.Add(5*time.Minute)); step != 0 {
+		t.Error("expected stale code to be rejected")
+	}
+	if step := ValidateTOTP(testTOTPSecret, "123", now); step != 0 {
+		t.Error("expected short code to be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := TOTPProvisioningURI("admin", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Shipyard:admin?") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("expected secret in uri %s", uri)
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("unexpected recovery code format %s", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate recovery code %s", c)
+		}
+		seen[c] = true
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("expected %d codes; received %d", recoveryCodeCount, len(codes))
+	}
+}